@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
+	_ "time/tzdata" // IANA zones for -tz on systems without a zone database
 
 	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/plugins"
 	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
@@ -24,12 +27,18 @@ type Hive struct {
 	Type     string
 	Size     int64
 	ModTime  time.Time
+	Marked   bool // Part of the host set used by multi-hive plugins
 	hiveData *regf.Hive
 }
 
 // Implement list.Item interface
 func (h Hive) FilterValue() string { return h.Name }
-func (h Hive) Title() string       { return h.Name }
+func (h Hive) Title() string {
+	if h.Marked {
+		return "● " + h.Name
+	}
+	return h.Name
+}
 func (h Hive) Description() string {
 	return fmt.Sprintf("%s | %s | %.2f MB", h.Type, h.Path, float64(h.Size)/1024/1024)
 }
@@ -42,6 +51,7 @@ const (
 	pluginBrowserMode          // New: Browse plugins first
 	hiveSelectionForPluginMode // New: Select hive(s) after plugin selection
 	pluginSelectorMode
+	optionsFormMode // Edit plugin options before running
 	resultViewMode
 )
 
@@ -72,6 +82,11 @@ type model struct {
 	height           int
 	err              error
 	filterByHiveType bool // Toggle for filtering plugins by hive type
+	optionForm       optionForm
+	running          bool
+	cancelRun        context.CancelFunc // Cancels the running plugin
+	runID            int                // Identifies the latest run
+	zoneName         string             // Time zone given with -tz
 }
 
 type scanCompleteMsg struct {
@@ -80,6 +95,7 @@ type scanCompleteMsg struct {
 }
 
 type pluginResultMsg struct {
+	runID  int
 	result string
 	err    error
 }
@@ -101,6 +117,10 @@ var (
 	successStyle = lipgloss.NewStyle().
 			Foreground(lipgloss.Color("42")).
 			Bold(true)
+
+	warningStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("214")).
+			Bold(true)
 )
 
 func initialModel() model {
@@ -123,7 +143,8 @@ func initialModel() model {
 	for _, name := range plugins.List() {
 		p, _ := plugins.Get(name)
 		if p != nil {
-			pluginItems = append(pluginItems, pluginItem{name: name, desc: p.Description()})
+			m := plugins.MetadataOf(p)
+			pluginItems = append(pluginItems, pluginItem{name: name, desc: fmt.Sprintf("[%s] %s", m.Category, p.Description())})
 		}
 	}
 
@@ -178,7 +199,7 @@ type pluginItem struct {
 	desc string
 }
 
-func (p pluginItem) FilterValue() string { return p.name }
+func (p pluginItem) FilterValue() string { return p.name + " " + p.desc }
 func (p pluginItem) Title() string       { return p.name }
 func (p pluginItem) Description() string { return p.desc }
 
@@ -203,33 +224,8 @@ func scanForHives(searchPath string) tea.Cmd {
 			}
 
 			// Check if filename looks like a registry hive
-			name := strings.ToUpper(d.Name())
-			isHive := false
-			hiveType := "Unknown"
-
-			switch {
-			case name == "SYSTEM" || strings.HasPrefix(name, "SYSTEM."):
-				isHive = true
-				hiveType = "SYSTEM"
-			case name == "SOFTWARE" || strings.HasPrefix(name, "SOFTWARE."):
-				isHive = true
-				hiveType = "SOFTWARE"
-			case name == "SAM" || strings.HasPrefix(name, "SAM."):
-				isHive = true
-				hiveType = "SAM"
-			case name == "SECURITY" || strings.HasPrefix(name, "SECURITY."):
-				isHive = true
-				hiveType = "SECURITY"
-			case name == "NTUSER.DAT" || strings.HasPrefix(name, "NTUSER.DAT"):
-				isHive = true
-				hiveType = "NTUSER.DAT"
-			case name == "USRCLASS.DAT" || strings.HasPrefix(name, "USRCLASS.DAT"):
-				isHive = true
-				hiveType = "USRCLASS.DAT"
-			case strings.HasSuffix(name, ".HIVE"):
-				isHive = true
-				hiveType = "Custom"
-			}
+			hiveType := plugins.HiveTypeFromName(d.Name())
+			isHive := hiveType != ""
 
 			if isHive {
 				info, err := d.Info()
@@ -269,56 +265,246 @@ func scanForHives(searchPath string) tea.Cmd {
 	}
 }
 
-func runPlugin(hive *Hive, pluginName string) tea.Cmd {
+// openHive opens the hive file unless it is already open.
+func openHive(hive *Hive) error {
+	if hive.hiveData != nil {
+		return nil
+	}
+	h, err := regf.OpenFile(hive.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open hive %s: %w", hive.Name, err)
+	}
+	hive.hiveData = h
+	return nil
+}
+
+// zoneSpec is the time zone results are shown in. For -tz hive, system is
+// the SYSTEM hive whose zone is used.
+type zoneSpec struct {
+	name   string
+	system *Hive
+}
+
+// resolve returns the zone, opening the SYSTEM hive if needed.
+func (z zoneSpec) resolve() (*time.Location, error) {
+	var system *regf.Hive
+	if z.system != nil {
+		if err := openHive(z.system); err != nil {
+			return nil, err
+		}
+		system = z.system.hiveData
+	}
+	return plugins.ParseZone(z.name, system)
+}
+
+func runPlugin(ctx context.Context, runID int, hive *Hive, hostSet []*Hive, zone zoneSpec, plugin plugins.Plugin, opts plugins.Options) tea.Cmd {
 	return func() tea.Msg {
 		// Open hive if not already open
-		if hive.hiveData == nil {
-			h, err := regf.OpenFile(hive.Path)
-			if err != nil {
-				return pluginResultMsg{err: fmt.Errorf("failed to open hive: %w", err)}
+		if err := openHive(hive); err != nil {
+			return pluginResultMsg{runID: runID, err: err}
+		}
+		loc, err := zone.resolve()
+		if err != nil {
+			return pluginResultMsg{runID: runID, err: err}
+		}
+
+		// Collect structured records and render them as text; multi-hive
+		// plugins get the whole host set, other plugins name SIDs with it
+		_, multi := plugin.(plugins.MultiHivePlugin)
+		host := &plugins.Host{}
+		host.Add(hive.Type, hive.Path, hive.hiveData)
+		for _, h := range hostSet {
+			if err := openHive(h); err != nil {
+				if multi {
+					return pluginResultMsg{runID: runID, err: err}
+				}
+				continue
 			}
-			hive.hiveData = h
+			host.Add(h.Type, h.Path, h.hiveData)
+		}
+		ctx = plugins.WithSIDResolver(ctx, host.SIDs())
+		var records []*plugins.Record
+		if multi && len(hostSet) > 0 {
+			records, err = plugins.CollectHost(ctx, plugin, host, opts)
+		} else {
+			records, err = plugins.CollectContext(ctx, plugin, hive.hiveData, opts)
+		}
+
+		var result strings.Builder
+		if renderErr := plugins.RenderTextIn(&result, plugin.Description(), loc, records); renderErr != nil && err == nil {
+			err = renderErr
 		}
 
-		// Get plugin
-		plugin, err := plugins.Get(pluginName)
 		if err != nil {
-			return pluginResultMsg{err: err}
+			return pluginResultMsg{runID: runID, result: result.String(), err: err}
 		}
 
-		// Capture output
-		oldStdout := os.Stdout
-		r, w, _ := os.Pipe()
-		os.Stdout = w
+		return pluginResultMsg{runID: runID, result: result.String()}
+	}
+}
+
+// resultView renders a plugin result with a line explaining its status. An
+// absent artifact is shown muted rather than as a failure, and records of a
+// partial run are kept above the warning.
+func resultView(result string, err error) string {
+	switch plugins.StatusOf(err) {
+	case plugins.StatusOK:
+		return result
+	case plugins.StatusCancelled:
+		return result + "\n" + errorStyle.Render("Cancelled")
+	case plugins.StatusNotFound:
+		return helpStyle.Render(fmt.Sprintf("Not found: %v", err))
+	case plugins.StatusNotApplicable:
+		return helpStyle.Render(fmt.Sprintf("Not applicable: %v", err))
+	case plugins.StatusPartial:
+		return result + "\n" + warningStyle.Render(fmt.Sprintf("Partial: %v", err))
+	default:
+		return errorStyle.Render(fmt.Sprintf("Error: %v", err))
+	}
+}
+
+// detailsHeight is the number of lines kept for the plugin metadata pane.
+const detailsHeight = 6
+
+// selectedPluginDetails renders the metadata of the highlighted plugin.
+func (m model) selectedPluginDetails() string {
+	if i, ok := m.pluginList.SelectedItem().(pluginItem); ok {
+		return pluginDetails(i.name, m.width-2)
+	}
+	return ""
+}
+
+// prepareRun shows the option form for plugins that declare options, or
+// starts the selected plugin straight away.
+func (m model) prepareRun(back viewMode) (model, tea.Cmd) {
+	plugin, err := plugins.Get(m.selectedPlugin)
+	if err != nil {
+		m.mode = resultViewMode
+		m.result = errorStyle.Render(fmt.Sprintf("Error: %v", err))
+		m.viewport.SetContent(m.result)
+		return m, nil
+	}
+
+	if len(plugins.DeclaredOptions(plugin)) > 0 {
+		m.optionForm = newOptionForm(plugin, back)
+		m.mode = optionsFormMode
+		return m, textinput.Blink
+	}
+	return m.startRun(plugin, plugins.DefaultOptions(plugin))
+}
 
-		// Run plugin
-		err = plugin.Run(hive.hiveData)
+// startRun runs the plugin in the background; it can be cancelled with
+// cancelRun.
+func (m model) startRun(plugin plugins.Plugin, opts plugins.Options) (model, tea.Cmd) {
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancelRun = cancel
+	m.runID++
+	m.running = true
+	m.mode = resultViewMode
+	m.result = "Running " + plugin.Name() + "... (c: Cancel)"
+	m.viewport.SetContent(m.result)
+	return m, runPlugin(ctx, m.runID, m.selectedHive, m.hostSet(plugin), m.zone(), plugin, opts)
+}
 
-		writeError := w.Close()
-		if writeError != nil {
-			return pluginResultMsg{result: "", err: writeError}
+// zone returns the time zone of results. With -tz hive the SYSTEM hive is
+// the selected one, a marked one, or the only scanned one.
+func (m model) zone() zoneSpec {
+	z := zoneSpec{name: m.zoneName}
+	if !strings.EqualFold(m.zoneName, plugins.ZoneHive) {
+		return z
+	}
+	if m.selectedHive != nil && m.selectedHive.Type == "SYSTEM" {
+		z.system = m.selectedHive
+		return z
+	}
+	var candidates []*Hive
+	for i := range m.hives {
+		if h := &m.hives[i]; h.Type == "SYSTEM" {
+			if h.Marked {
+				z.system = h
+				return z
+			}
+			candidates = append(candidates, h)
 		}
+	}
+	if len(candidates) == 1 {
+		z.system = candidates[0]
+	}
+	return z
+}
 
-		os.Stdout = oldStdout
+// sidHiveRoles are the roles other plugins resolve SIDs with.
+var sidHiveRoles = []string{"SOFTWARE", "SAM", "SECURITY"}
 
-		var result strings.Builder
-		buf := make([]byte, 1024)
-		for {
-			n, readErr := r.Read(buf)
-			if n > 0 {
-				result.Write(buf[:n])
+// hostSet returns the other hives a plugin runs with: the hives marked
+// with space and, for each role the plugin uses that is still missing, the
+// only scanned hive with that role. Multi-hive plugins read them; other
+// plugins resolve SIDs with them.
+func (m model) hostSet(plugin plugins.Plugin) []*Hive {
+	if m.selectedHive == nil {
+		return nil
+	}
+	roles := sidHiveRoles
+	if mp, ok := plugin.(plugins.MultiHivePlugin); ok {
+		roles = append(mp.RequiredHives(), mp.OptionalHives()...)
+	}
+
+	var set []*Hive
+	have := map[string]bool{m.selectedHive.Type: true}
+	for i := range m.hives {
+		if h := &m.hives[i]; h.Marked && h.Path != m.selectedHive.Path {
+			set = append(set, h)
+			have[h.Type] = true
+		}
+	}
+
+	for _, role := range roles {
+		if have[role] {
+			continue
+		}
+		var found *Hive
+		for i := range m.hives {
+			if m.hives[i].Type != role {
+				continue
 			}
-			if readErr != nil {
+			if found != nil {
+				// Several candidates; the user has to mark one
+				found = nil
 				break
 			}
+			found = &m.hives[i]
+		}
+		if found != nil {
+			set = append(set, found)
+			have[role] = true
 		}
+	}
+	return set
+}
 
-		if err != nil {
-			return pluginResultMsg{result: result.String(), err: err}
+// toggleMark adds the highlighted hive to the host set, or removes it.
+func (m model) toggleMark() model {
+	i, ok := m.hiveList.SelectedItem().(Hive)
+	if !ok {
+		return m
+	}
+	i.Marked = !i.Marked
+	for j := range m.hives {
+		if m.hives[j].Path == i.Path {
+			m.hives[j].Marked = i.Marked
 		}
+	}
+	m.hiveList.SetItem(m.hiveList.GlobalIndex(), i)
+	return m
+}
 
-		return pluginResultMsg{result: result.String()}
+// stopRun cancels the running plugin, if any.
+func (m model) stopRun() model {
+	if m.cancelRun != nil {
+		m.cancelRun()
+		m.cancelRun = nil
 	}
+	return m
 }
 
 // updatePluginList updates the plugin list based on current filter settings
@@ -407,21 +593,48 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 		if !m.ready {
 			m.hiveList.SetSize(msg.Width, msg.Height-10)
-			m.pluginList.SetSize(msg.Width, msg.Height-10)
+			m.pluginList.SetSize(msg.Width, msg.Height-10-detailsHeight)
 			m.workflowList.SetSize(msg.Width, msg.Height-10)
 			m.viewport = viewport.New(msg.Width-4, msg.Height-10)
 			m.ready = true
 		} else {
 			m.hiveList.SetSize(msg.Width, msg.Height-10)
-			m.pluginList.SetSize(msg.Width, msg.Height-10)
+			m.pluginList.SetSize(msg.Width, msg.Height-10-detailsHeight)
 			m.workflowList.SetSize(msg.Width, msg.Height-10)
 			m.viewport.Width = msg.Width - 4
 			m.viewport.Height = msg.Height - 10
 		}
 
 	case tea.KeyMsg:
+		// The option form takes every key so that values can be typed freely
+		if m.mode == optionsFormMode {
+			switch msg.String() {
+			case "ctrl+c":
+				return m, tea.Quit
+			case "esc":
+				m.mode = m.optionForm.back
+				return m, nil
+			case "tab", "down":
+				m.optionForm = m.optionForm.move(1)
+				return m, nil
+			case "shift+tab", "up":
+				m.optionForm = m.optionForm.move(-1)
+				return m, nil
+			case "enter":
+				opts, err := m.optionForm.options()
+				if err != nil {
+					m.optionForm.err = err
+					return m, nil
+				}
+				return m.startRun(m.optionForm.plugin, opts)
+			}
+			m.optionForm, cmd = m.optionForm.update(msg)
+			return m, cmd
+		}
+
 		switch msg.String() {
 		case "ctrl+c", "q":
+			m = m.stopRun()
 			// Close all open hives
 			for i := range m.hives {
 				if m.hives[i].hiveData != nil {
@@ -462,6 +675,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					m.selectedHive = nil
 				}
 			case resultViewMode:
+				m = m.stopRun()
 				if m.workflow == fileFirstWorkflow {
 					m.mode = pluginSelectorMode
 				} else {
@@ -469,6 +683,20 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				}
 			}
 
+		case "c", "esc":
+			// Cancel a running plugin
+			if m.mode == resultViewMode && m.running {
+				m = m.stopRun()
+			}
+
+		case " ":
+			// Mark hives of the same host for multi-hive plugins
+			if (m.mode == hiveBrowserMode || m.mode == hiveSelectionForPluginMode) &&
+				m.hiveList.FilterState() != list.Filtering {
+				m = m.toggleMark()
+				return m, nil
+			}
+
 		case "w":
 			// Toggle whitelist filter
 			if m.mode == pluginSelectorMode {
@@ -503,14 +731,12 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			case pluginSelectorMode:
 				if i, ok := m.pluginList.SelectedItem().(pluginItem); ok {
 					m.selectedPlugin = i.name
-					m.mode = resultViewMode
-					return m, runPlugin(m.selectedHive, m.selectedPlugin)
+					return m.prepareRun(pluginSelectorMode)
 				}
 			case hiveSelectionForPluginMode:
 				if i, ok := m.hiveList.SelectedItem().(Hive); ok {
 					m.selectedHive = &i
-					m.mode = resultViewMode
-					return m, runPlugin(m.selectedHive, m.selectedPlugin)
+					return m.prepareRun(hiveSelectionForPluginMode)
 				}
 			}
 		}
@@ -529,11 +755,13 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 
 	case pluginResultMsg:
-		if msg.err != nil {
-			m.result = errorStyle.Render(fmt.Sprintf("Error: %v", msg.err))
-		} else {
-			m.result = msg.result
+		if msg.runID != m.runID {
+			// Result of a run that was cancelled and replaced
+			break
 		}
+		m.running = false
+		m = m.stopRun()
+		m.result = resultView(msg.result, msg.err)
 		m.viewport.SetContent(m.result)
 	}
 
@@ -576,7 +804,7 @@ func (m model) View() string {
 
 	case hiveBrowserMode:
 		title := titleStyle.Render("HiveDigger - Registry Hive Browser")
-		help := helpStyle.Render("Enter: Select | q: Quit | /: Filter | b: Go Back")
+		help := helpStyle.Render("Enter: Select | Space: Add to Host Set | q: Quit | /: Filter | b: Go Back")
 		status := ""
 		if m.scanning {
 			status = fmt.Sprintf("Scanning %s for hives...", m.scanPath)
@@ -595,15 +823,16 @@ func (m model) View() string {
 		title := titleStyle.Render("HiveDigger - Plugin Browser")
 		help := helpStyle.Render("Enter: Select Plugin | b: Go Back | q: Quit | /: Search")
 
-		content = fmt.Sprintf("%s\n\n%s\n\n%s",
+		content = fmt.Sprintf("%s\n\n%s\n\n%s\n\n%s",
 			title,
 			m.pluginList.View(),
+			m.selectedPluginDetails(),
 			help,
 		)
 
 	case hiveSelectionForPluginMode:
 		title := titleStyle.Render(fmt.Sprintf("HiveDigger - Select Hive for Plugin: %s", m.selectedPlugin))
-		help := helpStyle.Render("Enter: Run Plugin | b: Go Back | q: Quit | /: Filter")
+		help := helpStyle.Render("Enter: Run Plugin | Space: Add to Host Set | b: Go Back | q: Quit | /: Filter")
 
 		content = fmt.Sprintf("%s\n\n%s\n\n%s",
 			title,
@@ -623,15 +852,35 @@ func (m model) View() string {
 		}
 		help := helpStyle.Render("Enter: Run | b: Back | q: Quit | /: Search | w: Toggle Filter" + filterStatus)
 
-		content = fmt.Sprintf("%s\n\n%s\n\n%s",
+		content = fmt.Sprintf("%s\n\n%s\n\n%s\n\n%s",
 			title,
 			m.pluginList.View(),
+			m.selectedPluginDetails(),
+			help,
+		)
+
+	case optionsFormMode:
+		title := titleStyle.Render(fmt.Sprintf("Options for %s on %s", m.selectedPlugin, m.selectedHive.Name))
+		help := helpStyle.Render("Enter: Run | Tab/↑↓: Next Field | Esc: Back | Ctrl+C: Quit")
+
+		content = fmt.Sprintf("%s\n\n%s\n%s",
+			title,
+			m.optionForm.view(),
 			help,
 		)
 
 	case resultViewMode:
-		title := titleStyle.Render(fmt.Sprintf("Results: %s on %s", m.selectedPlugin, m.selectedHive.Name))
+		on := m.selectedHive.Name
+		if plugin, err := plugins.Get(m.selectedPlugin); err == nil {
+			for _, h := range m.hostSet(plugin) {
+				on += " + " + h.Name
+			}
+		}
+		title := titleStyle.Render(fmt.Sprintf("Results: %s on %s", m.selectedPlugin, on))
 		help := helpStyle.Render("b: Back | q: Quit | ↑↓: Scroll")
+		if m.running {
+			help = helpStyle.Render("c/Esc: Cancel | b: Back | q: Quit")
+		}
 
 		content = fmt.Sprintf("%s\n\n%s\n\n%s",
 			title,
@@ -644,7 +893,25 @@ func (m model) View() string {
 }
 
 func main() {
-	p := tea.NewProgram(initialModel(), tea.WithAltScreen())
+	pluginDir := flag.String("plugin-dir", "",
+		"Directory of JSON plugin definitions (default "+plugins.DefaultPluginDir()+" when it exists)")
+	zoneName := flag.String("tz", "utc",
+		`Time zone of results: utc, local, hive (the SYSTEM hive's own zone), an IANA name or an offset such as +02:00`)
+	flag.Parse()
+	if _, err := plugins.RegisterDir(*pluginDir); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if !strings.EqualFold(*zoneName, plugins.ZoneHive) {
+		if _, err := plugins.ParseZone(*zoneName, nil); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: -tz: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	m := initialModel()
+	m.zoneName = *zoneName
+	p := tea.NewProgram(m, tea.WithAltScreen())
 	if _, err := p.Run(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
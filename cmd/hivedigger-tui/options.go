@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/plugins"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// optionForm holds one text input per option declared by a plugin.
+type optionForm struct {
+	plugin plugins.Plugin
+	defs   []plugins.Option
+	inputs []textinput.Model
+	focus  int
+	err    error
+	// back is the mode to return to when the form is dismissed.
+	back viewMode
+}
+
+func newOptionForm(p plugins.Plugin, back viewMode) optionForm {
+	f := optionForm{plugin: p, defs: plugins.DeclaredOptions(p), back: back}
+	for i, o := range f.defs {
+		ti := textinput.New()
+		ti.Prompt = ""
+		ti.CharLimit = 256
+		ti.Width = 30
+		ti.SetValue(o.Default)
+		if i == 0 {
+			ti.Focus()
+		}
+		f.inputs = append(f.inputs, ti)
+	}
+	return f
+}
+
+// move shifts the focus by delta, wrapping around.
+func (f optionForm) move(delta int) optionForm {
+	if len(f.inputs) == 0 {
+		return f
+	}
+	f.inputs[f.focus].Blur()
+	f.focus = (f.focus + delta + len(f.inputs)) % len(f.inputs)
+	f.inputs[f.focus].Focus()
+	return f
+}
+
+// options validates the form values.
+func (f optionForm) options() (plugins.Options, error) {
+	raw := make(map[string]string, len(f.defs))
+	for i, o := range f.defs {
+		raw[o.Name] = strings.TrimSpace(f.inputs[i].Value())
+	}
+	return plugins.ParseOptions(f.plugin, raw)
+}
+
+func (f optionForm) update(msg tea.Msg) (optionForm, tea.Cmd) {
+	if len(f.inputs) == 0 {
+		return f, nil
+	}
+	var cmd tea.Cmd
+	f.inputs[f.focus], cmd = f.inputs[f.focus].Update(msg)
+	return f, cmd
+}
+
+func (f optionForm) view() string {
+	var b strings.Builder
+	for i, o := range f.defs {
+		cursor := "  "
+		if i == f.focus {
+			cursor = "> "
+		}
+		fmt.Fprintf(&b, "%s%-12s %s\n", cursor, o.Name, f.inputs[i].View())
+		fmt.Fprintf(&b, "  %-12s %s\n\n", "", helpStyle.Render(fmt.Sprintf("%s, default %q. %s", o.Type, o.Default, o.Description)))
+	}
+	if f.err != nil {
+		b.WriteString(errorStyle.Render(f.err.Error()))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// pluginDetails renders the metadata of a plugin for the pane below the
+// plugin list, wrapped to width and cut to detailsHeight lines.
+func pluginDetails(name string, width int) string {
+	p, err := plugins.Get(name)
+	if err != nil {
+		return ""
+	}
+	m := plugins.MetadataOf(p)
+
+	var b strings.Builder
+	techniques := strings.Join(m.Techniques, ", ")
+	if techniques == "" {
+		techniques = "-"
+	}
+	fmt.Fprintf(&b, "%s v%s | %s | ATT&CK: %s\n", p.Name(), m.Version, m.Category, techniques)
+	if m.Artifact != "" {
+		fmt.Fprintf(&b, "%s\n", m.Artifact)
+	}
+	fields := make([]string, 0, len(m.Schema))
+	for _, f := range m.Schema {
+		if f.Sensitive {
+			fields = append(fields, f.Name+" ("+f.Type.String()+", sensitive)")
+			continue
+		}
+		fields = append(fields, f.Name+" ("+f.Type.String()+")")
+	}
+	if len(fields) > 0 {
+		fmt.Fprintf(&b, "Fields: %s\n", strings.Join(fields, ", "))
+	}
+	if len(m.References) > 0 {
+		fmt.Fprintf(&b, "Refs: %s", strings.Join(m.References, " "))
+	}
+	return helpStyle.Width(width).MaxHeight(detailsHeight).Render(strings.TrimRight(b.String(), "\n"))
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/plugins"
+	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
+)
+
+// hiveFlag collects repeated -hive path or -hive ROLE=path arguments.
+type hiveFlag []string
+
+func (h *hiveFlag) String() string {
+	return strings.Join(*h, ",")
+}
+
+func (h *hiveFlag) Set(value string) error {
+	if value == "" {
+		return fmt.Errorf("empty hive path")
+	}
+	*h = append(*h, value)
+	return nil
+}
+
+// splitHiveArg splits a -hive argument into an explicit role, if any, and
+// a path. A prefix that is not a known role is part of the path.
+func splitHiveArg(arg string) (string, string) {
+	if name, path, ok := strings.Cut(arg, "="); ok {
+		if role, ok := plugins.ParseHiveRole(name); ok {
+			return role, path
+		}
+	}
+	return "", arg
+}
+
+// scanHostDir returns the hive files found below dir. Transaction logs,
+// which share the name of their hive, are skipped.
+func scanHostDir(dir string) ([]string, error) {
+	var paths []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		ext := strings.ToUpper(filepath.Ext(d.Name()))
+		if strings.HasPrefix(ext, ".LOG") || plugins.HiveTypeFromName(d.Name()) == "" {
+			return nil
+		}
+		paths = append(paths, path)
+		return nil
+	})
+	return paths, err
+}
+
+// openHost opens the hives given with -hive and those found under dir. The
+// role of a hive is taken from its ROLE= prefix or detected from its name.
+func openHost(args hiveFlag, dir string) (*plugins.Host, error) {
+	host := &plugins.Host{Name: dir}
+	if dir != "" {
+		paths, err := scanHostDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan %s: %w", dir, err)
+		}
+		if len(paths) == 0 {
+			return nil, fmt.Errorf("no hives found in %s", dir)
+		}
+		for _, path := range paths {
+			args = append(args, path)
+		}
+	}
+
+	for _, arg := range args {
+		role, path := splitHiveArg(arg)
+		hive, err := regf.OpenFile(path)
+		if err != nil {
+			closeHost(host)
+			return nil, fmt.Errorf("failed to open %s: %w", path, err)
+		}
+		if role == "" {
+			role = plugins.DetectHiveType(path, hive)
+		}
+		host.Add(role, path, hive)
+	}
+	return host, nil
+}
+
+// closeHost closes every hive of the host.
+func closeHost(host *plugins.Host) {
+	for _, hh := range host.Hives {
+		if err := hh.Hive.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error closing hive %s: %v\n", hh.Path, err)
+		}
+	}
+}
+
+// untyped reports whether a hive role names no known hive type: either it
+// was not detected, or the file is a custom .hive.
+func untyped(role string) bool {
+	return role == "" || role == "Custom"
+}
+
+// appliesTo reports whether p can run on the host: a multi-hive plugin
+// needs all its required hives, other plugins one compatible hive. A hive
+// of unknown type accepts every plugin.
+func appliesTo(p plugins.Plugin, host *plugins.Host) bool {
+	if len(host.Hives) == 1 && untyped(host.Hives[0].Role) {
+		return true
+	}
+	if mp, ok := p.(plugins.MultiHivePlugin); ok {
+		return len(plugins.MissingHives(mp, host)) == 0
+	}
+	for _, role := range host.Roles() {
+		if untyped(role) || plugins.IsCompatibleWithHiveType(p.Name(), role) {
+			return true
+		}
+	}
+	return false
+}
+
+// target is one run of a plugin: on a single hive, or on the whole host
+// for multi-hive plugins.
+type target struct {
+	hive plugins.HostHive
+	host bool
+	// err is set instead of running the plugin when it cannot apply.
+	err error
+}
+
+// targets returns the runs of p on the host. A host with one hive runs the
+// plugin on it unless the hive's type is known and incompatible, which is
+// reported as not applicable. Otherwise a
+// single-hive plugin runs once per compatible hive, so that every
+// NTUSER.DAT of a host is read. A plugin that cannot run gets a single host
+// run that reports why.
+func targets(p plugins.Plugin, host *plugins.Host) []target {
+	if len(host.Hives) == 1 {
+		hh := host.Hives[0]
+		if !untyped(hh.Role) && !plugins.IsCompatibleWithHiveType(p.Name(), hh.Role) {
+			err := fmt.Errorf("%w: %s does not run on %s hives", plugins.ErrNotApplicable, p.Name(), hh.Role)
+			return []target{{hive: hh, err: err}}
+		}
+		return []target{{hive: hh}}
+	}
+	if _, ok := p.(plugins.MultiHivePlugin); ok {
+		hh, _ := plugins.PrimaryHive(p, host)
+		return []target{{hive: hh, host: true}}
+	}
+
+	var list []target
+	for _, hh := range host.Hives {
+		if untyped(hh.Role) || plugins.IsCompatibleWithHiveType(p.Name(), hh.Role) {
+			list = append(list, target{hive: hh})
+		}
+	}
+	if len(list) == 0 {
+		return []target{{host: true}}
+	}
+	return list
+}
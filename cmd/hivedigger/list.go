@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/plugins"
+)
+
+// listFilter selects and orders the plugins shown by -list.
+type listFilter struct {
+	category  string
+	technique string
+	hiveType  string
+	sortBy    string
+}
+
+// filterPlugins returns the registered plugins matching f, sorted.
+func filterPlugins(f listFilter) ([]plugins.Plugin, error) {
+	var selected []plugins.Plugin
+	for _, name := range plugins.List() {
+		p, err := plugins.Get(name)
+		if err != nil {
+			continue
+		}
+		m := plugins.MetadataOf(p)
+		if f.category != "" && !strings.EqualFold(string(m.Category), f.category) {
+			continue
+		}
+		if f.technique != "" && !m.HasTechnique(f.technique) {
+			continue
+		}
+		if f.hiveType != "" && !plugins.IsCompatibleWithHiveType(name, strings.ToUpper(f.hiveType)) {
+			continue
+		}
+		selected = append(selected, p)
+	}
+	if err := plugins.SortPlugins(selected, f.sortBy); err != nil {
+		return nil, err
+	}
+	return selected, nil
+}
+
+// printPluginTable prints one line per plugin with its main metadata and
+// the options it accepts.
+func printPluginTable(ps []plugins.Plugin) {
+	if len(ps) == 0 {
+		fmt.Println("No plugins match.")
+		return
+	}
+
+	fmt.Println("Available plugins:")
+	fmt.Printf("  %-15s %-14s %-8s %-22s %s\n", "NAME", "CATEGORY", "VERSION", "ATT&CK", "DESCRIPTION")
+	for _, p := range ps {
+		m := plugins.MetadataOf(p)
+		techniques := strings.Join(m.Techniques, ",")
+		if techniques == "" {
+			techniques = "-"
+		}
+		fmt.Printf("  %-15s %-14s %-8s %-22s %s\n", p.Name(), m.Category, m.Version, techniques, p.Description())
+		printPluginOptions(p)
+	}
+}
+
+// printPluginDetails prints every piece of metadata of a single plugin.
+func printPluginDetails(p plugins.Plugin) {
+	m := plugins.MetadataOf(p)
+	fmt.Printf("%s %s\n", p.Name(), m.Version)
+	fmt.Printf("  %s\n\n", p.Description())
+	fmt.Printf("Category:    %s\n", m.Category)
+	if dp, ok := p.(*plugins.DeclarativePlugin); ok {
+		fmt.Printf("Defined in:  %s\n", dp.Source())
+	}
+	if htp, ok := p.(plugins.HiveTypePlugin); ok && len(htp.CompatibleHiveTypes()) > 0 {
+		fmt.Printf("Hive types:  %s\n", strings.Join(htp.CompatibleHiveTypes(), ", "))
+	}
+	if mp, ok := p.(plugins.MultiHivePlugin); ok {
+		fmt.Printf("Needs hives: %s\n", strings.Join(mp.RequiredHives(), ", "))
+		if optional := mp.OptionalHives(); len(optional) > 0 {
+			fmt.Printf("Uses hives:  %s (when given)\n", strings.Join(optional, ", "))
+		}
+	}
+	if m.Artifact != "" {
+		fmt.Printf("Artifact:    %s\n", m.Artifact)
+	}
+	for _, t := range m.Techniques {
+		fmt.Printf("ATT&CK:      %s %s\n", t, plugins.TechniqueURL(t))
+	}
+	for _, r := range m.References {
+		fmt.Printf("Reference:   %s\n", r)
+	}
+	if opts := plugins.DeclaredOptions(p); len(opts) > 0 {
+		fmt.Println("\nOptions:")
+		for _, o := range opts {
+			fmt.Printf("  %-15s %-7s default %q  %s\n", o.Name, o.Type, o.Default, o.Description)
+		}
+	}
+	if len(m.Schema) > 0 {
+		fmt.Println("\nOutput schema:")
+		for _, f := range m.Schema {
+			desc := f.Description
+			if f.Sensitive {
+				desc += " [SENSITIVE]"
+			}
+			fmt.Printf("  %-22s %-8s %s\n", f.Name, f.Type, desc)
+		}
+	}
+}
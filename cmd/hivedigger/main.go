@@ -1,83 +1,341 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"strings"
+	_ "time/tzdata" // IANA zones for -tz on systems without a zone database
 
+	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/output"
 	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/plugins"
-	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
 )
 
 func main() {
-	var hivePath string
+	var hiveArgs hiveFlag
+	var hostDir string
 	var pluginName string
 	var listPlugins bool
+	var formatName string
+	var outputPath string
+	var timeline bool
+	var optionArgs optionFlag
+	var filter listFilter
+	var profileName string
+	var profilesPath string
+	var listProfiles bool
+	var pluginDir string
+	var zoneName string
 
-	flag.StringVar(&hivePath, "hive", "", "Path to registry hive file")
-	flag.StringVar(&pluginName, "plugin", "", "Plugin to run")
-	flag.BoolVar(&listPlugins, "list", false, "List available plugins")
+	flag.Var(&hiveArgs, "hive",
+		"Path to a registry hive, optionally as ROLE=path (repeatable; roles: "+strings.Join(plugins.HiveRoles(), ", ")+")")
+	flag.StringVar(&hostDir, "host", "", "Directory holding the hives of one host, searched recursively")
+	flag.StringVar(&pluginName, "plugin", "", `Plugin to run, or "all" for every plugin compatible with the hive`)
+	flag.StringVar(&profileName, "profile", "", "Run the plugins of a profile (see -list-profiles)")
+	flag.StringVar(&profilesPath, "profiles", "",
+		"Profiles file (default "+plugins.DefaultProfilesPath()+" when it exists)")
+	flag.BoolVar(&listProfiles, "list-profiles", false, "List available profiles")
+	flag.StringVar(&pluginDir, "plugin-dir", "",
+		"Directory of JSON plugin definitions (default "+plugins.DefaultPluginDir()+" when it exists)")
+	flag.BoolVar(&listPlugins, "list", false, "List available plugins (with -plugin, show its metadata)")
+	flag.StringVar(&filter.category, "category", "", "With -list, only show plugins of this category")
+	flag.StringVar(&filter.technique, "technique", "", "With -list, only show plugins mapped to this ATT&CK technique (e.g. T1547)")
+	flag.StringVar(&filter.hiveType, "hive-type", "", "With -list, only show plugins compatible with this hive type")
+	flag.StringVar(&filter.sortBy, "sort", "name",
+		"With -list, sort by: "+strings.Join(plugins.SortKeys, ", "))
+	flag.StringVar(&formatName, "format", string(output.FormatText),
+		"Output format: "+strings.Join(output.Formats(), ", "))
+	flag.StringVar(&zoneName, "tz", "utc",
+		`Time zone of text and record output: utc, local, hive (the SYSTEM hive's own zone), an IANA name or an offset such as +02:00`)
+	flag.StringVar(&outputPath, "output", "", "Write results to this file instead of stdout")
+	flag.BoolVar(&timeline, "timeline", false,
+		"Run every plugin compatible with the hive and write a timeline (bodyfile unless -format is tln, l2tcsv or timesketch)")
+	flag.Var(&optionArgs, "opt",
+		"Plugin option as name=value or plugin.name=value (repeatable, see -list)")
 	flag.Parse()
 
+	// Declarative plugins join the registry before anything lists or runs it
+	if _, err := plugins.RegisterDir(pluginDir); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	var profiles []plugins.Profile
+	if listProfiles || profileName != "" {
+		var err error
+		profiles, err = plugins.LoadProfiles(profilesPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if listProfiles {
+		printProfiles(profiles)
+		return
+	}
+
 	if listPlugins {
-		printAvailablePlugins()
+		if pluginName != "" {
+			plugin, err := plugins.Get(pluginName)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			printPluginDetails(plugin)
+			return
+		}
+		selected, err := filterPlugins(filter)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		printPluginTable(selected)
 		return
 	}
 
-	if hivePath == "" {
-		fmt.Fprintf(os.Stderr, "Error: -hive flag is required\n")
+	if len(hiveArgs) == 0 && hostDir == "" {
+		fmt.Fprintf(os.Stderr, "Error: -hive or -host flag is required\n")
 		flag.Usage()
 		os.Exit(1)
 	}
 
-	if pluginName == "" {
-		fmt.Fprintf(os.Stderr, "Error: -plugin flag is required\n")
+	if pluginName == "" && profileName == "" && !timeline {
+		fmt.Fprintf(os.Stderr, "Error: -plugin, -profile or -timeline flag is required\n")
 		flag.Usage()
 		os.Exit(1)
 	}
+	if pluginName != "" && profileName != "" {
+		fmt.Fprintf(os.Stderr, "Error: -plugin and -profile cannot be combined\n")
+		os.Exit(1)
+	}
+	// Several plugins run in one report unless a single plugin was named
+	single := pluginName != "" && pluginName != "all"
 
-	// Open the hive file
-	hive, err := regf.OpenFile(hivePath)
+	format, err := output.ParseFormat(formatName)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error opening hive: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error: %v (supported: %s)\n", err, strings.Join(output.Formats(), ", "))
 		os.Exit(1)
 	}
-	defer func() {
-		if err := hive.Close(); err != nil {
-			fmt.Fprintf(os.Stderr, "Error closing hive: %v\n", err)
+	if timeline && !output.IsTimeline(format) {
+		format = output.FormatBodyfile
+	}
+
+	var selected []plugins.Plugin
+	var profile plugins.Profile
+	switch {
+	case profileName != "":
+		profile, err = plugins.FindProfile(profiles, profileName)
+		if err == nil {
+			err = profile.Validate()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	case single:
+		plugin, err := plugins.Get(pluginName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			fmt.Fprintf(os.Stderr, "\nAvailable plugins:\n")
+			printAvailablePlugins()
+			os.Exit(1)
+		}
+		selected = append(selected, plugin)
+		if _, err := pluginOptions(selected, nil, optionArgs); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
 		}
-	}()
+	}
+
+	// Open the hives of the host
+	host, err := openHost(hiveArgs, hostDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening hive: %v\n", err)
+		os.Exit(1)
+	}
+	defer closeHost(host)
 
-	// Get the plugin
-	plugin, err := plugins.Get(pluginName)
+	zone, err := plugins.ParseZone(zoneName, host.Hive("SYSTEM"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: -tz: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Get the plugins to run; profiles and "all" need the hive types first
+	var base map[string]map[string]string
+	switch {
+	case profileName != "":
+		selected, base = profilePlugins(profile, host)
+	case !single:
+		selected = compatiblePlugins(host)
+	}
+
+	// Validate options before anything runs
+	options, err := pluginOptions(selected, base, optionArgs)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		fmt.Fprintf(os.Stderr, "\nAvailable plugins:\n")
-		printAvailablePlugins()
 		os.Exit(1)
 	}
 
-	// Run the plugin
-	if err := plugin.Run(hive); err != nil {
-		fmt.Fprintf(os.Stderr, "Plugin execution failed: %v\n", err)
+	// Open the output destination
+	out := os.Stdout
+	if outputPath != "" {
+		out, err = os.Create(outputPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating output file: %v\n", err)
+			os.Exit(1)
+		}
+		defer func() {
+			if err := out.Close(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error closing output file: %v\n", err)
+			}
+		}()
+	}
+
+	writer, err := output.NewWriter(out, format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
+
+	// Ctrl-C cancels the run; records collected so far are still written
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	// Plugins name the SIDs they report with every hive of the host
+	ctx = plugins.WithSIDResolver(ctx, host.SIDs())
+
+	// Run the plugins and write their records
+	worst := plugins.StatusOK
+	hashes := make(map[string]string)
+run:
+	for _, plugin := range selected {
+		for _, t := range targets(plugin, host) {
+			var records []*plugins.Record
+			var runErr error
+			switch {
+			case t.err != nil:
+				runErr = t.err
+			case t.host:
+				records, runErr = plugins.CollectHost(ctx, plugin, host, options[plugin.Name()])
+			default:
+				records, runErr = plugins.CollectContext(ctx, plugin, t.hive.Hive, options[plugin.Name()])
+			}
+			if errors.Is(runErr, context.Canceled) {
+				runErr = nil
+			}
+			if t.hive.Hive != nil && hashes[t.hive.Path] == "" {
+				hashes[t.hive.Path] = t.hive.Hive.SHA256()
+			}
+			src := output.Source{
+				HivePath:   t.hive.Path,
+				HiveSHA256: hashes[t.hive.Path],
+				Plugin:     plugin.Name(),
+				Title:      plugin.Description(),
+				Err:        runErr,
+				Zone:       zone,
+			}
+			if !single {
+				src.Title = plugin.Name() + ": " + plugin.Description()
+			}
+			if len(host.Hives) > 1 && t.hive.Path != "" {
+				src.Title += " (" + t.hive.Path + ")"
+			}
+			if err := writer.WriteRecords(src, records); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+			}
+			if ctx.Err() != nil {
+				break run
+			}
+			status := plugins.StatusOf(runErr)
+			switch status {
+			case plugins.StatusError, plugins.StatusPartial:
+				fmt.Fprintf(os.Stderr, "Plugin %s failed: %v\n", plugin.Name(), runErr)
+			}
+			if single || status == plugins.StatusError || status == plugins.StatusPartial {
+				worst = max(worst, status)
+			}
+		}
+	}
+	if err := writer.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+	}
+	if ctx.Err() != nil {
+		fmt.Fprintf(os.Stderr, "Interrupted\n")
+		os.Exit(130)
+	}
+	// When several plugins run, an absent artifact is part of the report
+	// and does not set the exit code; any failure does, as a partial run.
+	if worst != plugins.StatusOK {
+		os.Exit(exitCode(worst, single))
+	}
 }
 
-func printAvailablePlugins() {
-	pluginNames := plugins.List()
-	if len(pluginNames) == 0 {
-		fmt.Println("No plugins registered.")
-		return
+// exitCode maps the worst status of the run to the process exit code. A
+// failed plugin in a run of several makes the whole run partial.
+func exitCode(status plugins.Status, single bool) int {
+	switch status {
+	case plugins.StatusNotFound:
+		return 2
+	case plugins.StatusNotApplicable:
+		return 3
+	case plugins.StatusPartial:
+		return 4
+	case plugins.StatusError:
+		if !single {
+			return 4
+		}
+		return 1
 	}
+	return 0
+}
 
-	fmt.Println("Available plugins:")
-	for _, name := range pluginNames {
-		plugin, err := plugins.Get(name)
-		if err != nil {
-			fmt.Printf("  %-15s (error: %v)\n", name, err)
+// compatiblePlugins returns every plugin that applies to the host, sorted
+// by name so that reports and timelines are reproducible.
+func compatiblePlugins(host *plugins.Host) []plugins.Plugin {
+	var selected []plugins.Plugin
+	for _, name := range plugins.List() {
+		if p, err := plugins.Get(name); err == nil && appliesTo(p, host) {
+			selected = append(selected, p)
+		}
+	}
+	return selected
+}
+
+// profilePlugins returns the plugins of a profile that apply to the host,
+// in profile order, with the option values the profile sets for them.
+func profilePlugins(profile plugins.Profile, host *plugins.Host) ([]plugins.Plugin, map[string]map[string]string) {
+	var selected []plugins.Plugin
+	base := make(map[string]map[string]string)
+	for _, e := range profile.Plugins {
+		p, err := plugins.Get(e.Plugin)
+		if err != nil || base[e.Plugin] != nil || !appliesTo(p, host) {
 			continue
 		}
-		fmt.Printf("  %-15s %s\n", name, plugin.Description())
+		selected = append(selected, p)
+		base[e.Plugin] = make(map[string]string, len(e.Options))
+		for k, v := range e.Options {
+			base[e.Plugin][k] = v
+		}
+	}
+	return selected, base
+}
+
+func printProfiles(profiles []plugins.Profile) {
+	fmt.Println("Available profiles:")
+	for _, p := range profiles {
+		names := make([]string, len(p.Plugins))
+		for i, e := range p.Plugins {
+			names[i] = e.Plugin
+		}
+		fmt.Printf("  %-15s %s\n", p.Name, p.Description)
+		fmt.Printf("  %-15s   %s\n", "", strings.Join(names, ", "))
 	}
 }
+
+func printAvailablePlugins() {
+	selected, _ := filterPlugins(listFilter{})
+	printPluginTable(selected)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runMainEnv makes the test binary run main with its arguments instead of
+// the tests, so that exit codes can be checked.
+const runMainEnv = "HIVEDIGGER_RUN_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(runMainEnv) == "1" {
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// writeEmptyHive writes a hive holding only its root key.
+func writeEmptyHive(t *testing.T, path string) {
+	t.Helper()
+	name := []byte("ROOT")
+	nk := make([]byte, 0x4C+len(name))
+	copy(nk, "nk")
+	binary.LittleEndian.PutUint16(nk[0x02:], 0x0020) // ASCII name
+	binary.LittleEndian.PutUint32(nk[0x2C:], 0xFFFFFFFF)
+	binary.LittleEndian.PutUint32(nk[0x30:], 0xFFFFFFFF)
+	binary.LittleEndian.PutUint16(nk[0x48:], uint16(len(name)))
+	copy(nk[0x4C:], name)
+
+	bin := make([]byte, 0x1000)
+	copy(bin, "hbin")
+	binary.LittleEndian.PutUint32(bin[8:], uint32(len(bin)))
+	size := (len(nk) + 4 + 7) &^ 7
+	binary.LittleEndian.PutUint32(bin[0x20:], uint32(-int32(size)))
+	copy(bin[0x24:], nk)
+	binary.LittleEndian.PutUint32(bin[0x20+size:], uint32(len(bin)-0x20-size))
+
+	header := make([]byte, 0x1000)
+	copy(header, "regf")
+	binary.LittleEndian.PutUint32(header[0x24:], 0x20)
+	if err := os.WriteFile(path, append(header, bin...), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	hive := filepath.Join(t.TempDir(), "NTUSER.DAT")
+	writeEmptyHive(t, hive)
+
+	for _, tt := range []struct {
+		plugin string
+		want   int
+	}{
+		{"bam", 3},        // SYSTEM plugin on NTUSER.DAT: not applicable
+		{"recentdocs", 2}, // NTUSER.DAT plugin without its keys: not found
+	} {
+		cmd := exec.Command(os.Args[0], "-hive", hive, "-plugin", tt.plugin)
+		cmd.Env = append(os.Environ(), runMainEnv+"=1")
+		out, err := cmd.CombinedOutput()
+		code := 0
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			code = exitErr.ExitCode()
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if code != tt.want {
+			t.Errorf("%s: exit code %d, want %d\n%s", tt.plugin, code, tt.want, out)
+		}
+	}
+}
+
+func TestCustomHiveRunsEveryPlugin(t *testing.T) {
+	hive := filepath.Join(t.TempDir(), "evidence.hive")
+	writeEmptyHive(t, hive)
+
+	cmd := exec.Command(os.Args[0], "-hive", hive, "-plugin", "all", "-format", "jsonl")
+	cmd.Env = append(os.Environ(), runMainEnv+"=1")
+	out, _ := cmd.Output()
+	for _, plugin := range []string{"bam", "recentdocs"} {
+		if !strings.Contains(string(out), `"plugin":"`+plugin+`"`) {
+			t.Errorf("%s did not run on a custom hive:\n%s", plugin, out)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/plugins"
+)
+
+// optionFlag collects repeated -opt name=value or -opt plugin.name=value
+// arguments.
+type optionFlag []string
+
+func (o *optionFlag) String() string {
+	return strings.Join(*o, ",")
+}
+
+func (o *optionFlag) Set(value string) error {
+	if !strings.Contains(value, "=") {
+		return fmt.Errorf("expected name=value or plugin.name=value, got %q", value)
+	}
+	*o = append(*o, value)
+	return nil
+}
+
+// pluginOptions validates the -opt arguments against the selected plugins.
+// base holds per-plugin values, from a profile, that the arguments
+// override. A plugin-qualified option applies to that plugin only; an
+// unqualified one applies to every selected plugin that declares it.
+// Options that no selected plugin accepts are rejected.
+func pluginOptions(selected []plugins.Plugin, base map[string]map[string]string, args optionFlag) (map[string]plugins.Options, error) {
+	raw := make(map[string]map[string]string, len(selected))
+	byName := make(map[string]plugins.Plugin, len(selected))
+	for _, p := range selected {
+		raw[p.Name()] = make(map[string]string)
+		for k, v := range base[p.Name()] {
+			raw[p.Name()][k] = v
+		}
+		byName[p.Name()] = p
+	}
+
+	for _, arg := range args {
+		name, value, _ := strings.Cut(arg, "=")
+		pluginName, optName, qualified := strings.Cut(name, ".")
+		if qualified {
+			if _, ok := byName[pluginName]; !ok {
+				return nil, fmt.Errorf("%w: plugin %s is not selected", plugins.ErrInvalidOption, pluginName)
+			}
+			raw[pluginName][optName] = value
+			continue
+		}
+
+		used := false
+		for _, p := range selected {
+			for _, o := range plugins.DeclaredOptions(p) {
+				if o.Name == name {
+					raw[p.Name()][name] = value
+					used = true
+				}
+			}
+		}
+		if !used {
+			return nil, fmt.Errorf("%w: no selected plugin accepts %q", plugins.ErrInvalidOption, name)
+		}
+	}
+
+	opts := make(map[string]plugins.Options, len(selected))
+	for _, p := range selected {
+		o, err := plugins.ParseOptions(p, raw[p.Name()])
+		if err != nil {
+			return nil, err
+		}
+		opts[p.Name()] = o
+	}
+	return opts, nil
+}
+
+// printPluginOptions lists the options declared by a plugin below its entry
+// in -list.
+func printPluginOptions(p plugins.Plugin) {
+	for _, o := range plugins.DeclaredOptions(p) {
+		fmt.Printf("  %-15s   -opt %s=<%s> (default %q) %s\n", "", o.Name, o.Type, o.Default, o.Description)
+	}
+}
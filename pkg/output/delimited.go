@@ -0,0 +1,152 @@
+package output
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/plugins"
+)
+
+// delimitedHeader is the column layout shared by CSV and TSV. Records are
+// written in long form, one row per field, so the header never depends on
+// which plugins ran. Rows of the same record share a record number, and
+// the sensitive column is "true" on rows holding a secret such as a hash.
+var delimitedHeader = []string{
+	"schema_version",
+	"hive_path",
+	"hive_sha256",
+	"plugin",
+	"record",
+	"key_path",
+	"last_write",
+	"severity",
+	"tags",
+	"field",
+	"type",
+	"value",
+	"sensitive",
+}
+
+// delimitedRows flattens records into rows matching delimitedHeader.
+// next is the record number of the first record. A plugin that failed or
+// found nothing adds a row with record number 0, field "error" and its
+// status (error, partial, not-found, not-applicable) as type.
+func delimitedRows(src Source, records []*plugins.Record, next int) [][]string {
+	var rows [][]string
+	for i, r := range records {
+		prefix := []string{
+			fmt.Sprintf("%d", SchemaVersion),
+			src.HivePath,
+			src.HiveSHA256,
+			src.Plugin,
+			fmt.Sprintf("%d", next+i),
+			r.KeyPath,
+			formatTimestamp(r.LastWrite, src.Zone),
+			r.Severity.String(),
+			strings.Join(r.Tags, "|"),
+		}
+
+		if len(r.Fields) == 0 {
+			rows = append(rows, append(prefix, "", "", "", ""))
+			continue
+		}
+		for _, f := range r.Fields {
+			row := append(append([]string{}, prefix...), f.Name, f.Type.String(), fieldString(f, src.Zone),
+				fmt.Sprintf("%t", f.Sensitive))
+			rows = append(rows, row)
+		}
+	}
+	if src.Err != nil {
+		rows = append(rows, []string{
+			fmt.Sprintf("%d", SchemaVersion),
+			src.HivePath,
+			src.HiveSHA256,
+			src.Plugin,
+			"0",
+			"", "", "", "",
+			"error", plugins.StatusOf(src.Err).String(), src.Err.Error(), "",
+		})
+	}
+	return rows
+}
+
+// csvWriter writes RFC 4180 CSV.
+type csvWriter struct {
+	w       *csv.Writer
+	started bool
+	records int
+}
+
+func newCSVWriter(w io.Writer) *csvWriter {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+func (c *csvWriter) WriteRecords(src Source, records []*plugins.Record) error {
+	if !c.started {
+		c.started = true
+		if err := c.w.Write(delimitedHeader); err != nil {
+			return err
+		}
+	}
+	if err := c.w.WriteAll(delimitedRows(src, records, c.records+1)); err != nil {
+		return err
+	}
+	c.records += len(records)
+	return nil
+}
+
+func (c *csvWriter) Close() error {
+	if !c.started {
+		c.started = true
+		if err := c.w.Write(delimitedHeader); err != nil {
+			return err
+		}
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// tsvWriter writes tab-separated values. Cells are never quoted; instead
+// backslashes, tabs and line breaks are escaped as \\, \t, \n and \r.
+type tsvWriter struct {
+	w       io.Writer
+	started bool
+	records int
+}
+
+var tsvEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+func (t *tsvWriter) writeRow(row []string) error {
+	cells := make([]string, len(row))
+	for i, cell := range row {
+		cells[i] = tsvEscaper.Replace(cell)
+	}
+	_, err := io.WriteString(t.w, strings.Join(cells, "\t")+"\n")
+	return err
+}
+
+func (t *tsvWriter) WriteRecords(src Source, records []*plugins.Record) error {
+	if !t.started {
+		t.started = true
+		if err := t.writeRow(delimitedHeader); err != nil {
+			return err
+		}
+	}
+	for _, row := range delimitedRows(src, records, t.records+1) {
+		if err := t.writeRow(row); err != nil {
+			return err
+		}
+	}
+	t.records += len(records)
+	return nil
+}
+
+func (t *tsvWriter) Close() error {
+	if !t.started {
+		t.started = true
+		return t.writeRow(delimitedHeader)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package output
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/plugins"
+)
+
+// jsonRow is the schema of a single record in the JSON and JSON Lines
+// formats.
+type jsonRow struct {
+	SchemaVersion int               `json:"schema_version"`
+	HivePath      string            `json:"hive_path"`
+	HiveSHA256    string            `json:"hive_sha256"`
+	Plugin        string            `json:"plugin"`
+	KeyPath       string            `json:"key_path"`
+	LastWrite     string            `json:"last_write"`
+	Severity      string            `json:"severity"`
+	Tags          []string          `json:"tags"`
+	Fields        map[string]any    `json:"fields"`
+	FieldTypes    map[string]string `json:"field_types"`
+	// SensitiveFields names the fields holding secrets such as hashes.
+	SensitiveFields []string `json:"sensitive_fields,omitempty"`
+	// Error and Status are only set on the row standing for a plugin that
+	// failed or found nothing.
+	Error  string `json:"error,omitempty"`
+	Status string `json:"status,omitempty"`
+}
+
+// errorRow returns the row standing for a failed plugin.
+func errorRow(src Source) jsonRow {
+	return jsonRow{
+		SchemaVersion: SchemaVersion,
+		HivePath:      src.HivePath,
+		HiveSHA256:    src.HiveSHA256,
+		Plugin:        src.Plugin,
+		Tags:          []string{},
+		Fields:        map[string]any{},
+		FieldTypes:    map[string]string{},
+		Error:         src.Err.Error(),
+		Status:        plugins.StatusOf(src.Err).String(),
+	}
+}
+
+func newJSONRow(src Source, r *plugins.Record) jsonRow {
+	row := jsonRow{
+		SchemaVersion: SchemaVersion,
+		HivePath:      src.HivePath,
+		HiveSHA256:    src.HiveSHA256,
+		Plugin:        src.Plugin,
+		KeyPath:       r.KeyPath,
+		LastWrite:     formatTimestamp(r.LastWrite, src.Zone),
+		Severity:      r.Severity.String(),
+		Tags:          r.Tags,
+		Fields:        make(map[string]any, len(r.Fields)),
+		FieldTypes:    make(map[string]string, len(r.Fields)),
+	}
+	if row.Tags == nil {
+		row.Tags = []string{}
+	}
+	for _, f := range r.Fields {
+		row.Fields[f.Name] = fieldValue(f, src.Zone)
+		row.FieldTypes[f.Name] = f.Type.String()
+		if f.Sensitive {
+			row.SensitiveFields = append(row.SensitiveFields, f.Name)
+		}
+	}
+	return row
+}
+
+// jsonlWriter writes one JSON object per record and line.
+type jsonlWriter struct {
+	w io.Writer
+}
+
+func (j *jsonlWriter) WriteRecords(src Source, records []*plugins.Record) error {
+	enc := json.NewEncoder(j.w)
+	for _, r := range records {
+		if err := enc.Encode(newJSONRow(src, r)); err != nil {
+			return err
+		}
+	}
+	if src.Err != nil {
+		return enc.Encode(errorRow(src))
+	}
+	return nil
+}
+
+func (j *jsonlWriter) Close() error {
+	return nil
+}
+
+// jsonWriter writes a single JSON document holding every record. Rows are
+// streamed as they arrive; Close appends the failed plugins as "errors"
+// and terminates the document.
+type jsonWriter struct {
+	w       io.Writer
+	started bool
+	count   int
+	errors  []jsonRow
+}
+
+// start writes the document header, naming the zone the timestamps are
+// written in.
+func (j *jsonWriter) start(zone *time.Location) error {
+	if j.started {
+		return nil
+	}
+	j.started = true
+	header, err := json.Marshal(struct {
+		SchemaVersion int    `json:"schema_version"`
+		TimeZone      string `json:"time_zone"`
+	}{SchemaVersion, plugins.ZoneLabel(zone)})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(j.w, strings.TrimSuffix(string(header), "}")+`,"records":[`)
+	return err
+}
+
+func (j *jsonWriter) WriteRecords(src Source, records []*plugins.Record) error {
+	if err := j.start(src.Zone); err != nil {
+		return err
+	}
+	for _, r := range records {
+		data, err := json.Marshal(newJSONRow(src, r))
+		if err != nil {
+			return err
+		}
+		sep := "\n"
+		if j.count > 0 {
+			sep = ",\n"
+		}
+		if _, err := io.WriteString(j.w, sep+string(data)); err != nil {
+			return err
+		}
+		j.count++
+	}
+	if src.Err != nil {
+		j.errors = append(j.errors, errorRow(src))
+	}
+	return nil
+}
+
+func (j *jsonWriter) Close() error {
+	if err := j.start(nil); err != nil {
+		return err
+	}
+	errs := j.errors
+	if errs == nil {
+		errs = []jsonRow{}
+	}
+	data, err := json.Marshal(errs)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(j.w, "\n],\"errors\":"+string(data)+"}\n")
+	return err
+}
@@ -0,0 +1,214 @@
+// Package output serialises plugin records into machine-readable formats
+// (JSON, JSON Lines, CSV and TSV), timelines (bodyfile, TLN, l2tcsv and
+// Timesketch JSONL) and the human-readable text view.
+package output
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/plugins"
+)
+
+// SchemaVersion is the version of the record schema shared by every
+// machine-readable format. It is bumped whenever a column or key is renamed,
+// removed or changes meaning; adding new keys does not bump it.
+const SchemaVersion = 1
+
+// Format identifies an output format.
+type Format string
+
+const (
+	FormatText  Format = "text"
+	FormatJSON  Format = "json"
+	FormatJSONL Format = "jsonl"
+	FormatCSV   Format = "csv"
+	FormatTSV   Format = "tsv"
+)
+
+var (
+	// ErrUnknownFormat is returned when an output format is not supported.
+	ErrUnknownFormat = errors.New("unknown output format")
+)
+
+// Formats returns the names of all supported formats.
+func Formats() []string {
+	return []string{
+		string(FormatText),
+		string(FormatJSON),
+		string(FormatJSONL),
+		string(FormatCSV),
+		string(FormatTSV),
+		string(FormatBodyfile),
+		string(FormatTLN),
+		string(FormatL2TCSV),
+		string(FormatTimesketch),
+	}
+}
+
+// ParseFormat returns the format with the given name.
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(strings.ToLower(name)); f {
+	case FormatText, FormatJSON, FormatJSONL, FormatCSV, FormatTSV, FormatBodyfile, FormatTLN,
+		FormatL2TCSV, FormatTimesketch:
+		return f, nil
+	case "mactime", "body":
+		return FormatBodyfile, nil
+	case "ndjson":
+		return FormatJSONL, nil
+	case "l2t", "l2t_csv", "plaso":
+		return FormatL2TCSV, nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrUnknownFormat, name)
+}
+
+// Source identifies where a batch of records comes from. It is attached to
+// every row of the machine-readable formats.
+type Source struct {
+	HivePath   string
+	HiveSHA256 string
+	Plugin     string
+	// Title is used as the section heading by the text format.
+	Title string
+	// Err is the error the plugin returned, if any. Records collected
+	// before the error are still written alongside it.
+	Err error
+	// Zone is the time zone of the text and record formats; nil means
+	// UTC. Timelines are always written in UTC.
+	Zone *time.Location
+}
+
+// Writer serialises batches of records. Close must be called once all
+// batches have been written so that formats with a trailer can finish
+// their document.
+type Writer interface {
+	WriteRecords(src Source, records []*plugins.Record) error
+	Close() error
+}
+
+// NewWriter returns a Writer for the given format.
+func NewWriter(w io.Writer, format Format) (Writer, error) {
+	switch format {
+	case FormatText:
+		return &textWriter{w: w}, nil
+	case FormatJSON:
+		return &jsonWriter{w: w}, nil
+	case FormatJSONL:
+		return &jsonlWriter{w: w}, nil
+	case FormatCSV:
+		return newCSVWriter(w), nil
+	case FormatTSV:
+		return &tsvWriter{w: w}, nil
+	case FormatBodyfile:
+		return &bodyfileWriter{w: w}, nil
+	case FormatTLN:
+		return &tlnWriter{w: w}, nil
+	case FormatL2TCSV:
+		return newL2TCSVWriter(w), nil
+	case FormatTimesketch:
+		return &timesketchWriter{w: w}, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+}
+
+// textWriter renders records with plugins.RenderText. When more than one
+// section was written, Close appends a summary of the plugins that failed
+// or found nothing, grouped by status.
+type textWriter struct {
+	w        io.Writer
+	sections int
+	byStatus map[plugins.Status][]string
+}
+
+// statusLabels are the prefixes of the line explaining a plugin result.
+var statusLabels = map[plugins.Status]string{
+	plugins.StatusNotFound:      "Not found",
+	plugins.StatusNotApplicable: "Not applicable",
+	plugins.StatusPartial:       "Partial",
+	plugins.StatusError:         "Error",
+	plugins.StatusCancelled:     "Cancelled",
+}
+
+func (t *textWriter) WriteRecords(src Source, records []*plugins.Record) error {
+	if t.sections > 0 {
+		if _, err := io.WriteString(t.w, "\n"); err != nil {
+			return err
+		}
+	}
+	t.sections++
+	if err := plugins.RenderTextIn(t.w, src.Title, src.Zone, records); err != nil {
+		return err
+	}
+	if src.Err != nil {
+		status := plugins.StatusOf(src.Err)
+		if status == plugins.StatusCancelled {
+			status = plugins.StatusError
+		}
+		if t.byStatus == nil {
+			t.byStatus = make(map[plugins.Status][]string)
+		}
+		t.byStatus[status] = append(t.byStatus[status], src.Plugin)
+		if _, err := fmt.Fprintf(t.w, "%s: %v\n", statusLabels[status], src.Err); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *textWriter) Close() error {
+	if t.sections < 2 {
+		return nil
+	}
+	failed := t.byStatus[plugins.StatusError]
+	summary := fmt.Sprintf("\nSummary: %d plugins run, %d failed", t.sections, len(failed))
+	if len(failed) > 0 {
+		summary += " (" + strings.Join(failed, ", ") + ")"
+	}
+	for _, status := range []plugins.Status{plugins.StatusPartial, plugins.StatusNotFound, plugins.StatusNotApplicable} {
+		if names := t.byStatus[status]; len(names) > 0 {
+			summary += fmt.Sprintf(", %d %s (%s)", len(names), strings.ToLower(statusLabels[status]), strings.Join(names, ", "))
+		}
+	}
+	_, err := io.WriteString(t.w, summary+"\n")
+	return err
+}
+
+// formatTimestamp renders a timestamp as ISO 8601 with 100 ns precision
+// in zone, UTC when zone is nil.
+func formatTimestamp(t time.Time, zone *time.Location) string {
+	if t.IsZero() {
+		return ""
+	}
+	return plugins.FormatTimeIn(t, zone)
+}
+
+// fieldValue converts a field value into its machine-readable form:
+// timestamps become ISO 8601 strings and byte slices become hex.
+func fieldValue(f plugins.Field, zone *time.Location) any {
+	switch v := f.Value.(type) {
+	case time.Time:
+		return formatTimestamp(v, zone)
+	case []byte:
+		return hex.EncodeToString(v)
+	case nil:
+		return ""
+	default:
+		return v
+	}
+}
+
+// fieldString converts a field value into a single cell of text.
+func fieldString(f plugins.Field, zone *time.Location) string {
+	switch v := fieldValue(f, zone).(type) {
+	case string:
+		return v
+	case []string:
+		return strings.Join(v, "|")
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
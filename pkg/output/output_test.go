@@ -0,0 +1,438 @@
+package output
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/plugins"
+)
+
+var testSource = Source{
+	HivePath:   "evidence/SYSTEM",
+	HiveSHA256: "abc123",
+	Plugin:     "bam",
+	Title:      "BAM",
+}
+
+func testRecords() []*plugins.Record {
+	ts := time.Date(2024, 5, 6, 7, 8, 9, 123456700, time.UTC)
+	return []*plugins.Record{
+		(&plugins.Record{KeyPath: `ControlSet001\Services\bam`, LastWrite: ts}).
+			AddString("Executable", "C:\\Windows\\cmd.exe\tx").
+			AddTime("Timestamp", ts).
+			AddInt("Count", 3).
+			WithTags("execution"),
+		{KeyPath: `Empty`},
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, name := range Formats() {
+		if _, err := ParseFormat(name); err != nil {
+			t.Errorf("ParseFormat(%q) failed: %v", name, err)
+		}
+	}
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func TestJSONLWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := NewWriter(&buf, FormatJSONL)
+	if err := w.WriteRecords(testSource, testRecords()); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d", len(lines))
+	}
+
+	var row map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &row); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]any{
+		"schema_version": float64(SchemaVersion),
+		"hive_path":      "evidence/SYSTEM",
+		"hive_sha256":    "abc123",
+		"plugin":         "bam",
+		"key_path":       `ControlSet001\Services\bam`,
+		"last_write":     "2024-05-06T07:08:09.1234567Z",
+	} {
+		if row[key] != want {
+			t.Errorf("%s: expected %v, got %v", key, want, row[key])
+		}
+	}
+	fields := row["fields"].(map[string]any)
+	if fields["Count"] != float64(3) {
+		t.Errorf("expected numeric Count, got %v", fields["Count"])
+	}
+}
+
+func TestJSONWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := NewWriter(&buf, FormatJSON)
+	_ = w.WriteRecords(testSource, testRecords())
+	_ = w.WriteRecords(testSource, testRecords())
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var doc struct {
+		SchemaVersion int              `json:"schema_version"`
+		Records       []map[string]any `json:"records"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON document: %v\n%s", err, buf.String())
+	}
+	if doc.SchemaVersion != SchemaVersion || len(doc.Records) != 4 {
+		t.Errorf("unexpected document: version %d, %d records", doc.SchemaVersion, len(doc.Records))
+	}
+
+	// An empty run must still produce a valid document.
+	buf.Reset()
+	w, _ = NewWriter(&buf, FormatJSON)
+	_ = w.Close()
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Errorf("empty document is invalid: %v", err)
+	}
+}
+
+func TestCSVWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := NewWriter(&buf, FormatCSV)
+	_ = w.WriteRecords(testSource, testRecords())
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Header, three fields of the first record, one row for the empty one.
+	if len(rows) != 5 {
+		t.Fatalf("expected 5 rows, got %d", len(rows))
+	}
+	if strings.Join(rows[0], ",") != strings.Join(delimitedHeader, ",") {
+		t.Errorf("unexpected header %v", rows[0])
+	}
+	if rows[2][9] != "Timestamp" || rows[2][11] != "2024-05-06T07:08:09.1234567Z" {
+		t.Errorf("unexpected timestamp row %v", rows[2])
+	}
+	if rows[4][4] != "2" {
+		t.Errorf("expected second record number, got %v", rows[4])
+	}
+}
+
+func TestTSVWriterEscapes(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := NewWriter(&buf, FormatTSV)
+	_ = w.WriteRecords(testSource, testRecords())
+	_ = w.Close()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	cells := strings.Split(lines[1], "\t")
+	if len(cells) != len(delimitedHeader) {
+		t.Fatalf("expected %d cells, got %d: %q", len(delimitedHeader), len(cells), lines[1])
+	}
+	if cells[11] != `C:\\Windows\\cmd.exe\tx` {
+		t.Errorf("value not escaped: %q", cells[11])
+	}
+}
+
+func TestBodyfileWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := NewWriter(&buf, FormatBodyfile)
+	_ = w.WriteRecords(testSource, testRecords())
+	_ = w.Close()
+
+	// One LastWrite event and one Timestamp event; the empty record has none.
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d:\n%s", len(lines), buf.String())
+	}
+	cols := strings.Split(lines[0], "|")
+	if len(cols) != 11 {
+		t.Fatalf("expected 11 columns, got %d: %q", len(cols), lines[0])
+	}
+	if cols[8] != "1714979289.1234567" {
+		t.Errorf("unexpected mtime %q", cols[8])
+	}
+	if !strings.HasPrefix(cols[1], "[REG] bam ") {
+		t.Errorf("unexpected name %q", cols[1])
+	}
+}
+
+func TestTLNWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := NewWriter(&buf, FormatTLN)
+	_ = w.WriteRecords(testSource, testRecords())
+	_ = w.Close()
+
+	line := strings.Split(buf.String(), "\n")[0]
+	cols := strings.Split(line, "|")
+	if len(cols) != 5 || cols[0] != "1714979289" || cols[1] != "REG" {
+		t.Fatalf("unexpected TLN line %q", line)
+	}
+	if !strings.HasSuffix(cols[4], "(2024-05-06T07:08:09.1234567Z)") {
+		t.Errorf("description lacks full-precision time: %q", cols[4])
+	}
+}
+
+func TestEventsDedupeLastWrite(t *testing.T) {
+	ts := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	records := []*plugins.Record{
+		(&plugins.Record{KeyPath: `Run`, LastWrite: ts}).AddString("Name", "a"),
+		(&plugins.Record{KeyPath: `Run`, LastWrite: ts}).AddString("Name", "b"),
+	}
+	events := Events(testSource, records)
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events))
+	}
+	if events[0].Description != `Run (2 entries)` {
+		t.Errorf("unexpected description %q", events[0].Description)
+	}
+}
+
+func TestL2TCSVWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := NewWriter(&buf, FormatL2TCSV)
+	_ = w.WriteRecords(testSource, testRecords())
+	_ = w.Close()
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || len(rows[1]) != len(l2tHeader) {
+		t.Fatalf("unexpected rows %v", rows)
+	}
+	row := rows[1]
+	if row[0] != "05/06/2024" || row[1] != "07:08:09" || row[2] != "UTC" || row[3] != "M..." {
+		t.Errorf("unexpected date columns %v", row[:4])
+	}
+	if row[12] != "evidence/SYSTEM" || row[15] != "hivedigger/bam" {
+		t.Errorf("unexpected filename/format %q %q", row[12], row[15])
+	}
+}
+
+func TestTimesketchWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := NewWriter(&buf, FormatTimesketch)
+	_ = w.WriteRecords(testSource, testRecords())
+	_ = w.Close()
+
+	var event map[string]any
+	line := strings.Split(buf.String(), "\n")[0]
+	if err := json.Unmarshal([]byte(line), &event); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]any{
+		"datetime":       "2024-05-06T07:08:09.1234567Z",
+		"timestamp":      float64(1714979289123456),
+		"timestamp_desc": TimestampLastWrite,
+		"data_type":      "windows:registry:bam",
+		"executable":     "C:\\Windows\\cmd.exe\tx",
+		"count":          float64(3),
+	} {
+		if event[key] != want {
+			t.Errorf("%s: expected %v, got %v", key, want, event[key])
+		}
+	}
+	if !strings.HasPrefix(event["message"].(string), "[bam] ") {
+		t.Errorf("unexpected message %v", event["message"])
+	}
+}
+
+func TestWritersReportPluginErrors(t *testing.T) {
+	failed := testSource
+	failed.Plugin = "shimcache"
+	failed.Title = "ShimCache"
+	failed.Err = errors.New("AppCompatCache key not found")
+
+	var buf bytes.Buffer
+	w, _ := NewWriter(&buf, FormatJSON)
+	_ = w.WriteRecords(testSource, testRecords())
+	_ = w.WriteRecords(failed, nil)
+	_ = w.Close()
+
+	var doc struct {
+		Records []map[string]any `json:"records"`
+		Errors  []map[string]any `json:"errors"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON document: %v", err)
+	}
+	if len(doc.Records) != 2 || len(doc.Errors) != 1 || doc.Errors[0]["plugin"] != "shimcache" {
+		t.Errorf("unexpected document %+v", doc)
+	}
+
+	buf.Reset()
+	w, _ = NewWriter(&buf, FormatText)
+	_ = w.WriteRecords(testSource, testRecords())
+	_ = w.WriteRecords(failed, nil)
+	_ = w.Close()
+	text := buf.String()
+	if !strings.Contains(text, "Error: AppCompatCache key not found") ||
+		!strings.Contains(text, "Summary: 2 plugins run, 1 failed (shimcache)") {
+		t.Errorf("text report lacks error or summary:\n%s", text)
+	}
+}
+
+func TestWritersReportPluginStatus(t *testing.T) {
+	missing := testSource
+	missing.Plugin = "run"
+	missing.Err = fmt.Errorf("%w: no Run keys", plugins.ErrNotFound)
+	broken := testSource
+	broken.Plugin = "services"
+	broken.Err = fmt.Errorf("%w: %w", plugins.ErrPartial, errors.New("bad value"))
+
+	var buf bytes.Buffer
+	w, _ := NewWriter(&buf, FormatText)
+	_ = w.WriteRecords(missing, nil)
+	_ = w.WriteRecords(broken, testRecords())
+	_ = w.Close()
+	text := buf.String()
+	for _, want := range []string{
+		"Not found: artifact not found: no Run keys",
+		"Partial: partial results: bad value",
+		"Summary: 2 plugins run, 0 failed, 1 partial (services), 1 not found (run)",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text report lacks %q:\n%s", want, text)
+		}
+	}
+
+	buf.Reset()
+	w, _ = NewWriter(&buf, FormatJSONL)
+	_ = w.WriteRecords(missing, nil)
+	_ = w.Close()
+	if !strings.Contains(buf.String(), `"status":"not-found"`) {
+		t.Errorf("JSON Lines row lacks status: %s", buf.String())
+	}
+
+	buf.Reset()
+	w, _ = NewWriter(&buf, FormatCSV)
+	_ = w.WriteRecords(missing, nil)
+	_ = w.Close()
+	if !strings.Contains(buf.String(), ",error,not-found,") {
+		t.Errorf("CSV error row lacks status: %s", buf.String())
+	}
+}
+
+func TestWritersUseZone(t *testing.T) {
+	src := testSource
+	src.Zone = time.FixedZone("UTC+02:00", 2*3600)
+
+	var buf bytes.Buffer
+	w, _ := NewWriter(&buf, FormatJSON)
+	_ = w.WriteRecords(src, testRecords())
+	_ = w.Close()
+	var doc struct {
+		TimeZone string           `json:"time_zone"`
+		Records  []map[string]any `json:"records"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON document: %v", err)
+	}
+	if doc.TimeZone != "UTC+02:00" || doc.Records[0]["last_write"] != "2024-05-06T09:08:09.1234567+02:00" {
+		t.Errorf("unexpected zone or last_write: %s %v", doc.TimeZone, doc.Records[0]["last_write"])
+	}
+
+	buf.Reset()
+	w, _ = NewWriter(&buf, FormatText)
+	_ = w.WriteRecords(src, testRecords())
+	_ = w.Close()
+	if !strings.Contains(buf.String(), "Times: UTC+02:00\n") ||
+		!strings.Contains(buf.String(), "Timestamp: 2024-05-06T09:08:09.1234567+02:00") {
+		t.Errorf("text report ignores the zone:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	w, _ = NewWriter(&buf, FormatTimesketch)
+	_ = w.WriteRecords(src, testRecords())
+	_ = w.Close()
+	if !strings.Contains(buf.String(), `"datetime":"2024-05-06T07:08:09.1234567Z"`) {
+		t.Errorf("timelines must stay in UTC: %s", buf.String())
+	}
+}
+
+func TestWritersMarkSensitiveFields(t *testing.T) {
+	records := []*plugins.Record{plugins.NewRecord(`SAM\Domains\Account\Users\000001F4`, nil).
+		AddString("Username", "Administrator").
+		AddSecret("NT Hash", "31d6cfe0d16ae931b73c59d7e0c089c0")}
+
+	var buf bytes.Buffer
+	w, _ := NewWriter(&buf, FormatJSONL)
+	_ = w.WriteRecords(testSource, records)
+	var row jsonRow
+	if err := json.Unmarshal(buf.Bytes(), &row); err != nil {
+		t.Fatal(err)
+	}
+	if len(row.SensitiveFields) != 1 || row.SensitiveFields[0] != "NT Hash" || row.Tags[0] != "sensitive" {
+		t.Errorf("unexpected sensitive fields %v and tags %v", row.SensitiveFields, row.Tags)
+	}
+
+	buf.Reset()
+	w, _ = NewWriter(&buf, FormatText)
+	_ = w.WriteRecords(testSource, records)
+	_ = w.Close()
+	if !strings.Contains(buf.String(), "NT Hash: 31d6cfe0d16ae931b73c59d7e0c089c0  [SENSITIVE]") ||
+		strings.Contains(buf.String(), "Administrator  [SENSITIVE]") {
+		t.Errorf("text report should flag only the hash:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	w, _ = NewWriter(&buf, FormatCSV)
+	_ = w.WriteRecords(testSource, records)
+	_ = w.Close()
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[1][12] != "false" || rows[2][9] != "NT Hash" || rows[2][12] != "true" {
+		t.Errorf("unexpected sensitive column %v", rows)
+	}
+}
+
+func TestTimelinesRedactSensitiveFields(t *testing.T) {
+	ts := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	records := []*plugins.Record{(&plugins.Record{KeyPath: `SAM\Domains\Account\Users\000001F4`, LastWrite: ts}).
+		AddString("Username", "Administrator").
+		AddSecret("NT Hash", "31d6cfe0d16ae931b73c59d7e0c089c0")}
+
+	for _, format := range []Format{FormatBodyfile, FormatTLN, FormatL2TCSV, FormatTimesketch} {
+		var buf bytes.Buffer
+		w, _ := NewWriter(&buf, format)
+		_ = w.WriteRecords(testSource, records)
+		_ = w.Close()
+		out := buf.String()
+		if strings.Contains(out, "31d6cfe0") || !strings.Contains(out, "Administrator") ||
+			!strings.Contains(out, redacted) {
+			t.Errorf("%s: hash not redacted:\n%s", format, out)
+		}
+	}
+
+	var buf bytes.Buffer
+	w, _ := NewWriter(&buf, FormatTimesketch)
+	_ = w.WriteRecords(testSource, records)
+	var event map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &event); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(event["sensitive_fields"]) != "[nt_hash]" || event["nt_hash"] != redacted {
+		t.Errorf("unexpected sensitive attributes %v", event)
+	}
+}
@@ -0,0 +1,172 @@
+package output
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strings"
+	"unicode"
+
+	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/plugins"
+)
+
+const (
+	FormatL2TCSV     Format = "l2tcsv"
+	FormatTimesketch Format = "timesketch"
+)
+
+// l2tHeader is the column layout of the Plaso/log2timeline l2tcsv format.
+var l2tHeader = []string{
+	"date", "time", "timezone", "MACB", "source", "sourcetype", "type",
+	"user", "host", "short", "desc", "version", "filename", "inode",
+	"notes", "format", "extra",
+}
+
+// l2tCSVWriter writes timeline events in the l2tcsv layout. Every event
+// is a modification of a registry artifact, so MACB is always "M...".
+type l2tCSVWriter struct {
+	w       *csv.Writer
+	started bool
+}
+
+func newL2TCSVWriter(w io.Writer) *l2tCSVWriter {
+	return &l2tCSVWriter{w: csv.NewWriter(w)}
+}
+
+func (l *l2tCSVWriter) header() error {
+	if l.started {
+		return nil
+	}
+	l.started = true
+	return l.w.Write(l2tHeader)
+}
+
+func (l *l2tCSVWriter) WriteRecords(src Source, records []*plugins.Record) error {
+	if err := l.header(); err != nil {
+		return err
+	}
+	for _, e := range Events(src, records) {
+		t := e.Time.UTC()
+		short := e.KeyPath
+		if short == "" {
+			short = e.Description
+		}
+		extra := "sha256: " + src.HiveSHA256
+		if summary := summarize(e.Record); summary != "" {
+			extra = summary + "; " + extra
+		}
+		row := []string{
+			t.Format("01/02/2006"),
+			t.Format("15:04:05"),
+			"UTC",
+			"M...",
+			timelineSource,
+			"Registry Key : " + e.Plugin,
+			e.TimestampDesc,
+			"-",
+			"-",
+			short,
+			e.Description + " (" + filetimePrecision(e.Time) + ")",
+			"2",
+			src.HivePath,
+			"-",
+			"-",
+			"hivedigger/" + e.Plugin,
+			extra,
+		}
+		if err := l.w.Write(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *l2tCSVWriter) Close() error {
+	if err := l.header(); err != nil {
+		return err
+	}
+	l.w.Flush()
+	return l.w.Error()
+}
+
+// timesketchReserved are the attribute names owned by the Timesketch event
+// schema. Artifact fields with the same name are prefixed with "field_".
+var timesketchReserved = map[string]bool{
+	"message": true, "datetime": true, "timestamp": true, "timestamp_desc": true,
+	"data_type": true, "plugin": true, "key_path": true, "hive_path": true,
+	"hive_sha256": true, "severity": true, "tag": true, "sensitive_fields": true,
+}
+
+// timesketchWriter writes one Timesketch-importable JSON object per event.
+// Besides the required message, datetime and timestamp_desc attributes,
+// each event carries the artifact fields of its record under snake_case
+// names. Sensitive fields are redacted and listed in sensitive_fields.
+type timesketchWriter struct {
+	w io.Writer
+}
+
+func (t *timesketchWriter) WriteRecords(src Source, records []*plugins.Record) error {
+	enc := json.NewEncoder(t.w)
+	for _, e := range Events(src, records) {
+		event := map[string]any{
+			"message":        "[" + e.Plugin + "] " + e.Description,
+			"datetime":       filetimePrecision(e.Time),
+			"timestamp":      e.Time.UnixMicro(),
+			"timestamp_desc": e.TimestampDesc,
+			"data_type":      "windows:registry:" + e.Plugin,
+			"plugin":         e.Plugin,
+			"key_path":       e.KeyPath,
+			"hive_path":      src.HivePath,
+			"hive_sha256":    src.HiveSHA256,
+			"severity":       e.Record.Severity.String(),
+		}
+		if len(e.Record.Tags) > 0 {
+			event["tag"] = e.Record.Tags
+		}
+		var sensitive []string
+		for _, f := range e.Record.Fields {
+			name := attributeName(f.Name)
+			if timesketchReserved[name] {
+				name = "field_" + name
+			}
+			if f.Sensitive {
+				event[name] = redacted
+				sensitive = append(sensitive, name)
+				continue
+			}
+			event[name] = fieldValue(f, nil)
+		}
+		if len(sensitive) > 0 {
+			event["sensitive_fields"] = sensitive
+		}
+		if err := enc.Encode(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *timesketchWriter) Close() error {
+	return nil
+}
+
+// attributeName turns a display name such as "Last Run" into "last_run".
+func attributeName(name string) string {
+	var b strings.Builder
+	underscore := false
+	for _, r := range name {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if underscore && b.Len() > 0 {
+				b.WriteByte('_')
+			}
+			underscore = false
+			b.WriteRune(unicode.ToLower(r))
+			continue
+		}
+		underscore = true
+	}
+	if b.Len() == 0 {
+		return "value"
+	}
+	return b.String()
+}
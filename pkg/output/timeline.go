@@ -0,0 +1,198 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/plugins"
+)
+
+const (
+	FormatBodyfile Format = "bodyfile"
+	FormatTLN      Format = "tln"
+)
+
+// TimestampLastWrite is the timestamp description of key LastWrite events.
+const TimestampLastWrite = "Last Write"
+
+// timelineSource is the source tag of TLN lines and bodyfile names.
+const timelineSource = "REG"
+
+// Event is a single point on a timeline, derived either from the LastWrite
+// time of a record's key or from one of its time fields.
+type Event struct {
+	Time          time.Time
+	Plugin        string
+	HivePath      string
+	KeyPath       string
+	TimestampDesc string
+	Description   string
+	Record        *plugins.Record
+}
+
+// Events turns records into timeline events. Records sharing a key produce
+// a single LastWrite event for it; every non-zero time field produces an
+// event of its own. Events are sorted by time.
+func Events(src Source, records []*plugins.Record) []Event {
+	var events []Event
+
+	byKey := make(map[string][]*plugins.Record)
+	var keyOrder []string
+	for _, r := range records {
+		if r.KeyPath == "" || r.LastWrite.IsZero() {
+			continue
+		}
+		id := r.KeyPath + "\x00" + r.LastWrite.String()
+		if _, ok := byKey[id]; !ok {
+			keyOrder = append(keyOrder, id)
+		}
+		byKey[id] = append(byKey[id], r)
+	}
+
+	for _, id := range keyOrder {
+		group := byKey[id]
+		r := group[0]
+		desc := r.KeyPath
+		if len(group) == 1 {
+			if summary := summarize(r); summary != "" {
+				desc += " - " + summary
+			}
+		} else {
+			desc += fmt.Sprintf(" (%d entries)", len(group))
+		}
+		events = append(events, Event{
+			Time:          r.LastWrite,
+			Plugin:        src.Plugin,
+			HivePath:      src.HivePath,
+			KeyPath:       r.KeyPath,
+			TimestampDesc: TimestampLastWrite,
+			Description:   desc,
+			Record:        r,
+		})
+	}
+
+	for _, r := range records {
+		for _, f := range r.Fields {
+			t, ok := f.Value.(time.Time)
+			if !ok || t.IsZero() {
+				continue
+			}
+			desc := f.Name
+			if summary := summarize(r); summary != "" {
+				desc += " - " + summary
+			}
+			if r.KeyPath != "" {
+				desc += " [" + r.KeyPath + "]"
+			}
+			events = append(events, Event{
+				Time:          t,
+				Plugin:        src.Plugin,
+				HivePath:      src.HivePath,
+				KeyPath:       r.KeyPath,
+				TimestampDesc: f.Name,
+				Description:   desc,
+				Record:        r,
+			})
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Time.Before(events[j].Time)
+	})
+	return events
+}
+
+// redacted replaces the value of sensitive fields in timeline events,
+// which are meant to be shared and merged with other sources.
+const redacted = "[REDACTED]"
+
+// summarize joins the non-time fields of a record into a single line.
+// Sensitive fields keep their name but not their value.
+func summarize(r *plugins.Record) string {
+	var parts []string
+	for _, f := range r.Fields {
+		if f.Type == plugins.FieldTime || f.Type == plugins.FieldBytes {
+			continue
+		}
+		value := fieldString(f, nil)
+		if value == "" {
+			continue
+		}
+		if f.Sensitive {
+			value = redacted
+		}
+		parts = append(parts, f.Name+": "+value)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// timelineEscaper keeps events on one line and out of the | separators.
+var timelineEscaper = strings.NewReplacer("|", "%7C", "\r", " ", "\n", " ")
+
+// epochSeconds formats t as Unix seconds with seven fractional digits, the
+// full precision of a FILETIME.
+func epochSeconds(t time.Time) string {
+	t = t.UTC()
+	return fmt.Sprintf("%d.%07d", t.Unix(), t.Nanosecond()/100)
+}
+
+// filetimePrecision formats t as UTC ISO 8601 with 100 ns precision.
+func filetimePrecision(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.0000000Z")
+}
+
+// bodyfileWriter writes Sleuthkit bodyfile (mactime) lines. Each event
+// sets the mtime column; the other time columns are left at 0.
+type bodyfileWriter struct {
+	w io.Writer
+}
+
+func (b *bodyfileWriter) WriteRecords(src Source, records []*plugins.Record) error {
+	for _, e := range Events(src, records) {
+		name := fmt.Sprintf("[%s] %s %s: %s", timelineSource, e.Plugin, e.TimestampDesc, e.Description)
+		line := fmt.Sprintf("0|%s|0|0|0|0|0|0|%s|0|0\n", timelineEscaper.Replace(name), epochSeconds(e.Time))
+		if _, err := io.WriteString(b.w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *bodyfileWriter) Close() error {
+	return nil
+}
+
+// tlnWriter writes RegRipper-style TLN lines: Time|Source|System|User|Description.
+// TLN times are whole Unix seconds, so the description ends with the
+// full-precision UTC timestamp. The System and User columns are left empty.
+type tlnWriter struct {
+	w io.Writer
+}
+
+func (t *tlnWriter) WriteRecords(src Source, records []*plugins.Record) error {
+	for _, e := range Events(src, records) {
+		desc := fmt.Sprintf("%s %s: %s (%s)", e.Plugin, e.TimestampDesc, e.Description, filetimePrecision(e.Time))
+		line := fmt.Sprintf("%d|%s|||%s\n", e.Time.UTC().Unix(), timelineSource, timelineEscaper.Replace(desc))
+		if _, err := io.WriteString(t.w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *tlnWriter) Close() error {
+	return nil
+}
+
+// IsTimeline reports whether the format is a timeline format, which only
+// carries timestamped records.
+func IsTimeline(f Format) bool {
+	switch f {
+	case FormatBodyfile, FormatTLN, FormatL2TCSV, FormatTimesketch:
+		return true
+	}
+	return false
+}
@@ -1,8 +1,6 @@
 package plugins
 
 import (
-	"fmt"
-
 	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
 )
 
@@ -25,23 +23,37 @@ func (p *ActiveSetupPlugin) CompatibleHiveTypes() []string {
 	return []string{"SOFTWARE"}
 }
 
+func (p *ActiveSetupPlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategoryPersistence,
+		Techniques: []string{"T1547.014"},
+		Artifact:   "Active Setup components run their StubPath once per user at logon, which attackers abuse for persistence.",
+		References: []string{regRipperReference},
+		Version:    "1.0.0",
+		Schema: []FieldSpec{
+			{Name: "Component", Type: FieldString, Description: "component GUID or name"},
+			{Name: "StubPath", Type: FieldString, Description: "command run at logon"},
+		},
+	}
+}
+
 func (p *ActiveSetupPlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
+
+func (p *ActiveSetupPlugin) Collect(hive *regf.Hive, emit Emitter) error {
 	paths := []string{
 		"Microsoft\\Active Setup\\Installed Components",
 		"Wow6432Node\\Microsoft\\Active Setup\\Installed Components",
 	}
 
-	fmt.Println("Active Setup Components")
-	fmt.Println("=======================")
-	fmt.Println()
-
+	found := false
 	for _, path := range paths {
 		key, err := hive.GetKey(path)
 		if err != nil {
 			continue
 		}
-
-		fmt.Printf("[%s]\n", path)
+		found = true
 
 		for _, component := range key.Subkeys() {
 			stubPath := ""
@@ -53,13 +65,16 @@ func (p *ActiveSetupPlugin) Run(hive *regf.Hive) error {
 			}
 
 			if stubPath != "" {
-				fmt.Printf("  %s\n", component.Name())
-				fmt.Printf("    StubPath: %s\n", stubPath)
-				fmt.Printf("    Last Modified: %s\n", component.Timestamp().Format("2006-01-02 15:04:05"))
+				emit(NewRecord(joinKeyPath(path, component.Name()), component).
+					AddString("Component", component.Name()).
+					AddString("StubPath", stubPath).
+					WithTags("persistence"))
 			}
 		}
-		fmt.Println()
 	}
 
+	if !found {
+		return notFound("no Active Setup keys")
+	}
 	return nil
 }
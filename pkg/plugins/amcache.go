@@ -1,8 +1,13 @@
 package plugins
 
 import (
-	"fmt"
+	"context"
+	"encoding/binary"
+	"path"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
 )
@@ -11,7 +16,200 @@ func init() {
 	Register(&AmCachePlugin{})
 }
 
-// AmCachePlugin displays AmCache entries showing program execution artifacts.
+var amcacheLimitOption = Option{
+	Name:        "limit",
+	Type:        OptionInt,
+	Default:     "0",
+	Description: "Maximum number of entries to list after sorting (0 for no limit)",
+	Validate:    validateLimit,
+}
+
+var amcacheSortOption = Option{
+	Name:    "sort",
+	Type:    OptionString,
+	Default: "key",
+	Description: "Order of the entries: key (inventory, then registry order), lastwrite and linkdate " +
+		"(newest first), name, path or sha1",
+	Choices: []string{"key", "lastwrite", "linkdate", "name", "path", "sha1"},
+}
+
+// Artifact types of AmCache records, reported in the Artifact field.
+const (
+	AmcacheFile          = "Application File"
+	AmcacheApplication   = "Application"
+	AmcacheShortcut      = "Shortcut"
+	AmcacheDriverBinary  = "Driver Binary"
+	AmcacheDriverPackage = "Driver Package"
+	AmcacheDevice        = "PnP Device"
+	AmcacheLegacyFile    = "File (legacy)"
+	AmcacheLegacyProgram = "Program (legacy)"
+)
+
+// amcacheField maps an AmCache value to a record field.
+type amcacheField struct {
+	value  string
+	field  string
+	decode string
+}
+
+// Decoders of amcacheField besides the declarative ones.
+const (
+	amcacheSHA1 = "sha1" // FileId: "0000" followed by the SHA-1
+	amcacheDate = "date" // text date such as 05/14/2021 10:11:12
+	amcacheUnix = "unix" // DWORD seconds since 1970, as PE link dates
+	amcacheBool = "bool" // DWORD or text 0/1
+)
+
+// amcacheSection describes an inventory key whose subkeys are entries.
+type amcacheSection struct {
+	path     string
+	artifact string
+	// keyField, when set, names the field holding the entry key name.
+	keyField string
+	fields   []amcacheField
+}
+
+// amcacheSections lists the inventory keys of Windows 10 and later, and
+// the Root\Programs key of Windows 8. Root\File has an extra volume level
+// and is read by collectLegacyFiles.
+var amcacheSections = []amcacheSection{
+	{
+		path: `Root\InventoryApplicationFile`, artifact: AmcacheFile,
+		fields: []amcacheField{
+			{"Name", "Name", DecodeString},
+			{"LowerCaseLongPath", "Path", DecodeString},
+			{"FileId", "SHA1", amcacheSHA1},
+			{"Size", "Size", DecodeAuto},
+			{"Version", "Version", DecodeString},
+			{"ProductName", "Product", DecodeString},
+			{"ProductVersion", "Product Version", DecodeString},
+			{"Publisher", "Publisher", DecodeString},
+			{"OriginalFileName", "Original Name", DecodeString},
+			{"BinaryType", "Binary Type", DecodeString},
+			{"LinkDate", "Link Date", amcacheDate},
+			{"IsOsComponent", "OS Component", amcacheBool},
+			{"AppxPackageFullName", "Package", DecodeString},
+			{"Usn", "USN", DecodeAuto},
+			{"ProgramId", "Program ID", DecodeString},
+		},
+	},
+	{
+		path: `Root\InventoryApplication`, artifact: AmcacheApplication, keyField: "Program ID",
+		fields: []amcacheField{
+			{"Name", "Name", DecodeString},
+			{"Version", "Version", DecodeString},
+			{"Publisher", "Publisher", DecodeString},
+			{"InstallDate", "Install Date", amcacheDate},
+			{"Source", "Source", DecodeString},
+			{"Type", "Type", DecodeString},
+			{"RootDirPath", "Path", DecodeString},
+			{"UninstallString", "Uninstall", DecodeString},
+			{"RegistryKeyPath", "Registry Key", DecodeString},
+			{"MsiProductCode", "MSI Product Code", DecodeString},
+			{"PackageFullName", "Package", DecodeString},
+			{"ManifestPath", "Manifest", DecodeString},
+			{"OSVersionAtInstallTime", "OS Version At Install", DecodeString},
+		},
+	},
+	{
+		path: `Root\InventoryApplicationShortcut`, artifact: AmcacheShortcut,
+		fields: []amcacheField{
+			{"ShortcutPath", "Path", DecodeString},
+			{"ShortcutTargetPath", "Target", DecodeString},
+			{"ShortcutAumid", "AUMID", DecodeString},
+			{"ShortcutProgramId", "Program ID", DecodeString},
+		},
+	},
+	{
+		path: `Root\InventoryDriverBinary`, artifact: AmcacheDriverBinary, keyField: "Path",
+		fields: []amcacheField{
+			{"DriverName", "Name", DecodeString},
+			{"DriverId", "SHA1", amcacheSHA1},
+			{"DriverVersion", "Version", DecodeString},
+			{"DriverCompany", "Publisher", DecodeString},
+			{"Product", "Product", DecodeString},
+			{"ProductVersion", "Product Version", DecodeString},
+			{"Service", "Service", DecodeString},
+			{"Inf", "Inf", DecodeString},
+			{"DriverTimeStamp", "Link Date", amcacheUnix},
+			{"DriverLastWriteTime", "Last Modified", amcacheDate},
+			{"ImageSize", "Size", DecodeAuto},
+			{"DriverSigned", "Signed", amcacheBool},
+			{"DriverIsKernelMode", "Kernel Mode", amcacheBool},
+			{"DriverInBox", "In Box", amcacheBool},
+			{"DriverPackageStrongName", "Driver Package", DecodeString},
+		},
+	},
+	{
+		path: `Root\InventoryDriverPackage`, artifact: AmcacheDriverPackage, keyField: "Driver Package",
+		fields: []amcacheField{
+			{"Inf", "Inf", DecodeString},
+			{"Provider", "Publisher", DecodeString},
+			{"Version", "Version", DecodeString},
+			{"Date", "Date", amcacheDate},
+			{"Class", "Class", DecodeString},
+			{"ClassGuid", "Class GUID", DecodeString},
+			{"Directory", "Path", DecodeString},
+			{"SubmissionId", "Submission ID", DecodeString},
+			{"DriverInBox", "In Box", amcacheBool},
+			{"Hwids", "Hardware IDs", DecodeString},
+		},
+	},
+	{
+		path: `Root\InventoryDevicePnp`, artifact: AmcacheDevice, keyField: "Device ID",
+		fields: []amcacheField{
+			{"Description", "Name", DecodeString},
+			{"Model", "Model", DecodeString},
+			{"Manufacturer", "Publisher", DecodeString},
+			{"Class", "Class", DecodeString},
+			{"ClassGuid", "Class GUID", DecodeString},
+			{"HWID", "Hardware IDs", DecodeString},
+			{"Service", "Service", DecodeString},
+			{"Enumerator", "Enumerator", DecodeString},
+			{"ParentId", "Parent ID", DecodeString},
+			{"ContainerId", "Container ID", DecodeString},
+			{"Inf", "Inf", DecodeString},
+			{"DriverName", "Driver Name", DecodeString},
+			{"DriverVerVersion", "Driver Version", DecodeString},
+			{"DriverVerDate", "Driver Date", amcacheDate},
+			{"DriverPackageStrongName", "Driver Package", DecodeString},
+			{"InstallState", "Install State", DecodeDWORD},
+		},
+	},
+	{
+		path: `Root\Programs`, artifact: AmcacheLegacyProgram, keyField: "Program ID",
+		fields: []amcacheField{
+			{"0", "Name", DecodeString},
+			{"1", "Version", DecodeString},
+			{"2", "Publisher", DecodeString},
+			{"3", "Language", DecodeDWORD},
+			{"6", "Entry Type", DecodeString},
+			{"7", "Uninstall Key", DecodeString},
+			{"a", "Install Date", amcacheUnix},
+			{"d", "Files", DecodeStrings},
+		},
+	},
+}
+
+// amcacheLegacyFileFields maps the numbered values of Root\File entries.
+var amcacheLegacyFileFields = []amcacheField{
+	{"15", "Path", DecodeString},
+	{"101", "SHA1", amcacheSHA1},
+	{"6", "Size", DecodeAuto},
+	{"5", "Version", DecodeString},
+	{"0", "Product", DecodeString},
+	{"1", "Publisher", DecodeString},
+	{"c", "Description", DecodeString},
+	{"3", "Language", DecodeDWORD},
+	{"f", "Link Date", amcacheUnix},
+	{"12", "Created", DecodeFiletime},
+	{"11", "Modified", DecodeFiletime},
+	{"17", "Modified 2", DecodeFiletime},
+	{"100", "Program ID", DecodeString},
+}
+
+// AmCachePlugin displays AmCache inventory entries: files, applications,
+// shortcuts, drivers and devices, with files linked to their program.
 type AmCachePlugin struct{}
 
 func (p *AmCachePlugin) Name() string {
@@ -19,76 +217,318 @@ func (p *AmCachePlugin) Name() string {
 }
 
 func (p *AmCachePlugin) Description() string {
-	return "Display AmCache entries (program execution artifacts) from AmCache.hve"
+	return "Display AmCache inventory (files, programs, shortcuts, drivers, devices) from AmCache.hve"
 }
 
 func (p *AmCachePlugin) CompatibleHiveTypes() []string {
 	return []string{"AMCACHE.HVE", "SYSCACHE.HVE"}
 }
 
-func (p *AmCachePlugin) Run(hive *regf.Hive) error {
-	paths := []string{
-		"Root/File",
-		"Root/InventoryApplicationFile",
+func (p *AmCachePlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategoryExecution,
+		Techniques: []string{"T1204.002"},
+		Artifact: "Amcache.hve inventories executables, installed programs, shortcuts, drivers and devices with " +
+			"paths, SHA-1 hashes and PE link dates, evidence that a file was present or run.",
+		References: []string{regRipperReference},
+		Version:    "2.0.0",
+		Schema: []FieldSpec{
+			{Name: "Artifact", Type: FieldString, Description: "inventory the entry comes from"},
+			{Name: "Name", Type: FieldString, Description: "file, program, driver or device name"},
+			{Name: "Path", Type: FieldString, Description: "full path of the file or install directory"},
+			{Name: "SHA1", Type: FieldString, Description: "SHA-1 of the file, without the 0000 prefix of FileId"},
+			{Name: "Size", Type: FieldInt, Description: "file size in bytes"},
+			{Name: "Version", Type: FieldString, Description: "file, program or driver version"},
+			{Name: "Publisher", Type: FieldString, Description: "publisher, company or provider"},
+			{Name: "Link Date", Type: FieldTime, Description: "PE link (compile) time"},
+			{Name: "Install Date", Type: FieldTime, Description: "program install time"},
+			{Name: "Created", Type: FieldTime, Description: "file creation time (Root\\File)"},
+			{Name: "Modified", Type: FieldTime, Description: "file modification time (Root\\File)"},
+			{Name: "Program ID", Type: FieldString, Description: "ProgramId linking files and shortcuts to programs"},
+			{Name: "Program", Type: FieldString, Description: "name of the linked program"},
+			{Name: "Program Version", Type: FieldString, Description: "version of the linked program"},
+			{Name: "Driver Package", Type: FieldString, Description: "strong name linking drivers and devices to packages"},
+			{Name: "Package Provider", Type: FieldString, Description: "provider of the linked driver package"},
+			{Name: "*", Type: FieldString, Description: "other inventory values, named after them"},
+		},
 	}
+}
 
-	fmt.Println("AmCache Entries:")
-	fmt.Println(strings.Repeat("=", 80))
+func (p *AmCachePlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
+
+func (p *AmCachePlugin) Options() []Option {
+	return []Option{amcacheLimitOption, amcacheSortOption}
+}
+
+func (p *AmCachePlugin) Collect(hive *regf.Hive, emit Emitter) error {
+	return p.CollectContext(context.Background(), hive, DefaultOptions(p), emit)
+}
 
+func (p *AmCachePlugin) CollectContext(ctx context.Context, hive *regf.Hive, opts Options, emit Emitter) error {
+	var records []*Record
 	found := false
-	for _, path := range paths {
-		key, err := hive.GetKey(path)
+	for _, s := range amcacheSections {
+		key, err := hive.GetKey(s.path)
 		if err != nil {
 			continue
 		}
-
 		found = true
-		fmt.Printf("\n%s:\n", path)
-
-		count := 0
-		for _, subkey := range key.Subkeys() {
-			var fileName, filePath, sha1 string
-
-			for _, val := range subkey.Values() {
-				valStr := GetValueString(val)
-				switch val.Name() {
-				case "FileName", "Name":
-					fileName = valStr
-				case "FullPath", "LowerCaseLongPath", "LongPathHash":
-					filePath = valStr
-				case "FileId", "SHA1", "Sha1":
-					sha1 = valStr
-				}
+		for _, entry := range key.Subkeys() {
+			if err := ctx.Err(); err != nil {
+				return err
 			}
+			records = append(records, amcacheRecord(s.path, entry, s.artifact, s.keyField, s.fields))
+		}
+	}
+	if legacy, ok, err := collectLegacyFiles(ctx, hive); err != nil {
+		return err
+	} else if ok {
+		found = true
+		records = append(records, legacy...)
+	}
+	if !found {
+		return notFound("no Amcache inventory keys")
+	}
 
-			if fileName != "" || filePath != "" {
-				count++
-				if count <= 50 { // Limit output
-					fmt.Printf("\n  %s\n", subkey.Name())
-					if fileName != "" {
-						fmt.Printf("    File: %s\n", fileName)
-					}
-					if filePath != "" {
-						fmt.Printf("    Path: %s\n", filePath)
-					}
-					if sha1 != "" {
-						fmt.Printf("    SHA1: %s\n", sha1)
-					}
-					fmt.Printf("    Last Write: %s\n", subkey.Timestamp().Format("2006-01-02 15:04:05"))
-				}
+	linkAmcacheRecords(records)
+	sortAmcacheRecords(records, opts.String("sort"))
+	if limit := opts.Int("limit"); limit > 0 && len(records) > limit {
+		records = records[:limit]
+	}
+	for _, r := range records {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		emit(r)
+	}
+	return nil
+}
+
+// collectLegacyFiles reads Root\File, where entries are grouped by volume
+// GUID and named after the file reference of the file.
+func collectLegacyFiles(ctx context.Context, hive *regf.Hive) ([]*Record, bool, error) {
+	const filePath = `Root\File`
+	key, err := hive.GetKey(filePath)
+	if err != nil {
+		return nil, false, nil
+	}
+	var records []*Record
+	for _, volume := range key.Subkeys() {
+		volumePath := joinKeyPath(filePath, volume.Name())
+		for _, entry := range volume.Subkeys() {
+			if err := ctx.Err(); err != nil {
+				return nil, true, err
+			}
+			r := amcacheRecord(volumePath, entry, AmcacheLegacyFile, "", amcacheLegacyFileFields)
+			r.AddString("Volume", volume.Name())
+			if ref, err := strconv.ParseUint(entry.Name(), 16, 64); err == nil {
+				r.AddInt("MFT Entry", int64(ref&0xFFFFFFFFFFFF)).
+					AddInt("MFT Sequence", int64(ref>>48))
 			}
+			records = append(records, r)
+		}
+	}
+	return records, true, nil
+}
+
+// amcacheRecord builds the record of an inventory entry. The Artifact and
+// Name fields come first so records of different inventories line up.
+func amcacheRecord(parent string, entry *regf.Key, artifact, keyField string, fields []amcacheField) *Record {
+	r := NewRecord(joinKeyPath(parent, entry.Name()), entry).
+		AddString("Artifact", artifact)
+	if keyField != "" {
+		r.AddString(keyField, entry.Name())
+	}
+	for _, f := range fields {
+		v, err := getValue(entry, f.value)
+		if err != nil {
+			continue
+		}
+		field, ok := amcacheDecode(f, v)
+		if !ok {
+			continue
 		}
+		r.Fields = append(r.Fields, field)
+	}
 
-		if count > 50 {
-			fmt.Printf("\n  ... and %d more entries (showing first 50)\n", count-50)
+	if _, ok := r.Get("Name"); !ok {
+		if f, ok := r.Get("Path"); ok && FormatValue(f) != "" {
+			name := path.Base(strings.ReplaceAll(FormatValue(f), `\`, "/"))
+			r.Fields = append([]Field{r.Fields[0], {Name: "Name", Type: FieldString, Value: name}}, r.Fields[1:]...)
 		}
-		fmt.Printf("\n  Total entries: %d\n", count)
 	}
+	if artifact == AmcacheFile || artifact == AmcacheLegacyFile {
+		r.WithTags("execution")
+	}
+	return r
+}
 
-	if !found {
-		fmt.Println("No AmCache entries found")
-		fmt.Println("Note: This plugin requires AmCache.hve file")
+// amcacheDecode decodes a value as its amcacheField says. Empty strings
+// and zero dates are skipped.
+func amcacheDecode(f amcacheField, v *regf.Value) (Field, bool) {
+	switch f.decode {
+	case amcacheSHA1:
+		sha1 := normalizeSHA1(GetValueString(v))
+		return Field{Name: f.field, Type: FieldString, Value: sha1}, sha1 != ""
+	case amcacheDate:
+		t, ok := parseAmcacheDate(GetValueString(v))
+		return Field{Name: f.field, Type: FieldTime, Value: t}, ok
+	case amcacheUnix:
+		data := v.Bytes()
+		if len(data) < 4 || binary.LittleEndian.Uint32(data) == 0 {
+			return Field{}, false
+		}
+		t := time.Unix(int64(binary.LittleEndian.Uint32(data)), 0).UTC()
+		return Field{Name: f.field, Type: FieldTime, Value: t}, true
+	case amcacheBool:
+		s := GetValueString(v)
+		if data := v.Bytes(); v.Type() == regDWORD && len(data) >= 4 {
+			s = strconv.Itoa(int(binary.LittleEndian.Uint32(data)))
+		}
+		b, err := strconv.ParseBool(strings.TrimSpace(s))
+		return Field{Name: f.field, Type: FieldBool, Value: b}, err == nil
 	}
 
-	return nil
+	field, ok := ValueSpec{Field: f.field, Decode: f.decode}.field(v)
+	if s, isString := field.Value.(string); ok && isString && strings.TrimSpace(s) == "" {
+		return field, false
+	}
+	return field, ok
+}
+
+// normalizeSHA1 turns a FileId into a lower-case SHA-1. FileIds are the
+// hash prefixed with four zeros; anything that is not a hash is dropped.
+func normalizeSHA1(id string) string {
+	id = strings.ToLower(strings.TrimSpace(id))
+	if len(id) == 44 && strings.HasPrefix(id, "0000") {
+		id = id[4:]
+	}
+	if len(id) != 40 || strings.Trim(id, "0123456789abcdef") != "" {
+		return ""
+	}
+	return id
+}
+
+// amcacheDateLayouts are the text date formats of AmCache values.
+var amcacheDateLayouts = []string{
+	"01/02/2006 15:04:05",
+	"1/2/2006 15:04:05",
+	"01/02/2006",
+	"1/2/2006",
+	"01-02-2006",
+	"1-2-2006",
+	"2006-01-02 15:04:05",
+}
+
+// parseAmcacheDate parses a text date of an AmCache value, in UTC.
+func parseAmcacheDate(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	for _, layout := range amcacheDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, !t.IsZero()
+		}
+	}
+	return time.Time{}, false
+}
+
+// linkAmcacheRecords adds the name and version of the program each file
+// and shortcut belongs to, and the provider of the package of each driver
+// and device.
+func linkAmcacheRecords(records []*Record) {
+	programs := make(map[string]*Record)
+	packages := make(map[string]*Record)
+	for _, r := range records {
+		artifact, _ := r.Get("Artifact")
+		switch FormatValue(artifact) {
+		case AmcacheApplication, AmcacheLegacyProgram:
+			if id, ok := r.Get("Program ID"); ok {
+				programs[strings.ToLower(FormatValue(id))] = r
+			}
+		case AmcacheDriverPackage:
+			if name, ok := r.Get("Driver Package"); ok {
+				packages[strings.ToLower(FormatValue(name))] = r
+			}
+		}
+	}
+
+	for _, r := range records {
+		artifact, _ := r.Get("Artifact")
+		switch FormatValue(artifact) {
+		case AmcacheFile, AmcacheLegacyFile, AmcacheShortcut:
+			id, ok := r.Get("Program ID")
+			if !ok {
+				continue
+			}
+			program, ok := programs[strings.ToLower(FormatValue(id))]
+			if !ok {
+				continue
+			}
+			if name, ok := program.Get("Name"); ok {
+				r.AddString("Program", FormatValue(name))
+			}
+			if version, ok := program.Get("Version"); ok {
+				r.AddString("Program Version", FormatValue(version))
+			}
+		case AmcacheDriverBinary, AmcacheDevice:
+			name, ok := r.Get("Driver Package")
+			if !ok {
+				continue
+			}
+			if pkg, ok := packages[strings.ToLower(FormatValue(name))]; ok {
+				if provider, ok := pkg.Get("Publisher"); ok {
+					r.AddString("Package Provider", FormatValue(provider))
+				}
+			}
+		}
+	}
+}
+
+// sortAmcacheRecords orders records by the sort option. Records without
+// the sort field come last; ties keep their inventory order.
+func sortAmcacheRecords(records []*Record, by string) {
+	var less func(a, b *Record) (bool, bool)
+	byText := func(name string) func(a, b *Record) (bool, bool) {
+		return func(a, b *Record) (bool, bool) {
+			fa, oka := a.Get(name)
+			fb, okb := b.Get(name)
+			if oka != okb {
+				return oka, true
+			}
+			sa, sb := strings.ToLower(FormatValue(fa)), strings.ToLower(FormatValue(fb))
+			return sa < sb, sa != sb
+		}
+	}
+	switch by {
+	case "lastwrite":
+		less = func(a, b *Record) (bool, bool) {
+			return a.LastWrite.After(b.LastWrite), !a.LastWrite.Equal(b.LastWrite)
+		}
+	case "linkdate":
+		less = func(a, b *Record) (bool, bool) {
+			fa, oka := a.Get("Link Date")
+			fb, okb := b.Get("Link Date")
+			if oka != okb {
+				return oka, true
+			}
+			if !oka {
+				return false, false
+			}
+			ta, tb := fa.Value.(time.Time), fb.Value.(time.Time)
+			return ta.After(tb), !ta.Equal(tb)
+		}
+	case "name":
+		less = byText("Name")
+	case "path":
+		less = byText("Path")
+	case "sha1":
+		less = byText("SHA1")
+	default:
+		return
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		l, decided := less(records[i], records[j])
+		return decided && l
+	})
 }
@@ -0,0 +1,125 @@
+package plugins
+
+import (
+	"testing"
+	"time"
+)
+
+func qwordValue(name string, n uint64) testValue {
+	return testValue{name: name, dataType: regQWORD, data: le64(n)}
+}
+
+func TestAmCacheInventory(t *testing.T) {
+	const (
+		sha1      = "a94a8fe5ccb19ba61c4c0873d391e987982fbbd3"
+		programID = "0000f519feec486de87ed73cb92d3cac802400000000"
+		pkgName   = "acme.inf_amd64_0123456789abcdef"
+	)
+	old := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	recent := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	files := make([]*testKey, 60)
+	for i := range files {
+		files[i] = key("file" + string(rune('A'+i%26)) + string(rune('a'+i/26))).with(szValue("Name", "x.exe"))
+	}
+	files = append(files,
+		key("tool.exe|1").at(old).with(
+			szValue("Name", "tool.exe"),
+			szValue("LowerCaseLongPath", `c:\tools\tool.exe`),
+			szValue("FileId", "0000"+sha1),
+			qwordValue("Size", 4096),
+			szValue("LinkDate", "05/14/2021 10:11:12"),
+			szValue("ProgramId", programID),
+		),
+	)
+
+	hive := newTestHive(t, key("ROOT", key("Root",
+		key("InventoryApplicationFile", files...),
+		key("InventoryApplication", key(programID).at(recent).with(
+			szValue("Name", "Acme Tools"),
+			szValue("Version", "2.1"),
+			szValue("InstallDate", "03/02/2021 08:00:00"),
+		)),
+		key("InventoryDriverBinary", key(`c:\windows\system32\drivers\acme.sys`).with(
+			szValue("DriverName", "acme.sys"),
+			szValue("DriverId", "0000"+sha1),
+			dwordValue("DriverTimeStamp", uint32(time.Date(2019, 7, 8, 9, 10, 11, 0, time.UTC).Unix())),
+			szValue("DriverPackageStrongName", pkgName),
+		)),
+		key("InventoryDriverPackage", key(pkgName).with(szValue("Provider", "Acme Corp"))),
+		key("File", key("{11111111-2222-3333-4444-555555555555}", key("2000000001a2b").with(
+			szValue("15", `C:\Old\legacy.exe`),
+			szValue("101", "0000"+sha1),
+			szValue("100", programID),
+		))),
+	)))
+
+	p := &AmCachePlugin{}
+	records, err := Collect(p, hive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 65 {
+		t.Fatalf("expected every entry (65), got %d", len(records))
+	}
+
+	find := func(records []*Record, artifact, name string) *Record {
+		for _, r := range records {
+			a, _ := r.Get("Artifact")
+			n, _ := r.Get("Name")
+			if FormatValue(a) == artifact && FormatValue(n) == name {
+				return r
+			}
+		}
+		t.Fatalf("no %s record named %s", artifact, name)
+		return nil
+	}
+	checks := []struct {
+		r    *Record
+		want map[string]string
+	}{
+		{find(records, AmcacheFile, "tool.exe"), map[string]string{
+			"Path":            `c:\tools\tool.exe`,
+			"SHA1":            sha1,
+			"Size":            "4096",
+			"Link Date":       FormatTime(time.Date(2021, 5, 14, 10, 11, 12, 0, time.UTC)),
+			"Program":         "Acme Tools",
+			"Program Version": "2.1",
+		}},
+		{find(records, AmcacheDriverBinary, "acme.sys"), map[string]string{
+			"Link Date":        FormatTime(time.Date(2019, 7, 8, 9, 10, 11, 0, time.UTC)),
+			"Package Provider": "Acme Corp",
+		}},
+		{find(records, AmcacheLegacyFile, "legacy.exe"), map[string]string{
+			"SHA1":         sha1,
+			"Program":      "Acme Tools",
+			"MFT Entry":    "6699",
+			"MFT Sequence": "2",
+		}},
+	}
+	for _, c := range checks {
+		for name, value := range c.want {
+			if f, ok := c.r.Get(name); !ok || FormatValue(f) != value {
+				t.Errorf("%s: %s = %v, want %s", c.r.KeyPath, name, f.Value, value)
+			}
+		}
+	}
+
+	opts, err := ParseOptions(p, map[string]string{"sort": "linkdate", "limit": "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err = CollectContext(t.Context(), p, hive, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected the limit to apply after sorting, got %d records", len(records))
+	}
+	if n, _ := records[0].Get("Name"); FormatValue(n) != "tool.exe" {
+		t.Errorf("newest link date should come first, got %v", n.Value)
+	}
+	if n, _ := records[1].Get("Name"); FormatValue(n) != "acme.sys" {
+		t.Errorf("expected acme.sys second, got %v", n.Value)
+	}
+}
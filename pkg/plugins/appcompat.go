@@ -1,9 +1,6 @@
 package plugins
 
 import (
-	"fmt"
-	"strings"
-
 	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
 )
 
@@ -26,54 +23,65 @@ func (p *AppCompatPlugin) CompatibleHiveTypes() []string {
 	return []string{"NTUSER.DAT", "SOFTWARE"}
 }
 
+func (p *AppCompatPlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategoryPersistence,
+		Techniques: []string{"T1546.011"},
+		Artifact:   "AppCompatFlags Layers assign compatibility modes such as RUNASADMIN to programs; unusual entries can indicate shimming or privilege tricks.",
+		References: []string{regRipperReference},
+		Version:    "1.0.0",
+		Schema: []FieldSpec{
+			{Name: "Program", Type: FieldString, Description: "program path"},
+			{Name: "Flags", Type: FieldString, Description: "compatibility layers"},
+			{Name: "Name", Type: FieldString, Description: "value name under a subkey"},
+			{Name: "Value", Type: FieldString, Description: "value data, typed after the registry value"},
+		},
+	}
+}
+
 func (p *AppCompatPlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
+
+func (p *AppCompatPlugin) Collect(hive *regf.Hive, emit Emitter) error {
 	paths := []string{
 		"Software/Microsoft/Windows NT/CurrentVersion/AppCompatFlags/Layers",
 		"Software/Microsoft/Windows NT/CurrentVersion/AppCompatFlags/Compatibility Assistant/Store",
 		"Microsoft/Windows NT/CurrentVersion/AppCompatFlags",
 	}
 
-	fmt.Println("Application Compatibility Settings:")
-	fmt.Println(strings.Repeat("=", 80))
-
 	found := false
 	for _, path := range paths {
 		key, err := hive.GetKey(path)
 		if err != nil {
 			continue
 		}
-
 		found = true
-		fmt.Printf("\n%s:\n", path)
-		fmt.Printf("Last Write: %s\n\n", key.Timestamp().Format("2006-01-02 15:04:05"))
 
 		for _, val := range key.Values() {
 			if val.Name() != "" {
-				valStr := GetValueString(val)
-				fmt.Printf("  %s\n", val.Name())
-				if valStr != "" {
-					fmt.Printf("    Flags: %s\n", valStr)
+				r := NewRecord(path, key).AddString("Program", val.Name())
+				if valStr := GetValueString(val); valStr != "" && val.Type() != regBinary {
+					r.AddString("Flags", valStr)
 				}
+				emit(r)
 			}
 		}
 
 		// Check subkeys
 		for _, subkey := range key.Subkeys() {
-			fmt.Printf("\n  Subkey: %s\n", subkey.Name())
-			fmt.Printf("  Last Write: %s\n", subkey.Timestamp().Format("2006-01-02 15:04:05"))
-
 			for _, val := range subkey.Values() {
 				if val.Name() != "" {
-					valStr := GetValueString(val)
-					fmt.Printf("    %s = %s\n", val.Name(), valStr)
+					emit(NewRecord(joinKeyPath(path, subkey.Name()), subkey).
+						AddString("Name", val.Name()).
+						AddValue("Value", val))
 				}
 			}
 		}
 	}
 
 	if !found {
-		fmt.Println("No Application Compatibility flags found")
+		return notFound("no AppCompatFlags keys")
 	}
-
 	return nil
 }
@@ -1,8 +1,6 @@
 package plugins
 
 import (
-	"fmt"
-
 	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
 )
 
@@ -25,32 +23,50 @@ func (p *AppInitPlugin) CompatibleHiveTypes() []string {
 	return []string{"SOFTWARE"}
 }
 
+func (p *AppInitPlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategoryPersistence,
+		Techniques: []string{"T1546.010"},
+		Artifact:   "AppInit_DLLs are loaded into every process that loads user32.dll.",
+		References: []string{regRipperReference},
+		Version:    "1.0.0",
+		Schema: []FieldSpec{
+			{Name: "Name", Type: FieldString, Description: "value name"},
+			{Name: "Value", Type: FieldString, Description: "value data"},
+		},
+	}
+}
+
 func (p *AppInitPlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
+
+func (p *AppInitPlugin) Collect(hive *regf.Hive, emit Emitter) error {
 	paths := []string{
 		"Microsoft\\Windows NT\\CurrentVersion\\Windows",
 		"Wow6432Node\\Microsoft\\Windows NT\\CurrentVersion\\Windows",
 	}
 
-	fmt.Println("AppInit DLLs")
-	fmt.Println("============")
-	fmt.Println()
-
+	found := false
 	for _, path := range paths {
 		key, err := hive.GetKey(path)
 		if err != nil {
 			continue
 		}
-
-		fmt.Printf("[%s]\n", path)
-		fmt.Printf("Last Modified: %s\n", key.Timestamp().Format("2006-01-02 15:04:05"))
+		found = true
 
 		for _, val := range key.Values() {
 			if val.Name() == "AppInit_DLLs" || val.Name() == "LoadAppInit_DLLs" {
-				fmt.Printf("  %s = %s\n", val.Name(), GetValueString(val))
+				emit(NewRecord(path, key).
+					AddString("Name", val.Name()).
+					AddString("Value", GetValueString(val)).
+					WithTags("persistence"))
 			}
 		}
-		fmt.Println()
 	}
 
+	if !found {
+		return notFound("no AppInit_DLLs keys")
+	}
 	return nil
 }
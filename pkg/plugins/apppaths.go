@@ -25,7 +25,25 @@ func (p *AppPathsPlugin) CompatibleHiveTypes() []string {
 	return []string{"SOFTWARE"}
 }
 
+func (p *AppPathsPlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategoryPersistence,
+		Techniques: []string{"T1574"},
+		Artifact:   "App Paths map executable names to full paths used by ShellExecute; a changed path hijacks the program.",
+		References: []string{regRipperReference},
+		Version:    "1.0.0",
+		Schema: []FieldSpec{
+			{Name: "Application", Type: FieldString, Description: "executable name"},
+			{Name: "Path", Type: FieldString, Description: "registered path"},
+		},
+	}
+}
+
 func (p *AppPathsPlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
+
+func (p *AppPathsPlugin) Collect(hive *regf.Hive, emit Emitter) error {
 	path := "Microsoft\\Windows\\CurrentVersion\\App Paths"
 
 	key, err := hive.GetKey(path)
@@ -33,10 +51,6 @@ func (p *AppPathsPlugin) Run(hive *regf.Hive) error {
 		return fmt.Errorf("app paths key not found: %w", err)
 	}
 
-	fmt.Println("Application Paths")
-	fmt.Println("=================")
-	fmt.Println()
-
 	for _, appKey := range key.Subkeys() {
 		appName := appKey.Name()
 		appPath := ""
@@ -49,7 +63,9 @@ func (p *AppPathsPlugin) Run(hive *regf.Hive) error {
 		}
 
 		if appPath != "" {
-			fmt.Printf("%s: %s\n", appName, appPath)
+			emit(NewRecord(joinKeyPath(path, appName), appKey).
+				AddString("Application", appName).
+				AddString("Path", appPath))
 		}
 	}
 
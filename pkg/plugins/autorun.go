@@ -1,8 +1,6 @@
 package plugins
 
 import (
-	"fmt"
-
 	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
 )
 
@@ -25,7 +23,25 @@ func (p *AutoRunPlugin) CompatibleHiveTypes() []string {
 	return []string{"SOFTWARE"}
 }
 
+func (p *AutoRunPlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategoryPersistence,
+		Techniques: []string{"T1547.001"},
+		Artifact:   "Run keys and other autostart locations start programs at boot or logon.",
+		References: []string{regRipperReference},
+		Version:    "1.0.0",
+		Schema: []FieldSpec{
+			{Name: "Name", Type: FieldString, Description: "value name"},
+			{Name: "Command", Type: FieldString, Description: "command line started"},
+		},
+	}
+}
+
 func (p *AutoRunPlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
+
+func (p *AutoRunPlugin) Collect(hive *regf.Hive, emit Emitter) error {
 	paths := []string{
 		"Microsoft\\Windows\\CurrentVersion\\Run",
 		"Microsoft\\Windows\\CurrentVersion\\RunOnce",
@@ -34,28 +50,26 @@ func (p *AutoRunPlugin) Run(hive *regf.Hive) error {
 		"Wow6432Node\\Microsoft\\Windows\\CurrentVersion\\RunOnce",
 	}
 
-	fmt.Println("Autorun Locations")
-	fmt.Println("=================")
-	fmt.Println()
-
+	found := false
 	for _, path := range paths {
 		key, err := hive.GetKey(path)
 		if err != nil {
 			continue
 		}
+		found = true
 
-		if len(key.Values()) > 0 {
-			fmt.Printf("[%s]\n", path)
-			fmt.Printf("Last Modified: %s\n", key.Timestamp().Format("2006-01-02 15:04:05"))
-
-			for _, val := range key.Values() {
-				if val.Name() != "" {
-					fmt.Printf("  %s = %s\n", val.Name(), GetValueString(val))
-				}
+		for _, val := range key.Values() {
+			if val.Name() != "" {
+				emit(NewRecord(path, key).
+					AddString("Name", val.Name()).
+					AddString("Command", GetValueString(val)).
+					WithTags("persistence"))
 			}
-			fmt.Println()
 		}
 	}
 
+	if !found {
+		return notFound("no autorun keys")
+	}
 	return nil
 }
@@ -1,9 +1,9 @@
 package plugins
 
 import (
+	"context"
 	"encoding/binary"
 	"fmt"
-	"strings"
 	"time"
 
 	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
@@ -14,7 +14,8 @@ func init() {
 }
 
 // BAMPlugin displays Background Activity Moderator (BAM) entries.
-// Shows program execution timestamps (Windows 10+).
+// Shows program execution timestamps (Windows 10+). With the SOFTWARE, SAM
+// or SECURITY hives of the same host, SIDs are resolved to user names.
 type BAMPlugin struct{}
 
 func (p *BAMPlugin) Name() string {
@@ -29,89 +30,114 @@ func (p *BAMPlugin) CompatibleHiveTypes() []string {
 	return []string{"SYSTEM"}
 }
 
-func (p *BAMPlugin) Run(hive *regf.Hive) error {
-	// Find current ControlSet
-	controlSetName, err := p.findCurrentControlSet(hive)
-	if err != nil {
-		return fmt.Errorf("failed to find current ControlSet: %w", err)
+func (p *BAMPlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategoryExecution,
+		Techniques: []string{"T1204.002"},
+		Artifact:   "The Background Activity Moderator keeps the last execution time of programs per user SID (Windows 10 1709+).",
+		References: []string{regRipperReference},
+		Version:    "1.2.0",
+		Schema: []FieldSpec{
+			{Name: "SID", Type: FieldString, Description: "user SID"},
+			{Name: "User", Type: FieldString, Description: "account name of the SID, when known"},
+			{Name: "Domain", Type: FieldString, Description: "domain of the account, when known"},
+			{Name: "Profile Path", Type: FieldString, Description: "profile path of the SID, from SOFTWARE"},
+			{Name: "User Source", Type: FieldString, Description: "where the SID was resolved: well-known, SAM, ProfileList or SECURITY"},
+			{Name: "Executable", Type: FieldString, Description: "device path of the program"},
+			{Name: "Timestamp", Type: FieldTime, Description: "last execution time"},
+		},
 	}
+}
 
-	paths := []string{
-		fmt.Sprintf("%s/Services/bam/State/UserSettings", controlSetName),
-		fmt.Sprintf("%s/Services/dam/State/UserSettings", controlSetName),
-	}
+func (p *BAMPlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
+
+func (p *BAMPlugin) Options() []Option {
+	return []Option{controlSetOption}
+}
+
+func (p *BAMPlugin) RequiredHives() []string {
+	return []string{"SYSTEM"}
+}
+
+func (p *BAMPlugin) OptionalHives() []string {
+	return []string{"SOFTWARE", "SAM", "SECURITY"}
+}
 
-	fmt.Println("BAM/DAM Entries (Program Execution):")
-	fmt.Println(strings.Repeat("=", 80))
+// CollectHost collects the SYSTEM hive and resolves the SID of each entry
+// with the other hives of the host.
+func (p *BAMPlugin) CollectHost(ctx context.Context, host *Host, opts Options, emit Emitter) error {
+	return p.CollectContext(WithSIDResolver(ctx, host.SIDs()), host.Hive("SYSTEM"), opts, emit)
+}
+
+func (p *BAMPlugin) Collect(hive *regf.Hive, emit Emitter) error {
+	return p.CollectContext(context.Background(), hive, DefaultOptions(p), emit)
+}
 
-	found := false
-	for _, path := range paths {
-		key, err := hive.GetKey(path)
-		if err != nil {
-			continue
+func (p *BAMPlugin) CollectContext(ctx context.Context, hive *regf.Hive, opts Options, emit Emitter) error {
+	sids := SIDResolverFrom(ctx, "SYSTEM", hive)
+	return forEachControlSet(ctx, hive, opts, emit, func(controlSetName string, emit Emitter) error {
+		paths := []string{
+			fmt.Sprintf("%s/Services/bam/State/UserSettings", controlSetName),
+			fmt.Sprintf("%s/Services/dam/State/UserSettings", controlSetName),
 		}
 
-		found = true
-		fmt.Printf("\n%s:\n", path)
-
-		// Enumerate subkeys (SIDs)
-		for _, sidKey := range key.Subkeys() {
-			fmt.Printf("\n  SID: %s\n", sidKey.Name())
-			fmt.Printf("  Last Write: %s\n", sidKey.Timestamp().Format("2006-01-02 15:04:05"))
-
-			// List values (executables)
-			for _, val := range sidKey.Values() {
-				if val.Name() != "" && len(val.Bytes()) >= 8 {
-					// Parse FILETIME from first 8 bytes
-					data := val.Bytes()
-					timestamp := binary.LittleEndian.Uint64(data[0:8])
-					if timestamp > 0 {
-						// Convert Windows FILETIME to Unix time
-						t := filetimeToTime(timestamp)
-						if t.Year() > 1970 {
-							fmt.Printf("    %s\n", val.Name())
-							fmt.Printf("      Timestamp: %s\n", t.Format("2006-01-02 15:04:05"))
+		found := false
+		for _, path := range paths {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			key, err := hive.GetKey(path)
+			if err != nil {
+				continue
+			}
+			found = true
+
+			// Enumerate subkeys (SIDs)
+			for _, sidKey := range key.Subkeys() {
+				sidPath := path + "/" + sidKey.Name()
+
+				// List values (executables)
+				for _, val := range sidKey.Values() {
+					if val.Name() != "" && len(val.Bytes()) >= 8 {
+						// Parse FILETIME from first 8 bytes
+						data := val.Bytes()
+						timestamp := binary.LittleEndian.Uint64(data[0:8])
+						if timestamp > 0 {
+							// Convert Windows FILETIME to Unix time
+							t := filetimeToTime(timestamp)
+							if t.Year() > 1970 {
+								r := NewRecord(sidPath, sidKey).
+									AddString("SID", sidKey.Name()).
+									AddString("Executable", val.Name()).
+									AddTime("Timestamp", t).
+									WithTags("execution")
+								sids.addTo(r)
+								emit(r)
+							}
 						}
 					}
 				}
 			}
 		}
-	}
-
-	if !found {
-		fmt.Println("No BAM/DAM entries found (Windows 10+ feature)")
-	}
 
-	return nil
+		if !found {
+			return notFound("no BAM or DAM UserSettings keys")
+		}
+		return nil
+	})
 }
 
-// filetimeToTime converts a Windows FILETIME to time.Time
+// filetimeToTime converts a Windows FILETIME to a UTC time.Time, keeping
+// its full 100 ns precision.
 func filetimeToTime(filetime uint64) time.Time {
-	if filetime == 0 {
-		return time.Time{}
-	}
 	// Windows FILETIME is 100-nanosecond intervals since January 1, 1601
-	// Unix time is seconds since January 1, 1970
 	// Difference between 1601 and 1970 is 11644473600 seconds
-	unixTime := int64(filetime/10000000 - 11644473600)
-	if unixTime < 0 {
+	const windowsToUnixEpoch = 116444736000000000
+	if filetime < windowsToUnixEpoch {
 		return time.Time{}
 	}
-	return time.Unix(unixTime, 0)
-}
-
-func (p *BAMPlugin) findCurrentControlSet(hive *regf.Hive) (string, error) {
-	selectKey, err := hive.GetKey("Select")
-	if err != nil {
-		return "", err
-	}
-
-	for _, val := range selectKey.Values() {
-		if val.Name() == "Current" && len(val.Bytes()) >= 4 {
-			current := binary.LittleEndian.Uint32(val.Bytes()[:4])
-			return fmt.Sprintf("ControlSet%03d", current), nil
-		}
-	}
-
-	return "", fmt.Errorf("current value not found in select key")
+	return time.Unix(0, int64(filetime-windowsToUnixEpoch)*100).UTC()
 }
@@ -1,8 +1,6 @@
 package plugins
 
 import (
-	"fmt"
-
 	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
 )
 
@@ -25,41 +23,58 @@ func (p *BrowserHelperPlugin) CompatibleHiveTypes() []string {
 	return []string{"SOFTWARE"}
 }
 
+func (p *BrowserHelperPlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategoryPersistence,
+		Techniques: []string{"T1176"},
+		Artifact:   "Browser Helper Objects are COM objects loaded by Internet Explorer.",
+		References: []string{regRipperReference},
+		Version:    "1.0.0",
+		Schema: []FieldSpec{
+			{Name: "CLSID", Type: FieldString, Description: "class ID of the object"},
+			{Name: "Name", Type: FieldString, Description: "registered name"},
+		},
+	}
+}
+
 func (p *BrowserHelperPlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
+
+func (p *BrowserHelperPlugin) Collect(hive *regf.Hive, emit Emitter) error {
 	paths := []string{
 		"Microsoft\\Windows\\CurrentVersion\\Explorer\\Browser Helper Objects",
 		"Wow6432Node\\Microsoft\\Windows\\CurrentVersion\\Explorer\\Browser Helper Objects",
 	}
 
-	fmt.Println("Browser Helper Objects (BHO)")
-	fmt.Println("============================")
-	fmt.Println()
-
+	found := false
 	for _, path := range paths {
 		key, err := hive.GetKey(path)
 		if err != nil {
 			continue
 		}
-
-		fmt.Printf("[%s]\n", path)
+		found = true
 
 		for _, bhoKey := range key.Subkeys() {
-			fmt.Printf("  CLSID: %s\n", bhoKey.Name())
+			r := NewRecord(joinKeyPath(path, bhoKey.Name()), bhoKey).
+				AddString("CLSID", bhoKey.Name()).
+				WithTags("persistence")
 
 			// Try to get the name
 			for _, val := range bhoKey.Values() {
 				if val.Name() == "" || val.Name() == "(Default)" {
-					name := GetValueString(val)
-					if name != "" {
-						fmt.Printf("    Name: %s\n", name)
+					if name := GetValueString(val); name != "" {
+						r.AddString("Name", name)
 					}
 				}
 			}
 
-			fmt.Printf("    Last Modified: %s\n", bhoKey.Timestamp().Format("2006-01-02 15:04:05"))
+			emit(r)
 		}
-		fmt.Println()
 	}
 
+	if !found {
+		return notFound("no Browser Helper Objects keys")
+	}
 	return nil
 }
@@ -1,6 +1,7 @@
 package plugins
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
@@ -25,34 +26,47 @@ func (p *BootExecutePlugin) CompatibleHiveTypes() []string {
 	return []string{"SYSTEM"}
 }
 
-func (p *BootExecutePlugin) Run(hive *regf.Hive) error {
-	paths := []string{
-		"ControlSet001\\Control\\Session Manager",
-		"ControlSet002\\Control\\Session Manager",
+func (p *BootExecutePlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategoryPersistence,
+		Techniques: []string{"T1547.001"},
+		Artifact:   "BootExecute lists native programs run by the Session Manager before Windows starts; normally only autocheck autochk *.",
+		References: []string{regRipperReference},
+		Version:    "1.0.0",
+		Schema: []FieldSpec{
+			{Name: "BootExecute", Type: FieldStrings, Description: "configured commands"},
+		},
 	}
+}
+
+func (p *BootExecutePlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
 
-	fmt.Println("Boot Execute Commands")
-	fmt.Println("=====================")
-	fmt.Println()
+func (p *BootExecutePlugin) Options() []Option {
+	return []Option{controlSetOption}
+}
 
-	for _, path := range paths {
+func (p *BootExecutePlugin) Collect(hive *regf.Hive, emit Emitter) error {
+	return p.CollectContext(context.Background(), hive, DefaultOptions(p), emit)
+}
+
+func (p *BootExecutePlugin) CollectContext(ctx context.Context, hive *regf.Hive, opts Options, emit Emitter) error {
+	return forEachControlSet(ctx, hive, opts, emit, func(controlSet string, emit Emitter) error {
+		path := controlSet + "\\Control\\Session Manager"
 		key, err := hive.GetKey(path)
 		if err != nil {
-			continue
+			return fmt.Errorf("session manager key not found: %w", err)
 		}
 
-		fmt.Printf("[%s]\n", path)
-		fmt.Printf("Last Modified: %s\n", key.Timestamp().Format("2006-01-02 15:04:05"))
-
 		for _, val := range key.Values() {
 			if val.Name() == "BootExecute" {
-				fmt.Printf("  %s\n", GetValueString(val))
+				emit(NewRecord(path, key).
+					AddStrings("BootExecute", GetValueStrings(val)).
+					WithTags("persistence"))
 			}
 		}
-		fmt.Println()
 
 		return nil
-	}
-
-	return fmt.Errorf("session manager key not found")
+	})
 }
@@ -0,0 +1,48 @@
+package plugins
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
+)
+
+// bootKeyParts are the Control\Lsa subkeys whose class names, in this
+// order, hold the scrambled boot key (also called the system key).
+var bootKeyParts = []string{"JD", "Skew1", "GBG", "Data"}
+
+// bootKeyPermutation unscrambles the concatenated class names.
+var bootKeyPermutation = [16]int{8, 5, 4, 2, 11, 9, 13, 3, 0, 6, 1, 12, 14, 10, 15, 7}
+
+// readBootKey derives the boot key from the class names of the LSA keys
+// of the current control set of a SYSTEM hive.
+func readBootKey(system *regf.Hive) ([]byte, error) {
+	controlSet, err := findCurrentControlSet(system)
+	if err != nil {
+		return nil, err
+	}
+	lsaPath := controlSet + `\Control\Lsa`
+	lsa, err := system.GetKey(lsaPath)
+	if err != nil {
+		return nil, notFound("%s not found", lsaPath)
+	}
+
+	var scrambled []byte
+	for _, name := range bootKeyParts {
+		part, err := getSubkey(lsa, name)
+		if err != nil {
+			return nil, notFound("%s\\%s not found", lsaPath, name)
+		}
+		b, err := hex.DecodeString(part.Class())
+		if err != nil || len(b) != 4 {
+			return nil, fmt.Errorf("%s\\%s: invalid class name %q", lsaPath, name, part.Class())
+		}
+		scrambled = append(scrambled, b...)
+	}
+
+	key := make([]byte, 16)
+	for i, j := range bootKeyPermutation {
+		key[i] = scrambled[j]
+	}
+	return key, nil
+}
@@ -1,8 +1,14 @@
 package plugins
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
 )
@@ -11,7 +17,15 @@ func init() {
 	Register(&CachedPlugin{})
 }
 
-// CachedPlugin extracts cached domain logon information
+// cachePath is the SECURITY key holding the cached logons as NL$1 to NL$n.
+const cachePath = "Cache"
+
+// defaultDCC2Iterations is the PBKDF2 iteration count of DCC2 hashes
+// unless NL$IterationCount says otherwise.
+const defaultDCC2Iterations = 10240
+
+// CachedPlugin decrypts the cached domain logons of a SECURITY hive with
+// the NL$KM LSA secret, itself decrypted with the SYSTEM boot key.
 type CachedPlugin struct{}
 
 func (p *CachedPlugin) Name() string {
@@ -19,38 +33,193 @@ func (p *CachedPlugin) Name() string {
 }
 
 func (p *CachedPlugin) Description() string {
-	return "Cached domain logons - SECURITY\\Cache"
+	return "Cached domain logons - SECURITY\\Cache decrypted with the SYSTEM boot key"
 }
 
 func (p *CachedPlugin) CompatibleHiveTypes() []string {
-	return []string{"SYSTEM", "SECURITY"}
+	return []string{"SECURITY"}
+}
+
+func (p *CachedPlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategoryAccounts,
+		Techniques: []string{"T1003.005"},
+		Artifact: "The SECURITY Cache key holds cached domain logon verifiers (DCC2, or DCC1 before Vista) " +
+			"of recent domain users, encrypted with the NL$KM LSA secret.",
+		References: []string{regRipperReference},
+		Version:    "2.0.0",
+		Schema: []FieldSpec{
+			{Name: "Entry", Type: FieldString, Description: "cache slot name"},
+			{Name: "Username", Type: FieldString, Description: "account name"},
+			{Name: "Domain", Type: FieldString, Description: "NetBIOS domain name"},
+			{Name: "DNS Domain", Type: FieldString, Description: "DNS domain name"},
+			{Name: "RID", Type: FieldInt, Description: "relative ID of the account"},
+			{Name: "Last Logon", Type: FieldTime, Description: "time the entry was cached"},
+			{Name: "Format", Type: FieldString, Description: "DCC2 or DCC1"},
+			{Name: "Hash", Type: FieldString, Description: "hash in the format of cracking tools", Sensitive: true},
+		},
+	}
 }
 
 func (p *CachedPlugin) Run(hive *regf.Hive) error {
-	cachePath := "Policy\\Secrets\\NL$*"
-	cacheKey, err := hive.GetKey(cachePath)
+	return runText(p, hive)
+}
+
+func (p *CachedPlugin) RequiredHives() []string {
+	return []string{"SECURITY", "SYSTEM"}
+}
+
+func (p *CachedPlugin) OptionalHives() []string {
+	return nil
+}
+
+// Collect runs on a single hive, which cannot hold both the cache and the
+// boot key: it reports the missing SYSTEM hive.
+func (p *CachedPlugin) Collect(hive *regf.Hive, emit Emitter) error {
+	records, err := CollectContext(context.Background(), p, hive, DefaultOptions(p))
+	for _, r := range records {
+		emit(r)
+	}
+	return err
+}
+
+func (p *CachedPlugin) CollectHost(ctx context.Context, host *Host, opts Options, emit Emitter) error {
+	security := host.Hive("SECURITY")
+	cacheKey, err := security.GetKey(cachePath)
+	if err != nil {
+		return notFound("%s key not found", cachePath)
+	}
+
+	bootKey, err := readBootKey(host.Hive("SYSTEM"))
 	if err != nil {
-		// Try alternate location
-		cachePath = "Cache"
-		cacheKey, err = hive.GetKey(cachePath)
+		return fmt.Errorf("boot key: %w", err)
+	}
+	key, err := readLSAKey(security, bootKey)
+	if err != nil {
+		return err
+	}
+	nlkm, err := readLSASecret(security, key, "NL$KM", "CurrVal")
+	if err != nil {
+		return fmt.Errorf("NL$KM: %w", err)
+	}
+	if len(nlkm) < 32 {
+		return notFound("no NL$KM secret")
+	}
+
+	iterations := defaultDCC2Iterations
+	if v, err := getValue(cacheKey, "NL$IterationCount"); err == nil && len(v.Bytes()) >= 4 {
+		// Small counts are in units of 1024
+		if n := int(binary.LittleEndian.Uint32(v.Bytes())); n > 10240 {
+			iterations = n &^ 0x3FF
+		} else {
+			iterations = n * 1024
+		}
+	}
+
+	var failed []error
+	for _, val := range cacheKey.Values() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !strings.HasPrefix(val.Name(), "NL$") || val.Name() == "NL$Control" || val.Name() == "NL$IterationCount" {
+			continue
+		}
+		entry, ok, err := decryptCacheEntry(val.Bytes(), nlkm, key.vista)
 		if err != nil {
-			return fmt.Errorf("cache key not found: %w", err)
+			failed = append(failed, fmt.Errorf("%s: %w", val.Name(), err))
+			continue
+		}
+		if !ok {
+			// Unused slot
+			continue
+		}
+
+		r := NewRecord(cachePath, cacheKey).
+			AddString("Entry", val.Name()).
+			AddString("Username", entry.user).
+			AddString("Domain", entry.domain)
+		if entry.dnsDomain != "" {
+			r.AddString("DNS Domain", entry.dnsDomain)
+		}
+		r.AddInt("RID", int64(entry.rid)).
+			AddTime("Last Logon", entry.lastWrite)
+		if key.vista {
+			r.AddString("Format", "DCC2").
+				AddSecret("Hash", fmt.Sprintf("$DCC2$%d#%s#%s", iterations, entry.user, hex.EncodeToString(entry.hash)))
+		} else {
+			r.AddString("Format", "DCC1").
+				AddSecret("Hash", fmt.Sprintf("%s:%s", hex.EncodeToString(entry.hash), entry.user))
 		}
+		emit(r)
+	}
+	if len(failed) > 0 {
+		return partial(failed)
 	}
+	return nil
+}
 
-	fmt.Println("Cached Domain Logons:")
-	fmt.Println(strings.Repeat("=", 80))
+// cacheEntry is a decrypted NL$ cache entry.
+type cacheEntry struct {
+	user      string
+	domain    string
+	dnsDomain string
+	rid       uint32
+	lastWrite time.Time
+	hash      []byte
+}
 
-	for _, entry := range cacheKey.Subkeys() {
-		fmt.Printf("\nEntry: %s\n", entry.Name())
-		fmt.Printf("Last Write: %s\n", entry.Timestamp().Format("2006-01-02 15:04:05"))
+// decryptCacheEntry decodes an NL$ value. Its 96 byte header holds the
+// name lengths, the RID, the time it was written, flags and the IV; the
+// encrypted data follows. Vista and later encrypt it with AES-CBC and the
+// second 16 bytes of NL$KM, earlier systems with RC4 keyed by HMAC-MD5 of
+// the IV. The plain text starts with the hash; the names follow at 0x48,
+// each padded to 4 bytes. ok is false for unused entries.
+func decryptCacheEntry(data, nlkm []byte, vista bool) (entry cacheEntry, ok bool, err error) {
+	if len(data) < 96 {
+		return entry, false, fmt.Errorf("entry too short (%d bytes)", len(data))
+	}
+	userLen := int(binary.LittleEndian.Uint16(data[0:]))
+	domainLen := int(binary.LittleEndian.Uint16(data[2:]))
+	dnsDomainLen := int(binary.LittleEndian.Uint16(data[60:]))
+	iv := data[64:80]
+	flags := binary.LittleEndian.Uint32(data[48:])
+	if userLen == 0 || allZero(iv) || flags&1 == 0 {
+		return entry, false, nil
+	}
 
-		for _, val := range entry.Values() {
-			if len(val.Bytes()) > 0 && len(val.Bytes()) < 1000 {
-				fmt.Printf("  %s: %s\n", val.Name(), GetValueString(val))
-			}
+	var plain []byte
+	if vista {
+		if plain, err = aesDecrypt(nlkm[16:32], iv, data[96:]); err != nil {
+			return entry, false, err
 		}
+	} else {
+		mac := hmac.New(md5.New, nlkm)
+		mac.Write(iv)
+		plain = rc4Crypt(mac.Sum(nil), data[96:])
 	}
 
-	return nil
+	pad := func(n int) int { return (n + 3) &^ 3 }
+	names := plain
+	if len(names) < 0x48+pad(userLen)+pad(domainLen)+dnsDomainLen {
+		return entry, false, fmt.Errorf("decrypted entry too short (%d bytes)", len(plain))
+	}
+	names = names[0x48:]
+	entry.user = utf16String(names[:userLen])
+	entry.domain = utf16String(names[pad(userLen) : pad(userLen)+domainLen])
+	names = names[pad(userLen)+pad(domainLen):]
+	entry.dnsDomain = utf16String(names[:dnsDomainLen])
+	entry.rid = binary.LittleEndian.Uint32(data[16:])
+	entry.lastWrite = filetimeToTime(binary.LittleEndian.Uint64(data[32:]))
+	entry.hash = plain[:16]
+	return entry, true, nil
+}
+
+// allZero reports whether every byte of b is zero.
+func allZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
 }
@@ -0,0 +1,162 @@
+package plugins
+
+import (
+	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
+)
+
+func init() {
+	Register(&ComDlg32Plugin{})
+}
+
+// comDlg32Path is the NTUSER.DAT key of the common dialog MRU lists.
+const comDlg32Path = "Software\\Microsoft\\Windows\\CurrentVersion\\Explorer\\ComDlg32"
+
+// comDlg32List describes one MRU list under ComDlg32.
+type comDlg32List struct {
+	name string
+	// perExtension lists have one subkey per file extension, "*" holding
+	// every extension.
+	perExtension bool
+	// program is set when each value starts with the NUL-terminated
+	// UTF-16 name of the program that showed the dialog.
+	program bool
+	// content is what follows the program name.
+	content int
+	order   string
+}
+
+// Contents of a ComDlg32 list entry.
+const (
+	comDlg32IDList = iota // an ITEMIDLIST
+	comDlg32Text          // a UTF-16 path
+	comDlg32Sizes         // window sizes only
+)
+
+// comDlg32Lists are the Vista and later lists, then the XP ones.
+var comDlg32Lists = []comDlg32List{
+	{name: "OpenSavePidlMRU", perExtension: true, content: comDlg32IDList, order: OrderMRUListEx},
+	{name: "LastVisitedPidlMRU", program: true, content: comDlg32IDList, order: OrderMRUListEx},
+	{name: "LastVisitedPidlMRULegacy", program: true, content: comDlg32IDList, order: OrderMRUListEx},
+	{name: "FirstFolder", program: true, content: comDlg32IDList, order: OrderMRUListEx},
+	{name: "CIDSizeMRU", program: true, content: comDlg32Sizes, order: OrderMRUListEx},
+	{name: "OpenSaveMRU", perExtension: true, content: comDlg32Text, order: OrderMRUList},
+	{name: "LastVisitedMRU", program: true, content: comDlg32Text, order: OrderMRUList},
+}
+
+// ComDlg32Plugin displays the files and folders picked in Open and Save As
+// dialogs, from NTUSER.DAT.
+type ComDlg32Plugin struct{}
+
+func (p *ComDlg32Plugin) Name() string {
+	return "comdlg32"
+}
+
+func (p *ComDlg32Plugin) Description() string {
+	return "Display Open/Save dialog history (ComDlg32 MRU lists) from NTUSER.DAT"
+}
+
+func (p *ComDlg32Plugin) CompatibleHiveTypes() []string {
+	return []string{"NTUSER.DAT"}
+}
+
+func (p *ComDlg32Plugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategoryUserActivity,
+		Techniques: []string{"T1083"},
+		Artifact: "ComDlg32 keeps the files opened or saved through common dialogs per extension (OpenSavePidlMRU), " +
+			"and the programs that showed them with their last folder (LastVisitedPidlMRU, FirstFolder, CIDSizeMRU).",
+		References: []string{
+			regRipperReference,
+			"https://github.com/libyal/libfwsi/blob/main/documentation/Windows%20Shell%20Item%20format.asciidoc",
+		},
+		Version: "1.0.0",
+		Schema: []FieldSpec{
+			{Name: "List", Type: FieldString, Description: "MRU list the entry belongs to"},
+			{Name: "Extension", Type: FieldString, Description: "file extension of OpenSave lists, * for all"},
+			{Name: "Program", Type: FieldString, Description: "program that showed the dialog"},
+			{Name: "Path", Type: FieldString, Description: "file or folder path, reconstructed from the shell items"},
+			{Name: "Item Type", Type: FieldString, Description: "shell item type of the last path component"},
+			{Name: "MRU Position", Type: FieldInt, Description: "position in the list, 0 being the most recent"},
+			{Name: "Last Used", Type: FieldTime, Description: "LastWrite time of the list, for its most recent entry"},
+			{Name: "MFT Entry", Type: FieldInt, Description: "MFT entry number of the file"},
+			{Name: "MFT Sequence", Type: FieldInt, Description: "MFT sequence number of the file"},
+		},
+	}
+}
+
+func (p *ComDlg32Plugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
+
+func (p *ComDlg32Plugin) Collect(hive *regf.Hive, emit Emitter) error {
+	root, err := hive.GetKey(comDlg32Path)
+	if err != nil {
+		return notFound("ComDlg32 key not found")
+	}
+
+	found := false
+	for _, list := range comDlg32Lists {
+		key, err := getSubkey(root, list.name)
+		if err != nil {
+			continue
+		}
+		found = true
+		path := joinKeyPath(comDlg32Path, list.name)
+		if !list.perExtension {
+			collectComDlg32List(list, path, key, "", emit)
+			continue
+		}
+		for _, ext := range key.Subkeys() {
+			collectComDlg32List(list, joinKeyPath(path, ext.Name()), ext, ext.Name(), emit)
+		}
+	}
+	if !found {
+		return notFound("no MRU lists under ComDlg32")
+	}
+	return nil
+}
+
+// collectComDlg32List emits the entries of one list key, most recent
+// first. The key was last written when its most recent entry was added, so
+// that entry gets the LastWrite time. Entries the MRU list does not name
+// have neither a position nor a time.
+func collectComDlg32List(list comDlg32List, path string, key *regf.Key, ext string, emit Emitter) {
+	for _, e := range mruValues(key, list.order) {
+		data := e.Value.Bytes()
+		r := NewRecord(path, key).AddString("List", list.name)
+		if ext != "" {
+			r.AddString("Extension", ext)
+		}
+		if list.program {
+			name, rest := splitUTF16(data)
+			r.AddString("Program", name)
+			data = rest
+		}
+
+		var last shellItem
+		switch list.content {
+		case comDlg32IDList:
+			folder, items := parseIDList(data)
+			r.AddString("Path", folder)
+			if len(items) > 0 {
+				last = items[len(items)-1]
+				r.AddString("Item Type", last.Type)
+			}
+		case comDlg32Text:
+			if folder := utf16String(data); folder != "" {
+				r.AddString("Path", folder)
+			}
+		}
+		if e.Listed {
+			r.AddInt("MRU Position", int64(e.Position))
+			if e.Position == 0 && !key.Timestamp().IsZero() {
+				r.AddTime("Last Used", key.Timestamp())
+			}
+		}
+		if last.HasMFT {
+			r.AddInt("MFT Entry", int64(last.MFTEntry)).
+				AddInt("MFT Sequence", int64(last.MFTSequence))
+		}
+		emit(r)
+	}
+}
@@ -0,0 +1,74 @@
+package plugins
+
+import (
+	"testing"
+	"time"
+)
+
+func TestComDlg32DecodesLists(t *testing.T) {
+	modified := time.Date(2022, 6, 7, 8, 9, 10, 0, time.UTC)
+	written := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	myComputer := shellItemBytes([]byte{0x1F, 0x50}, []byte{
+		0xE0, 0x4F, 0xD0, 0x20, 0xEA, 0x3A, 0x69, 0x10, 0xA2, 0xD8, 0x08, 0x00, 0x2B, 0x30, 0x30, 0x9D})
+	drive := shellItemBytes([]byte{0x2F}, []byte("C:\\"), make([]byte, 19))
+	users := directoryItem("USERS", "Users", modified, modified, 0)
+	report := directoryItem("REPORT~1.DOC", "report final.docx", modified, modified, 4321)
+	idList := func(items ...[]byte) []byte { return concat(append(items, le16(0))...) }
+	program := func(name string) []byte { return concat(utf16le(name), le16(0)) }
+
+	hive := newTestHive(t, key("ROOT", key("Software", key("Microsoft", key("Windows", key("CurrentVersion", key("Explorer",
+		key("ComDlg32",
+			key("OpenSavePidlMRU",
+				key("docx").with(
+					binValue("0", idList(myComputer, drive, users)),
+					binValue("1", idList(myComputer, drive, users, report)),
+					binValue("MRUListEx", mruListEx(1, 0)),
+				).at(written),
+				key("pdf").with(binValue("0", idList(myComputer, drive, users))).at(written),
+			),
+			key("LastVisitedPidlMRU").with(
+				binValue("0", concat(program("WINWORD.EXE"), idList(myComputer, drive, users))),
+				binValue("MRUListEx", mruListEx(0)),
+			),
+			key("CIDSizeMRU").with(
+				binValue("0", concat(program("notepad.exe"), make([]byte, 20))),
+				binValue("MRUListEx", mruListEx(0)),
+			),
+		),
+	)))))))
+
+	records, err := Collect(&ComDlg32Plugin{}, hive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 5 {
+		t.Fatalf("expected 5 records, got %d", len(records))
+	}
+
+	want := []map[string]string{
+		{"List": "OpenSavePidlMRU", "Extension": "docx", "Path": `My Computer\C:\Users\report final.docx`,
+			"MRU Position": "0", "Last Used": FormatTime(written), "MFT Entry": "4321"},
+		{"List": "OpenSavePidlMRU", "Extension": "docx", "Path": `My Computer\C:\Users`, "MRU Position": "1"},
+		{"List": "OpenSavePidlMRU", "Extension": "pdf", "Path": `My Computer\C:\Users`},
+		{"List": "LastVisitedPidlMRU", "Program": "WINWORD.EXE", "Path": `My Computer\C:\Users`},
+		{"List": "CIDSizeMRU", "Program": "notepad.exe"},
+	}
+	for i, fields := range want {
+		for name, value := range fields {
+			if f, ok := records[i].Get(name); !ok || FormatValue(f) != value {
+				t.Errorf("record %d: %s = %v, want %s", i, name, f.Value, value)
+			}
+		}
+	}
+	if _, ok := records[1].Get("Last Used"); ok {
+		t.Errorf("unexpected Last Used on an older entry")
+	}
+	for _, name := range []string{"MRU Position", "Last Used"} {
+		if _, ok := records[2].Get(name); ok {
+			t.Errorf("unexpected %s on an entry missing from MRUListEx", name)
+		}
+	}
+	if _, ok := records[4].Get("Path"); ok {
+		t.Errorf("unexpected Path for CIDSizeMRU")
+	}
+}
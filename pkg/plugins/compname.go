@@ -1,6 +1,7 @@
 package plugins
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
@@ -25,32 +26,47 @@ func (p *ComputerNamePlugin) CompatibleHiveTypes() []string {
 	return []string{"SYSTEM"}
 }
 
-func (p *ComputerNamePlugin) Run(hive *regf.Hive) error {
-	paths := []string{
-		"ControlSet001\\Control\\ComputerName\\ComputerName",
-		"ControlSet002\\Control\\ComputerName\\ComputerName",
+func (p *ComputerNamePlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategorySystem,
+		Techniques: []string{"T1082"},
+		Artifact:   "The computer name configured in the active control set.",
+		References: []string{regRipperReference},
+		Version:    "1.0.0",
+		Schema: []FieldSpec{
+			{Name: "Computer Name", Type: FieldString, Description: "NetBIOS computer name"},
+		},
 	}
+}
 
-	fmt.Println("Computer Name Information")
-	fmt.Println("=========================")
-	fmt.Println()
+func (p *ComputerNamePlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
 
-	for _, path := range paths {
+func (p *ComputerNamePlugin) Options() []Option {
+	return []Option{controlSetOption}
+}
+
+func (p *ComputerNamePlugin) Collect(hive *regf.Hive, emit Emitter) error {
+	return p.CollectContext(context.Background(), hive, DefaultOptions(p), emit)
+}
+
+func (p *ComputerNamePlugin) CollectContext(ctx context.Context, hive *regf.Hive, opts Options, emit Emitter) error {
+	return forEachControlSet(ctx, hive, opts, emit, func(controlSet string, emit Emitter) error {
+		path := controlSet + "\\Control\\ComputerName\\ComputerName"
 		key, err := hive.GetKey(path)
 		if err != nil {
-			continue
+			return fmt.Errorf("computer name not found: %w", err)
 		}
 
 		for _, val := range key.Values() {
 			if val.Name() == "ComputerName" {
-				fmt.Printf("Computer Name: %s\n", GetValueString(val))
-				fmt.Printf("Path: %s\n", path)
-				fmt.Printf("Last Modified: %s\n", key.Timestamp().Format("2006-01-02 15:04:05"))
-				fmt.Println()
+				emit(NewRecord(path, key).
+					AddString("Computer Name", GetValueString(val)))
 				return nil
 			}
 		}
-	}
 
-	return fmt.Errorf("computer name not found")
+		return notFound("no ComputerName value")
+	})
 }
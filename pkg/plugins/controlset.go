@@ -0,0 +1,347 @@
+package plugins
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
+)
+
+// ErrControlSetNotFound is returned when a requested control set is not
+// present in the hive.
+var ErrControlSetNotFound = errors.New("control set not found")
+
+// Control set roles, named after the values of SYSTEM\Select.
+const (
+	RoleCurrent       = "Current"
+	RoleDefault       = "Default"
+	RoleFailed        = "Failed"
+	RoleLastKnownGood = "LastKnownGood"
+)
+
+// ControlSet is a ControlSetNNN key at the root of a SYSTEM hive.
+type ControlSet struct {
+	Name      string
+	Number    int
+	LastWrite time.Time
+	// Roles lists the Select values that point at this control set.
+	Roles []string
+}
+
+// ControlSets describes the control sets of a SYSTEM hive and the roles
+// Select assigns to them.
+type ControlSets struct {
+	// SelectLastWrite is the LastWrite time of the Select key.
+	SelectLastWrite time.Time
+	// Roles maps each role to a control set number; a role whose value is
+	// missing or 0 is absent.
+	Roles map[string]int
+	// Sets lists every ControlSetNNN key, in number order.
+	Sets []ControlSet
+}
+
+// ResolveControlSets reads Select and lists the control sets of the hive.
+// It fails only if the hive has neither a Select key nor any control set.
+func ResolveControlSets(hive *regf.Hive) (*ControlSets, error) {
+	cs := &ControlSets{Roles: make(map[string]int)}
+
+	if selectKey, err := hive.GetKey("Select"); err == nil {
+		cs.SelectLastWrite = selectKey.Timestamp()
+		for _, v := range selectKey.Values() {
+			for _, role := range []string{RoleCurrent, RoleDefault, RoleFailed, RoleLastKnownGood} {
+				data := v.Bytes()
+				if strings.EqualFold(v.Name(), role) && len(data) >= 4 {
+					if n := int(binary.LittleEndian.Uint32(data)); n > 0 {
+						cs.Roles[role] = n
+					}
+				}
+			}
+		}
+	}
+
+	if root := hive.RootKey(); root != nil {
+		for _, k := range root.Subkeys() {
+			n, ok := controlSetNumber(k.Name())
+			if !ok {
+				continue
+			}
+			set := ControlSet{Name: k.Name(), Number: n, LastWrite: k.Timestamp()}
+			for _, role := range []string{RoleCurrent, RoleDefault, RoleFailed, RoleLastKnownGood} {
+				if cs.Roles[role] == n {
+					set.Roles = append(set.Roles, role)
+				}
+			}
+			cs.Sets = append(cs.Sets, set)
+		}
+	}
+	sort.Slice(cs.Sets, func(i, j int) bool {
+		return cs.Sets[i].Number < cs.Sets[j].Number
+	})
+
+	if len(cs.Roles) == 0 && len(cs.Sets) == 0 {
+		return nil, fmt.Errorf("%w: no Select key and no ControlSet keys", ErrControlSetNotFound)
+	}
+	return cs, nil
+}
+
+// controlSetNumber parses the number of a "ControlSetNNN" key name.
+func controlSetNumber(name string) (int, bool) {
+	const prefix = "ControlSet"
+	if len(name) <= len(prefix) || !strings.EqualFold(name[:len(prefix)], prefix) {
+		return 0, false
+	}
+	n, err := strconv.Atoi(name[len(prefix):])
+	if err != nil || n < 1 || n > 999 {
+		return 0, false
+	}
+	return n, true
+}
+
+// Number returns the control set with the given number.
+func (cs *ControlSets) Number(n int) (ControlSet, error) {
+	for _, set := range cs.Sets {
+		if set.Number == n {
+			return set, nil
+		}
+	}
+	return ControlSet{}, fmt.Errorf("%w: ControlSet%03d", ErrControlSetNotFound, n)
+}
+
+// Role returns the control set Select assigns to role.
+func (cs *ControlSets) Role(role string) (ControlSet, error) {
+	n, ok := cs.Roles[role]
+	if !ok {
+		return ControlSet{}, fmt.Errorf("%w: Select\\%s is not set", ErrControlSetNotFound, role)
+	}
+	return cs.Number(n)
+}
+
+// Current returns the control set in use when the hive was saved. When
+// Select\Current is missing it falls back to the only control set, if
+// there is exactly one.
+func (cs *ControlSets) Current() (ControlSet, error) {
+	set, err := cs.Role(RoleCurrent)
+	if err != nil && len(cs.Sets) == 1 {
+		return cs.Sets[0], nil
+	}
+	return set, err
+}
+
+// findCurrentControlSet returns the name of the current control set.
+func findCurrentControlSet(hive *regf.Hive) (string, error) {
+	cs, err := ResolveControlSets(hive)
+	if err != nil {
+		return "", err
+	}
+	set, err := cs.Current()
+	if err != nil {
+		return "", err
+	}
+	return set.Name, nil
+}
+
+// Special controlset option values besides roles and numbers.
+const (
+	controlSetAll  = "all"
+	controlSetDiff = "diff"
+)
+
+// controlSetOption is the option shared by plugins that read a control set.
+var controlSetOption = Option{
+	Name:    "controlset",
+	Type:    OptionString,
+	Default: "current",
+	Description: "Control set to read: current, default, failed, lastknowngood, a number such as 2, " +
+		"all (report every control set) or diff (only what differs between control sets)",
+	Validate: func(value string) error {
+		_, _, err := parseControlSetChoice(value)
+		return err
+	},
+}
+
+// parseControlSetChoice splits a controlset option value into a role or a
+// special value, or a control set number.
+func parseControlSetChoice(value string) (string, int, error) {
+	value = strings.TrimSpace(value)
+	switch strings.ToLower(value) {
+	case "", "current":
+		return RoleCurrent, 0, nil
+	case "default":
+		return RoleDefault, 0, nil
+	case "failed":
+		return RoleFailed, 0, nil
+	case "lastknowngood":
+		return RoleLastKnownGood, 0, nil
+	case controlSetAll, controlSetDiff:
+		return strings.ToLower(value), 0, nil
+	}
+	if n, ok := controlSetNumber(value); ok {
+		return "", n, nil
+	}
+	if n, err := strconv.Atoi(value); err == nil && n >= 1 && n <= 999 {
+		return "", n, nil
+	}
+	return "", 0, fmt.Errorf("%q is not a control set", value)
+}
+
+// TagControlSetDiff marks records that are not identical in every control
+// set.
+const TagControlSetDiff = "controlset-diff"
+
+// forEachControlSet runs collect for the control sets chosen by the
+// controlset option. collect receives the control set key name, such as
+// "ControlSet001".
+//
+// With "all", every control set is collected and each record gets a
+// "Control Set" field. With "diff", only records that are missing from, or
+// different in, at least one control set are emitted; they are tagged
+// TagControlSetDiff and list the control sets holding them.
+func forEachControlSet(ctx context.Context, hive *regf.Hive, opts Options, emit Emitter,
+	collect func(controlSet string, emit Emitter) error) error {
+	cs, err := ResolveControlSets(hive)
+	if err != nil {
+		return err
+	}
+
+	role, n, err := parseControlSetChoice(opts.String("controlset"))
+	if err != nil {
+		return err
+	}
+
+	switch role {
+	case controlSetAll:
+		var result setResults
+		for _, set := range cs.Sets {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			name := set.Name
+			result.add(name, collect(name, func(r *Record) {
+				emit(r.AddString("Control Set", name))
+			}))
+		}
+		return result.err()
+
+	case controlSetDiff:
+		return diffControlSets(ctx, cs, emit, collect)
+	}
+
+	var set ControlSet
+	switch {
+	case n > 0:
+		set, err = cs.Number(n)
+	case role == RoleCurrent:
+		set, err = cs.Current()
+	default:
+		set, err = cs.Role(role)
+	}
+	if err != nil {
+		return err
+	}
+	return collect(set.Name, emit)
+}
+
+// diffControlSets collects every control set and emits the records that are
+// not identical in all of them. Records are compared on their key path
+// below the control set and their fields; LastWrite times are ignored.
+func diffControlSets(ctx context.Context, cs *ControlSets, emit Emitter,
+	collect func(controlSet string, emit Emitter) error) error {
+	type entry struct {
+		record *Record
+		sets   []string
+	}
+	var order []string
+	seen := make(map[string]*entry)
+	var result setResults
+
+	for _, set := range cs.Sets {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		name := set.Name
+		err := collect(name, func(r *Record) {
+			sig := recordSignature(name, r)
+			e, ok := seen[sig]
+			if !ok {
+				e = &entry{record: r}
+				seen[sig] = e
+				order = append(order, sig)
+			}
+			if len(e.sets) == 0 || e.sets[len(e.sets)-1] != name {
+				e.sets = append(e.sets, name)
+			}
+		})
+		result.add(name, err)
+	}
+	if result.ok == 0 {
+		return result.err()
+	}
+
+	for _, sig := range order {
+		e := seen[sig]
+		if len(e.sets) == len(cs.Sets) {
+			continue
+		}
+		emit(e.record.
+			AddString("Control Set", strings.SplitN(e.record.KeyPath, "\\", 2)[0]).
+			AddStrings("Present In", e.sets).
+			WithSeverity(SeverityNotice).
+			WithTags(TagControlSetDiff))
+	}
+	return result.err()
+}
+
+// setResults tallies the outcome of collecting several control sets.
+type setResults struct {
+	ok      int
+	missing []error
+	failed  []error
+}
+
+func (s *setResults) add(controlSet string, err error) {
+	switch StatusOf(err) {
+	case StatusOK:
+		s.ok++
+	case StatusNotFound:
+		s.missing = append(s.missing, fmt.Errorf("%s: %w", controlSet, err))
+	default:
+		s.failed = append(s.failed, fmt.Errorf("%s: %w", controlSet, err))
+	}
+}
+
+// err reports the combined outcome: not found when no control set holds
+// the artifact, an error when none could be read, partial when only some
+// could be read, and nil otherwise. A control set lacking the artifact
+// while others hold it is not a failure.
+func (s *setResults) err() error {
+	switch {
+	case len(s.failed) == 0 && s.ok == 0:
+		return errors.Join(s.missing...)
+	case len(s.failed) == 0:
+		return nil
+	case s.ok == 0 && len(s.missing) == 0:
+		return errors.Join(s.failed...)
+	}
+	return partial(s.failed)
+}
+
+// recordSignature identifies a record independently of the control set it
+// was read from.
+func recordSignature(controlSet string, r *Record) string {
+	var b strings.Builder
+	path := r.KeyPath
+	if len(path) >= len(controlSet) && strings.EqualFold(path[:len(controlSet)], controlSet) {
+		path = path[len(controlSet):]
+	}
+	b.WriteString(strings.ToLower(path))
+	for _, f := range r.Fields {
+		b.WriteString("\x00" + f.Name + "=" + FormatValue(f))
+	}
+	return b.String()
+}
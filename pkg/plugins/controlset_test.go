@@ -0,0 +1,104 @@
+package plugins
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func controlSetTestHive(t *testing.T) *testKey {
+	t.Helper()
+	printers := func(names ...string) *testKey {
+		var keys []*testKey
+		for _, name := range names {
+			keys = append(keys, key(name).with(szValue("Port", "LPT1:")))
+		}
+		return key("Control", key("Print", key("Printers", keys...)))
+	}
+	return key("ROOT",
+		key("Select").with(
+			dwordValue("Current", 2),
+			dwordValue("Default", 2),
+			dwordValue("Failed", 0),
+			dwordValue("LastKnownGood", 1),
+		),
+		key("ControlSet001", printers("Office")).at(time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)),
+		key("ControlSet002", printers("Office", "Rogue")).at(time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC)),
+	)
+}
+
+func TestResolveControlSets(t *testing.T) {
+	cs, err := ResolveControlSets(newTestHive(t, controlSetTestHive(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cs.Sets) != 2 {
+		t.Fatalf("expected 2 control sets, got %d", len(cs.Sets))
+	}
+	current, err := cs.Current()
+	if err != nil || current.Name != "ControlSet002" {
+		t.Errorf("unexpected current control set %+v (%v)", current, err)
+	}
+	if len(current.Roles) != 2 || current.LastWrite.Year() != 2024 {
+		t.Errorf("unexpected roles or LastWrite %+v", current)
+	}
+	if lkg, err := cs.Role(RoleLastKnownGood); err != nil || lkg.Number != 1 {
+		t.Errorf("unexpected LastKnownGood %+v (%v)", lkg, err)
+	}
+	if _, err := cs.Role(RoleFailed); !errors.Is(err, ErrControlSetNotFound) {
+		t.Errorf("expected ErrControlSetNotFound for Failed, got %v", err)
+	}
+}
+
+func TestForEachControlSet(t *testing.T) {
+	hive := newTestHive(t, controlSetTestHive(t))
+	p := &PrintersPlugin{}
+
+	collect := func(choice string) []*Record {
+		t.Helper()
+		opts, err := ParseOptions(p, map[string]string{"controlset": choice})
+		if err != nil {
+			t.Fatal(err)
+		}
+		records, err := CollectContext(t.Context(), p, hive, opts)
+		if err != nil {
+			t.Fatalf("%s: %v", choice, err)
+		}
+		return records
+	}
+
+	if records := collect("current"); len(records) != 2 {
+		t.Errorf("current: expected 2 records, got %d", len(records))
+	}
+	if records := collect("lastknowngood"); len(records) != 1 {
+		t.Errorf("lastknowngood: expected 1 record, got %d", len(records))
+	}
+
+	records := collect("all")
+	if len(records) != 3 {
+		t.Fatalf("all: expected 3 records, got %d", len(records))
+	}
+	if f, ok := records[0].Get("Control Set"); !ok || f.Value != "ControlSet001" {
+		t.Errorf("all: unexpected Control Set field %+v", f)
+	}
+
+	records = collect("diff")
+	if len(records) != 1 {
+		t.Fatalf("diff: expected 1 record, got %d", len(records))
+	}
+	r := records[0]
+	if f, _ := r.Get("Printer"); f.Value != "Rogue" {
+		t.Errorf("diff: unexpected printer %+v", f)
+	}
+	if f, ok := r.Get("Present In"); !ok || FormatValue(f) != "ControlSet002" {
+		t.Errorf("diff: unexpected Present In field %+v", f)
+	}
+	if !r.HasTag(TagControlSetDiff) {
+		t.Errorf("diff: expected %s tag, got %v", TagControlSetDiff, r.Tags)
+	}
+
+	opts, _ := ParseOptions(p, map[string]string{"controlset": "7"})
+	if _, err := CollectContext(t.Context(), p, hive, opts); !errors.Is(err, ErrControlSetNotFound) {
+		t.Errorf("expected ErrControlSetNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,639 @@
+package plugins
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
+)
+
+var (
+	// ErrInvalidDefinition is returned for malformed declarative plugins.
+	ErrInvalidDefinition = errors.New("invalid plugin definition")
+	// ErrDuplicatePlugin is returned when a declarative plugin reuses the
+	// name of a registered plugin.
+	ErrDuplicatePlugin = errors.New("plugin already registered")
+)
+
+// Decoders understood by declarative plugin values.
+const (
+	DecodeAuto     = "auto"
+	DecodeString   = "string"
+	DecodeStrings  = "strings"
+	DecodeDWORD    = "dword"
+	DecodeQWORD    = "qword"
+	DecodeFiletime = "filetime"
+	DecodeROT13    = "rot13"
+	DecodeBinary   = "binary"
+)
+
+// Value orders understood by declarative plugins.
+const (
+	OrderMRUList   = "mrulist"
+	OrderMRUListEx = "mrulistex"
+)
+
+// ValueSpec selects values of a matched key and tells how to decode them.
+type ValueSpec struct {
+	// Name is a value name or a wildcard pattern ("*", "Url*"); "" is the
+	// default value.
+	Name string `json:"name"`
+	// Field names the output field. It defaults to the value name, or
+	// "Value" for a wildcard.
+	Field string `json:"field,omitempty"`
+	// Decode is one of the Decode constants; it defaults to auto, which
+	// follows the registry type.
+	Decode string `json:"decode,omitempty"`
+	// NameField names the field holding the value name when Name is a
+	// wildcard; it defaults to "Name".
+	NameField string `json:"name_field,omitempty"`
+	// NameDecode is "rot13" for value names stored ROT13-encoded.
+	NameDecode string `json:"name_decode,omitempty"`
+}
+
+// Definition describes a data-driven plugin, loaded from a JSON file.
+//
+// Each key path is matched against the hive; a path component may hold
+// the wildcards of path.Match. A path starting with CurrentControlSet
+// follows the controlset option. When a value spec has a wildcard, every
+// matching value becomes a record; otherwise each matched key becomes one
+// record with a field per value.
+type Definition struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	HiveTypes   []string    `json:"hive_types"`
+	Keys        []string    `json:"keys"`
+	Values      []ValueSpec `json:"values"`
+	// Order sorts wildcard values by the key's MRUList or MRUListEx value
+	// and adds their position, 0 being the most recent.
+	Order      string `json:"order,omitempty"`
+	OrderField string `json:"order_field,omitempty"`
+	// KeyField, when set, names a field holding the name of the matched
+	// key, useful with wildcard paths.
+	KeyField   string   `json:"key_field,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+	Severity   string   `json:"severity,omitempty"`
+	Category   Category `json:"category,omitempty"`
+	Techniques []string `json:"techniques,omitempty"`
+	Artifact   string   `json:"artifact,omitempty"`
+	References []string `json:"references,omitempty"`
+	Version    string   `json:"version,omitempty"`
+}
+
+var definitionName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Validate checks the definition and fills in defaults.
+func (d *Definition) Validate() error {
+	invalid := func(format string, args ...any) error {
+		return fmt.Errorf("%w: %s: %s", ErrInvalidDefinition, d.Name, fmt.Sprintf(format, args...))
+	}
+
+	if !definitionName.MatchString(d.Name) {
+		return fmt.Errorf("%w: name %q must be lower-case letters, digits, - or _", ErrInvalidDefinition, d.Name)
+	}
+	if d.Description == "" {
+		return invalid("missing description")
+	}
+	for i, t := range d.HiveTypes {
+		role, ok := ParseHiveRole(t)
+		if !ok {
+			return invalid("unknown hive type %q", t)
+		}
+		d.HiveTypes[i] = role
+	}
+	if len(d.Keys) == 0 {
+		return invalid("no keys")
+	}
+	for _, k := range d.Keys {
+		for _, part := range splitKeyPath(k) {
+			if _, err := path.Match(part, ""); err != nil {
+				return invalid("bad key pattern %q", k)
+			}
+		}
+	}
+	if len(d.Values) == 0 {
+		return invalid("no values")
+	}
+	for i := range d.Values {
+		v := &d.Values[i]
+		if v.Decode == "" {
+			v.Decode = DecodeAuto
+		}
+		if _, ok := decoders[v.Decode]; !ok {
+			return invalid("unknown decoder %q", v.Decode)
+		}
+		if v.NameDecode != "" && v.NameDecode != DecodeROT13 {
+			return invalid("name_decode must be %q", DecodeROT13)
+		}
+		if _, err := path.Match(v.Name, ""); err != nil {
+			return invalid("bad value pattern %q", v.Name)
+		}
+		switch {
+		case v.Field != "":
+		case isPattern(v.Name):
+			v.Field = "Value"
+		case v.Name == "":
+			v.Field = "(default)"
+		default:
+			v.Field = v.Name
+		}
+		if v.NameField == "" {
+			v.NameField = "Name"
+		}
+	}
+	switch d.Order {
+	case "", OrderMRUList, OrderMRUListEx:
+	default:
+		return invalid("unknown order %q", d.Order)
+	}
+	if d.OrderField == "" {
+		d.OrderField = "Position"
+	}
+	if _, err := parseSeverity(d.Severity); err != nil {
+		return invalid("%v", err)
+	}
+	if d.Category == "" {
+		d.Category = CategoryOther
+	}
+	known := false
+	for _, c := range Categories() {
+		known = known || c == d.Category
+	}
+	if !known {
+		return invalid("unknown category %q", d.Category)
+	}
+	if d.Version == "" {
+		d.Version = "1.0.0"
+	}
+	return nil
+}
+
+// parseSeverity parses the name of a severity; "" is SeverityInfo.
+func parseSeverity(name string) (Severity, error) {
+	if name == "" {
+		return SeverityInfo, nil
+	}
+	for s := SeverityInfo; s <= SeverityCritical; s++ {
+		if strings.EqualFold(name, s.String()) {
+			return s, nil
+		}
+	}
+	return SeverityInfo, fmt.Errorf("unknown severity %q", name)
+}
+
+// decoder turns a registry value into a field of the given type.
+type decoder struct {
+	typ    FieldType
+	decode func(v *regf.Value) (any, bool)
+}
+
+var decoders = map[string]decoder{
+	DecodeAuto: {FieldString, nil},
+	DecodeString: {FieldString, func(v *regf.Value) (any, bool) {
+		if v.Type() == regBinary {
+			return parseNullTerminatedString(v.Bytes()), true
+		}
+		return GetValueString(v), true
+	}},
+	DecodeStrings: {FieldStrings, func(v *regf.Value) (any, bool) {
+		return GetValueStrings(v), true
+	}},
+	DecodeDWORD: {FieldInt, func(v *regf.Value) (any, bool) {
+		data := v.Bytes()
+		if len(data) < 4 {
+			return nil, false
+		}
+		return int64(binary.LittleEndian.Uint32(data)), true
+	}},
+	DecodeQWORD: {FieldInt, func(v *regf.Value) (any, bool) {
+		data := v.Bytes()
+		if len(data) < 8 {
+			return nil, false
+		}
+		return int64(binary.LittleEndian.Uint64(data)), true
+	}},
+	DecodeFiletime: {FieldTime, func(v *regf.Value) (any, bool) {
+		data := v.Bytes()
+		if len(data) < 8 {
+			return nil, false
+		}
+		t := filetimeToTime(binary.LittleEndian.Uint64(data))
+		return t, !t.IsZero()
+	}},
+	DecodeROT13: {FieldString, func(v *regf.Value) (any, bool) {
+		return rot13(GetValueString(v)), true
+	}},
+	DecodeBinary: {FieldBytes, func(v *regf.Value) (any, bool) {
+		return v.Bytes(), true
+	}},
+}
+
+// field decodes v as the spec says.
+func (s ValueSpec) field(v *regf.Value) (Field, bool) {
+	dec := decoders[s.Decode]
+	if dec.decode == nil {
+		return valueField(s.Field, v), true
+	}
+	value, ok := dec.decode(v)
+	return Field{Name: s.Field, Type: dec.typ, Value: value}, ok
+}
+
+// isPattern reports whether name holds wildcards.
+func isPattern(name string) bool {
+	return strings.ContainsAny(name, "*?[")
+}
+
+// matchName matches a key or value name against a pattern, ignoring case
+// as the registry does.
+func matchName(pattern, name string) bool {
+	ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(name))
+	return ok
+}
+
+// splitKeyPath splits a key path on backslashes, dropping empty parts.
+func splitKeyPath(keyPath string) []string {
+	var parts []string
+	for _, part := range strings.Split(keyPath, "\\") {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// matchedKey is a key found by a key path pattern.
+type matchedKey struct {
+	path string
+	key  *regf.Key
+}
+
+// matchKeys returns the keys matching a key path pattern, in hive order.
+func matchKeys(hive *regf.Hive, pattern string) []matchedKey {
+	root := hive.RootKey()
+	if root == nil {
+		return nil
+	}
+	current := []matchedKey{{key: root}}
+	for _, part := range splitKeyPath(pattern) {
+		var next []matchedKey
+		for _, m := range current {
+			for _, sub := range m.key.Subkeys() {
+				if matchName(part, sub.Name()) {
+					next = append(next, matchedKey{path: joinKeyPath(m.path, sub.Name()), key: sub})
+				}
+			}
+		}
+		current = next
+	}
+	return current
+}
+
+// DeclarativePlugin runs a Definition.
+type DeclarativePlugin struct {
+	def      Definition
+	severity Severity
+	source   string
+}
+
+// NewDeclarativePlugin validates a definition and returns its plugin.
+func NewDeclarativePlugin(def Definition) (*DeclarativePlugin, error) {
+	if err := def.Validate(); err != nil {
+		return nil, err
+	}
+	severity, _ := parseSeverity(def.Severity)
+	return &DeclarativePlugin{def: def, severity: severity}, nil
+}
+
+func (p *DeclarativePlugin) Name() string {
+	return p.def.Name
+}
+
+func (p *DeclarativePlugin) Description() string {
+	return p.def.Description
+}
+
+// Source returns the file the plugin was loaded from, if any.
+func (p *DeclarativePlugin) Source() string {
+	return p.source
+}
+
+func (p *DeclarativePlugin) CompatibleHiveTypes() []string {
+	return p.def.HiveTypes
+}
+
+func (p *DeclarativePlugin) Metadata() Metadata {
+	m := Metadata{
+		Category:   p.def.Category,
+		Techniques: p.def.Techniques,
+		Artifact:   p.def.Artifact,
+		References: p.def.References,
+		Version:    p.def.Version,
+	}
+	if p.def.KeyField != "" {
+		m.Schema = append(m.Schema, FieldSpec{Name: p.def.KeyField, Type: FieldString, Description: "matched key name"})
+	}
+	for _, v := range p.def.Values {
+		if isPattern(v.Name) {
+			m.Schema = append(m.Schema, FieldSpec{Name: v.NameField, Type: FieldString, Description: "value name"})
+		}
+		m.Schema = append(m.Schema, FieldSpec{Name: v.Field, Type: decoders[v.Decode].typ, Description: v.Decode + " of value " + strconv.Quote(v.Name)})
+	}
+	if p.def.Order != "" {
+		m.Schema = append(m.Schema, FieldSpec{Name: p.def.OrderField, Type: FieldInt, Description: "position in " + p.def.Order + ", 0 is the most recent"})
+	}
+	return m
+}
+
+func (p *DeclarativePlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
+
+// usesControlSet reports whether a key path goes through the current
+// control set.
+func (p *DeclarativePlugin) usesControlSet() bool {
+	for _, k := range p.def.Keys {
+		if parts := splitKeyPath(k); len(parts) > 0 && strings.EqualFold(parts[0], "CurrentControlSet") {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *DeclarativePlugin) Options() []Option {
+	if p.usesControlSet() {
+		return []Option{controlSetOption}
+	}
+	return nil
+}
+
+func (p *DeclarativePlugin) Collect(hive *regf.Hive, emit Emitter) error {
+	return p.CollectContext(context.Background(), hive, DefaultOptions(p), emit)
+}
+
+func (p *DeclarativePlugin) CollectContext(ctx context.Context, hive *regf.Hive, opts Options, emit Emitter) error {
+	if !p.usesControlSet() {
+		return p.collectKeys(ctx, hive, "", emit)
+	}
+	return forEachControlSet(ctx, hive, opts, emit, func(controlSet string, emit Emitter) error {
+		return p.collectKeys(ctx, hive, controlSet, emit)
+	})
+}
+
+// collectKeys emits the records of every key matching the definition.
+// controlSet replaces a leading CurrentControlSet.
+func (p *DeclarativePlugin) collectKeys(ctx context.Context, hive *regf.Hive, controlSet string, emit Emitter) error {
+	perValue := false
+	for _, v := range p.def.Values {
+		perValue = perValue || isPattern(v.Name)
+	}
+
+	found := false
+	for _, pattern := range p.def.Keys {
+		parts := splitKeyPath(pattern)
+		if controlSet != "" && len(parts) > 0 && strings.EqualFold(parts[0], "CurrentControlSet") {
+			parts[0] = controlSet
+		}
+		for _, m := range matchKeys(hive, strings.Join(parts, "\\")) {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			found = true
+			if perValue {
+				p.emitValues(m, emit)
+			} else {
+				p.emitKey(m, emit)
+			}
+		}
+	}
+	if !found {
+		return notFound("no key matches %s", strings.Join(p.def.Keys, ", "))
+	}
+	return nil
+}
+
+// newRecord starts a record for a matched key.
+func (p *DeclarativePlugin) newRecord(m matchedKey) *Record {
+	r := NewRecord(m.path, m.key).WithSeverity(p.severity)
+	if len(p.def.Tags) > 0 {
+		r.WithTags(p.def.Tags...)
+	}
+	if p.def.KeyField != "" {
+		r.AddString(p.def.KeyField, m.key.Name())
+	}
+	return r
+}
+
+// emitKey emits one record per key with a field per matching value.
+func (p *DeclarativePlugin) emitKey(m matchedKey, emit Emitter) {
+	r := p.newRecord(m)
+	added := false
+	for _, spec := range p.def.Values {
+		for _, v := range m.key.Values() {
+			if !strings.EqualFold(v.Name(), spec.Name) {
+				continue
+			}
+			if f, ok := spec.field(v); ok {
+				r.Fields = append(r.Fields, f)
+				added = true
+			}
+			break
+		}
+	}
+	if added {
+		emit(r)
+	}
+}
+
+// emitValues emits one record per value matching a wildcard spec, in MRU
+// order when the definition asks for it.
+func (p *DeclarativePlugin) emitValues(m matchedKey, emit Emitter) {
+	values := m.key.Values()
+	positions := mruPositions(m.key, p.def.Order)
+	if positions != nil {
+		sort.SliceStable(values, func(i, j int) bool {
+			pi, iok := positions[strings.ToLower(values[i].Name())]
+			pj, jok := positions[strings.ToLower(values[j].Name())]
+			if iok != jok {
+				return iok
+			}
+			return pi < pj
+		})
+	}
+
+	for _, v := range values {
+		name := v.Name()
+		if positions != nil && (strings.EqualFold(name, "MRUList") || strings.EqualFold(name, "MRUListEx")) {
+			continue
+		}
+		for _, spec := range p.def.Values {
+			if !matchName(spec.Name, name) {
+				continue
+			}
+			f, ok := spec.field(v)
+			if !ok {
+				break
+			}
+			r := p.newRecord(m)
+			if isPattern(spec.Name) {
+				if spec.NameDecode == DecodeROT13 {
+					name = rot13(name)
+				}
+				r.AddString(spec.NameField, name)
+			}
+			r.Fields = append(r.Fields, f)
+			if pos, ok := positions[strings.ToLower(v.Name())]; ok {
+				r.AddInt(p.def.OrderField, int64(pos))
+			}
+			emit(r)
+			break
+		}
+	}
+}
+
+// mruPositions maps value names, lower-cased, to their position in the
+// key's MRUList or MRUListEx value. It returns nil when order is "" or the
+// key has no such value.
+func mruPositions(key *regf.Key, order string) map[string]int {
+	var list *regf.Value
+	for _, v := range key.Values() {
+		if (order == OrderMRUList && strings.EqualFold(v.Name(), "MRUList")) ||
+			(order == OrderMRUListEx && strings.EqualFold(v.Name(), "MRUListEx")) {
+			list = v
+		}
+	}
+	if list == nil {
+		return nil
+	}
+
+	positions := make(map[string]int)
+	switch order {
+	case OrderMRUList:
+		for i, c := range GetValueString(list) {
+			positions[strings.ToLower(string(c))] = i
+		}
+	case OrderMRUListEx:
+		data := list.Bytes()
+		for i := 0; i+4 <= len(data); i += 4 {
+			n := binary.LittleEndian.Uint32(data[i:])
+			if n == 0xFFFFFFFF {
+				break
+			}
+			positions[strconv.FormatUint(uint64(n), 10)] = i / 4
+		}
+	}
+	return positions
+}
+
+// DefaultPluginDir returns the per-user directory of declarative plugins,
+// <config dir>/hivedigger/plugins.
+func DefaultPluginDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "hivedigger", "plugins")
+}
+
+// LoadDefinitions reads every *.json file of dir, each holding one
+// Definition, and returns their plugins sorted by name. YAML definitions
+// are rejected rather than skipped, as only JSON is supported.
+func LoadDefinitions(dir string) ([]*DeclarativePlugin, error) {
+	for _, pattern := range []string{"*.yaml", "*.yml"} {
+		yaml, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		if len(yaml) > 0 {
+			return nil, fmt.Errorf("%w: %s: YAML is not supported, convert the definition to JSON",
+				ErrInvalidDefinition, yaml[0])
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	var list []*DeclarativePlugin
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read plugin: %w", err)
+		}
+		var def Definition
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&def); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidDefinition, file, err)
+		}
+		p, err := NewDeclarativePlugin(def)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		p.source = file
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name() < list[j].Name()
+	})
+	return list, nil
+}
+
+// RegisterDir loads the declarative plugins of dir and registers them
+// alongside the Go plugins. An empty dir means DefaultPluginDir, which may
+// be missing; a dir given explicitly must exist. A definition may not reuse
+// the name of a registered plugin or of another definition. It returns the
+// names of the plugins registered.
+func RegisterDir(dir string) ([]string, error) {
+	if dir == "" {
+		dir = DefaultPluginDir()
+		if dir == "" {
+			return nil, nil
+		}
+		if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+	} else {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return nil, fmt.Errorf("plugin directory: %w", err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("plugin directory: %s is not a directory", dir)
+		}
+	}
+
+	list, err := LoadDefinitions(dir)
+	if err != nil {
+		return nil, err
+	}
+	sources := make(map[string]string, len(list))
+	for _, p := range list {
+		if _, exists := registry[p.Name()]; exists {
+			return nil, fmt.Errorf("%w: %s (%s)", ErrDuplicatePlugin, p.Name(), p.Source())
+		}
+		if other, exists := sources[p.Name()]; exists {
+			return nil, fmt.Errorf("%w: %s (%s and %s)", ErrDuplicatePlugin, p.Name(), other, p.Source())
+		}
+		sources[p.Name()] = p.Source()
+	}
+
+	names := make([]string, 0, len(list))
+	for _, p := range list {
+		Register(p)
+		names = append(names, p.Name())
+	}
+	return names, nil
+}
@@ -0,0 +1,206 @@
+package plugins
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeclarativePlugin(t *testing.T) {
+	mruListEx := make([]byte, 0, 12)
+	for _, n := range []uint32{1, 0, 0xFFFFFFFF} {
+		mruListEx = binary.LittleEndian.AppendUint32(mruListEx, n)
+	}
+	visited := time.Date(2024, 6, 1, 8, 0, 0, 0, time.UTC)
+	hive := newTestHive(t, key("ROOT",
+		key("Software", key("Vendor",
+			key("Docs", key(".txt").with(
+				binValue("0", utf16le("old.txt\x00")),
+				binValue("1", utf16le("new.txt\x00")),
+				binValue("MRUListEx", mruListEx),
+			)),
+			key("Tool").with(
+				szValue("Path", `C:\Tools\tool.exe`),
+				dwordValue("Runs", 7),
+				binValue("Last", binary.LittleEndian.AppendUint64(nil, filetime(visited))),
+				szValue(rot13("Secret"), "ignored"),
+			),
+		)),
+	))
+
+	docs, err := NewDeclarativePlugin(Definition{
+		Name:        "docs",
+		Description: "Documents by extension",
+		HiveTypes:   []string{"ntuser"},
+		Keys:        []string{`Software\Vendor\Docs\*`},
+		Values:      []ValueSpec{{Name: "*", Field: "Document", Decode: DecodeString}},
+		Order:       OrderMRUListEx,
+		KeyField:    "Extension",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := Collect(docs, hive)
+	if err != nil || len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d (%v)", len(records), err)
+	}
+	if f, _ := records[0].Get("Document"); f.Value != "new.txt" {
+		t.Errorf("expected new.txt first, got %+v", f)
+	}
+	if f, _ := records[0].Get("Position"); f.Value != int64(0) {
+		t.Errorf("unexpected position %+v", f)
+	}
+	if f, _ := records[0].Get("Extension"); f.Value != ".txt" {
+		t.Errorf("unexpected key field %+v", f)
+	}
+
+	tool, err := NewDeclarativePlugin(Definition{
+		Name:        "tool",
+		Description: "Tool settings",
+		Keys:        []string{`Software\Vendor\Tool`},
+		Values: []ValueSpec{
+			{Name: "path"},
+			{Name: "Runs", Decode: DecodeDWORD},
+			{Name: "Last", Field: "Last Run", Decode: DecodeFiletime},
+			{Name: "Missing"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err = Collect(tool, hive)
+	if err != nil || len(records) != 1 {
+		t.Fatalf("expected 1 record, got %d (%v)", len(records), err)
+	}
+	r := records[0]
+	if len(r.Fields) != 3 {
+		t.Errorf("expected 3 fields, got %+v", r.Fields)
+	}
+	if f, _ := r.Get("Runs"); f.Value != int64(7) || f.Type != FieldInt {
+		t.Errorf("unexpected Runs field %+v", f)
+	}
+	if f, _ := r.Get("Last Run"); f.Type != FieldTime || !f.Value.(time.Time).Equal(visited) {
+		t.Errorf("unexpected Last Run field %+v", f)
+	}
+
+	secret, err := NewDeclarativePlugin(Definition{
+		Name:        "secret",
+		Description: "ROT13 names",
+		Keys:        []string{`Software\Vendor\Tool`},
+		Values:      []ValueSpec{{Name: rot13("S") + "*", NameDecode: DecodeROT13}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, _ = Collect(secret, hive)
+	if len(records) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(records))
+	}
+	if f, _ := records[0].Get("Name"); f.Value != "Secret" {
+		t.Errorf("unexpected decoded name %+v", f)
+	}
+}
+
+func TestDefinitionValidate(t *testing.T) {
+	valid := func() Definition {
+		return Definition{Name: "ok", Description: "d", Keys: []string{"A"}, Values: []ValueSpec{{Name: "*"}}}
+	}
+	for name, mutate := range map[string]func(d *Definition){
+		"name":     func(d *Definition) { d.Name = "Bad Name" },
+		"hive":     func(d *Definition) { d.HiveTypes = []string{"BOOT"} },
+		"keys":     func(d *Definition) { d.Keys = nil },
+		"decoder":  func(d *Definition) { d.Values[0].Decode = "base64" },
+		"order":    func(d *Definition) { d.Order = "lru" },
+		"severity": func(d *Definition) { d.Severity = "urgent" },
+		"category": func(d *Definition) { d.Category = "misc" },
+	} {
+		d := valid()
+		mutate(&d)
+		if err := d.Validate(); !errors.Is(err, ErrInvalidDefinition) {
+			t.Errorf("%s: expected ErrInvalidDefinition, got %v", name, err)
+		}
+	}
+}
+
+func TestRegisterDir(t *testing.T) {
+	dir := t.TempDir()
+	def := `{"name": "test-runonce", "description": "RunOnce entries", "hive_types": ["SOFTWARE"],
+		"keys": ["Microsoft\\Windows\\CurrentVersion\\RunOnce"],
+		"values": [{"name": "*", "field": "Command"}], "category": "persistence"}`
+	if err := os.WriteFile(filepath.Join(dir, "runonce.json"), []byte(def), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		delete(registry, "test-runonce")
+		delete(hiveTypeMap, "test-runonce")
+	})
+
+	names, err := RegisterDir(dir)
+	if err != nil || len(names) != 1 {
+		t.Fatalf("expected 1 plugin, got %v (%v)", names, err)
+	}
+	if !IsCompatibleWithHiveType("test-runonce", "SOFTWARE") || IsCompatibleWithHiveType("test-runonce", "SYSTEM") {
+		t.Error("declared hive types are not registered")
+	}
+	if _, err := RegisterDir(dir); !errors.Is(err, ErrDuplicatePlugin) {
+		t.Errorf("expected ErrDuplicatePlugin, got %v", err)
+	}
+
+	twinDir := t.TempDir()
+	for _, name := range []string{"a.json", "b.json"} {
+		twin := strings.Replace(def, "test-runonce", "test-twin", 1)
+		if err := os.WriteFile(filepath.Join(twinDir, name), []byte(twin), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = RegisterDir(twinDir)
+	if !errors.Is(err, ErrDuplicatePlugin) || !strings.Contains(err.Error(), "a.json") ||
+		!strings.Contains(err.Error(), "b.json") {
+		t.Errorf("expected ErrDuplicatePlugin naming both files, got %v", err)
+	}
+	if _, ok := registry["test-twin"]; ok {
+		delete(registry, "test-twin")
+		t.Error("duplicate definitions were registered")
+	}
+
+	if _, err := RegisterDir(filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected an error for a missing plugin directory")
+	}
+	if _, err := RegisterDir(filepath.Join(dir, "runonce.json")); err == nil {
+		t.Error("expected an error for a plugin directory that is a file")
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "run.json"), []byte(`{"name": "run", "unknown": 1}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadDefinitions(dir); !errors.Is(err, ErrInvalidDefinition) {
+		t.Errorf("expected ErrInvalidDefinition, got %v", err)
+	}
+
+	yamlDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(yamlDir, "run.yml"), []byte("name: run\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadDefinitions(yamlDir); !errors.Is(err, ErrInvalidDefinition) {
+		t.Errorf("expected ErrInvalidDefinition for a YAML definition, got %v", err)
+	}
+}
+
+func TestExampleDefinitions(t *testing.T) {
+	list, err := LoadDefinitions(filepath.Join("..", "..", "example", "plugins"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) == 0 {
+		t.Fatal("no example definitions found")
+	}
+	for _, p := range list {
+		if _, exists := registry[p.Name()]; exists {
+			t.Errorf("example %s clashes with a built-in plugin", p.Name())
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package plugins
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
@@ -25,35 +26,48 @@ func (p *EnvironmentPlugin) CompatibleHiveTypes() []string {
 	return []string{"SYSTEM"}
 }
 
-func (p *EnvironmentPlugin) Run(hive *regf.Hive) error {
-	paths := []string{
-		"ControlSet001\\Control\\Session Manager\\Environment",
-		"ControlSet002\\Control\\Session Manager\\Environment",
+func (p *EnvironmentPlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategorySystem,
+		Techniques: []string{"T1574.007"},
+		Artifact:   "System environment variables, including the PATH searched for executables.",
+		References: []string{regRipperReference},
+		Version:    "1.0.0",
+		Schema: []FieldSpec{
+			{Name: "Variable", Type: FieldString, Description: "variable name"},
+			{Name: "Value", Type: FieldString, Description: "variable value"},
+		},
 	}
+}
+
+func (p *EnvironmentPlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
 
-	fmt.Println("System Environment Variables")
-	fmt.Println("============================")
-	fmt.Println()
+func (p *EnvironmentPlugin) Options() []Option {
+	return []Option{controlSetOption}
+}
 
-	for _, path := range paths {
+func (p *EnvironmentPlugin) Collect(hive *regf.Hive, emit Emitter) error {
+	return p.CollectContext(context.Background(), hive, DefaultOptions(p), emit)
+}
+
+func (p *EnvironmentPlugin) CollectContext(ctx context.Context, hive *regf.Hive, opts Options, emit Emitter) error {
+	return forEachControlSet(ctx, hive, opts, emit, func(controlSet string, emit Emitter) error {
+		path := controlSet + "\\Control\\Session Manager\\Environment"
 		key, err := hive.GetKey(path)
 		if err != nil {
-			continue
+			return fmt.Errorf("environment key not found: %w", err)
 		}
 
-		fmt.Printf("[%s]\n", path)
-		fmt.Printf("Last Modified: %s\n", key.Timestamp().Format("2006-01-02 15:04:05"))
-		fmt.Println()
-
 		for _, val := range key.Values() {
 			if val.Name() != "" {
-				fmt.Printf("%s = %s\n", val.Name(), GetValueString(val))
+				emit(NewRecord(path, key).
+					AddString("Variable", val.Name()).
+					AddString("Value", GetValueString(val)))
 			}
 		}
-		fmt.Println()
 
 		return nil
-	}
-
-	return fmt.Errorf("environment key not found")
+	})
 }
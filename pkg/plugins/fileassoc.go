@@ -1,6 +1,7 @@
 package plugins
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
@@ -10,6 +11,14 @@ func init() {
 	Register(&FileAssocPlugin{})
 }
 
+var fileAssocLimitOption = Option{
+	Name:        "limit",
+	Type:        OptionInt,
+	Default:     "50",
+	Description: "Maximum number of associations to list (0 for no limit)",
+	Validate:    validateLimit,
+}
+
 // FileAssocPlugin displays file associations from SOFTWARE hive.
 type FileAssocPlugin struct{}
 
@@ -25,7 +34,33 @@ func (p *FileAssocPlugin) CompatibleHiveTypes() []string {
 	return []string{"SOFTWARE"}
 }
 
+func (p *FileAssocPlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategoryPersistence,
+		Techniques: []string{"T1546.001"},
+		Artifact:   "File extension associations decide which handler opens a file type; a changed handler runs attacker code.",
+		References: []string{regRipperReference},
+		Version:    "1.0.0",
+		Schema: []FieldSpec{
+			{Name: "Extension", Type: FieldString, Description: "file extension"},
+			{Name: "Handler", Type: FieldString, Description: "ProgID handling the extension"},
+		},
+	}
+}
+
 func (p *FileAssocPlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
+
+func (p *FileAssocPlugin) Options() []Option {
+	return []Option{fileAssocLimitOption}
+}
+
+func (p *FileAssocPlugin) Collect(hive *regf.Hive, emit Emitter) error {
+	return p.CollectContext(context.Background(), hive, DefaultOptions(p), emit)
+}
+
+func (p *FileAssocPlugin) CollectContext(ctx context.Context, hive *regf.Hive, opts Options, emit Emitter) error {
 	path := "Classes"
 
 	key, err := hive.GetKey(path)
@@ -33,12 +68,12 @@ func (p *FileAssocPlugin) Run(hive *regf.Hive) error {
 		return fmt.Errorf("classes key not found: %w", err)
 	}
 
-	fmt.Println("File Associations")
-	fmt.Println("=================")
-	fmt.Println()
-
 	count := 0
 	for _, subkey := range key.Subkeys() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		name := subkey.Name()
 		if len(name) > 0 && name[0] == '.' {
 			// This is a file extension
@@ -51,10 +86,11 @@ func (p *FileAssocPlugin) Run(hive *regf.Hive) error {
 			}
 
 			if defaultValue != "" {
-				fmt.Printf("%s -> %s\n", name, defaultValue)
+				emit(NewRecord(joinKeyPath(path, name), subkey).
+					AddString("Extension", name).
+					AddString("Handler", defaultValue))
 				count++
-				if count >= 50 {
-					fmt.Println("... (truncated)")
+				if limit := opts.Int("limit"); limit > 0 && count >= limit {
 					break
 				}
 			}
@@ -0,0 +1,51 @@
+package plugins
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
+)
+
+// HiveTypeFromName guesses the hive type from a file name, for example
+// "SYSTEM" for "SYSTEM.LOG1"-style copies or "NTUSER.DAT" for
+// "NTUSER.DAT_john". It returns "" when the name is not recognised.
+func HiveTypeFromName(name string) string {
+	name = strings.ToUpper(filepath.Base(strings.ReplaceAll(name, "\\", "/")))
+
+	switch {
+	case name == "SYSTEM" || strings.HasPrefix(name, "SYSTEM."):
+		return "SYSTEM"
+	case name == "SOFTWARE" || strings.HasPrefix(name, "SOFTWARE."):
+		return "SOFTWARE"
+	case name == "SAM" || strings.HasPrefix(name, "SAM."):
+		return "SAM"
+	case name == "SECURITY" || strings.HasPrefix(name, "SECURITY."):
+		return "SECURITY"
+	case strings.HasPrefix(name, "NTUSER.DAT"):
+		return "NTUSER.DAT"
+	case strings.HasPrefix(name, "USRCLASS.DAT"):
+		return "USRCLASS.DAT"
+	case strings.HasPrefix(name, "AMCACHE.HVE"):
+		return "AMCACHE.HVE"
+	case strings.HasPrefix(name, "SYSCACHE.HVE"):
+		return "SYSCACHE.HVE"
+	case strings.HasSuffix(name, ".HIVE"):
+		return "Custom"
+	}
+	return ""
+}
+
+// DetectHiveType returns the hive type of an open hive, trying the file
+// name on disk first and then the name recorded in the hive's base block.
+func DetectHiveType(path string, hive *regf.Hive) string {
+	if t := HiveTypeFromName(path); t != "" && t != "Custom" {
+		return t
+	}
+	if hive != nil {
+		if t := HiveTypeFromName(hive.FileName()); t != "" && t != "Custom" {
+			return t
+		}
+	}
+	return HiveTypeFromName(path)
+}
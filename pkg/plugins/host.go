@@ -0,0 +1,190 @@
+package plugins
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
+)
+
+// ErrMissingHive is returned when a multi-hive plugin runs on a host that
+// lacks one of its required hives.
+var ErrMissingHive = errors.New("required hive missing")
+
+// HiveRoles lists the hive types a host can hold. A hive's role is its hive
+// type.
+func HiveRoles() []string {
+	return []string{"SYSTEM", "SOFTWARE", "SAM", "SECURITY", "NTUSER.DAT", "USRCLASS.DAT", "AMCACHE.HVE", "SYSCACHE.HVE"}
+}
+
+// ParseHiveRole matches a role name case-insensitively, with or without its
+// extension, so "ntuser" and "NTUSER.DAT" both give "NTUSER.DAT".
+func ParseHiveRole(name string) (string, bool) {
+	for _, role := range HiveRoles() {
+		short, _, _ := strings.Cut(role, ".")
+		if strings.EqualFold(name, role) || strings.EqualFold(name, short) {
+			return role, true
+		}
+	}
+	return "", false
+}
+
+// HostHive is one hive of a host and the role it plays.
+type HostHive struct {
+	Role string
+	Path string
+	Hive *regf.Hive
+}
+
+// Host is the set of hives collected from one machine. A role may hold
+// several hives, such as one NTUSER.DAT per user.
+type Host struct {
+	Name  string
+	Hives []HostHive
+
+	sids *SIDResolver
+}
+
+// HostFromHive returns a host holding a single hive, whose role is
+// detected from its path and base block.
+func HostFromHive(path string, hive *regf.Hive) *Host {
+	return &Host{Hives: []HostHive{{Role: DetectHiveType(path, hive), Path: path, Hive: hive}}}
+}
+
+// Add adds a hive to the host.
+func (h *Host) Add(role, path string, hive *regf.Hive) {
+	h.Hives = append(h.Hives, HostHive{Role: role, Path: path, Hive: hive})
+	h.sids = nil
+}
+
+// SIDs returns the resolver of the SIDs of the host, read from its hives
+// on first use.
+func (h *Host) SIDs() *SIDResolver {
+	if h.sids == nil {
+		h.sids = NewSIDResolver(h)
+	}
+	return h.sids
+}
+
+// Lookup returns the first hive with the given role.
+func (h *Host) Lookup(role string) (HostHive, bool) {
+	for _, hh := range h.Hives {
+		if hh.Role == role {
+			return hh, true
+		}
+	}
+	return HostHive{}, false
+}
+
+// Hive returns the first hive with the given role, or nil.
+func (h *Host) Hive(role string) *regf.Hive {
+	hh, _ := h.Lookup(role)
+	return hh.Hive
+}
+
+// All returns every hive with the given role, in the order they were added.
+func (h *Host) All(role string) []HostHive {
+	var hives []HostHive
+	for _, hh := range h.Hives {
+		if hh.Role == role {
+			hives = append(hives, hh)
+		}
+	}
+	return hives
+}
+
+// Roles returns the roles present on the host, in the order they were
+// first added.
+func (h *Host) Roles() []string {
+	var roles []string
+	seen := make(map[string]bool)
+	for _, hh := range h.Hives {
+		if !seen[hh.Role] {
+			seen[hh.Role] = true
+			roles = append(roles, hh.Role)
+		}
+	}
+	return roles
+}
+
+// MultiHivePlugin is implemented by plugins that correlate several hives of
+// a host, such as SYSTEM and SOFTWARE. They may also implement
+// ContextPlugin to run on a single hive.
+type MultiHivePlugin interface {
+	Plugin
+	// RequiredHives lists the roles the plugin cannot run without. The
+	// first one is the plugin's primary hive.
+	RequiredHives() []string
+	// OptionalHives lists roles the plugin uses when they are present.
+	OptionalHives() []string
+	// CollectHost reads the hives of the host with the given options and
+	// passes each result to emit. It returns ctx.Err() once ctx is
+	// cancelled.
+	CollectHost(ctx context.Context, host *Host, opts Options, emit Emitter) error
+}
+
+// MissingHives returns the required roles of p that host lacks.
+func MissingHives(p MultiHivePlugin, host *Host) []string {
+	var missing []string
+	for _, role := range p.RequiredHives() {
+		if _, ok := host.Lookup(role); !ok {
+			missing = append(missing, role)
+		}
+	}
+	return missing
+}
+
+// PrimaryHive returns the hive a plugin reports on: the first required
+// hive of a multi-hive plugin, or the first hive the plugin is compatible
+// with. A host with a single hive always returns that hive.
+func PrimaryHive(p Plugin, host *Host) (HostHive, bool) {
+	if mp, ok := p.(MultiHivePlugin); ok && len(mp.RequiredHives()) > 0 {
+		if hh, ok := host.Lookup(mp.RequiredHives()[0]); ok {
+			return hh, true
+		}
+	}
+	if len(host.Hives) == 1 {
+		return host.Hives[0], true
+	}
+	for _, hh := range host.Hives {
+		if IsCompatibleWithHiveType(p.Name(), hh.Role) {
+			return hh, true
+		}
+	}
+	return HostHive{}, false
+}
+
+// CollectHost runs the plugin on a host and returns its records.
+// Multi-hive plugins receive the whole host; other plugins run on their
+// primary hive. Either way the plugin resolves SIDs with the hives of the
+// host.
+func CollectHost(ctx context.Context, p Plugin, host *Host, opts Options) ([]*Record, error) {
+	if _, ok := ctx.Value(sidResolverKey{}).(*SIDResolver); !ok {
+		ctx = WithSIDResolver(ctx, host.SIDs())
+	}
+	mp, ok := p.(MultiHivePlugin)
+	if !ok {
+		hh, ok := PrimaryHive(p, host)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s needs one of %s", ErrMissingHive, p.Name(), strings.Join(hiveTypeMap[p.Name()], ", "))
+		}
+		return CollectContext(ctx, p, hh.Hive, opts)
+	}
+
+	if missing := MissingHives(mp, host); len(missing) > 0 {
+		return nil, fmt.Errorf("%w: %s needs %s", ErrMissingHive, p.Name(), strings.Join(missing, ", "))
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var records []*Record
+	err := mp.CollectHost(ctx, host, opts, func(r *Record) {
+		if ctx.Err() == nil {
+			records = append(records, r)
+		}
+	})
+	return records, err
+}
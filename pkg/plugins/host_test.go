@@ -0,0 +1,66 @@
+package plugins
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCollectHostMultiHive(t *testing.T) {
+	const sid = "S-1-5-21-1111-2222-3333-1001"
+	ran := time.Date(2024, 2, 3, 4, 5, 6, 0, time.UTC)
+	system := newTestHive(t, key("ROOT",
+		key("Select").with(dwordValue("Current", 1)),
+		key("ControlSet001", key("Services", key("bam", key("State", key("UserSettings",
+			key(sid).with(binValue(`\Device\HarddiskVolume3\Tools\x.exe`, binary.LittleEndian.AppendUint64(nil, filetime(ran)))),
+		))))),
+	))
+	software := newTestHive(t, key("ROOT",
+		key("Microsoft", key("Windows NT", key("CurrentVersion", key("ProfileList",
+			key(sid).with(szValue("ProfileImagePath", `C:\Users\alice`)),
+		)))),
+	))
+
+	p := &BAMPlugin{}
+	host := &Host{}
+	host.Add("SYSTEM", "SYSTEM", system)
+
+	records, err := CollectHost(context.Background(), p, host, DefaultOptions(p))
+	if err != nil || len(records) != 1 {
+		t.Fatalf("expected 1 record, got %d (%v)", len(records), err)
+	}
+	if _, ok := records[0].Get("User"); ok {
+		t.Errorf("unexpected User field without SOFTWARE")
+	}
+
+	host.Add("SOFTWARE", "SOFTWARE", software)
+	records, err = CollectHost(context.Background(), p, host, DefaultOptions(p))
+	if err != nil || len(records) != 1 {
+		t.Fatalf("expected 1 record, got %d (%v)", len(records), err)
+	}
+	if f, ok := records[0].Get("User"); !ok || f.Value != "alice" {
+		t.Errorf("unexpected User field %+v", f)
+	}
+	if f, ok := records[0].Get("User Source"); !ok || f.Value != sidSourceProfileList {
+		t.Errorf("unexpected User Source field %+v", f)
+	}
+
+	softwareOnly := &Host{}
+	softwareOnly.Add("SOFTWARE", "SOFTWARE", software)
+	if _, err := CollectHost(context.Background(), p, softwareOnly, DefaultOptions(p)); !errors.Is(err, ErrMissingHive) {
+		t.Errorf("expected ErrMissingHive, got %v", err)
+	}
+}
+
+func TestParseHiveRole(t *testing.T) {
+	for name, want := range map[string]string{"system": "SYSTEM", "ntuser": "NTUSER.DAT", "UsrClass.dat": "USRCLASS.DAT"} {
+		if got, ok := ParseHiveRole(name); !ok || got != want {
+			t.Errorf("ParseHiveRole(%q) = %q, %v", name, got, ok)
+		}
+	}
+	if _, ok := ParseHiveRole("registry"); ok {
+		t.Errorf("unexpected role for %q", "registry")
+	}
+}
@@ -2,7 +2,6 @@ package plugins
 
 import (
 	"fmt"
-	"strings"
 
 	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
 )
@@ -26,18 +25,33 @@ func (p *ImageFilePlugin) CompatibleHiveTypes() []string {
 	return []string{"SOFTWARE"}
 }
 
+func (p *ImageFilePlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategoryPersistence,
+		Techniques: []string{"T1546.012"},
+		Artifact:   "Image File Execution Options can set a Debugger that is started instead of the program.",
+		References: []string{regRipperReference},
+		Version:    "1.0.0",
+		Schema: []FieldSpec{
+			{Name: "Executable", Type: FieldString, Description: "program name"},
+			{Name: "Debugger", Type: FieldString, Description: "debugger started instead"},
+			{Name: "*", Type: FieldString, Description: "other IFEO values, typed after the registry value"},
+		},
+	}
+}
+
 func (p *ImageFilePlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
+
+func (p *ImageFilePlugin) Collect(hive *regf.Hive, emit Emitter) error {
 	ifeoPath := "Microsoft\\Windows NT\\CurrentVersion\\Image File Execution Options"
 	ifeoKey, err := hive.GetKey(ifeoPath)
 	if err != nil {
 		return fmt.Errorf("IFEO key not found: %w", err)
 	}
 
-	fmt.Println("Image File Execution Options (IFEO):")
-	fmt.Println(strings.Repeat("=", 80))
-	fmt.Println("Note: Debugger entries can indicate malware persistence or legitimate debugging")
-	fmt.Println()
-
+	// Debugger entries can indicate malware persistence or legitimate debugging
 	for _, exe := range ifeoKey.Subkeys() {
 		hasDebugger := false
 		debuggerVal := ""
@@ -50,14 +64,18 @@ func (p *ImageFilePlugin) Run(hive *regf.Hive) error {
 		}
 
 		if hasDebugger {
-			fmt.Printf("\n[%s] %s\n", exe.Timestamp().Format("2006-01-02 15:04:05"), exe.Name())
-			fmt.Printf("  Debugger: %s\n", debuggerVal)
+			r := NewRecord(joinKeyPath(ifeoPath, exe.Name()), exe).
+				AddString("Executable", exe.Name()).
+				AddString("Debugger", debuggerVal).
+				WithSeverity(SeverityWarning).
+				WithTags("persistence")
 
 			for _, val := range exe.Values() {
 				if val.Name() != "Debugger" && val.Name() != "" {
-					fmt.Printf("  %s: %s\n", val.Name(), GetValueString(val))
+					r.AddValue(val.Name(), val)
 				}
 			}
+			emit(r)
 		}
 	}
 
@@ -1,6 +1,7 @@
 package plugins
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -27,112 +28,71 @@ func (p *IPSPlugin) CompatibleHiveTypes() []string {
 	return []string{"SYSTEM"}
 }
 
-func (p *IPSPlugin) Run(hive *regf.Hive) error {
-	// Step 1: Find current ControlSet
-	controlSetName, err := p.findCurrentControlSet(hive)
-	if err != nil {
-		return fmt.Errorf("failed to find current controlset: %w", err)
-	}
-
-	fmt.Printf("Current ControlSet: %s\n\n", controlSetName)
-
-	// Step 2: Navigate to Services\Tcpip\Parameters\Interfaces
-	interfacesPath := fmt.Sprintf("%s\\Services\\Tcpip\\Parameters\\Interfaces", controlSetName)
-	interfacesKey, err := hive.GetKey(interfacesPath)
-	if err != nil {
-		return fmt.Errorf("failed to find interfaces key: %w", err)
+func (p *IPSPlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategoryNetwork,
+		Techniques: []string{"T1016"},
+		Artifact:   "TCP/IP interface parameters with static and DHCP addresses and domains.",
+		References: []string{regRipperReference},
+		Version:    "1.0.0",
+		Schema: []FieldSpec{
+			{Name: "Interface", Type: FieldString, Description: "interface GUID"},
+			{Name: "*", Type: FieldString, Description: "DhcpIPAddress, DhcpDomain, DhcpNetworkHint, IPAddress and Domain"},
+		},
 	}
+}
 
-	// Step 3: Iterate through interface subkeys
-	subkeys := interfacesKey.Subkeys()
-	if len(subkeys) == 0 {
-		fmt.Println("No network interfaces found.")
-		return nil
-	}
+func (p *IPSPlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
 
-	for _, ifaceKey := range subkeys {
-		p.printInterface(ifaceKey)
-	}
+func (p *IPSPlugin) Options() []Option {
+	return []Option{controlSetOption}
+}
 
-	return nil
+func (p *IPSPlugin) Collect(hive *regf.Hive, emit Emitter) error {
+	return p.CollectContext(context.Background(), hive, DefaultOptions(p), emit)
 }
 
-// findCurrentControlSet determines the current ControlSet by reading Select\Current.
-func (p *IPSPlugin) findCurrentControlSet(hive *regf.Hive) (string, error) {
-	selectKey, err := hive.GetKey("Select")
-	if err != nil {
-		return "", err
-	}
+func (p *IPSPlugin) CollectContext(ctx context.Context, hive *regf.Hive, opts Options, emit Emitter) error {
+	return forEachControlSet(ctx, hive, opts, emit, func(controlSetName string, emit Emitter) error {
+		// Step 2: Navigate to Services\Tcpip\Parameters\Interfaces
+		interfacesPath := fmt.Sprintf("%s\\Services\\Tcpip\\Parameters\\Interfaces", controlSetName)
+		interfacesKey, err := hive.GetKey(interfacesPath)
+		if err != nil {
+			return fmt.Errorf("failed to find interfaces key: %w", err)
+		}
 
-	// Find the "Current" value
-	values := selectKey.Values()
-	for _, v := range values {
-		if strings.EqualFold(v.Name(), "Current") {
-			// Current is a REG_DWORD (4)
-			if v.Type() == 4 {
-				data := v.Bytes()
-				if len(data) >= 4 {
-					// Read as little-endian DWORD
-					currentNum := uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16 | uint32(data[3])<<24
-					return fmt.Sprintf("ControlSet%03d", currentNum), nil
-				}
+		// Step 3: Iterate through interface subkeys
+		for _, ifaceKey := range interfacesKey.Subkeys() {
+			if err := ctx.Err(); err != nil {
+				return err
 			}
+
+			emit(p.interfaceRecord(interfacesPath, ifaceKey))
 		}
-	}
 
-	return "", fmt.Errorf("current value not found in select key")
+		return nil
+	})
 }
 
-// printInterface prints IP configuration for a single interface.
-func (p *IPSPlugin) printInterface(ifaceKey *regf.Key) {
-	fmt.Printf("Interface: %s\n", ifaceKey.Name())
-
-	values := ifaceKey.Values()
-	if len(values) == 0 {
-		fmt.Println("  (no values)")
-		fmt.Println()
-		return
-	}
-
-	// Collect interesting values
-	dhcpIPAddress := ""
-	dhcpDomain := ""
-	dhcpNetworkHint := ""
-	ipAddress := ""
-	domain := ""
-
-	for _, v := range values {
-		name := v.Name()
-		switch {
-		case strings.EqualFold(name, "DhcpIPAddress"):
-			dhcpIPAddress = GetValueString(v)
-		case strings.EqualFold(name, "DhcpDomain"):
-			dhcpDomain = GetValueString(v)
-		case strings.EqualFold(name, "DhcpNetworkHint"):
-			dhcpNetworkHint = GetValueString(v)
-		case strings.EqualFold(name, "IPAddress"):
-			ipAddress = GetValueString(v)
-		case strings.EqualFold(name, "Domain"):
-			domain = GetValueString(v)
+// interfaceRecord returns the IP configuration of a single interface.
+func (p *IPSPlugin) interfaceRecord(interfacesPath string, ifaceKey *regf.Key) *Record {
+	r := NewRecord(joinKeyPath(interfacesPath, ifaceKey.Name()), ifaceKey).
+		AddString("Interface", ifaceKey.Name())
+
+	// Collect interesting values in the order ips.pl prints them
+	names := []string{"DhcpIPAddress", "DhcpDomain", "DhcpNetworkHint", "IPAddress", "Domain"}
+	for _, name := range names {
+		for _, v := range ifaceKey.Values() {
+			if strings.EqualFold(v.Name(), name) {
+				if value := GetValueString(v); value != "" {
+					r.AddString(name, value)
+				}
+				break
+			}
 		}
 	}
 
-	// Print values in the style of ips.pl
-	if dhcpIPAddress != "" {
-		fmt.Printf("  DhcpIPAddress    : %s\n", dhcpIPAddress)
-	}
-	if dhcpDomain != "" {
-		fmt.Printf("  DhcpDomain       : %s\n", dhcpDomain)
-	}
-	if dhcpNetworkHint != "" {
-		fmt.Printf("  DhcpNetworkHint  : %s\n", dhcpNetworkHint)
-	}
-	if ipAddress != "" {
-		fmt.Printf("  IPAddress        : %s\n", ipAddress)
-	}
-	if domain != "" {
-		fmt.Printf("  Domain           : %s\n", domain)
-	}
-
-	fmt.Println()
+	return r
 }
@@ -1,7 +1,6 @@
 package plugins
 
 import (
-	"fmt"
 	"strings"
 
 	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
@@ -26,16 +25,37 @@ func (p *JumpListsPlugin) CompatibleHiveTypes() []string {
 	return []string{"NTUSER.DAT", "USRCLASS.DAT"}
 }
 
+func (p *JumpListsPlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategoryUserActivity,
+		Techniques: []string{"T1204.002"},
+		Artifact:   "Taskband and jump list related values record applications pinned to or launched from the taskbar.",
+		References: []string{regRipperReference},
+		Version:    "1.0.0",
+		Schema: []FieldSpec{
+			{Name: "Name", Type: FieldString, Description: "value name"},
+			{Name: "Size", Type: FieldInt, Description: "size of the value data"},
+			{Name: "Application", Type: FieldString, Description: "application name"},
+			{Name: "Count", Type: FieldString, Description: "usage count"},
+		},
+	}
+}
+
 func (p *JumpListsPlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
+
+func (p *JumpListsPlugin) Collect(hive *regf.Hive, emit Emitter) error {
 	// Try TaskBand (Win7+)
+	found := false
 	taskbandPath := "Software\\Microsoft\\Windows\\CurrentVersion\\Explorer\\TaskBand"
 	if taskband, err := hive.GetKey(taskbandPath); err == nil {
-		fmt.Println("TaskBand Jump Lists:")
-		fmt.Println(strings.Repeat("=", 80))
-
+		found = true
 		for _, val := range taskband.Values() {
 			if strings.Contains(val.Name(), "Favorites") {
-				fmt.Printf("%s: %d bytes\n", val.Name(), len(val.Bytes()))
+				emit(NewRecord(taskbandPath, taskband).
+					AddString("Name", val.Name()).
+					AddInt("Size", int64(len(val.Bytes()))))
 			}
 		}
 	}
@@ -43,13 +63,17 @@ func (p *JumpListsPlugin) Run(hive *regf.Hive) error {
 	// Try Destinations (Win7+)
 	destPath := "Software\\Microsoft\\Windows\\CurrentVersion\\Explorer\\FeatureUsage\\AppSwitched"
 	if dest, err := hive.GetKey(destPath); err == nil {
-		fmt.Println("\nRecently Used Applications:")
-		fmt.Println(strings.Repeat("=", 80))
-
+		found = true
 		for _, val := range dest.Values() {
-			fmt.Printf("%s: %s\n", val.Name(), GetValueString(val))
+			emit(NewRecord(destPath, dest).
+				AddString("Application", val.Name()).
+				AddValue("Count", val).
+				WithTags("execution"))
 		}
 	}
 
+	if !found {
+		return notFound("no TaskBand or AppSwitched keys")
+	}
 	return nil
 }
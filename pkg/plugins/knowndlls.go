@@ -1,6 +1,7 @@
 package plugins
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
@@ -25,35 +26,48 @@ func (p *KnownDLLsPlugin) CompatibleHiveTypes() []string {
 	return []string{"SYSTEM"}
 }
 
-func (p *KnownDLLsPlugin) Run(hive *regf.Hive) error {
-	paths := []string{
-		"ControlSet001\\Control\\Session Manager\\KnownDLLs",
-		"ControlSet002\\Control\\Session Manager\\KnownDLLs",
+func (p *KnownDLLsPlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategoryPersistence,
+		Techniques: []string{"T1574.001"},
+		Artifact:   "KnownDLLs are loaded from System32 only; removing an entry opens the DLL to search order hijacking.",
+		References: []string{regRipperReference},
+		Version:    "1.0.0",
+		Schema: []FieldSpec{
+			{Name: "Name", Type: FieldString, Description: "value name"},
+			{Name: "DLL", Type: FieldString, Description: "DLL file name"},
+		},
 	}
+}
+
+func (p *KnownDLLsPlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
 
-	fmt.Println("Known DLLs")
-	fmt.Println("==========")
-	fmt.Println()
+func (p *KnownDLLsPlugin) Options() []Option {
+	return []Option{controlSetOption}
+}
 
-	for _, path := range paths {
+func (p *KnownDLLsPlugin) Collect(hive *regf.Hive, emit Emitter) error {
+	return p.CollectContext(context.Background(), hive, DefaultOptions(p), emit)
+}
+
+func (p *KnownDLLsPlugin) CollectContext(ctx context.Context, hive *regf.Hive, opts Options, emit Emitter) error {
+	return forEachControlSet(ctx, hive, opts, emit, func(controlSet string, emit Emitter) error {
+		path := controlSet + "\\Control\\Session Manager\\KnownDLLs"
 		key, err := hive.GetKey(path)
 		if err != nil {
-			continue
+			return fmt.Errorf("KnownDLLs key not found: %w", err)
 		}
 
-		fmt.Printf("[%s]\n", path)
-		fmt.Printf("Last Modified: %s\n", key.Timestamp().Format("2006-01-02 15:04:05"))
-		fmt.Println()
-
 		for _, val := range key.Values() {
 			if val.Name() != "" {
-				fmt.Printf("  %s = %s\n", val.Name(), GetValueString(val))
+				emit(NewRecord(path, key).
+					AddString("Name", val.Name()).
+					AddString("DLL", GetValueString(val)))
 			}
 		}
-		fmt.Println()
 
 		return nil
-	}
-
-	return fmt.Errorf("KnownDLLs key not found")
+	})
 }
@@ -0,0 +1,68 @@
+package plugins
+
+import "strings"
+
+// knownFolder is a Windows KnownFolder: its canonical name and default
+// location. Per-user folders are rooted at %USERPROFILE% or %APPDATA%,
+// since a single hive does not tell where the profile lives.
+type knownFolder struct {
+	Name string
+	Path string
+}
+
+// knownFolders maps KnownFolder IDs, upper case with braces, to folders.
+// UserAssist, ShellBags and jump lists refer to folders by these IDs.
+var knownFolders = map[string]knownFolder{
+	"{0139D44E-6AFE-49F2-8690-3DAFCAE6FFB8}": {"CommonPrograms", `C:\ProgramData\Microsoft\Windows\Start Menu\Programs`},
+	"{0762D272-C50A-4BB0-A382-697DCD729B80}": {"UserProfiles", `C:\Users`},
+	"{1777F761-68AD-4D8A-87BD-30B759FA33DD}": {"Favorites", `%USERPROFILE%\Favorites`},
+	"{18989B1D-99B5-455B-841C-AB7C74E4DDFC}": {"Videos", `%USERPROFILE%\Videos`},
+	"{1AC14E77-02E7-4E5D-B744-2EB1AE5198B7}": {"System", `C:\Windows\System32`},
+	"{33E28130-4E1E-4676-835A-98395C3BC3BB}": {"Pictures", `%USERPROFILE%\Pictures`},
+	"{374DE290-123F-4565-9164-39C4925E467B}": {"Downloads", `%USERPROFILE%\Downloads`},
+	"{3EB685DB-65F9-4CF6-A03A-E3EF65729F3D}": {"RoamingAppData", `%APPDATA%`},
+	"{4BD8D571-6D19-48D3-BE97-422220080E43}": {"Music", `%USERPROFILE%\Music`},
+	"{5E6C858F-0E22-4760-9AFE-EA3317B67173}": {"Profile", `%USERPROFILE%`},
+	"{625B53C3-AB48-4EC1-BA1F-A1EF4146FC19}": {"StartMenu", `%APPDATA%\Microsoft\Windows\Start Menu`},
+	"{62AB5D82-FDC1-4DC3-A9DD-070D1D495D97}": {"ProgramData", `C:\ProgramData`},
+	"{6D809377-6AF0-444B-8957-A3773F02200E}": {"ProgramFilesX64", `C:\Program Files`},
+	"{724EF170-A42D-4FEF-9F26-B60E846FBA4F}": {"AdminTools", `%APPDATA%\Microsoft\Windows\Start Menu\Programs\Administrative Tools`},
+	"{7C5A40EF-A0FB-4BFC-874A-C0F2E0B9FA8E}": {"ProgramFilesX86", `C:\Program Files (x86)`},
+	"{82A5EA35-D9CD-47C5-9629-E15D2F714E6E}": {"CommonStartup", `C:\ProgramData\Microsoft\Windows\Start Menu\Programs\StartUp`},
+	"{8983036C-27C0-404B-8F08-102D10DCFD74}": {"SendTo", `%APPDATA%\Microsoft\Windows\SendTo`},
+	"{905E63B6-C1BF-494E-B29C-65B732D3D21A}": {"ProgramFiles", `C:\Program Files`},
+	"{9E3995AB-1F9C-4F13-B827-48B24B6C7174}": {"UserPinned", `%APPDATA%\Microsoft\Internet Explorer\Quick Launch\User Pinned`},
+	"{A4115719-D62E-491D-AA7C-E74B8BE3B067}": {"CommonStartMenu", `C:\ProgramData\Microsoft\Windows\Start Menu`},
+	"{A77F5D77-2E2B-44C3-A6A2-ABA601054A51}": {"Programs", `%APPDATA%\Microsoft\Windows\Start Menu\Programs`},
+	"{B4BFCC3A-DB2C-424C-B029-7FE99A87C641}": {"Desktop", `%USERPROFILE%\Desktop`},
+	"{B97D20BB-F46A-4C97-BA10-5E3608430854}": {"Startup", `%APPDATA%\Microsoft\Windows\Start Menu\Programs\StartUp`},
+	"{C4AA340D-F20F-4863-AFEF-F87EF2E6BA25}": {"PublicDesktop", `C:\Users\Public\Desktop`},
+	"{D0384E7D-BAC3-4797-8F14-CBA229B392B5}": {"CommonAdminTools", `C:\ProgramData\Microsoft\Windows\Start Menu\Programs\Administrative Tools`},
+	"{D65231B0-B2F1-4857-A4CE-A8E7C6EA7D27}": {"SystemX86", `C:\Windows\SysWOW64`},
+	"{DFDF76A2-C82A-4D63-906A-5644AC457385}": {"Public", `C:\Users\Public`},
+	"{F1B32785-6FBA-4FCF-9D55-7B8E7F157091}": {"LocalAppData", `%LOCALAPPDATA%`},
+	"{F38BF404-1D43-42F2-9305-67DE0B28FC23}": {"Windows", `C:\Windows`},
+	"{FDD39AD0-238F-46AF-ADB4-6C85480369C7}": {"Documents", `%USERPROFILE%\Documents`},
+}
+
+// lookupKnownFolder returns the folder with the given ID, in any case and
+// with or without braces.
+func lookupKnownFolder(id string) (knownFolder, bool) {
+	id = strings.ToUpper(strings.Trim(id, "{}"))
+	f, ok := knownFolders["{"+id+"}"]
+	return f, ok
+}
+
+// expandKnownFolder replaces a leading KnownFolder ID, as in
+// {6D809377-6AF0-444B-8957-A3773F02200E}\app.exe, with the folder path.
+// Paths without a known ID are returned unchanged.
+func expandKnownFolder(path string) string {
+	if len(path) < 38 || path[0] != '{' || path[37] != '}' {
+		return path
+	}
+	f, ok := lookupKnownFolder(path[:38])
+	if !ok {
+		return path
+	}
+	return f.Path + path[38:]
+}
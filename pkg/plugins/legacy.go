@@ -0,0 +1,88 @@
+package plugins
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
+)
+
+// TagLegacy marks records produced by the legacy text adapter.
+const TagLegacy = "legacy"
+
+// stdoutMu serialises stdout redirection, which is process-wide.
+var stdoutMu sync.Mutex
+
+// legacyAdapter turns the printed output of a text-only plugin into records,
+// one per line, so it can go through the same renderers as record plugins.
+type legacyAdapter struct {
+	Plugin
+}
+
+func (a legacyAdapter) Collect(hive *regf.Hive, emit Emitter) error {
+	output, err := captureStdout(func() error {
+		return a.Run(hive)
+	})
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		r := &Record{Tags: []string{TagLegacy}}
+		r.AddString("text", scanner.Text())
+		emit(r)
+	}
+
+	return err
+}
+
+// captureStdout runs fn with os.Stdout redirected to a pipe and returns
+// everything it wrote.
+func captureStdout(fn func() error) ([]byte, error) {
+	stdoutMu.Lock()
+	defer stdoutMu.Unlock()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+
+	// Drain the pipe concurrently so large outputs cannot block the plugin.
+	var buf bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(&buf, r)
+		close(done)
+	}()
+
+	oldStdout := os.Stdout
+	os.Stdout = w
+	runErr := fn()
+	os.Stdout = oldStdout
+
+	if err := w.Close(); err != nil && runErr == nil {
+		runErr = err
+	}
+	<-done
+	if err := r.Close(); err != nil && runErr == nil {
+		runErr = err
+	}
+
+	return buf.Bytes(), runErr
+}
+
+// legacyText returns the text of a record produced by the legacy adapter.
+func legacyText(r *Record) (string, bool) {
+	if !r.HasTag(TagLegacy) {
+		return "", false
+	}
+	f, ok := r.Get("text")
+	if !ok {
+		return "", false
+	}
+	s, ok := f.Value.(string)
+	return strings.TrimRight(s, "\r"), ok
+}
@@ -1,7 +1,6 @@
 package plugins
 
 import (
-	"fmt"
 	"strings"
 
 	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
@@ -27,28 +26,50 @@ func (p *ListSoftPlugin) CompatibleHiveTypes() []string {
 	return []string{"SOFTWARE"}
 }
 
+func (p *ListSoftPlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategorySoftware,
+		Techniques: []string{"T1518"},
+		Artifact:   "Installed software from the Uninstall keys, including 32-bit programs under WOW6432Node.",
+		References: []string{regRipperReference},
+		Version:    "1.0.0",
+		Schema: []FieldSpec{
+			{Name: "Software", Type: FieldString, Description: "display name"},
+			{Name: "Version", Type: FieldString, Description: "display version"},
+			{Name: "Publisher", Type: FieldString, Description: "publisher"},
+			{Name: "Install Date", Type: FieldString, Description: "install date as recorded (YYYYMMDD)"},
+			{Name: "Install Location", Type: FieldString, Description: "install directory"},
+		},
+	}
+}
+
 func (p *ListSoftPlugin) Run(hive *regf.Hive) error {
-	fmt.Println("Installed Software")
-	fmt.Println("==================")
-	fmt.Println()
+	return runText(p, hive)
+}
 
+func (p *ListSoftPlugin) Collect(hive *regf.Hive, emit Emitter) error {
 	// Check both 32-bit and 64-bit uninstall locations
 	paths := []string{
 		"Microsoft\\Windows\\CurrentVersion\\Uninstall",
 		"Wow6432Node\\Microsoft\\Windows\\CurrentVersion\\Uninstall",
 	}
 
+	found := false
 	for _, path := range paths {
-		if err := p.listUninstallKeys(hive, path); err != nil {
+		if err := p.listUninstallKeys(hive, path, emit); err != nil {
 			// Continue to next path if this one fails
 			continue
 		}
+		found = true
 	}
 
+	if !found {
+		return notFound("no Uninstall keys")
+	}
 	return nil
 }
 
-func (p *ListSoftPlugin) listUninstallKeys(hive *regf.Hive, basePath string) error {
+func (p *ListSoftPlugin) listUninstallKeys(hive *regf.Hive, basePath string, emit Emitter) error {
 	key, err := hive.GetKey(basePath)
 	if err != nil {
 		return err
@@ -78,22 +99,23 @@ func (p *ListSoftPlugin) listUninstallKeys(hive *regf.Hive, basePath string) err
 			}
 		}
 
-		// Only display if we have a display name
+		// Only emit if we have a display name
 		if displayName != "" {
-			fmt.Printf("Software: %s\n", displayName)
+			r := NewRecord(joinKeyPath(basePath, subkey.Name()), subkey).
+				AddString("Software", displayName)
 			if displayVersion != "" {
-				fmt.Printf("  Version: %s\n", displayVersion)
+				r.AddString("Version", displayVersion)
 			}
 			if publisher != "" {
-				fmt.Printf("  Publisher: %s\n", publisher)
+				r.AddString("Publisher", publisher)
 			}
 			if installDate != "" {
-				fmt.Printf("  Install Date: %s\n", installDate)
+				r.AddString("Install Date", installDate)
 			}
 			if installLocation != "" {
-				fmt.Printf("  Install Location: %s\n", installLocation)
+				r.AddString("Install Location", installLocation)
 			}
-			fmt.Println()
+			emit(r)
 		}
 	}
 
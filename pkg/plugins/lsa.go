@@ -0,0 +1,153 @@
+package plugins
+
+import (
+	"crypto/aes"
+	"crypto/des"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
+)
+
+// LSA key paths of the SECURITY hive.
+const (
+	lsaKeyPath     = `Policy\PolEKList`              // Vista and later
+	lsaKeyPathXP   = `Policy\PolSecretEncryptionKey` // XP and 2003
+	lsaSecretsPath = `Policy\Secrets`
+)
+
+// lsaKey is the key protecting the LSA secrets, decrypted with the boot
+// key. Vista and later use SHA-256 and AES; earlier systems MD5, RC4 and
+// DES.
+type lsaKey struct {
+	key   []byte
+	vista bool
+}
+
+// readLSAKey decrypts the LSA key of a SECURITY hive with the boot key.
+func readLSAKey(security *regf.Hive, bootKey []byte) (lsaKey, error) {
+	if data, ok := defaultValue(security, lsaKeyPath); ok {
+		blob, err := lsaDecryptAES(bootKey, data)
+		if err != nil {
+			return lsaKey{}, fmt.Errorf("%s: %w", lsaKeyPath, err)
+		}
+		if len(blob) < 52+32 {
+			return lsaKey{}, fmt.Errorf("%s: decrypted key too short (%d bytes)", lsaKeyPath, len(blob))
+		}
+		return lsaKey{key: blob[52 : 52+32], vista: true}, nil
+	}
+
+	data, ok := defaultValue(security, lsaKeyPathXP)
+	if !ok {
+		return lsaKey{}, notFound("neither %s nor %s found", lsaKeyPath, lsaKeyPathXP)
+	}
+	if len(data) < 76 {
+		return lsaKey{}, fmt.Errorf("%s too short (%d bytes)", lsaKeyPathXP, len(data))
+	}
+	h := md5.New()
+	h.Write(bootKey)
+	for i := 0; i < 1000; i++ {
+		h.Write(data[60:76])
+	}
+	plain := rc4Crypt(h.Sum(nil), data[12:60])
+	return lsaKey{key: plain[0x10:0x20]}, nil
+}
+
+// decrypt decrypts the data of an LSA secret value (CurrVal or OldVal).
+func (k lsaKey) decrypt(data []byte) ([]byte, error) {
+	if k.vista {
+		return lsaDecryptAES(k.key, data)
+	}
+
+	// The XP secret is DES encrypted in 8 byte blocks, each with the next
+	// 7 bytes of the key, wrapping around the key.
+	if len(data) < 0x0C+4 {
+		return nil, fmt.Errorf("secret too short (%d bytes)", len(data))
+	}
+	data = data[0x0C:]
+	size := int(binary.LittleEndian.Uint32(data))
+	if size > len(data) {
+		return nil, fmt.Errorf("secret size %d exceeds data (%d bytes)", size, len(data))
+	}
+	data = data[len(data)-size:]
+
+	plain := make([]byte, len(data)/8*8)
+	key := k.key
+	for i := 0; i+8 <= len(data); i += 8 {
+		block, err := des.NewCipher(desKey(key[:7]))
+		if err != nil {
+			return nil, err
+		}
+		block.Decrypt(plain[i:], data[i:i+8])
+		key = key[7:]
+		if len(key) < 7 {
+			key = k.key[len(key):]
+		}
+	}
+	if len(plain) < 8 {
+		return nil, fmt.Errorf("secret too short (%d bytes)", len(plain))
+	}
+	length := int(binary.LittleEndian.Uint32(plain))
+	if 8+length > len(plain) {
+		return nil, fmt.Errorf("secret length %d exceeds data (%d bytes)", length, len(plain)-8)
+	}
+	return plain[8 : 8+length], nil
+}
+
+// lsaDecryptAES decrypts a Vista style LSA_SECRET: a 28 byte header, then
+// a 32 byte salt hashed 1000 times with the key into an AES-256 key, and
+// the data, encrypted block by block. The plain text starts with the
+// secret length and 12 unknown bytes.
+func lsaDecryptAES(key, data []byte) ([]byte, error) {
+	if len(data) < 28+32+16 {
+		return nil, fmt.Errorf("encrypted secret too short (%d bytes)", len(data))
+	}
+	data = data[28:]
+	h := sha256.New()
+	h.Write(key)
+	for i := 0; i < 1000; i++ {
+		h.Write(data[:32])
+	}
+	block, err := aes.NewCipher(h.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+
+	data = data[32:]
+	plain := make([]byte, (len(data)+15)/16*16)
+	for i := 0; i < len(data); i += 16 {
+		in := make([]byte, 16)
+		copy(in, data[i:])
+		block.Decrypt(plain[i:], in)
+	}
+	length := int(binary.LittleEndian.Uint32(plain))
+	if 16+length > len(plain) {
+		return nil, fmt.Errorf("secret length %d exceeds data (%d bytes)", length, len(plain)-16)
+	}
+	return plain[16 : 16+length], nil
+}
+
+// readLSASecret decrypts the CurrVal or OldVal of a named LSA secret. It
+// returns nil for a secret without that value.
+func readLSASecret(security *regf.Hive, key lsaKey, name, value string) ([]byte, error) {
+	data, ok := defaultValue(security, joinKeyPath(lsaSecretsPath, name, value))
+	if !ok || len(data) == 0 {
+		return nil, nil
+	}
+	return key.decrypt(data)
+}
+
+// defaultValue returns the data of the default value of the key at path.
+func defaultValue(hive *regf.Hive, path string) ([]byte, bool) {
+	key, err := hive.GetKey(path)
+	if err != nil {
+		return nil, false
+	}
+	v, err := getValue(key, "")
+	if err != nil {
+		return nil, false
+	}
+	return v.Bytes(), true
+}
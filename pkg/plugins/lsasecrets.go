@@ -0,0 +1,209 @@
+package plugins
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
+)
+
+func init() {
+	Register(&LSASecretsPlugin{})
+}
+
+// LSASecretsPlugin decrypts the LSA secrets of a SECURITY hive with the
+// boot key of the SYSTEM hive of the same host.
+type LSASecretsPlugin struct{}
+
+func (p *LSASecretsPlugin) Name() string {
+	return "lsasecrets"
+}
+
+func (p *LSASecretsPlugin) Description() string {
+	return "Decrypt LSA secrets from SECURITY with the SYSTEM boot key"
+}
+
+func (p *LSASecretsPlugin) CompatibleHiveTypes() []string {
+	return []string{"SECURITY"}
+}
+
+func (p *LSASecretsPlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategoryAccounts,
+		Techniques: []string{"T1003.004"},
+		Artifact: "LSA secrets hold the machine account password, the auto-logon password, service account " +
+			"passwords, the DPAPI system keys and the key of cached domain logons.",
+		References: []string{regRipperReference},
+		Version:    "1.0.0",
+		Schema: []FieldSpec{
+			{Name: "Secret", Type: FieldString, Description: "secret name"},
+			{Name: "Value", Type: FieldString, Description: "CurrVal (current) or OldVal (previous)"},
+			{Name: "Type", Type: FieldString, Description: "kind of secret"},
+			{Name: "Updated", Type: FieldTime, Description: "time the value was set"},
+			{Name: "Service", Type: FieldString, Description: "service of an _SC_ secret"},
+			{Name: "Account", Type: FieldString, Description: "account the service runs as"},
+			{Name: "Password", Type: FieldString, Description: "plain text password", Sensitive: true},
+			{Name: "NT Hash", Type: FieldString, Description: "NT hash of the machine account password", Sensitive: true},
+			{Name: "Machine Key", Type: FieldString, Description: "DPAPI_SYSTEM machine key", Sensitive: true},
+			{Name: "User Key", Type: FieldString, Description: "DPAPI_SYSTEM user key", Sensitive: true},
+			{Name: "Key", Type: FieldString, Description: "NL$KM key of cached domain logons", Sensitive: true},
+			{Name: "Data", Type: FieldString, Description: "other secrets, as text or hex", Sensitive: true},
+		},
+	}
+}
+
+func (p *LSASecretsPlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
+
+func (p *LSASecretsPlugin) RequiredHives() []string {
+	return []string{"SECURITY", "SYSTEM"}
+}
+
+func (p *LSASecretsPlugin) OptionalHives() []string {
+	return nil
+}
+
+// Collect runs on a single hive, which cannot hold both the secrets and
+// the boot key: it reports the missing SYSTEM hive.
+func (p *LSASecretsPlugin) Collect(hive *regf.Hive, emit Emitter) error {
+	records, err := CollectContext(context.Background(), p, hive, DefaultOptions(p))
+	for _, r := range records {
+		emit(r)
+	}
+	return err
+}
+
+func (p *LSASecretsPlugin) CollectHost(ctx context.Context, host *Host, opts Options, emit Emitter) error {
+	security, system := host.Hive("SECURITY"), host.Hive("SYSTEM")
+	bootKey, err := readBootKey(system)
+	if err != nil {
+		return fmt.Errorf("boot key: %w", err)
+	}
+	key, err := readLSAKey(security, bootKey)
+	if err != nil {
+		return err
+	}
+	secrets, err := security.GetKey(lsaSecretsPath)
+	if err != nil {
+		return notFound("%s not found", lsaSecretsPath)
+	}
+
+	var failed []error
+	for _, secret := range secrets.Subkeys() {
+		for _, value := range []string{"CurrVal", "OldVal"} {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			data, err := readLSASecret(security, key, secret.Name(), value)
+			if err != nil {
+				failed = append(failed, fmt.Errorf("%s\\%s: %w", secret.Name(), value, err))
+				continue
+			}
+			if len(data) == 0 {
+				continue
+			}
+
+			path := joinKeyPath(lsaSecretsPath, secret.Name(), value)
+			valueKey, _ := security.GetKey(path)
+			r := NewRecord(path, valueKey).
+				AddString("Secret", secret.Name()).
+				AddString("Value", value)
+			decodeLSASecret(r, system, secret.Name(), data)
+			if updated, ok := lsaSecretUpdated(security, secret.Name(), value); ok {
+				r.AddTime("Updated", updated)
+			}
+			emit(r)
+		}
+	}
+	if len(failed) > 0 {
+		return partial(failed)
+	}
+	return nil
+}
+
+// decodeLSASecret adds the fields of a decrypted secret, decoded after
+// its name.
+func decodeLSASecret(r *Record, system *regf.Hive, name string, data []byte) {
+	switch {
+	case strings.EqualFold(name, "$MACHINE.ACC"):
+		r.AddString("Type", "Machine Account").
+			AddSecret("NT Hash", hex.EncodeToString(ntHash(data)))
+	case strings.EqualFold(name, "DefaultPassword"):
+		r.AddString("Type", "Auto-Logon Password").
+			AddSecret("Password", utf16String(data))
+	case strings.HasPrefix(strings.ToUpper(name), "_SC_"):
+		service := name[4:]
+		r.AddString("Type", "Service Account").
+			AddString("Service", service)
+		if account := serviceAccount(system, service); account != "" {
+			r.AddString("Account", account)
+		}
+		r.AddSecret("Password", utf16String(data))
+	case strings.EqualFold(name, "DPAPI_SYSTEM") && len(data) >= 44:
+		// A version, then the 20 byte machine and user keys
+		r.AddString("Type", "DPAPI System Keys").
+			AddSecret("Machine Key", hex.EncodeToString(data[4:24])).
+			AddSecret("User Key", hex.EncodeToString(data[24:44]))
+	case strings.EqualFold(name, "NL$KM"):
+		r.AddString("Type", "Cached Logon Key").
+			AddSecret("Key", hex.EncodeToString(data))
+	default:
+		r.AddString("Type", "Other")
+		if text, ok := secretText(data); ok {
+			r.AddSecret("Data", text)
+		} else {
+			r.AddSecret("Data", hex.EncodeToString(data))
+		}
+	}
+}
+
+// lsaSecretUpdated reads the time a secret value was set, stored next to
+// it as CupdTime or OupdTime.
+func lsaSecretUpdated(security *regf.Hive, name, value string) (time.Time, bool) {
+	updName := "CupdTime"
+	if value == "OldVal" {
+		updName = "OupdTime"
+	}
+	data, found := defaultValue(security, joinKeyPath(lsaSecretsPath, name, updName))
+	if !found || len(data) < 8 {
+		return time.Time{}, false
+	}
+	t := filetimeToTime(binary.LittleEndian.Uint64(data))
+	return t, !t.IsZero()
+}
+
+// serviceAccount returns the account a service of the current control set
+// runs as.
+func serviceAccount(system *regf.Hive, service string) string {
+	controlSet, err := findCurrentControlSet(system)
+	if err != nil {
+		return ""
+	}
+	key, err := system.GetKey(joinKeyPath(controlSet, "Services", service))
+	if err != nil {
+		return ""
+	}
+	v, err := getValue(key, "ObjectName")
+	if err != nil {
+		return ""
+	}
+	return GetValueString(v)
+}
+
+// secretText decodes a secret as UTF-16 text if it is printable.
+func secretText(data []byte) (string, bool) {
+	if len(data) < 2 || len(data)%2 != 0 {
+		return "", false
+	}
+	text := utf16String(data)
+	if text == "" || strings.IndexFunc(text, func(r rune) bool { return !unicode.IsPrint(r) }) >= 0 {
+		return "", false
+	}
+	return text, true
+}
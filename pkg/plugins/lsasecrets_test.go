@@ -0,0 +1,142 @@
+package plugins
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+	"time"
+)
+
+// lsaEncrypt builds a Vista style LSA_SECRET holding secret, the inverse
+// of lsaDecryptAES.
+func lsaEncrypt(t *testing.T, key, secret []byte) []byte {
+	salt := []byte("saltsaltsaltsaltsaltsaltsaltsalt")
+	h := sha256.New()
+	h.Write(key)
+	for i := 0; i < 1000; i++ {
+		h.Write(salt)
+	}
+	block, err := aes.NewCipher(h.Sum(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := concat(le32(len(secret)), make([]byte, 12), secret)
+	plain = append(plain, make([]byte, (16-len(plain)%16)%16)...)
+	out := make([]byte, len(plain))
+	for i := 0; i < len(plain); i += 16 {
+		block.Encrypt(out[i:], plain[i:i+16])
+	}
+	return concat(make([]byte, 28), salt, out)
+}
+
+// secretKey returns a Policy\Secrets subkey holding data as CurrVal.
+func secretKey(name string, data []byte, updated time.Time) *testKey {
+	return key(name,
+		key("CurrVal").with(binValue("", data)),
+		key("CupdTime").with(binValue("", le64(filetime(updated)))),
+	)
+}
+
+func TestLSASecretsAndCachedLogons(t *testing.T) {
+	bootKey, _ := hex.DecodeString("00112233445566778899aabbccddeeff")
+	lsaKeyBytes := []byte("0123456789abcdef0123456789abcdef")
+	nlkm := make([]byte, 64)
+	for i := range nlkm {
+		nlkm[i] = byte(i)
+	}
+	updated := time.Date(2024, 2, 3, 4, 5, 6, 0, time.UTC)
+	cachedAt := time.Date(2024, 6, 7, 8, 9, 10, 0, time.UTC)
+
+	// NL$1: header, then the encrypted hash and padded names
+	dcc2, _ := hex.DecodeString("a7a4b7f2e3d1c9b8a1f0e2d3c4b5a697")
+	pad4 := func(b []byte) []byte { return append(b, make([]byte, (4-len(b)%4)%4)...) }
+	plain := concat(dcc2, make([]byte, 0x48-16), pad4(utf16le("jdoe")), pad4(utf16le("CORP")), pad4(utf16le("corp.example.com")))
+	plain = append(plain, make([]byte, (16-len(plain)%16)%16)...)
+	iv := []byte("initialvector123")
+	header := make([]byte, 96)
+	binary.LittleEndian.PutUint16(header[0:], uint16(len(utf16le("jdoe"))))
+	binary.LittleEndian.PutUint16(header[2:], uint16(len(utf16le("CORP"))))
+	binary.LittleEndian.PutUint32(header[16:], 1105)
+	binary.LittleEndian.PutUint64(header[32:], filetime(cachedAt))
+	binary.LittleEndian.PutUint32(header[48:], 1)
+	binary.LittleEndian.PutUint16(header[60:], uint16(len(utf16le("corp.example.com"))))
+	copy(header[64:], iv)
+	nl1 := concat(header, aesEncrypt(t, nlkm[16:32], iv, plain))
+
+	security := newTestHive(t, key("ROOT",
+		key("Policy",
+			key("PolEKList").with(binValue("", lsaEncrypt(t, bootKey, concat(make([]byte, 52), lsaKeyBytes)))),
+			key("Secrets",
+				secretKey("$MACHINE.ACC", lsaEncrypt(t, lsaKeyBytes, utf16le("password")), updated),
+				secretKey("DefaultPassword", lsaEncrypt(t, lsaKeyBytes, utf16le("Winter2024!")), updated),
+				secretKey("_SC_Backup", lsaEncrypt(t, lsaKeyBytes, utf16le("s3rvice")), updated),
+				secretKey("NL$KM", lsaEncrypt(t, lsaKeyBytes, nlkm), updated),
+			),
+		),
+		key("Cache").with(
+			binValue("NL$1", nl1),
+			binValue("NL$2", make([]byte, 96)),
+			binValue("NL$Control", make([]byte, 8)),
+		),
+	))
+	system := bootKeySystem(bootKey)
+	system.subkeys[1].subkeys = append(system.subkeys[1].subkeys,
+		key("Services", key("Backup").with(szValue("ObjectName", `CORP\svc_backup`))))
+
+	host := &Host{}
+	host.Add("SECURITY", "SECURITY", security)
+	host.Add("SYSTEM", "SYSTEM", newTestHive(t, system))
+
+	p := &LSASecretsPlugin{}
+	records, err := CollectHost(context.Background(), p, host, DefaultOptions(p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]*Record)
+	for _, r := range records {
+		f, _ := r.Get("Secret")
+		got[FormatValue(f)] = r
+	}
+	for secret, want := range map[string]map[string]string{
+		"$MACHINE.ACC":    {"Type": "Machine Account", "NT Hash": "8846f7eaee8fb117ad06bdd830b7586c", "Updated": FormatTime(updated)},
+		"DefaultPassword": {"Password": "Winter2024!"},
+		"_SC_Backup":      {"Service": "Backup", "Account": `CORP\svc_backup`, "Password": "s3rvice"},
+		"NL$KM":           {"Key": hex.EncodeToString(nlkm)},
+	} {
+		r, ok := got[secret]
+		if !ok {
+			t.Errorf("secret %s not reported", secret)
+			continue
+		}
+		for name, value := range want {
+			if f, ok := r.Get(name); !ok || FormatValue(f) != value {
+				t.Errorf("%s: %s = %v, want %s", secret, name, f.Value, value)
+			}
+		}
+	}
+
+	c := &CachedPlugin{}
+	records, err = CollectHost(context.Background(), c, host, DefaultOptions(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("expected 1 cached logon, got %d", len(records))
+	}
+	for name, value := range map[string]string{
+		"Entry":      "NL$1",
+		"Username":   "jdoe",
+		"Domain":     "CORP",
+		"DNS Domain": "corp.example.com",
+		"RID":        "1105",
+		"Last Logon": FormatTime(cachedAt),
+		"Hash":       "$DCC2$10240#jdoe#" + hex.EncodeToString(dcc2),
+	} {
+		if f, ok := records[0].Get(name); !ok || FormatValue(f) != value {
+			t.Errorf("cached: %s = %v, want %s", name, f.Value, value)
+		}
+	}
+}
@@ -25,7 +25,26 @@ func (p *MapNetworkDrivePlugin) CompatibleHiveTypes() []string {
 	return []string{"NTUSER.DAT"}
 }
 
+func (p *MapNetworkDrivePlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategoryNetwork,
+		Techniques: []string{"T1021.002"},
+		Artifact:   "Drives the user mapped to network shares.",
+		References: []string{regRipperReference},
+		Version:    "1.0.0",
+		Schema: []FieldSpec{
+			{Name: "Drive", Type: FieldString, Description: "drive letter"},
+			{Name: "Remote Path", Type: FieldString, Description: "UNC path of the share"},
+			{Name: "User Name", Type: FieldString, Description: "account used for the mapping"},
+		},
+	}
+}
+
 func (p *MapNetworkDrivePlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
+
+func (p *MapNetworkDrivePlugin) Collect(hive *regf.Hive, emit Emitter) error {
 	path := "Network"
 
 	key, err := hive.GetKey(path)
@@ -33,33 +52,20 @@ func (p *MapNetworkDrivePlugin) Run(hive *regf.Hive) error {
 		return fmt.Errorf("network key not found: %w", err)
 	}
 
-	fmt.Println("Mapped Network Drives")
-	fmt.Println("=====================")
-	fmt.Println()
-
 	for _, driveKey := range key.Subkeys() {
-		driveLetter := driveKey.Name()
-		remotePath := ""
-		userName := ""
+		r := NewRecord(joinKeyPath(path, driveKey.Name()), driveKey).
+			AddString("Drive", driveKey.Name())
 
 		for _, val := range driveKey.Values() {
 			switch val.Name() {
 			case "RemotePath":
-				remotePath = GetValueString(val)
+				r.AddString("Remote Path", GetValueString(val))
 			case "UserName":
-				userName = GetValueString(val)
+				r.AddString("User Name", GetValueString(val))
 			}
 		}
 
-		fmt.Printf("Drive %s:\n", driveLetter)
-		if remotePath != "" {
-			fmt.Printf("  Remote Path: %s\n", remotePath)
-		}
-		if userName != "" {
-			fmt.Printf("  User Name: %s\n", userName)
-		}
-		fmt.Printf("  Last Modified: %s\n", driveKey.Timestamp().Format("2006-01-02 15:04:05"))
-		fmt.Println()
+		emit(r)
 	}
 
 	return nil
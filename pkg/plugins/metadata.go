@@ -0,0 +1,144 @@
+package plugins
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Category groups plugins by the kind of evidence they extract.
+type Category string
+
+const (
+	CategoryExecution    Category = "execution"
+	CategoryPersistence  Category = "persistence"
+	CategoryUSB          Category = "usb"
+	CategoryNetwork      Category = "network"
+	CategoryAccounts     Category = "accounts"
+	CategoryUserActivity Category = "user-activity"
+	CategorySoftware     Category = "software"
+	CategorySystem       Category = "system"
+	// CategoryOther is used for plugins that do not declare metadata.
+	CategoryOther Category = "other"
+)
+
+// Categories returns every category in display order.
+func Categories() []Category {
+	return []Category{
+		CategoryExecution,
+		CategoryPersistence,
+		CategoryUSB,
+		CategoryNetwork,
+		CategoryAccounts,
+		CategoryUserActivity,
+		CategorySoftware,
+		CategorySystem,
+		CategoryOther,
+	}
+}
+
+// FieldSpec documents one field of the records a plugin emits. A Name of
+// "*" stands for fields named after registry values.
+type FieldSpec struct {
+	Name        string
+	Type        FieldType
+	Description string
+	// Sensitive marks fields holding secrets, see Record.AddSecret.
+	Sensitive bool
+}
+
+// Metadata describes a plugin beyond its name and description.
+type Metadata struct {
+	Category Category
+	// Techniques are MITRE ATT&CK technique IDs such as "T1547.001".
+	Techniques []string
+	// Artifact explains what the registry artifact is and why it matters.
+	Artifact   string
+	References []string
+	Version    string
+	// Schema lists the fields of the records the plugin emits.
+	Schema []FieldSpec
+}
+
+// MetadataPlugin is an optional interface for plugins that describe
+// themselves beyond Name and Description.
+type MetadataPlugin interface {
+	Plugin
+	Metadata() Metadata
+}
+
+// MetadataOf returns the metadata of p, with defaults for plugins that do
+// not implement MetadataPlugin.
+func MetadataOf(p Plugin) Metadata {
+	var m Metadata
+	if mp, ok := p.(MetadataPlugin); ok {
+		m = mp.Metadata()
+	}
+	if m.Category == "" {
+		m.Category = CategoryOther
+	}
+	if m.Version == "" {
+		m.Version = "0.0.0"
+	}
+	return m
+}
+
+// HasTechnique reports whether the metadata lists the ATT&CK technique id.
+// A parent technique such as "T1547" also matches its sub-techniques.
+func (m Metadata) HasTechnique(id string) bool {
+	id = strings.ToUpper(strings.TrimSpace(id))
+	for _, t := range m.Techniques {
+		if t == id || strings.HasPrefix(t, id+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// TechniqueURL returns the ATT&CK page of a technique ID.
+func TechniqueURL(id string) string {
+	base, sub, found := strings.Cut(id, ".")
+	if found {
+		return fmt.Sprintf("https://attack.mitre.org/techniques/%s/%s/", base, sub)
+	}
+	return fmt.Sprintf("https://attack.mitre.org/techniques/%s/", base)
+}
+
+// SortKeys lists the keys accepted by SortPlugins.
+var SortKeys = []string{"name", "category", "technique", "version"}
+
+// SortPlugins sorts plugins in place by the given key, then by name.
+func SortPlugins(ps []Plugin, by string) error {
+	var key func(p Plugin) string
+	switch by {
+	case "", "name":
+		key = func(p Plugin) string { return "" }
+	case "category":
+		key = func(p Plugin) string { return string(MetadataOf(p).Category) }
+	case "technique":
+		key = func(p Plugin) string {
+			ts := MetadataOf(p).Techniques
+			if len(ts) == 0 {
+				// Plugins without techniques go last
+				return "~"
+			}
+			return ts[0]
+		}
+	case "version":
+		key = func(p Plugin) string { return MetadataOf(p).Version }
+	default:
+		return fmt.Errorf("unknown sort key %q (supported: %s)", by, strings.Join(SortKeys, ", "))
+	}
+
+	sort.SliceStable(ps, func(i, j int) bool {
+		ki, kj := key(ps[i]), key(ps[j])
+		if ki != kj {
+			return ki < kj
+		}
+		return ps[i].Name() < ps[j].Name()
+	})
+	return nil
+}
+
+// regRipperReference is the upstream project most plugins are adapted from.
+const regRipperReference = "https://github.com/keydet89/RegRipper3.0"
@@ -1,6 +1,7 @@
 package plugins
 
 import (
+	"encoding/binary"
 	"fmt"
 
 	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
@@ -25,7 +26,25 @@ func (p *MountPointsPlugin) CompatibleHiveTypes() []string {
 	return []string{"SYSTEM"}
 }
 
+func (p *MountPointsPlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategoryUSB,
+		Techniques: []string{"T1091"},
+		Artifact:   "MountedDevices maps drive letters and volume GUIDs to disks, including removable media.",
+		References: []string{regRipperReference},
+		Version:    "1.0.0",
+		Schema: []FieldSpec{
+			{Name: "Mount Point", Type: FieldString, Description: "drive letter or volume GUID"},
+			{Name: "Device", Type: FieldString, Description: "decoded disk signature, GPT partition or device path"},
+		},
+	}
+}
+
 func (p *MountPointsPlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
+
+func (p *MountPointsPlugin) Collect(hive *regf.Hive, emit Emitter) error {
 	path := "MountedDevices"
 
 	key, err := hive.GetKey(path)
@@ -33,17 +52,28 @@ func (p *MountPointsPlugin) Run(hive *regf.Hive) error {
 		return fmt.Errorf("MountedDevices key not found: %w", err)
 	}
 
-	fmt.Println("Mounted Devices")
-	fmt.Println("===============")
-	fmt.Printf("Last Modified: %s\n", key.Timestamp().Format("2006-01-02 15:04:05"))
-	fmt.Println()
-
 	for _, val := range key.Values() {
 		if val.Name() != "" {
-			// The data is binary, but we can show the name
-			fmt.Printf("%s\n", val.Name())
+			emit(NewRecord(path, key).
+				AddString("Mount Point", val.Name()).
+				AddString("Device", describeMountedDevice(val.Bytes())))
 		}
 	}
 
 	return nil
 }
+
+// describeMountedDevice decodes the data of a MountedDevices value: an MBR
+// disk signature and partition offset, a GPT partition GUID, or a UTF-16
+// device path.
+func describeMountedDevice(data []byte) string {
+	switch {
+	case len(data) == 12:
+		return fmt.Sprintf("MBR disk signature %08X, partition offset %d",
+			binary.LittleEndian.Uint32(data[0:4]), binary.LittleEndian.Uint64(data[4:12]))
+	case len(data) == 24 && string(data[:8]) == "DMIO:ID:":
+		return "GPT partition " + formatGUID(data[8:24])
+	default:
+		return parseNullTerminatedString(data)
+	}
+}
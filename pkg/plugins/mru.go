@@ -0,0 +1,53 @@
+package plugins
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
+)
+
+// mruEntry is a value of an MRU key and its position in the key's MRUList
+// or MRUListEx. Listed is false when the list is missing or does not name
+// the value, in which case Position is meaningless.
+type mruEntry struct {
+	Value    *regf.Value
+	Position int
+	Listed   bool
+}
+
+// mruValues returns the entries of an MRU key in MRUList or MRUListEx
+// order. Entries missing from the list follow in name order.
+func mruValues(key *regf.Key, order string) []mruEntry {
+	positions := mruPositions(key, order)
+	var entries []mruEntry
+	for _, v := range key.Values() {
+		if v.Name() == "" || strings.EqualFold(v.Name(), "MRUList") || strings.EqualFold(v.Name(), "MRUListEx") {
+			continue
+		}
+		pos, ok := positions[strings.ToLower(v.Name())]
+		entries = append(entries, mruEntry{Value: v, Position: pos, Listed: ok})
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		ei, ej := entries[i], entries[j]
+		if ei.Listed != ej.Listed {
+			return ei.Listed
+		}
+		if ei.Listed {
+			return ei.Position < ej.Position
+		}
+		return ei.Value.Name() < ej.Value.Name()
+	})
+	return entries
+}
+
+// splitUTF16 splits data after its first UTF-16 NUL, returning the string
+// before it and the bytes after it.
+func splitUTF16(data []byte) (string, []byte) {
+	for i := 0; i+1 < len(data); i += 2 {
+		if data[i] == 0 && data[i+1] == 0 {
+			return utf16String(data[:i]), data[i+2:]
+		}
+	}
+	return utf16String(data), nil
+}
@@ -1,9 +1,6 @@
 package plugins
 
 import (
-	"fmt"
-	"strings"
-
 	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
 )
 
@@ -27,41 +24,54 @@ func (p *MUICachePlugin) CompatibleHiveTypes() []string {
 	return []string{"USRCLASS.DAT", "NTUSER.DAT"}
 }
 
+func (p *MUICachePlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategoryExecution,
+		Techniques: []string{"T1204.002"},
+		Artifact:   "MUICache stores the display name of programs that were run by the user.",
+		References: []string{regRipperReference},
+		Version:    "1.0.0",
+		Schema: []FieldSpec{
+			{Name: "Application", Type: FieldString, Description: "program path"},
+			{Name: "Description", Type: FieldString, Description: "cached display name"},
+		},
+	}
+}
+
 func (p *MUICachePlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
+
+func (p *MUICachePlugin) Collect(hive *regf.Hive, emit Emitter) error {
 	paths := []string{
 		"Local Settings/Software/Microsoft/Windows/Shell/MuiCache",
 		"Software/Microsoft/Windows/ShellNoRoam/MUICache",
 		"Software/Classes/Local Settings/Software/Microsoft/Windows/Shell/MuiCache",
 	}
 
-	fmt.Println("MUICache Entries (Executed Applications):")
-	fmt.Println(strings.Repeat("=", 80))
-
 	found := false
 	for _, path := range paths {
 		key, err := hive.GetKey(path)
 		if err != nil {
 			continue
 		}
-
 		found = true
-		fmt.Printf("\n%s:\n", path)
-		fmt.Printf("Last Write Time: %s\n\n", key.Timestamp().Format("2006-01-02 15:04:05"))
 
 		for _, val := range key.Values() {
 			if val.Name() != "" {
-				valStr := GetValueString(val)
-				fmt.Printf("  %s\n", val.Name())
-				if valStr != "" {
-					fmt.Printf("    Description: %s\n", valStr)
+				r := NewRecord(path, key).
+					AddString("Application", val.Name()).
+					WithTags("execution")
+				if valStr := GetValueString(val); valStr != "" {
+					r.AddString("Description", valStr)
 				}
+				emit(r)
 			}
 		}
 	}
 
 	if !found {
-		fmt.Println("No MUICache entries found")
+		return notFound("no MUICache keys")
 	}
-
 	return nil
 }
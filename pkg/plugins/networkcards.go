@@ -2,7 +2,6 @@ package plugins
 
 import (
 	"fmt"
-	"strings"
 
 	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
 )
@@ -26,21 +25,38 @@ func (p *NetworkCardsPlugin) CompatibleHiveTypes() []string {
 	return []string{"SOFTWARE"}
 }
 
+func (p *NetworkCardsPlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategoryNetwork,
+		Techniques: []string{"T1016"},
+		Artifact:   "Network adapters installed on the system.",
+		References: []string{regRipperReference},
+		Version:    "1.0.0",
+		Schema: []FieldSpec{
+			{Name: "Adapter", Type: FieldString, Description: "adapter number"},
+			{Name: "*", Type: FieldString, Description: "adapter values such as Description and ServiceName"},
+		},
+	}
+}
+
 func (p *NetworkCardsPlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
+
+func (p *NetworkCardsPlugin) Collect(hive *regf.Hive, emit Emitter) error {
 	netcardsPath := "Microsoft\\Windows NT\\CurrentVersion\\NetworkCards"
 	netcardsKey, err := hive.GetKey(netcardsPath)
 	if err != nil {
 		return fmt.Errorf("NetworkCards key not found: %w", err)
 	}
 
-	fmt.Println("Network Adapters:")
-	fmt.Println(strings.Repeat("=", 80))
-
 	for _, card := range netcardsKey.Subkeys() {
-		fmt.Printf("\nAdapter %s:\n", card.Name())
+		r := NewRecord(joinKeyPath(netcardsPath, card.Name()), card).
+			AddString("Adapter", card.Name())
 		for _, val := range card.Values() {
-			fmt.Printf("  %s: %s\n", val.Name(), GetValueString(val))
+			r.AddValue(val.Name(), val)
 		}
+		emit(r)
 	}
 
 	return nil
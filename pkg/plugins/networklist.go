@@ -26,7 +26,28 @@ func (p *NetworkListPlugin) CompatibleHiveTypes() []string {
 	return []string{"SOFTWARE"}
 }
 
+func (p *NetworkListPlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategoryNetwork,
+		Techniques: []string{"T1016"},
+		Artifact:   "NetworkList profiles record the networks the system connected to, with first and last connection times.",
+		References: []string{regRipperReference},
+		Version:    "1.0.0",
+		Schema: []FieldSpec{
+			{Name: "Profile GUID", Type: FieldString, Description: "profile key name"},
+			{Name: "Name", Type: FieldString, Description: "profile name (often the SSID)"},
+			{Name: "Description", Type: FieldString, Description: "profile description"},
+			{Name: "Date Created", Type: FieldTime, Description: "first connection"},
+			{Name: "Date Last Connected", Type: FieldTime, Description: "last connection"},
+		},
+	}
+}
+
 func (p *NetworkListPlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
+
+func (p *NetworkListPlugin) Collect(hive *regf.Hive, emit Emitter) error {
 	path := "Microsoft\\Windows NT\\CurrentVersion\\NetworkList\\Profiles"
 
 	key, err := hive.GetKey(path)
@@ -34,30 +55,26 @@ func (p *NetworkListPlugin) Run(hive *regf.Hive) error {
 		return fmt.Errorf("network list key not found: %w", err)
 	}
 
-	fmt.Println("Network Profiles")
-	fmt.Println("================")
-	fmt.Println()
-
 	for _, profile := range key.Subkeys() {
-		fmt.Printf("Profile GUID: %s\n", profile.Name())
+		r := NewRecord(joinKeyPath(path, profile.Name()), profile).
+			AddString("Profile GUID", profile.Name())
 
 		for _, val := range profile.Values() {
 			name := val.Name()
 			switch {
 			case strings.EqualFold(name, "ProfileName"):
-				fmt.Printf("  Name: %s\n", GetValueString(val))
+				r.AddString("Name", GetValueString(val))
 			case strings.EqualFold(name, "Description"):
-				fmt.Printf("  Description: %s\n", GetValueString(val))
+				r.AddString("Description", GetValueString(val))
 			case strings.EqualFold(name, "DateCreated"):
-				// Could parse this as a binary timestamp
-				fmt.Printf("  Date Created: (binary data)\n")
+				// SYSTEMTIME in the system's local time zone
+				r.AddTime("Date Created", systemtimeToTime(val.Bytes()))
 			case strings.EqualFold(name, "DateLastConnected"):
-				fmt.Printf("  Date Last Connected: (binary data)\n")
+				r.AddTime("Date Last Connected", systemtimeToTime(val.Bytes()))
 			}
 		}
 
-		fmt.Printf("  Last Modified: %s\n", profile.Timestamp().Format("2006-01-02 15:04:05"))
-		fmt.Println()
+		emit(r)
 	}
 
 	return nil
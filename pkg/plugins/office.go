@@ -0,0 +1,261 @@
+package plugins
+
+import (
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
+)
+
+func init() {
+	Register(&OfficePlugin{})
+}
+
+// officePath is the NTUSER.DAT key holding one subkey per Office version.
+const officePath = "Software\\Microsoft\\Office"
+
+// officeVersionKey matches version subkeys such as 16.0 (2016 and later),
+// 15.0 (2013), 14.0 (2010) and 12.0 (2007).
+var officeVersionKey = regexp.MustCompile(`^\d+\.\d+$`)
+
+// Artifacts reported in the Artifact field.
+const (
+	OfficeFileMRU         = "File MRU"
+	OfficePlaceMRU        = "Place MRU"
+	OfficeTrustRecord     = "Trust Record"
+	OfficeReadingLocation = "Reading Location"
+)
+
+// Trust states, the last DWORD of a TrustRecords value.
+const (
+	officeTrustEditing = 0x00000001
+	officeTrustMacros  = 0x7FFFFFFF
+)
+
+// OfficePlugin displays the recent files and folders, trusted documents
+// and reading positions of Microsoft Office applications.
+type OfficePlugin struct{}
+
+func (p *OfficePlugin) Name() string {
+	return "office"
+}
+
+func (p *OfficePlugin) Description() string {
+	return "Display Microsoft Office MRU lists, trusted documents and reading locations from NTUSER.DAT"
+}
+
+func (p *OfficePlugin) CompatibleHiveTypes() []string {
+	return []string{"NTUSER.DAT"}
+}
+
+func (p *OfficePlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategoryUserActivity,
+		Techniques: []string{"T1204.002"},
+		Artifact: "Office keeps the files and folders each application opened (File MRU, Place MRU, per account " +
+			"under User MRU), the documents the user enabled editing or macros on (TrustRecords) and where Word " +
+			"documents were last read (Reading Locations).",
+		References: []string{regRipperReference},
+		Version:    "1.0.0",
+		Schema: []FieldSpec{
+			{Name: "Artifact", Type: FieldString, Description: "File MRU, Place MRU, Trust Record or Reading Location"},
+			{Name: "Office Version", Type: FieldString, Description: "Office version key, such as 16.0"},
+			{Name: "Application", Type: FieldString, Description: "Office application, such as Word"},
+			{Name: "Account", Type: FieldString, Description: "LiveId or ADAL account of a User MRU list"},
+			{Name: "MRU Position", Type: FieldInt, Description: "position in the MRU list, 0 being the most recent"},
+			{Name: "Path", Type: FieldString, Description: "document or folder path"},
+			{Name: "Last Opened", Type: FieldTime, Description: "time embedded in the MRU entry"},
+			{Name: "Trust", Type: FieldString, Description: "Editing Enabled or Macros Enabled"},
+			{Name: "Trusted", Type: FieldTime, Description: "time the document was trusted"},
+			{Name: "Last Read", Type: FieldString, Description: "local time the document was last closed, as Word stores it"},
+			{Name: "Reading Position", Type: FieldString, Description: "position in the document when it was closed"},
+		},
+	}
+}
+
+func (p *OfficePlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
+
+func (p *OfficePlugin) Collect(hive *regf.Hive, emit Emitter) error {
+	office, err := hive.GetKey(officePath)
+	if err != nil {
+		return notFound("Office key not found")
+	}
+
+	found := false
+	emitFound := func(r *Record) {
+		found = true
+		emit(r)
+	}
+	for _, versionKey := range office.Subkeys() {
+		if !officeVersionKey.MatchString(versionKey.Name()) {
+			continue
+		}
+		for _, appKey := range versionKey.Subkeys() {
+			app := officeApp{
+				hive:    hive,
+				version: versionKey.Name(),
+				name:    appKey.Name(),
+				path:    joinKeyPath(officePath, versionKey.Name(), appKey.Name()),
+			}
+			app.collect(appKey, emitFound)
+		}
+	}
+	if !found {
+		return notFound("no Office MRU lists, trust records or reading locations")
+	}
+	return nil
+}
+
+// officeApp is the key of one application of one Office version.
+type officeApp struct {
+	hive    *regf.Hive
+	version string
+	name    string
+	path    string
+}
+
+// record starts a record of the application for a key below it.
+func (a officeApp) record(artifact, path string, key *regf.Key) *Record {
+	return NewRecord(path, key).
+		AddString("Artifact", artifact).
+		AddString("Office Version", a.version).
+		AddString("Application", a.name)
+}
+
+// collect emits the artifacts of the application key.
+func (a officeApp) collect(appKey *regf.Key, emit Emitter) {
+	for _, list := range []string{OfficeFileMRU, OfficePlaceMRU} {
+		if key, err := getSubkey(appKey, list); err == nil {
+			a.collectMRU(list, joinKeyPath(a.path, list), key, "", emit)
+		}
+	}
+
+	// Office 2013 and later keep a list per signed in account
+	if userMRU, err := getSubkey(appKey, "User MRU"); err == nil {
+		for _, account := range userMRU.Subkeys() {
+			for _, list := range []string{OfficeFileMRU, OfficePlaceMRU} {
+				if key, err := getSubkey(account, list); err == nil {
+					path := joinKeyPath(a.path, "User MRU", account.Name(), list)
+					a.collectMRU(list, path, key, account.Name(), emit)
+				}
+			}
+		}
+	}
+
+	trustPath := joinKeyPath(a.path, "Security", "Trusted Documents", "TrustRecords")
+	if key, err := a.hive.GetKey(trustPath); err == nil {
+		a.collectTrustRecords(trustPath, key, emit)
+	}
+
+	if key, err := getSubkey(appKey, "Reading Locations"); err == nil {
+		a.collectReadingLocations(joinKeyPath(a.path, "Reading Locations"), key, emit)
+	}
+}
+
+// collectMRU emits the "Item N" values of a File MRU or Place MRU key in
+// order, Item 1 being the most recent.
+func (a officeApp) collectMRU(list, path string, key *regf.Key, account string, emit Emitter) {
+	type item struct {
+		n     int
+		value *regf.Value
+	}
+	var items []item
+	for _, v := range key.Values() {
+		number, ok := strings.CutPrefix(v.Name(), "Item ")
+		n, err := strconv.Atoi(number)
+		if !ok || err != nil {
+			// Item Metadata N and other values
+			continue
+		}
+		items = append(items, item{n, v})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].n < items[j].n })
+
+	for i, it := range items {
+		entry, opened := parseOfficeMRU(GetValueString(it.value))
+		r := a.record(list, path, key)
+		if account != "" {
+			r.AddString("Account", account)
+		}
+		r.AddInt("MRU Position", int64(i)).
+			AddString("Path", entry)
+		if !opened.IsZero() {
+			r.AddTime("Last Opened", opened)
+		}
+		emit(r)
+	}
+}
+
+// parseOfficeMRU splits an MRU entry such as
+// "[F00000000][T01D7A1B2C3D4E5F6][O00000000]*C:\doc.docx" into the path and
+// the FILETIME of its T field, in hex. Office 2007 stores the bare path.
+func parseOfficeMRU(s string) (string, time.Time) {
+	var opened time.Time
+	for strings.HasPrefix(s, "[") {
+		end := strings.IndexByte(s, ']')
+		if end < 0 {
+			break
+		}
+		if field := s[1:end]; strings.HasPrefix(field, "T") {
+			if ft, err := strconv.ParseUint(field[1:], 16, 64); err == nil {
+				opened = filetimeToTime(ft)
+			}
+		}
+		s = s[end+1:]
+	}
+	return strings.TrimPrefix(s, "*"), opened
+}
+
+// collectTrustRecords emits the documents the user trusted. Each value is
+// named after the document; its data starts with the FILETIME the
+// document was trusted and ends with the trust state.
+func (a officeApp) collectTrustRecords(path string, key *regf.Key, emit Emitter) {
+	for _, v := range key.Values() {
+		data := v.Bytes()
+		r := a.record(OfficeTrustRecord, path, key).
+			AddString("Path", v.Name())
+		if len(data) >= 12 {
+			if trusted := filetimeToTime(binary.LittleEndian.Uint64(data)); !trusted.IsZero() {
+				r.AddTime("Trusted", trusted)
+			}
+			switch state := binary.LittleEndian.Uint32(data[len(data)-4:]); state {
+			case officeTrustMacros:
+				r.AddString("Trust", "Macros Enabled").
+					WithSeverity(SeverityWarning).
+					WithTags("macros")
+			case officeTrustEditing:
+				r.AddString("Trust", "Editing Enabled")
+			default:
+				r.AddString("Trust", fmt.Sprintf("Unknown (0x%08X)", state))
+			}
+		}
+		emit(r)
+	}
+}
+
+// collectReadingLocations emits the "Document N" subkeys, which hold the
+// path, the last closing time and the position reached.
+func (a officeApp) collectReadingLocations(path string, key *regf.Key, emit Emitter) {
+	for _, doc := range key.Subkeys() {
+		r := a.record(OfficeReadingLocation, joinKeyPath(path, doc.Name()), doc)
+		for _, field := range []struct{ value, name string }{
+			{"File Path", "Path"},
+			{"Datetime", "Last Read"},
+			{"Position", "Reading Position"},
+		} {
+			if v, err := getValue(doc, field.value); err == nil {
+				if s := GetValueString(v); s != "" {
+					r.AddString(field.name, s)
+				}
+			}
+		}
+		emit(r)
+	}
+}
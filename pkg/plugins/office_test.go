@@ -0,0 +1,73 @@
+package plugins
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestOfficeDecodesMRUAndTrustRecords(t *testing.T) {
+	opened := time.Date(2024, 3, 4, 5, 6, 7, 0, time.UTC)
+	trusted := time.Date(2024, 3, 4, 5, 7, 0, 0, time.UTC)
+	mru := func(path string) string {
+		return fmt.Sprintf("[F00000000][T%016X][O00000000]*%s", filetime(opened), path)
+	}
+	trustRecord := func(state int) []byte {
+		return concat(le64(filetime(trusted)), make([]byte, 12), le32(state))
+	}
+
+	hive := newTestHive(t, key("ROOT", key("Software", key("Microsoft", key("Office",
+		key("Common"),
+		key("16.0",
+			key("Word",
+				key("User MRU", key("ADAL_ABC123",
+					key("File MRU").with(
+						szValue("Item 2", mru(`C:\Users\alice\Documents\old.docx`)),
+						szValue("Item 1", mru(`C:\Users\alice\Downloads\invoice.docm`)),
+						szValue("Item Metadata 1", "<Metadata />"),
+					),
+				)),
+				key("Security", key("Trusted Documents", key("TrustRecords").with(
+					binValue("%USERPROFILE%/Downloads/invoice.docm", trustRecord(0x7FFFFFFF)),
+					binValue("%USERPROFILE%/Documents/notes.docx", trustRecord(1)),
+				))),
+				key("Reading Locations", key("Document 0").with(
+					szValue("File Path", `C:\Users\alice\Documents\old.docx`),
+					szValue("Datetime", "2024-03-04T05:10"),
+					szValue("Position", "120 0"),
+				)),
+			),
+		),
+	)))))
+
+	records, err := Collect(&OfficePlugin{}, hive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]string{
+		{"Artifact": OfficeFileMRU, "Application": "Word", "Account": "ADAL_ABC123", "MRU Position": "0",
+			"Path": `C:\Users\alice\Downloads\invoice.docm`, "Last Opened": FormatTime(opened)},
+		{"Artifact": OfficeFileMRU, "MRU Position": "1", "Path": `C:\Users\alice\Documents\old.docx`},
+		{"Artifact": OfficeTrustRecord, "Path": "%USERPROFILE%/Downloads/invoice.docm",
+			"Trust": "Macros Enabled", "Trusted": FormatTime(trusted)},
+		{"Artifact": OfficeTrustRecord, "Path": "%USERPROFILE%/Documents/notes.docx", "Trust": "Editing Enabled"},
+		{"Artifact": OfficeReadingLocation, "Office Version": "16.0", "Path": `C:\Users\alice\Documents\old.docx`,
+			"Last Read": "2024-03-04T05:10", "Reading Position": "120 0"},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("expected %d records, got %d", len(want), len(records))
+	}
+	for i, fields := range want {
+		for name, value := range fields {
+			if f, ok := records[i].Get(name); !ok || FormatValue(f) != value {
+				t.Errorf("record %d: %s = %v, want %s", i, name, f.Value, value)
+			}
+		}
+	}
+	if records[2].Severity != SeverityWarning || !records[2].HasTag("macros") {
+		t.Errorf("macro trust record not flagged: %v %v", records[2].Severity, records[2].Tags)
+	}
+	if records[3].Severity != SeverityInfo {
+		t.Errorf("editing trust record flagged %v", records[3].Severity)
+	}
+}
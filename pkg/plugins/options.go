@@ -0,0 +1,237 @@
+package plugins
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
+)
+
+// ErrInvalidOption is returned when a plugin option is unknown or its value
+// does not validate.
+var ErrInvalidOption = errors.New("invalid plugin option")
+
+// OptionType is the type of a plugin option value.
+type OptionType int
+
+const (
+	// OptionString holds free text.
+	OptionString OptionType = iota
+	// OptionInt holds a decimal integer.
+	OptionInt
+	// OptionBool holds true or false.
+	OptionBool
+)
+
+// String returns the lower-case name of the option type.
+func (t OptionType) String() string {
+	switch t {
+	case OptionString:
+		return "string"
+	case OptionInt:
+		return "int"
+	case OptionBool:
+		return "bool"
+	default:
+		return "unknown"
+	}
+}
+
+// Option declares a setting a plugin accepts.
+type Option struct {
+	Name        string
+	Type        OptionType
+	Default     string
+	Description string
+	// Choices, when set, lists the only accepted values.
+	Choices []string
+	// Validate, when set, performs extra checks on the raw value.
+	Validate func(value string) error
+}
+
+// parse converts a raw value into the option's Go type.
+func (o Option) parse(raw string) (any, error) {
+	if len(o.Choices) > 0 {
+		found := false
+		for _, c := range o.Choices {
+			if strings.EqualFold(c, raw) {
+				raw = c
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("must be one of %s", strings.Join(o.Choices, ", "))
+		}
+	}
+	if o.Validate != nil {
+		if err := o.Validate(raw); err != nil {
+			return nil, err
+		}
+	}
+
+	switch o.Type {
+	case OptionInt:
+		n, err := strconv.Atoi(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an integer", raw)
+		}
+		return n, nil
+	case OptionBool:
+		b, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a boolean", raw)
+		}
+		return b, nil
+	default:
+		return raw, nil
+	}
+}
+
+// validateLimit accepts non-negative integers, the usual type of a "limit"
+// option where 0 means no limit.
+func validateLimit(value string) error {
+	if n, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && n < 0 {
+		return fmt.Errorf("must not be negative")
+	}
+	return nil
+}
+
+// Options holds validated option values for a single plugin run.
+type Options struct {
+	values map[string]any
+}
+
+// String returns a string option, or "" if it is not set.
+func (o Options) String(name string) string {
+	s, _ := o.values[name].(string)
+	return s
+}
+
+// Int returns an integer option, or 0 if it is not set.
+func (o Options) Int(name string) int {
+	n, _ := o.values[name].(int)
+	return n
+}
+
+// Bool returns a boolean option, or false if it is not set.
+func (o Options) Bool(name string) bool {
+	b, _ := o.values[name].(bool)
+	return b
+}
+
+// ContextPlugin is implemented by plugins that declare options and honour
+// context cancellation.
+type ContextPlugin interface {
+	Plugin
+	// Options lists the options the plugin accepts.
+	Options() []Option
+	// CollectContext reads the hive with the given options and passes each
+	// result to emit. It returns ctx.Err() once ctx is cancelled.
+	CollectContext(ctx context.Context, hive *regf.Hive, opts Options, emit Emitter) error
+}
+
+// optionsPlugin is implemented by every plugin that declares options,
+// ContextPlugins and MultiHivePlugins alike.
+type optionsPlugin interface {
+	Options() []Option
+}
+
+// DeclaredOptions returns the options declared by p, or nil.
+func DeclaredOptions(p Plugin) []Option {
+	if op, ok := p.(optionsPlugin); ok {
+		return op.Options()
+	}
+	return nil
+}
+
+// ParseOptions validates raw option values against the options declared by
+// p and fills in defaults for the ones not given.
+func ParseOptions(p Plugin, raw map[string]string) (Options, error) {
+	declared := DeclaredOptions(p)
+	opts := Options{values: make(map[string]any, len(declared))}
+
+	known := make(map[string]Option, len(declared))
+	for _, o := range declared {
+		known[o.Name] = o
+	}
+
+	// Report unknown names in a stable order.
+	names := make([]string, 0, len(raw))
+	for name := range raw {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, ok := known[name]; !ok {
+			return Options{}, fmt.Errorf("%w: %s does not accept %q", ErrInvalidOption, p.Name(), name)
+		}
+	}
+
+	for _, o := range declared {
+		value, given := raw[o.Name]
+		if !given {
+			value = o.Default
+		}
+		v, err := o.parse(value)
+		if err != nil {
+			return Options{}, fmt.Errorf("%w: %s.%s: %v", ErrInvalidOption, p.Name(), o.Name, err)
+		}
+		opts.values[o.Name] = v
+	}
+	return opts, nil
+}
+
+// DefaultOptions returns the default option values of p.
+func DefaultOptions(p Plugin) Options {
+	opts, err := ParseOptions(p, nil)
+	if err != nil {
+		// Defaults are declared by the plugin itself and must validate.
+		panic(err)
+	}
+	return opts
+}
+
+// CollectContext runs the plugin with the given options and returns its
+// records. Plugins that are not ContextPlugins ignore the options; their
+// records are dropped once ctx is cancelled. A MultiHivePlugin that cannot
+// run on a single hive gets a host holding just this hive, in its primary
+// role if the hive type cannot be detected.
+func CollectContext(ctx context.Context, p Plugin, hive *regf.Hive, opts Options) ([]*Record, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var records []*Record
+	emit := func(r *Record) {
+		if ctx.Err() == nil {
+			records = append(records, r)
+		}
+	}
+
+	if cp, ok := p.(ContextPlugin); ok {
+		err := cp.CollectContext(ctx, hive, opts, emit)
+		return records, err
+	}
+
+	if mp, ok := p.(MultiHivePlugin); ok {
+		host := HostFromHive("", hive)
+		if host.Hives[0].Role == "" && len(mp.RequiredHives()) > 0 {
+			host.Hives[0].Role = mp.RequiredHives()[0]
+		}
+		return CollectHost(ctx, p, host, opts)
+	}
+
+	rp, ok := p.(RecordPlugin)
+	if !ok {
+		rp = legacyAdapter{p}
+	}
+	if err := rp.Collect(hive, emit); err != nil {
+		return records, err
+	}
+	return records, ctx.Err()
+}
@@ -0,0 +1,62 @@
+package plugins
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestParseOptions(t *testing.T) {
+	p := &ServicesExPlugin{}
+
+	opts, err := ParseOptions(p, nil)
+	if err != nil {
+		t.Fatalf("defaults failed to parse: %v", err)
+	}
+	if opts.String("controlset") != "current" || opts.Int("limit") != 100 {
+		t.Errorf("unexpected defaults: %q %d", opts.String("controlset"), opts.Int("limit"))
+	}
+
+	opts, err = ParseOptions(p, map[string]string{"controlset": "ControlSet002", "limit": "0"})
+	if err != nil {
+		t.Fatalf("valid options rejected: %v", err)
+	}
+	if opts.Int("limit") != 0 {
+		t.Errorf("expected limit 0, got %d", opts.Int("limit"))
+	}
+
+	for _, raw := range []map[string]string{
+		{"limit": "many"},
+		{"limit": "-1"},
+		{"controlset": "last"},
+		{"paths": "Root"},
+	} {
+		if _, err := ParseOptions(p, raw); !errors.Is(err, ErrInvalidOption) {
+			t.Errorf("%v: expected ErrInvalidOption, got %v", raw, err)
+		}
+	}
+}
+
+func TestCollectContextHonoursOptionsAndCancel(t *testing.T) {
+	var children []*testKey
+	for _, ext := range []string{".a", ".b", ".c"} {
+		children = append(children, key(ext).with(szValue("", "handler"+ext)))
+	}
+	hive := newTestHive(t, key("ROOT", key("Classes", children...)))
+
+	p := &FileAssocPlugin{}
+	opts, err := ParseOptions(p, map[string]string{"limit": "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := CollectContext(context.Background(), p, hive, opts)
+	if err != nil || len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d (%v)", len(records), err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := CollectContext(ctx, p, hive, opts); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
@@ -1,6 +1,8 @@
 package plugins
 
 import (
+	"regexp"
+	"sort"
 	"testing"
 )
 
@@ -60,3 +62,35 @@ func TestPluginCount(t *testing.T) {
 		t.Errorf("expected at least 30 plugins, got %d", len(plugins))
 	}
 }
+
+func TestPluginMetadata(t *testing.T) {
+	known := make(map[Category]bool)
+	for _, c := range Categories() {
+		known[c] = true
+	}
+	technique := regexp.MustCompile(`^T\d{4}(\.\d{3})?$`)
+
+	names := List()
+	if !sort.StringsAreSorted(names) {
+		t.Error("List() is not sorted")
+	}
+	for _, name := range names {
+		p, _ := Get(name)
+		if _, ok := p.(MetadataPlugin); !ok {
+			t.Errorf("plugin %q does not declare metadata", name)
+			continue
+		}
+		m := MetadataOf(p)
+		if !known[m.Category] || m.Category == CategoryOther {
+			t.Errorf("plugin %q has category %q", name, m.Category)
+		}
+		for _, id := range m.Techniques {
+			if !technique.MatchString(id) {
+				t.Errorf("plugin %q has malformed technique %q", name, id)
+			}
+		}
+		if m.Version == "" || m.Artifact == "" || len(m.Schema) == 0 {
+			t.Errorf("plugin %q has incomplete metadata", name)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package plugins
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -26,35 +27,64 @@ func (p *PortDevPlugin) CompatibleHiveTypes() []string {
 	return []string{"SYSTEM"}
 }
 
-func (p *PortDevPlugin) Run(hive *regf.Hive) error {
-	controlSetName, err := findCurrentControlSet(hive)
-	if err != nil {
-		return fmt.Errorf("failed to find current ControlSet: %w", err)
+func (p *PortDevPlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategoryUSB,
+		Techniques: []string{"T1091"},
+		Artifact:   "The COM Name Arbiter and port device mappings record serial and modem devices.",
+		References: []string{regRipperReference},
+		Version:    "1.0.0",
+		Schema: []FieldSpec{
+			{Name: "Name", Type: FieldString, Description: "value name"},
+			{Name: "Value", Type: FieldString, Description: "value data"},
+			{Name: "Device", Type: FieldString, Description: "device"},
+			{Name: "Port", Type: FieldString, Description: "assigned port"},
+		},
 	}
+}
 
-	portPath := fmt.Sprintf("%s\\Control\\COM Name Arbiter", controlSetName)
-	portKey, err := hive.GetKey(portPath)
-	if err != nil {
-		return fmt.Errorf("port device key not found: %w", err)
-	}
+func (p *PortDevPlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
 
-	fmt.Println("Port Devices:")
-	fmt.Println(strings.Repeat("=", 80))
+func (p *PortDevPlugin) Options() []Option {
+	return []Option{controlSetOption}
+}
 
-	for _, val := range portKey.Values() {
-		if strings.HasPrefix(val.Name(), "ComDB") {
-			continue
+func (p *PortDevPlugin) Collect(hive *regf.Hive, emit Emitter) error {
+	return p.CollectContext(context.Background(), hive, DefaultOptions(p), emit)
+}
+
+func (p *PortDevPlugin) CollectContext(ctx context.Context, hive *regf.Hive, opts Options, emit Emitter) error {
+	return forEachControlSet(ctx, hive, opts, emit, func(controlSetName string, emit Emitter) error {
+		portPath := fmt.Sprintf("%s\\Control\\COM Name Arbiter", controlSetName)
+		portKey, err := hive.GetKey(portPath)
+		if err != nil {
+			return fmt.Errorf("port device key not found: %w", err)
 		}
-		fmt.Printf("%-20s: %s\n", val.Name(), GetValueString(val))
-	}
 
-	// Try Devices subkey
-	if devices, err := getSubkey(portKey, "Devices"); err == nil {
-		fmt.Println("\nConnected Devices:")
-		for _, val := range devices.Values() {
-			fmt.Printf("%-20s: %s\n", val.Name(), GetValueString(val))
+		for _, val := range portKey.Values() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			if strings.HasPrefix(val.Name(), "ComDB") {
+				continue
+			}
+			emit(NewRecord(portPath, portKey).
+				AddString("Name", val.Name()).
+				AddString("Value", GetValueString(val)))
+		}
+
+		// Try Devices subkey
+		if devices, err := getSubkey(portKey, "Devices"); err == nil {
+			for _, val := range devices.Values() {
+				emit(NewRecord(joinKeyPath(portPath, "Devices"), devices).
+					AddString("Port", val.Name()).
+					AddString("Device", GetValueString(val)))
+			}
 		}
-	}
 
-	return nil
+		return nil
+	})
 }
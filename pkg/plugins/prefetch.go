@@ -1,6 +1,7 @@
 package plugins
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
@@ -25,38 +26,47 @@ func (p *PrefetchPlugin) CompatibleHiveTypes() []string {
 	return []string{"SYSTEM"}
 }
 
-func (p *PrefetchPlugin) Run(hive *regf.Hive) error {
-	paths := []string{
-		"ControlSet001\\Control\\Session Manager\\Memory Management\\PrefetchParameters",
-		"ControlSet002\\Control\\Session Manager\\Memory Management\\PrefetchParameters",
+func (p *PrefetchPlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategorySystem,
+		Techniques: []string{"T1112"},
+		Artifact:   "Prefetcher settings; a disabled prefetcher removes an important source of execution evidence.",
+		References: []string{regRipperReference},
+		Version:    "1.0.0",
+		Schema: []FieldSpec{
+			{Name: "*", Type: FieldString, Description: "PrefetchParameters values such as EnablePrefetcher"},
+		},
 	}
+}
+
+func (p *PrefetchPlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
 
-	fmt.Println("Prefetch Configuration")
-	fmt.Println("======================")
-	fmt.Println()
+func (p *PrefetchPlugin) Options() []Option {
+	return []Option{controlSetOption}
+}
 
-	for _, path := range paths {
+func (p *PrefetchPlugin) Collect(hive *regf.Hive, emit Emitter) error {
+	return p.CollectContext(context.Background(), hive, DefaultOptions(p), emit)
+}
+
+func (p *PrefetchPlugin) CollectContext(ctx context.Context, hive *regf.Hive, opts Options, emit Emitter) error {
+	return forEachControlSet(ctx, hive, opts, emit, func(controlSet string, emit Emitter) error {
+		path := controlSet + "\\Control\\Session Manager\\Memory Management\\PrefetchParameters"
 		key, err := hive.GetKey(path)
 		if err != nil {
-			continue
+			return fmt.Errorf("prefetch key not found: %w", err)
 		}
 
-		fmt.Printf("[%s]\n", path)
-		fmt.Printf("Last Modified: %s\n", key.Timestamp().Format("2006-01-02 15:04:05"))
-
 		for _, val := range key.Values() {
 			if val.Name() == "EnablePrefetcher" || val.Name() == "EnableSuperfetch" {
-				data := val.Bytes()
-				if len(data) >= 4 {
-					value := uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16 | uint32(data[3])<<24
-					fmt.Printf("  %s: %d\n", val.Name(), value)
+				if len(val.Bytes()) >= 4 {
+					emit(NewRecord(path, key).AddValue(val.Name(), val))
 				}
 			}
 		}
-		fmt.Println()
 
 		return nil
-	}
-
-	return fmt.Errorf("prefetch key not found")
+	})
 }
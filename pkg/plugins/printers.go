@@ -1,6 +1,7 @@
 package plugins
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
@@ -25,42 +26,59 @@ func (p *PrintersPlugin) CompatibleHiveTypes() []string {
 	return []string{"SYSTEM"}
 }
 
-func (p *PrintersPlugin) Run(hive *regf.Hive) error {
-	paths := []string{
-		"ControlSet001\\Control\\Print\\Printers",
-		"ControlSet002\\Control\\Print\\Printers",
+func (p *PrintersPlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategorySystem,
+		Artifact:   "Printers installed on the system with their drivers and ports.",
+		References: []string{regRipperReference},
+		Version:    "1.0.0",
+		Schema: []FieldSpec{
+			{Name: "Printer", Type: FieldString, Description: "printer name"},
+			{Name: "Driver", Type: FieldString, Description: "driver name"},
+			{Name: "Port", Type: FieldString, Description: "port name"},
+			{Name: "Print Processor", Type: FieldString, Description: "print processor"},
+		},
 	}
+}
+
+func (p *PrintersPlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
 
-	fmt.Println("Installed Printers")
-	fmt.Println("==================")
-	fmt.Println()
+func (p *PrintersPlugin) Options() []Option {
+	return []Option{controlSetOption}
+}
+
+func (p *PrintersPlugin) Collect(hive *regf.Hive, emit Emitter) error {
+	return p.CollectContext(context.Background(), hive, DefaultOptions(p), emit)
+}
 
-	for _, path := range paths {
+func (p *PrintersPlugin) CollectContext(ctx context.Context, hive *regf.Hive, opts Options, emit Emitter) error {
+	return forEachControlSet(ctx, hive, opts, emit, func(controlSet string, emit Emitter) error {
+		path := controlSet + "\\Control\\Print\\Printers"
 		key, err := hive.GetKey(path)
 		if err != nil {
-			continue
+			return fmt.Errorf("printers key not found: %w", err)
 		}
 
 		for _, printerKey := range key.Subkeys() {
-			fmt.Printf("Printer: %s\n", printerKey.Name())
+			r := NewRecord(joinKeyPath(path, printerKey.Name()), printerKey).
+				AddString("Printer", printerKey.Name())
 
 			for _, val := range printerKey.Values() {
 				switch val.Name() {
 				case "Port":
-					fmt.Printf("  Port: %s\n", GetValueString(val))
+					r.AddString("Port", GetValueString(val))
 				case "Print Processor":
-					fmt.Printf("  Print Processor: %s\n", GetValueString(val))
+					r.AddString("Print Processor", GetValueString(val))
 				case "Printer Driver":
-					fmt.Printf("  Driver: %s\n", GetValueString(val))
+					r.AddString("Driver", GetValueString(val))
 				}
 			}
 
-			fmt.Printf("  Last Modified: %s\n", printerKey.Timestamp().Format("2006-01-02 15:04:05"))
-			fmt.Println()
+			emit(r)
 		}
 
 		return nil
-	}
-
-	return fmt.Errorf("printers key not found")
+	})
 }
@@ -0,0 +1,166 @@
+package plugins
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ErrProfileNotFound is returned when no profile has the requested name.
+var ErrProfileNotFound = errors.New("profile not found")
+
+// ProfileEntry is one plugin of a profile with its option values.
+type ProfileEntry struct {
+	Plugin  string            `json:"plugin"`
+	Options map[string]string `json:"options,omitempty"`
+}
+
+// Profile is a named list of plugins run together, like a RegRipper
+// profile. Plugins that do not apply to a hive are skipped when it runs.
+type Profile struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Plugins     []ProfileEntry `json:"plugins"`
+}
+
+// profileFile is the layout of a profiles configuration file.
+type profileFile struct {
+	Profiles []Profile `json:"profiles"`
+}
+
+// entries builds profile entries without options.
+func entries(names ...string) []ProfileEntry {
+	list := make([]ProfileEntry, len(names))
+	for i, name := range names {
+		list[i] = ProfileEntry{Plugin: name}
+	}
+	return list
+}
+
+// BuiltinProfiles returns the profiles shipped with HiveDigger.
+func BuiltinProfiles() []Profile {
+	return []Profile{
+		{
+			Name:        "triage-system",
+			Description: "System identity, network, devices, software and execution evidence from SYSTEM and SOFTWARE",
+			Plugins: entries(
+				"compname", "timezone", "winver", "shutdown",
+				"ips", "networkcards", "networklist",
+				"usbstor2", "mountpoints",
+				"listsoft", "services",
+				"bam", "shimcache",
+			),
+		},
+		{
+			Name:        "user-activity",
+			Description: "What a user ran, opened, typed and browsed, from NTUSER.DAT and USRCLASS.DAT",
+			Plugins: entries(
+				"userassist", "recentapps", "runmru", "muicache", "jumplists",
+				"recentdocs", "typedpaths", "typedurls", "wordwheel",
+				"shellbags", "comdlg32", "office", "mapnetdrive",
+			),
+		},
+		{
+			Name:        "persistence",
+			Description: "Autostart locations across SYSTEM, SOFTWARE and NTUSER.DAT",
+			Plugins: entries(
+				"run", "autorun", "winlogon", "activesetup", "appinit",
+				"imagefile", "bho", "apppaths", "fileassoc", "tasks",
+				"services", "bootexecute", "knowndlls", "sessionmgr",
+			),
+		},
+	}
+}
+
+// DefaultProfilesPath returns the per-user profiles file,
+// <config dir>/hivedigger/profiles.json.
+func DefaultProfilesPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "hivedigger", "profiles.json")
+}
+
+// LoadProfiles reads a JSON profiles file of the form
+//
+//	{"profiles": [{"name": "...", "description": "...",
+//	  "plugins": [{"plugin": "amcache", "options": {"limit": "0"}}]}]}
+//
+// and returns the built-in profiles merged with it. A profile in the file
+// replaces a built-in of the same name. A missing file is not an error
+// when path is the default location. Profiles are returned sorted by name.
+func LoadProfiles(path string) ([]Profile, error) {
+	profiles := BuiltinProfiles()
+	if path == "" {
+		path = DefaultProfilesPath()
+		if path == "" {
+			return sortProfiles(profiles), nil
+		}
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			return sortProfiles(profiles), nil
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profiles: %w", err)
+	}
+	var file profileFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse profiles %s: %w", path, err)
+	}
+
+	byName := make(map[string]int, len(profiles))
+	for i, p := range profiles {
+		byName[p.Name] = i
+	}
+	for _, p := range file.Profiles {
+		if p.Name == "" {
+			return nil, fmt.Errorf("profile without a name in %s", path)
+		}
+		if i, ok := byName[p.Name]; ok {
+			profiles[i] = p
+			continue
+		}
+		byName[p.Name] = len(profiles)
+		profiles = append(profiles, p)
+	}
+
+	return sortProfiles(profiles), nil
+}
+
+func sortProfiles(profiles []Profile) []Profile {
+	sort.SliceStable(profiles, func(i, j int) bool {
+		return profiles[i].Name < profiles[j].Name
+	})
+	return profiles
+}
+
+// FindProfile returns the profile with the given name.
+func FindProfile(profiles []Profile, name string) (Profile, error) {
+	for _, p := range profiles {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return Profile{}, fmt.Errorf("%w: %s", ErrProfileNotFound, name)
+}
+
+// Validate checks that every plugin of the profile exists and that its
+// options are valid.
+func (p Profile) Validate() error {
+	for _, e := range p.Plugins {
+		plugin, err := Get(e.Plugin)
+		if err != nil {
+			return fmt.Errorf("profile %s: %w", p.Name, err)
+		}
+		if _, err := ParseOptions(plugin, e.Options); err != nil {
+			return fmt.Errorf("profile %s: %w", p.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package plugins
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuiltinProfilesAreValid(t *testing.T) {
+	for _, p := range BuiltinProfiles() {
+		if err := p.Validate(); err != nil {
+			t.Errorf("built-in profile %s: %v", p.Name, err)
+		}
+	}
+}
+
+func TestLoadProfiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profiles.json")
+	config := `{"profiles": [
+		{"name": "persistence", "description": "mine", "plugins": [{"plugin": "run"}]},
+		{"name": "amcache-full", "plugins": [{"plugin": "amcache", "options": {"limit": "0"}}]}
+	]}`
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	profiles, err := LoadProfiles(path)
+	if err != nil {
+		t.Fatalf("LoadProfiles failed: %v", err)
+	}
+	if len(profiles) != len(BuiltinProfiles())+1 {
+		t.Errorf("expected one extra profile, got %d profiles", len(profiles))
+	}
+
+	p, err := FindProfile(profiles, "persistence")
+	if err != nil || p.Description != "mine" || len(p.Plugins) != 1 {
+		t.Errorf("built-in not overridden: %+v (%v)", p, err)
+	}
+	p, _ = FindProfile(profiles, "amcache-full")
+	if err := p.Validate(); err != nil {
+		t.Errorf("valid profile rejected: %v", err)
+	}
+
+	if _, err := FindProfile(profiles, "missing"); !errors.Is(err, ErrProfileNotFound) {
+		t.Errorf("expected ErrProfileNotFound, got %v", err)
+	}
+
+	bad := Profile{Name: "bad", Plugins: []ProfileEntry{{Plugin: "amcache", Options: map[string]string{"limit": "x"}}}}
+	if err := bad.Validate(); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("expected ErrInvalidOption, got %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+package plugins
+
+import (
+	"strings"
+
+	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
+)
+
+// profileListPath is the SOFTWARE key listing the user profiles of a host.
+const profileListPath = "Microsoft\\Windows NT\\CurrentVersion\\ProfileList"
+
+// profilePaths maps the SIDs of the SOFTWARE profile list to their
+// ProfileImagePath.
+func profilePaths(software *regf.Hive) map[string]string {
+	paths := make(map[string]string)
+	key, err := software.GetKey(profileListPath)
+	if err != nil {
+		return paths
+	}
+	for _, sidKey := range key.Subkeys() {
+		for _, val := range sidKey.Values() {
+			if !strings.EqualFold(val.Name(), "ProfileImagePath") {
+				continue
+			}
+			if path := strings.TrimRight(GetValueString(val), "\\"); path != "" {
+				paths[sidKey.Name()] = path
+			}
+		}
+	}
+	return paths
+}
+
+// profileUser returns the last element of a profile path, which is the
+// user name for local and domain accounts alike.
+func profileUser(path string) string {
+	if i := strings.LastIndex(path, "\\"); i >= 0 {
+		path = path[i+1:]
+	}
+	return path
+}
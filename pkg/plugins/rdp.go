@@ -1,6 +1,7 @@
 package plugins
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
@@ -25,32 +26,45 @@ func (p *TerminalServerPlugin) CompatibleHiveTypes() []string {
 	return []string{"SYSTEM"}
 }
 
-func (p *TerminalServerPlugin) Run(hive *regf.Hive) error {
-	paths := []string{
-		"ControlSet001\\Control\\Terminal Server",
-		"ControlSet002\\Control\\Terminal Server",
+func (p *TerminalServerPlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategoryNetwork,
+		Techniques: []string{"T1021.001"},
+		Artifact:   "Terminal Server settings, including whether Remote Desktop connections are allowed.",
+		References: []string{regRipperReference},
+		Version:    "1.0.0",
+		Schema: []FieldSpec{
+			{Name: "*", Type: FieldString, Description: "Terminal Server values such as fDenyTSConnections"},
+		},
 	}
+}
+
+func (p *TerminalServerPlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
 
-	fmt.Println("Terminal Server/RDP Configuration")
-	fmt.Println("==================================")
-	fmt.Println()
+func (p *TerminalServerPlugin) Options() []Option {
+	return []Option{controlSetOption}
+}
 
-	for _, path := range paths {
+func (p *TerminalServerPlugin) Collect(hive *regf.Hive, emit Emitter) error {
+	return p.CollectContext(context.Background(), hive, DefaultOptions(p), emit)
+}
+
+func (p *TerminalServerPlugin) CollectContext(ctx context.Context, hive *regf.Hive, opts Options, emit Emitter) error {
+	return forEachControlSet(ctx, hive, opts, emit, func(controlSet string, emit Emitter) error {
+		path := controlSet + "\\Control\\Terminal Server"
 		key, err := hive.GetKey(path)
 		if err != nil {
-			continue
+			return fmt.Errorf("terminal server key not found: %w", err)
 		}
 
-		fmt.Printf("[%s]\n", path)
-		fmt.Printf("Last Modified: %s\n", key.Timestamp().Format("2006-01-02 15:04:05"))
-
+		r := NewRecord(path, key)
 		for _, val := range key.Values() {
-			fmt.Printf("  %s = %s\n", val.Name(), GetValueString(val))
+			r.AddValue(val.Name(), val)
 		}
-		fmt.Println()
+		emit(r)
 
 		return nil
-	}
-
-	return fmt.Errorf("terminal server key not found")
+	})
 }
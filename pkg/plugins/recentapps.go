@@ -1,8 +1,8 @@
 package plugins
 
 import (
+	"encoding/binary"
 	"fmt"
-	"strings"
 
 	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
 )
@@ -26,25 +26,48 @@ func (p *RecentAppsPlugin) CompatibleHiveTypes() []string {
 	return []string{"NTUSER.DAT"}
 }
 
+func (p *RecentAppsPlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategoryExecution,
+		Techniques: []string{"T1204.002"},
+		Artifact:   "Search RecentApps records applications the user launched, with launch counts and last access times (Windows 10).",
+		References: []string{regRipperReference},
+		Version:    "1.0.0",
+		Schema: []FieldSpec{
+			{Name: "*", Type: FieldString, Description: "RecentApps values; LastAccessedTime is decoded as a time"},
+		},
+	}
+}
+
 func (p *RecentAppsPlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
+
+func (p *RecentAppsPlugin) Collect(hive *regf.Hive, emit Emitter) error {
 	appsPath := "Software\\Microsoft\\Windows\\CurrentVersion\\Search\\RecentApps"
 	appsKey, err := hive.GetKey(appsPath)
 	if err != nil {
 		return fmt.Errorf("RecentApps key not found: %w", err)
 	}
 
-	fmt.Println("Recently Used Applications:")
-	fmt.Println(strings.Repeat("=", 80))
-
 	for _, app := range appsKey.Subkeys() {
-		fmt.Printf("\n[%s]\n", app.Timestamp().Format("2006-01-02 15:04:05"))
+		r := NewRecord(joinKeyPath(appsPath, app.Name()), app).
+			WithTags("execution")
 
 		for _, val := range app.Values() {
-			if val.Name() == "AppId" || val.Name() == "AppPath" ||
-				val.Name() == "LastAccessedTime" {
-				fmt.Printf("  %s: %s\n", val.Name(), GetValueString(val))
+			switch val.Name() {
+			case "AppId", "AppPath":
+				r.AddString(val.Name(), GetValueString(val))
+			case "LastAccessedTime":
+				if data := val.Bytes(); len(data) >= 8 {
+					r.AddTime(val.Name(), filetimeToTime(binary.LittleEndian.Uint64(data)))
+				}
+			case "LaunchCount":
+				r.AddValue(val.Name(), val)
 			}
 		}
+
+		emit(r)
 	}
 
 	return nil
@@ -1,8 +1,6 @@
 package plugins
 
 import (
-	"fmt"
-
 	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
 )
 
@@ -10,6 +8,9 @@ func init() {
 	Register(&RecentDocsPlugin{})
 }
 
+// recentDocsPath is the NTUSER.DAT key of the recent documents list.
+const recentDocsPath = "Software\\Microsoft\\Windows\\CurrentVersion\\Explorer\\RecentDocs"
+
 // RecentDocsPlugin displays recently opened documents from NTUSER.DAT.
 type RecentDocsPlugin struct{}
 
@@ -25,25 +26,63 @@ func (p *RecentDocsPlugin) CompatibleHiveTypes() []string {
 	return []string{"NTUSER.DAT"}
 }
 
+func (p *RecentDocsPlugin) Metadata() Metadata {
+	return Metadata{
+		Category: CategoryUserActivity,
+		Artifact: "RecentDocs lists documents and folders recently opened by the user, most recent first, overall " +
+			"and per extension. Each subkey was last written when its most recent entry was opened.",
+		References: []string{regRipperReference},
+		Version:    "2.0.0",
+		Schema: []FieldSpec{
+			{Name: "Extension", Type: FieldString, Description: "extension subkey, empty for the list of all documents"},
+			{Name: "MRU Position", Type: FieldInt, Description: "position in the list, 0 being the most recent"},
+			{Name: "Name", Type: FieldString, Description: "document or folder name"},
+			{Name: "Link", Type: FieldString, Description: "name of the shortcut created in the Recent folder"},
+			{Name: "Last Opened", Type: FieldTime, Description: "LastWrite time of the list, for its most recent entry"},
+		},
+	}
+}
+
 func (p *RecentDocsPlugin) Run(hive *regf.Hive) error {
-	path := "Software\\Microsoft\\Windows\\CurrentVersion\\Explorer\\RecentDocs"
+	return runText(p, hive)
+}
 
-	key, err := hive.GetKey(path)
+func (p *RecentDocsPlugin) Collect(hive *regf.Hive, emit Emitter) error {
+	key, err := hive.GetKey(recentDocsPath)
 	if err != nil {
-		return fmt.Errorf("RecentDocs key not found: %w", err)
+		return notFound("RecentDocs key not found")
 	}
 
-	fmt.Println("Recently Opened Documents")
-	fmt.Println("=========================")
-	fmt.Printf("Last Modified: %s\n", key.Timestamp().Format("2006-01-02 15:04:05"))
-	fmt.Println()
-
-	// List extensions
+	collectRecentDocs(recentDocsPath, key, "", emit)
 	for _, extKey := range key.Subkeys() {
-		fmt.Printf("Extension: .%s\n", extKey.Name())
-		fmt.Printf("  Last Modified: %s\n", extKey.Timestamp().Format("2006-01-02 15:04:05"))
-		fmt.Println()
+		collectRecentDocs(joinKeyPath(recentDocsPath, extKey.Name()), extKey, extKey.Name(), emit)
 	}
-
 	return nil
 }
+
+// collectRecentDocs emits the entries of one list in MRUListEx order. Each
+// value holds the NUL-terminated UTF-16 name of the document, followed by
+// a file entry shell item naming its shortcut. Entries the MRUListEx does
+// not name have neither a position nor a time.
+func collectRecentDocs(path string, key *regf.Key, ext string, emit Emitter) {
+	for _, e := range mruValues(key, OrderMRUListEx) {
+		name, rest := splitUTF16(e.Value.Bytes())
+		r := NewRecord(path, key)
+		if ext != "" {
+			r.AddString("Extension", ext)
+		}
+		if e.Listed {
+			r.AddInt("MRU Position", int64(e.Position))
+		}
+		r.AddString("Name", name)
+		if len(rest) >= 2 {
+			if item := parseShellItem(rest); item.Name != "" {
+				r.AddString("Link", item.Name)
+			}
+		}
+		if e.Listed && e.Position == 0 && !key.Timestamp().IsZero() {
+			r.AddTime("Last Opened", key.Timestamp())
+		}
+		emit(r)
+	}
+}
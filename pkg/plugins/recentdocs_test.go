@@ -0,0 +1,60 @@
+package plugins
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecentDocsDecodesLists(t *testing.T) {
+	modified := time.Date(2022, 6, 7, 8, 9, 10, 0, time.UTC)
+	written := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	entry := func(name string, link []byte) []byte {
+		return concat(utf16le(name), le16(0), link)
+	}
+	shortLink := shellItemBytes([]byte{0x32, 0}, le32(0), le32(0), le16(0x20), []byte("OLD.LNK\x00"))
+	longLink := directoryItem("REPORT~1.LNK", "report final.lnk", modified, modified, 0)
+
+	hive := newTestHive(t, key("ROOT", key("Software", key("Microsoft", key("Windows", key("CurrentVersion", key("Explorer",
+		key("RecentDocs",
+			key(".docx").with(
+				binValue("0", entry("old.docx", shortLink)),
+				binValue("1", entry("report final.docx", longLink)),
+				binValue("MRUListEx", mruListEx(1, 0)),
+			).at(written),
+			key(".pdf").with(binValue("0", entry("scan.pdf", nil))).at(written),
+		).with(
+			binValue("0", entry("report final.docx", longLink)),
+			binValue("MRUListEx", mruListEx(0)),
+		),
+	)))))))
+
+	records, err := Collect(&RecentDocsPlugin{}, hive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]string{
+		{"MRU Position": "0", "Name": "report final.docx", "Link": "report final.lnk"},
+		{"Extension": ".docx", "MRU Position": "0", "Name": "report final.docx", "Link": "report final.lnk",
+			"Last Opened": FormatTime(written)},
+		{"Extension": ".docx", "MRU Position": "1", "Name": "old.docx", "Link": "OLD.LNK"},
+		{"Extension": ".pdf", "Name": "scan.pdf"},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("expected %d records, got %d", len(want), len(records))
+	}
+	for i, fields := range want {
+		for name, value := range fields {
+			if f, ok := records[i].Get(name); !ok || FormatValue(f) != value {
+				t.Errorf("record %d: %s = %v, want %s", i, name, f.Value, value)
+			}
+		}
+	}
+	if _, ok := records[2].Get("Last Opened"); ok {
+		t.Errorf("unexpected Last Opened on an older entry")
+	}
+	for _, name := range []string{"MRU Position", "Last Opened"} {
+		if _, ok := records[3].Get(name); ok {
+			t.Errorf("unexpected %s on an entry missing from MRUListEx", name)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package plugins
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
+)
+
+// Severity classifies how interesting a record is to an analyst.
+type Severity int
+
+const (
+	// SeverityInfo is the default for plain artifact data.
+	SeverityInfo Severity = iota
+	// SeverityNotice marks records worth a second look.
+	SeverityNotice
+	// SeverityWarning marks suspicious records.
+	SeverityWarning
+	// SeverityCritical marks records that are almost certainly malicious.
+	SeverityCritical
+)
+
+// String returns the lower-case name of the severity.
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityNotice:
+		return "notice"
+	case SeverityWarning:
+		return "warning"
+	case SeverityCritical:
+		return "critical"
+	default:
+		return "unknown"
+	}
+}
+
+// FieldType describes the type of a record field value.
+type FieldType int
+
+const (
+	// FieldString holds a string.
+	FieldString FieldType = iota
+	// FieldInt holds an int64.
+	FieldInt
+	// FieldBool holds a bool.
+	FieldBool
+	// FieldTime holds a time.Time.
+	FieldTime
+	// FieldBytes holds a []byte.
+	FieldBytes
+	// FieldStrings holds a []string.
+	FieldStrings
+)
+
+// String returns the lower-case name of the field type.
+func (t FieldType) String() string {
+	switch t {
+	case FieldString:
+		return "string"
+	case FieldInt:
+		return "int"
+	case FieldBool:
+		return "bool"
+	case FieldTime:
+		return "time"
+	case FieldBytes:
+		return "bytes"
+	case FieldStrings:
+		return "strings"
+	default:
+		return "unknown"
+	}
+}
+
+// Field is a single named, typed value of a record.
+type Field struct {
+	Name  string
+	Type  FieldType
+	Value any
+	// Sensitive marks secrets such as password hashes, which output
+	// flags so they are not shared by accident.
+	Sensitive bool
+}
+
+// Record is a single structured result emitted by a plugin.
+type Record struct {
+	// KeyPath is the registry path the record was read from.
+	KeyPath string
+	// LastWrite is the LastWrite timestamp of the key at KeyPath.
+	LastWrite time.Time
+	// Severity is how interesting the record is.
+	Severity Severity
+	// Tags are free-form labels such as "persistence" or "legacy".
+	Tags []string
+	// Fields are the named values of the record, in display order.
+	Fields []Field
+}
+
+// NewRecord returns a record for the given key. Forward slashes in keyPath
+// are normalised to backslashes.
+func NewRecord(keyPath string, key *regf.Key) *Record {
+	r := &Record{KeyPath: strings.ReplaceAll(keyPath, "/", "\\")}
+	if key != nil {
+		r.LastWrite = key.Timestamp()
+	}
+	return r
+}
+
+// joinKeyPath joins registry path elements with backslashes.
+func joinKeyPath(parts ...string) string {
+	return strings.Join(parts, "\\")
+}
+
+// AddString appends a string field.
+func (r *Record) AddString(name, value string) *Record {
+	r.Fields = append(r.Fields, Field{Name: name, Type: FieldString, Value: value})
+	return r
+}
+
+// AddInt appends an integer field.
+func (r *Record) AddInt(name string, value int64) *Record {
+	r.Fields = append(r.Fields, Field{Name: name, Type: FieldInt, Value: value})
+	return r
+}
+
+// AddBool appends a boolean field.
+func (r *Record) AddBool(name string, value bool) *Record {
+	r.Fields = append(r.Fields, Field{Name: name, Type: FieldBool, Value: value})
+	return r
+}
+
+// AddTime appends a timestamp field.
+func (r *Record) AddTime(name string, value time.Time) *Record {
+	r.Fields = append(r.Fields, Field{Name: name, Type: FieldTime, Value: value})
+	return r
+}
+
+// AddBytes appends a raw binary field.
+func (r *Record) AddBytes(name string, value []byte) *Record {
+	r.Fields = append(r.Fields, Field{Name: name, Type: FieldBytes, Value: value})
+	return r
+}
+
+// AddStrings appends a string list field.
+func (r *Record) AddStrings(name string, value []string) *Record {
+	r.Fields = append(r.Fields, Field{Name: name, Type: FieldStrings, Value: value})
+	return r
+}
+
+// AddSecret appends a string field holding a secret, such as a password
+// hash. The field is marked sensitive and the record tagged "sensitive".
+func (r *Record) AddSecret(name, value string) *Record {
+	r.Fields = append(r.Fields, Field{Name: name, Type: FieldString, Value: value, Sensitive: true})
+	if !r.HasTag("sensitive") {
+		r.Tags = append(r.Tags, "sensitive")
+	}
+	return r
+}
+
+// AddValue appends a field typed after the registry value's data type.
+func (r *Record) AddValue(name string, v *regf.Value) *Record {
+	r.Fields = append(r.Fields, valueField(name, v))
+	return r
+}
+
+// WithSeverity sets the record severity.
+func (r *Record) WithSeverity(s Severity) *Record {
+	r.Severity = s
+	return r
+}
+
+// WithTags appends tags to the record.
+func (r *Record) WithTags(tags ...string) *Record {
+	r.Tags = append(r.Tags, tags...)
+	return r
+}
+
+// Get returns the field with the given name.
+func (r *Record) Get(name string) (Field, bool) {
+	for _, f := range r.Fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+// HasTag reports whether the record carries the given tag.
+func (r *Record) HasTag(tag string) bool {
+	for _, t := range r.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Emitter receives the records produced by a plugin.
+type Emitter func(r *Record)
+
+// RecordPlugin is implemented by plugins that emit structured records
+// instead of printing free-form text.
+type RecordPlugin interface {
+	Plugin
+	// Collect reads the hive and passes each result to emit.
+	Collect(hive *regf.Hive, emit Emitter) error
+}
+
+// Collect runs the plugin with its default options and returns its
+// records. Plugins that do not implement RecordPlugin are run through the
+// legacy text adapter.
+func Collect(p Plugin, hive *regf.Hive) ([]*Record, error) {
+	return CollectContext(context.Background(), p, hive, DefaultOptions(p))
+}
+
+// Registry value types used when typing record fields.
+const (
+	regSZ       = 1
+	regExpandSZ = 2
+	regBinary   = 3
+	regDWORD    = 4
+	regMultiSZ  = 7
+	regQWORD    = 11
+)
+
+// valueField converts a registry value into a record field.
+func valueField(name string, v *regf.Value) Field {
+	if v == nil {
+		return Field{Name: name, Type: FieldString, Value: ""}
+	}
+
+	data := v.Bytes()
+	switch v.Type() {
+	case regDWORD:
+		if len(data) >= 4 {
+			return Field{Name: name, Type: FieldInt, Value: int64(uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16 | uint32(data[3])<<24)}
+		}
+	case regQWORD:
+		if len(data) >= 8 {
+			var n uint64
+			for i := 7; i >= 0; i-- {
+				n = n<<8 | uint64(data[i])
+			}
+			return Field{Name: name, Type: FieldInt, Value: int64(n)}
+		}
+	case regMultiSZ:
+		return Field{Name: name, Type: FieldStrings, Value: GetValueStrings(v)}
+	case regBinary:
+		return Field{Name: name, Type: FieldBytes, Value: data}
+	}
+
+	return Field{Name: name, Type: FieldString, Value: GetValueString(v)}
+}
@@ -0,0 +1,96 @@
+package plugins
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
+)
+
+func TestCollectRecordPlugin(t *testing.T) {
+	lastWrite := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	hive := newTestHive(t, key("ROOT",
+		key("Microsoft", key("Windows", key("CurrentVersion",
+			key("Run").at(lastWrite).with(
+				szValue("Updater", `C:\Users\Public\upd.exe`),
+				szValue("OneDrive", `C:\Program Files\OneDrive\OneDrive.exe /background`),
+			),
+		))),
+	))
+
+	records, err := Collect(&RunPlugin{}, hive)
+	if err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+
+	r := records[0]
+	if r.KeyPath != `Microsoft\Windows\CurrentVersion\Run` {
+		t.Errorf("unexpected key path %q", r.KeyPath)
+	}
+	if !r.LastWrite.Equal(lastWrite) {
+		t.Errorf("expected LastWrite %v, got %v", lastWrite, r.LastWrite)
+	}
+	if f, ok := r.Get("Command"); !ok || f.Value != `C:\Users\Public\upd.exe` || f.Type != FieldString {
+		t.Errorf("unexpected Command field %+v", f)
+	}
+	if !r.HasTag("persistence") {
+		t.Errorf("expected persistence tag, got %v", r.Tags)
+	}
+}
+
+type printingPlugin struct{}
+
+func (p *printingPlugin) Name() string        { return "printing" }
+func (p *printingPlugin) Description() string { return "Prints text" }
+func (p *printingPlugin) Run(hive *regf.Hive) error {
+	fmt.Println("first line")
+	fmt.Println("second line")
+	return nil
+}
+
+func TestCollectLegacyPlugin(t *testing.T) {
+	records, err := Collect(&printingPlugin{}, nil)
+	if err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+
+	var out strings.Builder
+	if err := RenderText(&out, "", records); err != nil {
+		t.Fatalf("RenderText failed: %v", err)
+	}
+	if out.String() != "first line\nsecond line\n" {
+		t.Errorf("unexpected legacy rendering %q", out.String())
+	}
+}
+
+func TestRenderTextGroupsByKey(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	records := []*Record{
+		(&Record{KeyPath: `A\B`, LastWrite: ts}).AddString("Name", "one"),
+		(&Record{KeyPath: `A\B`, LastWrite: ts}).AddString("Name", "two"),
+		(&Record{KeyPath: `A\C`}).AddInt("Count", 3).WithSeverity(SeverityWarning),
+	}
+
+	var out strings.Builder
+	if err := RenderText(&out, "Title", records); err != nil {
+		t.Fatalf("RenderText failed: %v", err)
+	}
+
+	text := out.String()
+	if strings.Count(text, `[A\B]`) != 1 {
+		t.Errorf("expected a single header for A\\B:\n%s", text)
+	}
+	for _, want := range []string{"Title\n=====", "Name: one", "Name: two", `[A\C]`, "!! warning", "Count: 3"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("expected %q in output:\n%s", want, text)
+		}
+	}
+}
@@ -2,8 +2,12 @@
 package plugins
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"sort"
+	"time"
+	"unicode/utf16"
 
 	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
 )
@@ -58,16 +62,17 @@ func Get(name string) (Plugin, error) {
 	return p, nil
 }
 
-// List returns a list of all registered plugin names.
+// List returns the names of all registered plugins, sorted.
 func List() []string {
 	names := make([]string, 0, len(registry))
 	for name := range registry {
 		names = append(names, name)
 	}
+	sort.Strings(names)
 	return names
 }
 
-// ListForHiveType returns a list of plugin names compatible with the given hive type.
+// ListForHiveType returns the sorted names of the plugins compatible with the given hive type.
 // If a plugin doesn't specify compatible types, it's considered compatible with all types.
 func ListForHiveType(hiveType string) []string {
 	names := make([]string, 0)
@@ -76,6 +81,7 @@ func ListForHiveType(hiveType string) []string {
 			names = append(names, name)
 		}
 	}
+	sort.Strings(names)
 	return names
 }
 
@@ -122,6 +128,42 @@ func GetValueString(v *regf.Value) string {
 	return string(data)
 }
 
+// GetValueStrings returns every string stored in a REG_MULTI_SZ value.
+// Other string types are returned as a single-element slice.
+func GetValueStrings(v *regf.Value) []string {
+	if v == nil {
+		return nil
+	}
+
+	if v.Type() != 7 {
+		if s := GetValueString(v); s != "" {
+			return []string{s}
+		}
+		return nil
+	}
+
+	data := v.Bytes()
+	var result []string
+	var current []uint16
+	for i := 0; i+1 < len(data); i += 2 {
+		ch := uint16(data[i]) | uint16(data[i+1])<<8
+		if ch == 0 {
+			if len(current) == 0 {
+				break
+			}
+			result = append(result, string(utf16.Decode(current)))
+			current = current[:0]
+			continue
+		}
+		current = append(current, ch)
+	}
+	if len(current) > 0 {
+		result = append(result, string(utf16.Decode(current)))
+	}
+
+	return result
+}
+
 // parseNullTerminatedString parses a null-terminated string from byte data.
 // It handles both ASCII and UTF-16LE encoding.
 func parseNullTerminatedString(data []byte) string {
@@ -132,14 +174,15 @@ func parseNullTerminatedString(data []byte) string {
 	// Check if UTF-16LE (every other byte might be 0x00 for ASCII chars)
 	isUTF16 := len(data) >= 2 && len(data)%2 == 0
 	if isUTF16 {
-		zeroCount := 0
+		zeroCount, sampled := 0, 0
 		for i := 1; i < len(data) && i < 20; i += 2 {
+			sampled++
 			if data[i] == 0x00 {
 				zeroCount++
 			}
 		}
 
-		if zeroCount > len(data)/4 {
+		if zeroCount > sampled/2 {
 			// UTF-16LE
 			var result []uint16
 			for i := 0; i+1 < len(data); i += 2 {
@@ -171,30 +214,47 @@ func parseNullTerminatedString(data []byte) string {
 	return string(data[:end])
 }
 
-// findCurrentControlSet is a helper to determine the current ControlSet
-func findCurrentControlSet(hive *regf.Hive) (string, error) {
-	selectKey, err := hive.GetKey("Select")
-	if err != nil {
-		return "", err
-	}
-
-	// Find the "Current" value
-	values := selectKey.Values()
-	for _, v := range values {
-		if v.Name() == "Current" || v.Name() == "current" {
-			// Current is a REG_DWORD (4)
-			if v.Type() == 4 {
-				data := v.Bytes()
-				if len(data) >= 4 {
-					// Read as little-endian DWORD
-					currentNum := uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16 | uint32(data[3])<<24
-					return fmt.Sprintf("ControlSet%03d", currentNum), nil
-				}
-			}
+// utf16String decodes UTF-16LE data up to its first NUL character.
+func utf16String(data []byte) string {
+	units := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		ch := binary.LittleEndian.Uint16(data[i:])
+		if ch == 0 {
+			break
 		}
+		units = append(units, ch)
+	}
+	return string(utf16.Decode(units))
+}
+
+// systemtimeToTime decodes a 16-byte SYSTEMTIME structure.
+func systemtimeToTime(data []byte) time.Time {
+	if len(data) < 16 {
+		return time.Time{}
+	}
+	year := int(binary.LittleEndian.Uint16(data[0:2]))
+	month := int(binary.LittleEndian.Uint16(data[2:4]))
+	day := int(binary.LittleEndian.Uint16(data[6:8]))
+	hour := int(binary.LittleEndian.Uint16(data[8:10]))
+	minute := int(binary.LittleEndian.Uint16(data[10:12]))
+	second := int(binary.LittleEndian.Uint16(data[12:14]))
+	millis := int(binary.LittleEndian.Uint16(data[14:16]))
+	if year == 0 || month < 1 || month > 12 {
+		return time.Time{}
 	}
+	return time.Date(year, time.Month(month), day, hour, minute, second, millis*int(time.Millisecond), time.UTC)
+}
 
-	return "", fmt.Errorf("current value not found in select key")
+// formatGUID formats a 16-byte little-endian GUID as {XXXXXXXX-XXXX-...}.
+func formatGUID(b []byte) string {
+	if len(b) < 16 {
+		return ""
+	}
+	return fmt.Sprintf("{%08X-%04X-%04X-%X-%X}",
+		binary.LittleEndian.Uint32(b[0:4]),
+		binary.LittleEndian.Uint16(b[4:6]),
+		binary.LittleEndian.Uint16(b[6:8]),
+		b[8:10], b[10:16])
 }
 
 // getSubkey is a helper to get a subkey by name
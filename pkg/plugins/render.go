@@ -0,0 +1,128 @@
+package plugins
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
+)
+
+// maxBytesShown limits how much of a binary field the text view prints.
+const maxBytesShown = 64
+
+// RenderText writes records as the human-readable text view with times in
+// UTC. Consecutive records from the same key share a single key header.
+func RenderText(w io.Writer, title string, records []*Record) error {
+	return RenderTextIn(w, title, time.UTC, records)
+}
+
+// RenderTextIn is RenderText with times shown in zone. The title header
+// names the zone and its offset.
+func RenderTextIn(w io.Writer, title string, zone *time.Location, records []*Record) error {
+	var b strings.Builder
+
+	if title != "" {
+		b.WriteString(title + "\n")
+		b.WriteString(strings.Repeat("=", len(title)) + "\n")
+		b.WriteString("Times: " + ZoneLabel(zone) + "\n\n")
+	}
+
+	lastKey := ""
+	for _, r := range records {
+		if text, ok := legacyText(r); ok {
+			b.WriteString(text + "\n")
+			continue
+		}
+
+		if r.KeyPath != "" && r.KeyPath != lastKey {
+			if lastKey != "" {
+				b.WriteString("\n")
+			}
+			fmt.Fprintf(&b, "[%s]\n", r.KeyPath)
+			if !r.LastWrite.IsZero() {
+				fmt.Fprintf(&b, "Last Write: %s\n", formatTimeIn(r.LastWrite, zone))
+			}
+			lastKey = r.KeyPath
+		}
+
+		if r.Severity > SeverityInfo {
+			fmt.Fprintf(&b, "  !! %s", r.Severity)
+			if len(r.Tags) > 0 {
+				fmt.Fprintf(&b, " [%s]", strings.Join(r.Tags, ", "))
+			}
+			b.WriteString("\n")
+		}
+
+		for _, f := range r.Fields {
+			if f.Sensitive {
+				fmt.Fprintf(&b, "  %s: %s  [SENSITIVE]\n", f.Name, FormatValueIn(f, zone))
+				continue
+			}
+			fmt.Fprintf(&b, "  %s: %s\n", f.Name, FormatValueIn(f, zone))
+		}
+		if len(r.Fields) > 1 {
+			b.WriteString("\n")
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// FormatValue returns the text representation of a field value, with
+// times in UTC.
+func FormatValue(f Field) string {
+	return FormatValueIn(f, time.UTC)
+}
+
+// FormatValueIn is FormatValue with times shown in zone.
+func FormatValueIn(f Field, zone *time.Location) string {
+	switch v := f.Value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int64:
+		return fmt.Sprintf("%d", v)
+	case bool:
+		return fmt.Sprintf("%t", v)
+	case time.Time:
+		return formatTimeIn(v, zone)
+	case []byte:
+		if len(v) > maxBytesShown {
+			return fmt.Sprintf("%s... (%d bytes)", hex.EncodeToString(v[:maxBytesShown]), len(v))
+		}
+		return hex.EncodeToString(v)
+	case []string:
+		return strings.Join(v, ", ")
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// FormatTime formats a timestamp for the text view: UTC ISO 8601 with
+// 100 ns precision, or "-" for a missing time.
+func FormatTime(t time.Time) string {
+	return formatTimeIn(t, time.UTC)
+}
+
+func formatTimeIn(t time.Time, zone *time.Location) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return FormatTimeIn(t, zone)
+}
+
+// runText collects the records of p and prints them as text on stdout.
+// Record plugins use it to implement Run.
+func runText(p RecordPlugin, hive *regf.Hive) error {
+	records, err := Collect(p, hive)
+	if renderErr := RenderText(os.Stdout, p.Description(), records); renderErr != nil && err == nil {
+		err = renderErr
+	}
+	return err
+}
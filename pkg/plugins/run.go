@@ -1,8 +1,6 @@
 package plugins
 
 import (
-	"fmt"
-
 	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
 )
 
@@ -25,11 +23,25 @@ func (p *RunPlugin) CompatibleHiveTypes() []string {
 	return []string{"SOFTWARE"}
 }
 
+func (p *RunPlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategoryPersistence,
+		Techniques: []string{"T1547.001"},
+		Artifact:   "Run and RunOnce keys start programs at logon.",
+		References: []string{regRipperReference, "https://learn.microsoft.com/en-us/windows/win32/setupapi/run-and-runonce-registry-keys"},
+		Version:    "1.0.0",
+		Schema: []FieldSpec{
+			{Name: "Name", Type: FieldString, Description: "value name"},
+			{Name: "Command", Type: FieldString, Description: "command line started"},
+		},
+	}
+}
+
 func (p *RunPlugin) Run(hive *regf.Hive) error {
-	fmt.Println("Startup Programs")
-	fmt.Println("================")
-	fmt.Println()
+	return runText(p, hive)
+}
 
+func (p *RunPlugin) Collect(hive *regf.Hive, emit Emitter) error {
 	paths := []string{
 		"Microsoft\\Windows\\CurrentVersion\\Run",
 		"Microsoft\\Windows\\CurrentVersion\\RunOnce",
@@ -39,30 +51,26 @@ func (p *RunPlugin) Run(hive *regf.Hive) error {
 		"Wow6432Node\\Microsoft\\Windows\\CurrentVersion\\RunOnce",
 	}
 
+	found := false
 	for _, path := range paths {
-		if err := p.printRunKeys(hive, path); err != nil {
+		key, err := hive.GetKey(path)
+		if err != nil {
 			continue
 		}
-	}
+		found = true
 
-	return nil
-}
-
-func (p *RunPlugin) printRunKeys(hive *regf.Hive, path string) error {
-	key, err := hive.GetKey(path)
-	if err != nil {
-		return err
-	}
-
-	fmt.Printf("[%s]\n", path)
-	fmt.Printf("Last Modified: %s\n", key.Timestamp().Format("2006-01-02 15:04:05"))
-
-	for _, val := range key.Values() {
-		if val.Name() != "" {
-			fmt.Printf("  %s = %s\n", val.Name(), GetValueString(val))
+		for _, val := range key.Values() {
+			if val.Name() != "" {
+				emit(NewRecord(path, key).
+					AddString("Name", val.Name()).
+					AddString("Command", GetValueString(val)).
+					WithTags("persistence"))
+			}
 		}
 	}
-	fmt.Println()
 
+	if !found {
+		return notFound("no Run keys")
+	}
 	return nil
 }
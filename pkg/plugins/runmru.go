@@ -25,7 +25,26 @@ func (p *RunMRUPlugin) CompatibleHiveTypes() []string {
 	return []string{"NTUSER.DAT"}
 }
 
+func (p *RunMRUPlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategoryExecution,
+		Techniques: []string{"T1059"},
+		Artifact:   "RunMRU keeps the commands typed in the Run dialog, most recent first.",
+		References: []string{regRipperReference},
+		Version:    "1.0.0",
+		Schema: []FieldSpec{
+			{Name: "Position", Type: FieldInt, Description: "position in MRUList, 1 being the most recent"},
+			{Name: "Value", Type: FieldString, Description: "value name"},
+			{Name: "Command", Type: FieldString, Description: "typed command"},
+		},
+	}
+}
+
 func (p *RunMRUPlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
+
+func (p *RunMRUPlugin) Collect(hive *regf.Hive, emit Emitter) error {
 	path := "Software\\Microsoft\\Windows\\CurrentVersion\\Explorer\\RunMRU"
 
 	key, err := hive.GetKey(path)
@@ -33,11 +52,6 @@ func (p *RunMRUPlugin) Run(hive *regf.Hive) error {
 		return fmt.Errorf("RunMRU key not found: %w", err)
 	}
 
-	fmt.Println("Run Dialog History (MRU)")
-	fmt.Println("========================")
-	fmt.Printf("Last Modified: %s\n", key.Timestamp().Format("2006-01-02 15:04:05"))
-	fmt.Println()
-
 	// Get MRU order
 	var mruOrder string
 	for _, val := range key.Values() {
@@ -47,13 +61,16 @@ func (p *RunMRUPlugin) Run(hive *regf.Hive) error {
 		}
 	}
 
-	// Display in MRU order
+	// Emit in MRU order
 	if mruOrder != "" {
 		for i, char := range mruOrder {
 			valName := string(char)
 			for _, val := range key.Values() {
 				if val.Name() == valName {
-					fmt.Printf("%d. %s\n", i+1, GetValueString(val))
+					emit(NewRecord(path, key).
+						AddInt("Position", int64(i+1)).
+						AddString("Value", valName).
+						AddString("Command", GetValueString(val)))
 					break
 				}
 			}
@@ -62,7 +79,9 @@ func (p *RunMRUPlugin) Run(hive *regf.Hive) error {
 		// No MRU order, just list all
 		for _, val := range key.Values() {
 			if val.Name() != "" && val.Name() != "MRUList" {
-				fmt.Printf("%s: %s\n", val.Name(), GetValueString(val))
+				emit(NewRecord(path, key).
+					AddString("Value", val.Name()).
+					AddString("Command", GetValueString(val)))
 			}
 		}
 	}
@@ -0,0 +1,336 @@
+package plugins
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
+)
+
+// SAM key paths.
+const (
+	samAccountPath = `SAM\Domains\Account`
+	samUsersPath   = samAccountPath + `\Users`
+	samBuiltinPath = `SAM\Domains\Builtin`
+)
+
+// Account control bits (ACB) of the F structure.
+const (
+	acbDisabled             = 0x0001
+	acbHomeDirRequired      = 0x0002
+	acbPasswordNotRequired  = 0x0004
+	acbTempDuplicate        = 0x0008
+	acbNormalUser           = 0x0010
+	acbMNSLogon             = 0x0020
+	acbInterdomainTrust     = 0x0040
+	acbWorkstationTrust     = 0x0080
+	acbServerTrust          = 0x0100
+	acbPasswordNeverExpires = 0x0200
+	acbAutoLocked           = 0x0400
+)
+
+// acbNames names the account control bits, in bit order.
+var acbNames = []struct {
+	bit  uint16
+	name string
+}{
+	{acbDisabled, "Account Disabled"},
+	{acbHomeDirRequired, "Home Directory Required"},
+	{acbPasswordNotRequired, "Password Not Required"},
+	{acbTempDuplicate, "Temporary Duplicate Account"},
+	{acbNormalUser, "Normal User Account"},
+	{acbMNSLogon, "MNS Logon Account"},
+	{acbInterdomainTrust, "Interdomain Trust Account"},
+	{acbWorkstationTrust, "Workstation Trust Account"},
+	{acbServerTrust, "Server Trust Account"},
+	{acbPasswordNeverExpires, "Password Does Not Expire"},
+	{acbAutoLocked, "Account Locked"},
+}
+
+// samAccount is a local account decoded from its F and V values and the
+// alias (group) memberships that reference it.
+type samAccount struct {
+	RID         uint32
+	KeyPath     string
+	Key         *regf.Key
+	SID         string
+	Username    string
+	FullName    string
+	Comment     string
+	HomeDir     string
+	HomeDrive   string
+	LogonScript string
+	ProfilePath string
+
+	LastLogon       time.Time
+	PasswordLastSet time.Time
+	AccountExpires  time.Time
+	LastFailedLogon time.Time
+	LogonCount      uint16
+	BadPwdCount     uint16
+	ACB             uint16
+	HasF            bool
+
+	// LMHash and NTHash are the encrypted hash structures of V, empty
+	// when the account has no such hash.
+	LMHash []byte
+	NTHash []byte
+
+	Groups []string
+}
+
+// flags returns the names of the account control bits set.
+func (a samAccount) flags() []string {
+	var names []string
+	for _, f := range acbNames {
+		if a.ACB&f.bit != 0 {
+			names = append(names, f.name)
+		}
+	}
+	return names
+}
+
+// readSAMAccounts decodes every account under SAM\Domains\Account\Users,
+// sorted by RID, with its group memberships.
+func readSAMAccounts(hive *regf.Hive) ([]samAccount, error) {
+	usersKey, err := hive.GetKey(samUsersPath)
+	if err != nil {
+		return nil, fmt.Errorf("SAM Users key not found: %w", err)
+	}
+
+	domainSID := samDomainSID(hive)
+	names := samAccountNames(usersKey)
+	var accounts []samAccount
+	for _, user := range usersKey.Subkeys() {
+		rid, err := strconv.ParseUint(user.Name(), 16, 32)
+		if err != nil {
+			// Names and other non-account subkeys
+			continue
+		}
+		a := samAccount{
+			RID:     uint32(rid),
+			KeyPath: joinKeyPath(samUsersPath, user.Name()),
+			Key:     user,
+		}
+		if domainSID != "" {
+			a.SID = fmt.Sprintf("%s-%d", domainSID, a.RID)
+		}
+		if v, err := getValue(user, "F"); err == nil {
+			a.decodeF(v.Bytes())
+		}
+		if v, err := getValue(user, "V"); err == nil {
+			a.decodeV(v.Bytes())
+		}
+		if a.Username == "" {
+			a.Username = names[a.RID]
+		}
+		accounts = append(accounts, a)
+	}
+	if len(accounts) == 0 {
+		return nil, notFound("no accounts under %s", samUsersPath)
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].RID < accounts[j].RID })
+
+	members := samAliasMembers(hive)
+	for i := range accounts {
+		a := &accounts[i]
+		groups := members[a.SID]
+		if a.SID == "" {
+			groups = members[fmt.Sprintf("*-%d", a.RID)]
+		}
+		a.Groups = groups
+	}
+	return accounts, nil
+}
+
+// samAccountNames maps RIDs to account names from the Users\Names
+// subkeys, whose default value stores the RID as its type.
+func samAccountNames(usersKey *regf.Key) map[uint32]string {
+	names := make(map[uint32]string)
+	namesKey, err := getSubkey(usersKey, "Names")
+	if err != nil {
+		return names
+	}
+	for _, nameKey := range namesKey.Subkeys() {
+		if v, err := getValue(nameKey, ""); err == nil {
+			names[v.Type()] = nameKey.Name()
+		}
+	}
+	return names
+}
+
+// decodeF reads the fixed-size F structure: times, counters and flags.
+func (a *samAccount) decodeF(f []byte) {
+	if len(f) < 0x44 {
+		return
+	}
+	a.HasF = true
+	a.LastLogon = filetimeToTime(binary.LittleEndian.Uint64(f[0x08:]))
+	a.PasswordLastSet = filetimeToTime(binary.LittleEndian.Uint64(f[0x18:]))
+	if expires := binary.LittleEndian.Uint64(f[0x20:]); expires != 0x7FFFFFFFFFFFFFFF {
+		a.AccountExpires = filetimeToTime(expires)
+	}
+	a.LastFailedLogon = filetimeToTime(binary.LittleEndian.Uint64(f[0x28:]))
+	a.ACB = binary.LittleEndian.Uint16(f[0x38:])
+	a.BadPwdCount = binary.LittleEndian.Uint16(f[0x40:])
+	a.LogonCount = binary.LittleEndian.Uint16(f[0x42:])
+}
+
+// samVHeader is the size of the V header; the offsets it stores are
+// relative to its end.
+const samVHeader = 0xCC
+
+// vEntry returns the data described by the V header entry at off: a
+// 32-bit offset followed by a 32-bit length.
+func vEntry(v []byte, off int) []byte {
+	if len(v) < off+8 {
+		return nil
+	}
+	start := int(binary.LittleEndian.Uint32(v[off:])) + samVHeader
+	length := int(binary.LittleEndian.Uint32(v[off+4:]))
+	if start > len(v) || length > len(v)-start {
+		return nil
+	}
+	return v[start : start+length]
+}
+
+// decodeV reads the variable V structure: names, paths and hashes.
+func (a *samAccount) decodeV(v []byte) {
+	if len(v) < samVHeader {
+		return
+	}
+	a.Username = utf16String(vEntry(v, 0x0C))
+	a.FullName = utf16String(vEntry(v, 0x18))
+	a.Comment = utf16String(vEntry(v, 0x24))
+	a.HomeDir = utf16String(vEntry(v, 0x48))
+	a.HomeDrive = utf16String(vEntry(v, 0x54))
+	a.LogonScript = utf16String(vEntry(v, 0x60))
+	a.ProfilePath = utf16String(vEntry(v, 0x6C))
+	if samHashPresent(vEntry(v, 0x9C)) {
+		a.LMHash = vEntry(v, 0x9C)
+	}
+	if samHashPresent(vEntry(v, 0xA8)) {
+		a.NTHash = vEntry(v, 0xA8)
+	}
+}
+
+// samHashPresent tells whether a V hash structure holds a hash. RC4
+// (revision 1) structures are 20 bytes with a hash and 4 without; AES
+// (revision 2) ones are 24 bytes plus the encrypted hash.
+func samHashPresent(h []byte) bool {
+	if len(h) < 4 {
+		return false
+	}
+	if binary.LittleEndian.Uint16(h[2:]) == 2 {
+		return len(h) > 0x18
+	}
+	return len(h) >= 20
+}
+
+// samDomainSID returns the SID of the local machine domain, stored in
+// the last 24 bytes of SAM\Domains\Account V.
+func samDomainSID(hive *regf.Hive) string {
+	key, err := hive.GetKey(samAccountPath)
+	if err != nil {
+		return ""
+	}
+	v, err := getValue(key, "V")
+	if err != nil || len(v.Bytes()) < 24 {
+		return ""
+	}
+	data := v.Bytes()
+	sid, n := parseSID(data[len(data)-24:])
+	if n != 24 || !strings.HasPrefix(sid, "S-1-5-21-") {
+		return ""
+	}
+	return sid
+}
+
+// parseSID decodes a binary SID and returns it with its size in bytes.
+func parseSID(b []byte) (string, int) {
+	if len(b) < 8 || b[0] != 1 {
+		return "", 0
+	}
+	count := int(b[1])
+	size := 8 + 4*count
+	if len(b) < size {
+		return "", 0
+	}
+	var authority uint64
+	for _, c := range b[2:8] {
+		authority = authority<<8 | uint64(c)
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "S-1-%d", authority)
+	for i := 0; i < count; i++ {
+		fmt.Fprintf(&sb, "-%d", binary.LittleEndian.Uint32(b[8+4*i:]))
+	}
+	return sb.String(), size
+}
+
+// samAliasMembers maps member SIDs to the names of the aliases (local
+// groups) listing them, from the C values under Builtin\Aliases and
+// Account\Aliases. Local accounts are also indexed as *-RID, for hives
+// whose domain SID cannot be read.
+func samAliasMembers(hive *regf.Hive) map[string][]string {
+	members := make(map[string][]string)
+	for _, path := range []string{samBuiltinPath + `\Aliases`, samAccountPath + `\Aliases`} {
+		aliases, err := hive.GetKey(path)
+		if err != nil {
+			continue
+		}
+		for _, alias := range aliases.Subkeys() {
+			c, err := getValue(alias, "C")
+			if err != nil {
+				continue
+			}
+			name, sids := parseAliasC(c.Bytes())
+			if name == "" {
+				continue
+			}
+			for _, sid := range sids {
+				members[sid] = append(members[sid], name)
+				if strings.HasPrefix(sid, "S-1-5-21-") {
+					rid := sid[strings.LastIndex(sid, "-")+1:]
+					members["*-"+rid] = append(members["*-"+rid], name)
+				}
+			}
+		}
+	}
+	return members
+}
+
+// parseAliasC decodes an alias C value: its name and member SIDs. Offsets
+// in its 0x34 byte header are relative to the end of the header.
+func parseAliasC(c []byte) (string, []string) {
+	const header = 0x34
+	if len(c) < header {
+		return "", nil
+	}
+	field := func(off int) []byte {
+		start := int(binary.LittleEndian.Uint32(c[off:])) + header
+		length := int(binary.LittleEndian.Uint32(c[off+4:]))
+		if start > len(c) || length > len(c)-start {
+			return nil
+		}
+		return c[start : start+length]
+	}
+	name := utf16String(field(0x10))
+	data := field(0x28)
+	count := int(binary.LittleEndian.Uint32(c[0x30:]))
+
+	var sids []string
+	for i := 0; i < count && len(data) > 0; i++ {
+		sid, n := parseSID(data)
+		if n == 0 {
+			break
+		}
+		sids = append(sids, sid)
+		data = data[n:]
+	}
+	return name, sids
+}
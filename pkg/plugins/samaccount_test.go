@@ -0,0 +1,133 @@
+package plugins
+
+import (
+	"encoding/binary"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sidBytes encodes a SID string such as S-1-5-21-1-2-3-500.
+func sidBytes(sid string) []byte {
+	parts := strings.Split(sid, "-")[2:]
+	b := []byte{1, byte(len(parts) - 1), 0, 0, 0, 0, 0, 0}
+	authority, _ := strconv.Atoi(parts[0])
+	b[7] = byte(authority)
+	for _, p := range parts[1:] {
+		n, _ := strconv.Atoi(p)
+		b = append(b, le32(n)...)
+	}
+	return b
+}
+
+// samRecord builds a V or C style structure: a header of the given size
+// with (offset, length) pairs at the given positions, pointing at data
+// stored after the header.
+func samRecord(header int, fields map[int][]byte, extra map[int]uint32) []byte {
+	h := make([]byte, header)
+	var data []byte
+	for off := 0; off < header; off++ {
+		f, ok := fields[off]
+		if !ok {
+			continue
+		}
+		binary.LittleEndian.PutUint32(h[off:], uint32(len(data)))
+		binary.LittleEndian.PutUint32(h[off+4:], uint32(len(f)))
+		data = append(data, f...)
+		for len(data)%4 != 0 {
+			data = append(data, 0)
+		}
+	}
+	for off, v := range extra {
+		binary.LittleEndian.PutUint32(h[off:], v)
+	}
+	return append(h, data...)
+}
+
+func TestSAMParseDecodesAccounts(t *testing.T) {
+	lastLogon := time.Date(2024, 3, 4, 5, 6, 7, 800, time.UTC)
+	pwdSet := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	f := make([]byte, 0x50)
+	binary.LittleEndian.PutUint64(f[0x08:], filetime(lastLogon))
+	binary.LittleEndian.PutUint64(f[0x18:], filetime(pwdSet))
+	binary.LittleEndian.PutUint64(f[0x20:], 0x7FFFFFFFFFFFFFFF)
+	binary.LittleEndian.PutUint32(f[0x30:], 1001)
+	binary.LittleEndian.PutUint16(f[0x38:], acbNormalUser|acbPasswordNeverExpires|acbAutoLocked)
+	binary.LittleEndian.PutUint16(f[0x40:], 3)
+	binary.LittleEndian.PutUint16(f[0x42:], 42)
+
+	ntHash := append([]byte{0, 0, 2, 0}, make([]byte, 52)...)
+	v := samRecord(samVHeader, map[int][]byte{
+		0x0C: utf16le("alice"),
+		0x18: utf16le("Alice Example"),
+		0x48: utf16le(`\\server\home\alice`),
+		0x9C: {0, 0, 2, 0},
+		0xA8: ntHash,
+	}, nil)
+
+	domain := "S-1-5-21-11-22-33"
+	domainV := append(make([]byte, 0x30), sidBytes(domain)...)
+	members := append(sidBytes(domain+"-1001"), sidBytes("S-1-5-4")...)
+	admins := samRecord(0x34, map[int][]byte{
+		0x10: utf16le("Administrators"),
+		0x28: members,
+	}, map[int]uint32{0x30: 2})
+	users := samRecord(0x34, map[int][]byte{
+		0x10: utf16le("Users"),
+		0x28: sidBytes(domain + "-1002"),
+	}, map[int]uint32{0x30: 1})
+
+	hive := newTestHive(t, key("ROOT", key("SAM", key("Domains",
+		key("Account",
+			key("Users",
+				key("000003E9").with(binValue("F", f), binValue("V", v)),
+				key("000003EA"),
+				key("Names", key("bob").with(testValue{name: "", dataType: 0x3EA})),
+			),
+		).with(binValue("V", domainV)),
+		key("Builtin", key("Aliases",
+			key("00000220").with(binValue("C", admins)),
+			key("00000221").with(binValue("C", users)),
+		)),
+	))))
+
+	records, err := Collect(&SAMParsePlugin{}, hive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+	want := map[string]string{
+		"RID":                    "1001",
+		"SID":                    domain + "-1001",
+		"Username":               "alice",
+		"Full Name":              "Alice Example",
+		"Home Dir":               `\\server\home\alice`,
+		"Last Logon":             FormatTime(lastLogon),
+		"Password Last Set":      FormatTime(pwdSet),
+		"Logon Count":            "42",
+		"Bad Password Count":     "3",
+		"Locked":                 "true",
+		"Disabled":               "false",
+		"Password Never Expires": "true",
+		"LM Hash Present":        "false",
+		"NT Hash Present":        "true",
+		"Groups":                 "Administrators",
+	}
+	for name, value := range want {
+		if f, ok := records[0].Get(name); !ok || FormatValue(f) != value {
+			t.Errorf("%s = %v, want %s", name, f.Value, value)
+		}
+	}
+	if _, ok := records[0].Get("Account Expires"); ok {
+		t.Error("an account that never expires should have no expiry time")
+	}
+	if f, _ := records[1].Get("Username"); FormatValue(f) != "bob" {
+		t.Errorf("account without V should be named from Names, got %v", f.Value)
+	}
+	if f, _ := records[1].Get("Groups"); FormatValue(f) != "Users" {
+		t.Errorf("expected Users membership, got %v", f.Value)
+	}
+}
@@ -0,0 +1,296 @@
+package plugins
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/md5"
+	"crypto/rc4"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
+)
+
+func init() {
+	Register(&SAMHashesPlugin{})
+}
+
+// Hashes reported for accounts without an LM or NT hash: those of the
+// empty password.
+const (
+	emptyLMHash = "aad3b435b51404eeaad3b435b51404ee"
+	emptyNTHash = "31d6cfe0d16ae931b73c59d7e0c089c0"
+)
+
+// Constants mixed into the SAM key derivations.
+var (
+	samQwerty     = []byte("!@#$%^&*()qwertyUIOPAzxcvbnmQQQQQQQQQQQQ)(*@&%\x00")
+	samDigits     = []byte("0123456789012345678901234567890123456789\x00")
+	samLMPassword = []byte("LMPASSWORD\x00")
+	samNTPassword = []byte("NTPASSWORD\x00")
+)
+
+// errBootKeyMismatch is returned when the SAM hashed boot key does not
+// decrypt with the boot key, as when SAM and SYSTEM come from different
+// hosts.
+var errBootKeyMismatch = errors.New("boot key does not decrypt the SAM key; are SAM and SYSTEM from the same host?")
+
+// SAMHashesPlugin decrypts the LM and NT password hashes of local accounts
+// with the boot key of the SYSTEM hive of the same host.
+type SAMHashesPlugin struct{}
+
+func (p *SAMHashesPlugin) Name() string {
+	return "samhashes"
+}
+
+func (p *SAMHashesPlugin) Description() string {
+	return "Decrypt local account LM/NT password hashes from SAM with the SYSTEM boot key"
+}
+
+func (p *SAMHashesPlugin) CompatibleHiveTypes() []string {
+	return []string{"SAM"}
+}
+
+func (p *SAMHashesPlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategoryAccounts,
+		Techniques: []string{"T1003.002"},
+		Artifact: "Local account password hashes, encrypted in SAM with a key derived from the SYSTEM boot key " +
+			"(RC4 before Windows 10 1607, AES since). Useful to find reused or default passwords.",
+		References: []string{regRipperReference},
+		Version:    "1.0.0",
+		Schema: []FieldSpec{
+			{Name: "RID", Type: FieldInt, Description: "relative ID"},
+			{Name: "Username", Type: FieldString, Description: "account name"},
+			{Name: "Encryption", Type: FieldString, Description: "RC4 or AES"},
+			{Name: "LM Hash", Type: FieldString, Description: "LM hash, the empty-password hash if none is stored", Sensitive: true},
+			{Name: "NT Hash", Type: FieldString, Description: "NT hash, the empty-password hash if none is stored", Sensitive: true},
+			{Name: "Blank Password", Type: FieldBool, Description: "the NT hash is that of the empty password"},
+			{Name: "Pwdump", Type: FieldString, Description: "user:rid:lm:nt::: line for cracking tools", Sensitive: true},
+		},
+	}
+}
+
+func (p *SAMHashesPlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
+
+func (p *SAMHashesPlugin) RequiredHives() []string {
+	return []string{"SAM", "SYSTEM"}
+}
+
+func (p *SAMHashesPlugin) OptionalHives() []string {
+	return nil
+}
+
+// Collect runs on a single hive, which cannot hold both SAM and the boot
+// key: it reports the missing SYSTEM hive.
+func (p *SAMHashesPlugin) Collect(hive *regf.Hive, emit Emitter) error {
+	records, err := CollectContext(context.Background(), p, hive, DefaultOptions(p))
+	for _, r := range records {
+		emit(r)
+	}
+	return err
+}
+
+func (p *SAMHashesPlugin) CollectHost(ctx context.Context, host *Host, opts Options, emit Emitter) error {
+	sam := host.Hive("SAM")
+	bootKey, err := readBootKey(host.Hive("SYSTEM"))
+	if err != nil {
+		return fmt.Errorf("boot key: %w", err)
+	}
+	hashedBootKey, err := samHashedBootKey(sam, bootKey)
+	if err != nil {
+		return err
+	}
+	accounts, err := readSAMAccounts(sam)
+	if err != nil {
+		return err
+	}
+
+	var failed []error
+	for _, a := range accounts {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		lm, errLM := decryptSAMHash(a.LMHash, hashedBootKey, a.RID, samLMPassword)
+		nt, errNT := decryptSAMHash(a.NTHash, hashedBootKey, a.RID, samNTPassword)
+		if err := errors.Join(errLM, errNT); err != nil {
+			failed = append(failed, fmt.Errorf("RID %d: %w", a.RID, err))
+			continue
+		}
+		if lm == "" {
+			lm = emptyLMHash
+		}
+		if nt == "" {
+			nt = emptyNTHash
+		}
+
+		r := NewRecord(a.KeyPath, a.Key).
+			AddInt("RID", int64(a.RID)).
+			AddString("Username", a.Username).
+			AddString("Encryption", samEncryption(a))
+		r.AddSecret("LM Hash", lm).
+			AddSecret("NT Hash", nt).
+			AddBool("Blank Password", nt == emptyNTHash).
+			AddSecret("Pwdump", fmt.Sprintf("%s:%d:%s:%s:::", a.Username, a.RID, lm, nt))
+		emit(r)
+	}
+	if len(failed) > 0 {
+		return partial(failed)
+	}
+	return nil
+}
+
+// samEncryption names the scheme of an account's stored hashes.
+func samEncryption(a samAccount) string {
+	for _, h := range [][]byte{a.NTHash, a.LMHash} {
+		if len(h) >= 4 {
+			if binary.LittleEndian.Uint16(h[2:]) == 2 {
+				return "AES"
+			}
+			return "RC4"
+		}
+	}
+	return "None"
+}
+
+// samHashedBootKey decrypts the key protecting the account hashes, stored
+// at 0x68 of the F value of SAM\Domains\Account. Revision 1 is RC4 keyed by
+// MD5 over a salt and the boot key, with an MD5 checksum; revision 2 is
+// AES-128-CBC with the boot key.
+func samHashedBootKey(sam *regf.Hive, bootKey []byte) ([]byte, error) {
+	key, err := sam.GetKey(samAccountPath)
+	if err != nil {
+		return nil, notFound("%s not found", samAccountPath)
+	}
+	v, err := getValue(key, "F")
+	if err != nil {
+		return nil, notFound("%s F value not found", samAccountPath)
+	}
+	f := v.Bytes()
+	if len(f) < 0x88 {
+		return nil, fmt.Errorf("%s F value too short (%d bytes)", samAccountPath, len(f))
+	}
+
+	switch revision := binary.LittleEndian.Uint32(f[0x68:]); revision {
+	case 1:
+		if len(f) < 0xA0 {
+			return nil, fmt.Errorf("%s F value too short for RC4 key (%d bytes)", samAccountPath, len(f))
+		}
+		rc4Key := md5Sum(f[0x70:0x80], samQwerty, bootKey, samDigits)
+		data := rc4Crypt(rc4Key, f[0x80:0xA0])
+		hashedBootKey, checksum := data[:16], data[16:]
+		if !bytes.Equal(md5Sum(hashedBootKey, samDigits, hashedBootKey, samQwerty), checksum) {
+			return nil, errBootKeyMismatch
+		}
+		return hashedBootKey, nil
+	case 2:
+		dataLen := int(binary.LittleEndian.Uint32(f[0x74:]))
+		if len(f) < 0x88+dataLen || dataLen < 16 {
+			return nil, fmt.Errorf("%s F value too short for AES key (%d bytes)", samAccountPath, len(f))
+		}
+		data, err := aesDecrypt(bootKey, f[0x78:0x88], f[0x88:0x88+dataLen])
+		if err != nil {
+			return nil, err
+		}
+		return data[:16], nil
+	default:
+		return nil, fmt.Errorf("%s: unsupported SAM key revision %d", samAccountPath, revision)
+	}
+}
+
+// decryptSAMHash decrypts a hash structure of the V value and returns the
+// hash in hex, or "" if the structure holds none. The structure is a
+// 16-bit PEK ID and revision, then for revision 1 the RC4 encrypted hash,
+// and for revision 2 a data offset, a 16 byte IV and the AES encrypted
+// hash. Either way the result is still DES encrypted with keys derived
+// from the RID.
+func decryptSAMHash(h, hashedBootKey []byte, rid uint32, constant []byte) (string, error) {
+	if !samHashPresent(h) {
+		return "", nil
+	}
+	ridBytes := binary.LittleEndian.AppendUint32(nil, rid)
+
+	var obfuscated []byte
+	if binary.LittleEndian.Uint16(h[2:]) == 2 {
+		data, err := aesDecrypt(hashedBootKey, h[8:24], h[24:])
+		if err != nil {
+			return "", err
+		}
+		obfuscated = data[:16]
+	} else {
+		rc4Key := md5Sum(hashedBootKey[:16], ridBytes, constant)
+		obfuscated = rc4Crypt(rc4Key, h[4:20])
+	}
+
+	k := ridBytes
+	hash := make([]byte, 16)
+	for i, raw := range [][]byte{
+		{k[0], k[1], k[2], k[3], k[0], k[1], k[2]},
+		{k[3], k[0], k[1], k[2], k[3], k[0], k[1]},
+	} {
+		block, err := des.NewCipher(desKey(raw))
+		if err != nil {
+			return "", err
+		}
+		block.Decrypt(hash[8*i:], obfuscated[8*i:8*i+8])
+	}
+	return hex.EncodeToString(hash), nil
+}
+
+// desKey spreads 7 key bytes over the 7 high bits of 8 DES key bytes.
+func desKey(s []byte) []byte {
+	key := []byte{
+		s[0] >> 1,
+		(s[0]&0x01)<<6 | s[1]>>2,
+		(s[1]&0x03)<<5 | s[2]>>3,
+		(s[2]&0x07)<<4 | s[3]>>4,
+		(s[3]&0x0F)<<3 | s[4]>>5,
+		(s[4]&0x1F)<<2 | s[5]>>6,
+		(s[5]&0x3F)<<1 | s[6]>>7,
+		s[6] & 0x7F,
+	}
+	for i := range key {
+		key[i] <<= 1
+	}
+	return key
+}
+
+// md5Sum returns the MD5 digest of the concatenated parts.
+func md5Sum(parts ...[]byte) []byte {
+	h := md5.New()
+	for _, p := range parts {
+		h.Write(p)
+	}
+	return h.Sum(nil)
+}
+
+// rc4Crypt encrypts or decrypts data with RC4.
+func rc4Crypt(key, data []byte) []byte {
+	c, _ := rc4.NewCipher(key) // only fails for keys outside 1 to 256 bytes
+	out := make([]byte, len(data))
+	c.XORKeyStream(out, data)
+	return out
+}
+
+// aesDecrypt decrypts data with AES-CBC. Trailing bytes short of a block
+// are ignored.
+func aesDecrypt(key, iv, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	data = data[:len(data)/aes.BlockSize*aes.BlockSize]
+	if len(data) == 0 {
+		return nil, errors.New("AES data shorter than a block")
+	}
+	out := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, data)
+	return out, nil
+}
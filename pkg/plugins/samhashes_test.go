@@ -0,0 +1,149 @@
+package plugins
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+// bootKeySystem returns the root of a SYSTEM hive whose LSA class names
+// scramble bootKey.
+func bootKeySystem(bootKey []byte) *testKey {
+	scrambled := make([]byte, 16)
+	for i, j := range bootKeyPermutation {
+		scrambled[j] = bootKey[i]
+	}
+	lsa := key("Lsa")
+	for i, name := range bootKeyParts {
+		lsa.subkeys = append(lsa.subkeys, &testKey{name: name, class: hex.EncodeToString(scrambled[4*i : 4*i+4])})
+	}
+	return key("ROOT",
+		key("Select").with(dwordValue("Current", 1)),
+		key("ControlSet001", key("Control", lsa)),
+	)
+}
+
+// encryptSAMHash builds the V hash structure holding hash for rid, the
+// inverse of decryptSAMHash.
+func encryptSAMHash(t *testing.T, hash, hashedBootKey []byte, rid uint32, constant []byte, aesIV []byte) []byte {
+	k := binary.LittleEndian.AppendUint32(nil, rid)
+	obfuscated := make([]byte, 16)
+	for i, raw := range [][]byte{
+		{k[0], k[1], k[2], k[3], k[0], k[1], k[2]},
+		{k[3], k[0], k[1], k[2], k[3], k[0], k[1]},
+	} {
+		block, err := des.NewCipher(desKey(raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+		block.Encrypt(obfuscated[8*i:], hash[8*i:8*i+8])
+	}
+	if aesIV == nil {
+		return concat([]byte{0, 0, 1, 0}, rc4Crypt(md5Sum(hashedBootKey, k, constant), obfuscated))
+	}
+	return concat([]byte{0, 0, 2, 0}, le32(0x10), aesIV, aesEncrypt(t, hashedBootKey, aesIV, obfuscated))
+}
+
+func aesEncrypt(t *testing.T, key, iv, data []byte) []byte {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make([]byte, len(data))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, data)
+	return out
+}
+
+func TestSAMHashesDecrypts(t *testing.T) {
+	bootKey, _ := hex.DecodeString("00112233445566778899aabbccddeeff")
+	hashedBootKey, _ := hex.DecodeString("0f1e2d3c4b5a69788796a5b4c3d2e1f0")
+	ntHash, _ := hex.DecodeString("8846f7eaee8fb117ad06bdd830b7586c")
+	salt := []byte("0123456789abcdef")
+
+	rc4F := make([]byte, 0xA0)
+	binary.LittleEndian.PutUint32(rc4F[0x68:], 1)
+	copy(rc4F[0x70:], salt)
+	copy(rc4F[0x80:], rc4Crypt(md5Sum(salt, samQwerty, bootKey, samDigits),
+		concat(hashedBootKey, md5Sum(hashedBootKey, samDigits, hashedBootKey, samQwerty))))
+
+	aesF := make([]byte, 0x88)
+	binary.LittleEndian.PutUint32(aesF[0x68:], 2)
+	binary.LittleEndian.PutUint32(aesF[0x74:], 32)
+	copy(aesF[0x78:], salt)
+	aesF = append(aesF, aesEncrypt(t, bootKey, salt, append(append([]byte{}, hashedBootKey...), make([]byte, 16)...))...)
+
+	for _, tc := range []struct {
+		name       string
+		accountF   []byte
+		iv         []byte
+		encryption string
+	}{
+		{"RC4", rc4F, nil, "RC4"},
+		{"AES", aesF, []byte("fedcba9876543210"), "AES"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			v := samRecord(samVHeader, map[int][]byte{
+				0x0C: utf16le("alice"),
+				0x9C: {0, 0, 1, 0},
+				0xA8: encryptSAMHash(t, ntHash, hashedBootKey, 1001, samNTPassword, tc.iv),
+			}, nil)
+			sam := newTestHive(t, key("ROOT", key("SAM", key("Domains", key("Account",
+				key("Users", key("000003E9").with(binValue("V", v))),
+			).with(binValue("F", tc.accountF))))))
+
+			host := &Host{}
+			host.Add("SAM", "SAM", sam)
+			host.Add("SYSTEM", "SYSTEM", newTestHive(t, bootKeySystem(bootKey)))
+			p := &SAMHashesPlugin{}
+			records, err := CollectHost(context.Background(), p, host, DefaultOptions(p))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != 1 {
+				t.Fatalf("expected 1 record, got %d", len(records))
+			}
+			r := records[0]
+			want := map[string]string{
+				"Encryption":     tc.encryption,
+				"LM Hash":        emptyLMHash,
+				"NT Hash":        hex.EncodeToString(ntHash),
+				"Blank Password": "false",
+				"Pwdump":         "alice:1001:" + emptyLMHash + ":" + hex.EncodeToString(ntHash) + ":::",
+			}
+			for name, value := range want {
+				if f, ok := r.Get(name); !ok || FormatValue(f) != value {
+					t.Errorf("%s = %v, want %s", name, f.Value, value)
+				}
+			}
+			if f, _ := r.Get("NT Hash"); !f.Sensitive {
+				t.Error("NT Hash should be marked sensitive")
+			}
+			if !r.HasTag("sensitive") {
+				t.Error("record should be tagged sensitive")
+			}
+		})
+	}
+}
+
+func TestSAMHashesNeedsMatchingSystem(t *testing.T) {
+	f := make([]byte, 0xA0)
+	binary.LittleEndian.PutUint32(f[0x68:], 1)
+	sam := newTestHive(t, key("ROOT", key("SAM", key("Domains", key("Account", key("Users")).with(binValue("F", f))))))
+
+	p := &SAMHashesPlugin{}
+	if _, err := CollectContext(context.Background(), p, sam, DefaultOptions(p)); !errors.Is(err, ErrMissingHive) {
+		t.Errorf("expected ErrMissingHive without SYSTEM, got %v", err)
+	}
+
+	host := &Host{}
+	host.Add("SAM", "SAM", sam)
+	host.Add("SYSTEM", "SYSTEM", newTestHive(t, bootKeySystem(make([]byte, 16))))
+	if _, err := CollectHost(context.Background(), p, host, DefaultOptions(p)); !errors.Is(err, errBootKeyMismatch) {
+		t.Errorf("expected errBootKeyMismatch, got %v", err)
+	}
+}
@@ -1,8 +1,7 @@
 package plugins
 
 import (
-	"fmt"
-	"strings"
+	"context"
 
 	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
 )
@@ -11,7 +10,8 @@ func init() {
 	Register(&SAMParsePlugin{})
 }
 
-// SAMParsePlugin provides comprehensive SAM parsing (users, groups, last login)
+// SAMParsePlugin decodes local accounts from the SAM hive: the F and V
+// values of each user and its alias (group) memberships.
 type SAMParsePlugin struct{}
 
 func (p *SAMParsePlugin) Name() string {
@@ -19,52 +19,118 @@ func (p *SAMParsePlugin) Name() string {
 }
 
 func (p *SAMParsePlugin) Description() string {
-	return "Comprehensive SAM parsing - users, groups, last login times"
+	return "Comprehensive SAM parsing - account details, logon history, flags and groups"
 }
 
 func (p *SAMParsePlugin) CompatibleHiveTypes() []string {
 	return []string{"SAM"}
 }
 
-func (p *SAMParsePlugin) Run(hive *regf.Hive) error {
-	usersPath := "SAM\\Domains\\Account\\Users"
-	usersKey, err := hive.GetKey(usersPath)
-	if err != nil {
-		return fmt.Errorf("users key not found: %w", err)
+func (p *SAMParsePlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategoryAccounts,
+		Techniques: []string{"T1087.001", "T1078.003"},
+		Artifact:   "Local user accounts from the SAM hive, with logon history, account flags and group memberships.",
+		References: []string{regRipperReference},
+		Version:    "2.1.0",
+		Schema: []FieldSpec{
+			{Name: "RID", Type: FieldInt, Description: "relative ID"},
+			{Name: "SID", Type: FieldString, Description: "account SID, when the domain SID is known"},
+			{Name: "Username", Type: FieldString, Description: "account name"},
+			{Name: "Domain", Type: FieldString, Description: "machine name from the SECURITY hive of the host"},
+			{Name: "Local Profile", Type: FieldString, Description: "profile directory from the ProfileList of the host"},
+			{Name: "Full Name", Type: FieldString, Description: "full name"},
+			{Name: "Comment", Type: FieldString, Description: "account comment"},
+			{Name: "Home Dir", Type: FieldString, Description: "home directory"},
+			{Name: "Home Drive", Type: FieldString, Description: "home drive letter"},
+			{Name: "Logon Script", Type: FieldString, Description: "logon script path"},
+			{Name: "Profile Path", Type: FieldString, Description: "roaming profile path"},
+			{Name: "Last Logon", Type: FieldTime, Description: "last successful logon"},
+			{Name: "Password Last Set", Type: FieldTime, Description: "last password change"},
+			{Name: "Account Expires", Type: FieldTime, Description: "expiry time, absent when the account never expires"},
+			{Name: "Last Failed Logon", Type: FieldTime, Description: "last failed logon"},
+			{Name: "Logon Count", Type: FieldInt, Description: "number of logons"},
+			{Name: "Bad Password Count", Type: FieldInt, Description: "failed logons since the last success"},
+			{Name: "Flags", Type: FieldStrings, Description: "account control flags"},
+			{Name: "Disabled", Type: FieldBool, Description: "account is disabled"},
+			{Name: "Locked", Type: FieldBool, Description: "account is locked out"},
+			{Name: "Password Never Expires", Type: FieldBool, Description: "password does not expire"},
+			{Name: "LM Hash Present", Type: FieldBool, Description: "an LM hash is stored"},
+			{Name: "NT Hash Present", Type: FieldBool, Description: "an NT hash is stored"},
+			{Name: "Groups", Type: FieldStrings, Description: "local groups the account is a member of"},
+		},
 	}
+}
 
-	fmt.Println("SAM Users (Comprehensive):")
-	fmt.Println(strings.Repeat("=", 80))
+func (p *SAMParsePlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
 
-	namesKey, _ := getSubkey(usersKey, "Names")
+// Options is empty; samparse is a ContextPlugin so that it resolves the
+// SIDs of accounts with the hives of the host.
+func (p *SAMParsePlugin) Options() []Option {
+	return nil
+}
 
-	for _, user := range usersKey.Subkeys() {
-		if user.Name() == "Names" {
-			continue
-		}
+func (p *SAMParsePlugin) Collect(hive *regf.Hive, emit Emitter) error {
+	return p.CollectContext(context.Background(), hive, DefaultOptions(p), emit)
+}
 
-		fmt.Printf("\nRID: %s\n", user.Name())
-		fmt.Printf("Last Write: %s\n", user.Timestamp().Format("2006-01-02 15:04:05"))
+func (p *SAMParsePlugin) CollectContext(ctx context.Context, hive *regf.Hive, opts Options, emit Emitter) error {
+	accounts, err := readSAMAccounts(hive)
+	if err != nil {
+		return err
+	}
+	sids := SIDResolverFrom(ctx, "SAM", hive)
 
-		// Try to find username from Names subkey
-		if namesKey != nil {
-			for _, nameEntry := range namesKey.Subkeys() {
-				if defVal, err := getValue(nameEntry, ""); err == nil {
-					ridStr := fmt.Sprintf("0x%s", user.Name())
-					if strings.Contains(GetValueString(defVal), ridStr) || user.Name() == nameEntry.Name() {
-						fmt.Printf("Username: %s\n", nameEntry.Name())
-					}
-				}
+	for _, a := range accounts {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		r := NewRecord(a.KeyPath, a.Key).
+			AddInt("RID", int64(a.RID))
+		if a.SID != "" {
+			r.AddString("SID", a.SID)
+		}
+		r.AddString("Username", a.Username)
+		if n, ok := sids.Resolve(a.SID); ok && a.SID != "" {
+			if n.Domain != "" {
+				r.AddString("Domain", n.Domain)
+			}
+			if n.ProfilePath != "" {
+				r.AddString("Local Profile", n.ProfilePath)
 			}
 		}
-
-		// Parse F value (contains last login, etc.)
-		if fVal, err := getValue(user, "F"); err == nil {
-			data := fVal.Bytes()
-			if len(data) >= 8 {
-				fmt.Printf("F value length: %d bytes\n", len(data))
+		for _, f := range []struct{ name, value string }{
+			{"Full Name", a.FullName},
+			{"Comment", a.Comment},
+			{"Home Dir", a.HomeDir},
+			{"Home Drive", a.HomeDrive},
+			{"Logon Script", a.LogonScript},
+			{"Profile Path", a.ProfilePath},
+		} {
+			if f.value != "" {
+				r.AddString(f.name, f.value)
+			}
+		}
+		if a.HasF {
+			r.AddTime("Last Logon", a.LastLogon).
+				AddTime("Password Last Set", a.PasswordLastSet)
+			if !a.AccountExpires.IsZero() {
+				r.AddTime("Account Expires", a.AccountExpires)
 			}
+			r.AddTime("Last Failed Logon", a.LastFailedLogon).
+				AddInt("Logon Count", int64(a.LogonCount)).
+				AddInt("Bad Password Count", int64(a.BadPwdCount)).
+				AddStrings("Flags", a.flags()).
+				AddBool("Disabled", a.ACB&acbDisabled != 0).
+				AddBool("Locked", a.ACB&acbAutoLocked != 0).
+				AddBool("Password Never Expires", a.ACB&acbPasswordNeverExpires != 0)
 		}
+		r.AddBool("LM Hash Present", len(a.LMHash) > 0).
+			AddBool("NT Hash Present", len(a.NTHash) > 0).
+			AddStrings("Groups", a.Groups)
+		emit(r)
 	}
 
 	return nil
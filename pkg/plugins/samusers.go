@@ -1,10 +1,6 @@
 package plugins
 
 import (
-	"encoding/binary"
-	"fmt"
-	"strings"
-
 	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
 )
 
@@ -20,51 +16,52 @@ func (p *SAMUsersPlugin) Name() string {
 }
 
 func (p *SAMUsersPlugin) Description() string {
-	return "List local users from SAM hive"
+	return "List local users with RIDs from SAM hive"
 }
 
 func (p *SAMUsersPlugin) CompatibleHiveTypes() []string {
 	return []string{"SAM"}
 }
 
+func (p *SAMUsersPlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategoryAccounts,
+		Techniques: []string{"T1087.001"},
+		Artifact:   "Local user accounts from the SAM hive.",
+		References: []string{regRipperReference},
+		Version:    "1.1.0",
+		Schema: []FieldSpec{
+			{Name: "RID", Type: FieldInt, Description: "relative ID"},
+			{Name: "Username", Type: FieldString, Description: "account name"},
+			{Name: "Full Name", Type: FieldString, Description: "full name"},
+			{Name: "Last Logon", Type: FieldTime, Description: "last successful logon"},
+			{Name: "Disabled", Type: FieldBool, Description: "account is disabled"},
+		},
+	}
+}
+
 func (p *SAMUsersPlugin) Run(hive *regf.Hive) error {
-	path := "SAM\\Domains\\Account\\Users"
+	return runText(p, hive)
+}
 
-	_, err := hive.GetKey(path)
+func (p *SAMUsersPlugin) Collect(hive *regf.Hive, emit Emitter) error {
+	accounts, err := readSAMAccounts(hive)
 	if err != nil {
-		return fmt.Errorf("SAM Users key not found: %w", err)
+		return err
 	}
 
-	fmt.Println("Local Users (from SAM)")
-	fmt.Println("======================")
-	fmt.Println()
-
-	// Get Names subkey for username mapping
-	namesKey, err := hive.GetKey(path + "\\Names")
-	if err == nil {
-		for _, nameKey := range namesKey.Subkeys() {
-			username := nameKey.Name()
-
-			// Get RID from the default value type field
-			rid := ""
-			for _, val := range nameKey.Values() {
-				if val.Name() == "" || strings.EqualFold(val.Name(), "(Default)") {
-					data := val.Bytes()
-					if len(data) >= 4 {
-						ridNum := binary.LittleEndian.Uint32(data)
-						rid = fmt.Sprintf("0x%x", ridNum)
-					}
-					break
-				}
-			}
-
-			fmt.Printf("Username: %s\n", username)
-			if rid != "" {
-				fmt.Printf("  RID: %s\n", rid)
-			}
-			fmt.Printf("  Last Modified: %s\n", nameKey.Timestamp().Format("2006-01-02 15:04:05"))
-			fmt.Println()
+	for _, a := range accounts {
+		r := NewRecord(a.KeyPath, a.Key).
+			AddInt("RID", int64(a.RID)).
+			AddString("Username", a.Username)
+		if a.FullName != "" {
+			r.AddString("Full Name", a.FullName)
+		}
+		if a.HasF {
+			r.AddTime("Last Logon", a.LastLogon).
+				AddBool("Disabled", a.ACB&acbDisabled != 0)
 		}
+		emit(r)
 	}
 
 	return nil
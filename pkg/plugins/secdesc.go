@@ -0,0 +1,127 @@
+package plugins
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// Security descriptor control flags.
+const (
+	sdDACLPresent  = 0x0004
+	sdSelfRelative = 0x8000
+)
+
+// ACE types of the DACL.
+const (
+	aceAccessAllowed = 0x00
+	aceAccessDenied  = 0x01
+)
+
+// securityACE is an access control entry of a DACL.
+type securityACE struct {
+	Type  byte
+	Flags byte
+	Mask  uint32
+	SID   string
+}
+
+// securityDescriptor is a decoded self-relative SECURITY_DESCRIPTOR.
+type securityDescriptor struct {
+	Owner string
+	Group string
+	// DACL is nil when the descriptor has no DACL, which grants everyone
+	// full access.
+	DACL []securityACE
+}
+
+// parseSecurityDescriptor decodes a self-relative security descriptor: a
+// revision, the control flags, then the offsets of the owner and group
+// SIDs, the SACL and the DACL.
+func parseSecurityDescriptor(b []byte) (securityDescriptor, error) {
+	var sd securityDescriptor
+	if len(b) < 20 || b[0] != 1 {
+		return sd, fmt.Errorf("not a security descriptor (%d bytes)", len(b))
+	}
+	control := binary.LittleEndian.Uint16(b[2:])
+	if control&sdSelfRelative == 0 {
+		return sd, fmt.Errorf("security descriptor not self-relative")
+	}
+	sidAt := func(off uint32) string {
+		if off == 0 || int(off) >= len(b) {
+			return ""
+		}
+		sid, _ := parseSID(b[off:])
+		return sid
+	}
+	sd.Owner = sidAt(binary.LittleEndian.Uint32(b[4:]))
+	sd.Group = sidAt(binary.LittleEndian.Uint32(b[8:]))
+
+	daclOffset := int(binary.LittleEndian.Uint32(b[16:]))
+	if control&sdDACLPresent == 0 || daclOffset == 0 {
+		return sd, nil
+	}
+	if daclOffset+8 > len(b) {
+		return sd, fmt.Errorf("DACL offset %d outside descriptor", daclOffset)
+	}
+	acl := b[daclOffset:]
+	count := int(binary.LittleEndian.Uint16(acl[4:]))
+	sd.DACL = []securityACE{}
+	off := 8
+	for i := 0; i < count; i++ {
+		if off+8 > len(acl) {
+			return sd, fmt.Errorf("ACE %d outside DACL", i)
+		}
+		size := int(binary.LittleEndian.Uint16(acl[off+2:]))
+		if size < 8 || off+size > len(acl) {
+			return sd, fmt.Errorf("ACE %d has invalid size %d", i, size)
+		}
+		ace := securityACE{Type: acl[off], Flags: acl[off+1], Mask: binary.LittleEndian.Uint32(acl[off+4:])}
+		if ace.Type == aceAccessAllowed || ace.Type == aceAccessDenied {
+			ace.SID, _ = parseSID(acl[off+8 : off+size])
+		}
+		sd.DACL = append(sd.DACL, ace)
+		off += size
+	}
+	return sd, nil
+}
+
+// String renders the descriptor in SDDL form, with SIDs and access masks
+// left numeric.
+func (sd securityDescriptor) String() string {
+	return sd.format(nil)
+}
+
+// format renders the descriptor in SDDL form, naming the SIDs sids
+// resolves to an account. Access masks are left numeric.
+func (sd securityDescriptor) format(sids *SIDResolver) string {
+	name := func(sid string) string {
+		if sids != nil {
+			if account := sids.Account(sid); account != "" {
+				return account
+			}
+		}
+		return sid
+	}
+	var b strings.Builder
+	if sd.Owner != "" {
+		b.WriteString("O:" + name(sd.Owner))
+	}
+	if sd.Group != "" {
+		b.WriteString("G:" + name(sd.Group))
+	}
+	if sd.DACL != nil {
+		b.WriteString("D:")
+		for _, ace := range sd.DACL {
+			switch ace.Type {
+			case aceAccessAllowed:
+				fmt.Fprintf(&b, "(A;;0x%08X;;;%s)", ace.Mask, name(ace.SID))
+			case aceAccessDenied:
+				fmt.Fprintf(&b, "(D;;0x%08X;;;%s)", ace.Mask, name(ace.SID))
+			default:
+				fmt.Fprintf(&b, "(0x%02X;;0x%08X;;;)", ace.Type, ace.Mask)
+			}
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,470 @@
+package plugins
+
+import (
+	"encoding/binary"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
+)
+
+// Service type bits of the Type value.
+const (
+	serviceKernelDriver     = 0x001
+	serviceFileSystemDriver = 0x002
+	serviceAdapter          = 0x004
+	serviceRecognizerDriver = 0x008
+	serviceWin32OwnProcess  = 0x010
+	serviceWin32Share       = 0x020
+	serviceUserService      = 0x040
+	serviceUserInstance     = 0x080
+	serviceInteractive      = 0x100
+
+	serviceDriverMask = serviceKernelDriver | serviceFileSystemDriver | serviceRecognizerDriver
+)
+
+// serviceTypeNames names the bits of the Type value, in bit order.
+var serviceTypeNames = []struct {
+	bit  uint32
+	name string
+}{
+	{serviceKernelDriver, "Kernel Driver"},
+	{serviceFileSystemDriver, "File System Driver"},
+	{serviceAdapter, "Adapter"},
+	{serviceRecognizerDriver, "Recognizer Driver"},
+	{serviceWin32OwnProcess, "Win32 Own Process"},
+	{serviceWin32Share, "Win32 Share Process"},
+	{serviceUserService, "User Service"},
+	{serviceUserInstance, "User Service Instance"},
+	{serviceInteractive, "Interactive"},
+}
+
+// serviceStartNames, serviceErrorControlNames and serviceSIDTypeNames
+// name the values of Start, ErrorControl and ServiceSidType.
+var (
+	serviceStartNames        = []string{"Boot", "System", "Automatic", "Manual", "Disabled"}
+	serviceErrorControlNames = []string{"Ignore", "Normal", "Severe", "Critical"}
+	serviceSIDTypeNames      = map[uint32]string{0: "None", 1: "Unrestricted", 3: "Restricted"}
+)
+
+// serviceFailureActionNames names the SC_ACTION types of FailureActions.
+var serviceFailureActionNames = []string{"None", "Restart", "Reboot", "Run Command"}
+
+// serviceInfo is a service or driver decoded from its key below Services.
+type serviceInfo struct {
+	Name         string
+	DisplayName  string
+	Description  string
+	ImagePath    string
+	ObjectName   string
+	Group        string
+	Dependencies []string
+
+	Start, Type, ErrorControl          uint32
+	HasStart, HasType, HasErrorControl bool
+	DelayedAutostart                   bool
+	SIDType                            uint32
+	HasSIDType                         bool
+	RequiredPrivileges                 []string
+
+	ServiceDll  string
+	ServiceMain string
+
+	FailureActions string
+	FailureCommand string
+
+	Security    string
+	SecurityErr error
+	// WritableBy lists the broad groups the DACL lets change the service.
+	WritableBy []string
+}
+
+// readService decodes the values of a service key and its Parameters and
+// Security subkeys, naming the SIDs of the security descriptor with sids.
+func readService(key *regf.Key, sids *SIDResolver) serviceInfo {
+	s := serviceInfo{Name: key.Name()}
+	dword := func(v *regf.Value) (uint32, bool) {
+		if len(v.Bytes()) < 4 {
+			return 0, false
+		}
+		return binary.LittleEndian.Uint32(v.Bytes()), true
+	}
+	for _, v := range key.Values() {
+		switch strings.ToLower(v.Name()) {
+		case "displayname":
+			s.DisplayName = GetValueString(v)
+		case "description":
+			s.Description = GetValueString(v)
+		case "imagepath":
+			s.ImagePath = GetValueString(v)
+		case "objectname":
+			s.ObjectName = GetValueString(v)
+		case "group":
+			s.Group = GetValueString(v)
+		case "dependonservice":
+			s.Dependencies = GetValueStrings(v)
+		case "start":
+			s.Start, s.HasStart = dword(v)
+		case "type":
+			s.Type, s.HasType = dword(v)
+		case "errorcontrol":
+			s.ErrorControl, s.HasErrorControl = dword(v)
+		case "delayedautostart":
+			n, _ := dword(v)
+			s.DelayedAutostart = n != 0
+		case "servicesidtype":
+			s.SIDType, s.HasSIDType = dword(v)
+		case "requiredprivileges":
+			s.RequiredPrivileges = GetValueStrings(v)
+		case "servicedll":
+			// Before Parameters existed, and still used by some services
+			s.ServiceDll = GetValueString(v)
+		case "failureactions":
+			s.FailureActions = formatFailureActions(v.Bytes())
+		case "failurecommand":
+			s.FailureCommand = GetValueString(v)
+		}
+	}
+
+	for _, sk := range key.Subkeys() {
+		switch strings.ToLower(sk.Name()) {
+		case "parameters":
+			for _, v := range sk.Values() {
+				switch strings.ToLower(v.Name()) {
+				case "servicedll":
+					s.ServiceDll = GetValueString(v)
+				case "servicemain":
+					s.ServiceMain = GetValueString(v)
+				}
+			}
+		case "security":
+			v, err := getValue(sk, "Security")
+			if err != nil {
+				continue
+			}
+			sd, err := parseSecurityDescriptor(v.Bytes())
+			if err != nil {
+				s.SecurityErr = err
+				continue
+			}
+			s.Security = sd.format(sids)
+			s.WritableBy = serviceWritableBy(sd, sids)
+		}
+	}
+	if s.ServiceDll != "" && s.ServiceMain == "" {
+		s.ServiceMain = "ServiceMain"
+	}
+	return s
+}
+
+// isDriver reports whether the service is a kernel, file system or
+// recognizer driver.
+func (s serviceInfo) isDriver() bool {
+	return s.Type&serviceDriverMask != 0
+}
+
+// startType names the Start value, noting delayed automatic starts.
+func (s serviceInfo) startType() string {
+	if !s.HasStart {
+		return ""
+	}
+	name := fmt.Sprintf("Unknown (%d)", s.Start)
+	if int(s.Start) < len(serviceStartNames) {
+		name = serviceStartNames[s.Start]
+	}
+	if s.Start == 2 && s.DelayedAutostart {
+		name += " (Delayed)"
+	}
+	return name
+}
+
+// serviceType names the bits set in the Type value.
+func (s serviceInfo) serviceType() string {
+	if !s.HasType {
+		return ""
+	}
+	var names []string
+	rest := s.Type
+	for _, t := range serviceTypeNames {
+		if s.Type&t.bit != 0 {
+			names = append(names, t.name)
+			rest &^= t.bit
+		}
+	}
+	if rest != 0 || len(names) == 0 {
+		names = append(names, fmt.Sprintf("0x%X", rest))
+	}
+	return strings.Join(names, ", ")
+}
+
+// errorControl names the ErrorControl value.
+func (s serviceInfo) errorControl() string {
+	if !s.HasErrorControl {
+		return ""
+	}
+	if int(s.ErrorControl) < len(serviceErrorControlNames) {
+		return serviceErrorControlNames[s.ErrorControl]
+	}
+	return fmt.Sprintf("Unknown (%d)", s.ErrorControl)
+}
+
+// sidType names the ServiceSidType value.
+func (s serviceInfo) sidType() string {
+	if !s.HasSIDType {
+		return ""
+	}
+	if name, ok := serviceSIDTypeNames[s.SIDType]; ok {
+		return name
+	}
+	return fmt.Sprintf("Unknown (%d)", s.SIDType)
+}
+
+// account returns the account a Win32 service runs as: ObjectName, which
+// defaults to LocalSystem. Drivers use ObjectName for their driver object
+// instead.
+func (s serviceInfo) account() string {
+	if s.isDriver() || !s.HasType {
+		return ""
+	}
+	if s.ObjectName == "" {
+		return "LocalSystem"
+	}
+	return s.ObjectName
+}
+
+// formatFailureActions decodes a FailureActions value, a
+// SERVICE_FAILURE_ACTIONS structure: the reset period in seconds, the
+// reboot message, command and action array pointers and the action count,
+// then the actions, each a type and a delay in milliseconds.
+func formatFailureActions(data []byte) string {
+	if len(data) < 20 {
+		return ""
+	}
+	reset := binary.LittleEndian.Uint32(data)
+	count := int(binary.LittleEndian.Uint32(data[12:]))
+	var actions []string
+	for i, off := 0, 20; i < count && off+8 <= len(data); i, off = i+1, off+8 {
+		kind := binary.LittleEndian.Uint32(data[off:])
+		delay := time.Duration(binary.LittleEndian.Uint32(data[off+4:])) * time.Millisecond
+		name := fmt.Sprintf("Unknown (%d)", kind)
+		if int(kind) < len(serviceFailureActionNames) {
+			name = serviceFailureActionNames[kind]
+		}
+		actions = append(actions, fmt.Sprintf("%s after %s", name, delay))
+	}
+	if len(actions) == 0 {
+		actions = []string{"None"}
+	}
+	s := strings.Join(actions, ", ")
+	if reset == 0xFFFFFFFF {
+		return s + "; never reset"
+	}
+	return fmt.Sprintf("%s; reset after %s", s, time.Duration(reset)*time.Second)
+}
+
+// Access rights that let a user reconfigure a service.
+const serviceWriteAccess = 0x00000002 | // SERVICE_CHANGE_CONFIG
+	0x00040000 | // WRITE_DAC
+	0x00080000 | // WRITE_OWNER
+	0x10000000 | // GENERIC_ALL
+	0x40000000 // GENERIC_WRITE
+
+// serviceBroadSIDs are the groups every user belongs to.
+var serviceBroadSIDs = []string{"S-1-1-0", "S-1-5-11", "S-1-5-32-545", "S-1-5-4"}
+
+// serviceWritableBy lists the broad groups an allow ACE of the DACL gives
+// write access to the service configuration.
+func serviceWritableBy(sd securityDescriptor, sids *SIDResolver) []string {
+	var groups []string
+	for _, ace := range sd.DACL {
+		if ace.Type != aceAccessAllowed || ace.Mask&serviceWriteAccess == 0 {
+			continue
+		}
+		for _, sid := range serviceBroadSIDs {
+			if ace.SID == sid {
+				groups = append(groups, sids.Account(sid))
+			}
+		}
+	}
+	return groups
+}
+
+// serviceExecutable extracts the executable of an image path, without
+// quotes or arguments, and expands the forms Windows accepts for system
+// paths. The result is lower case with backslashes.
+func serviceExecutable(imagePath string) string {
+	p := strings.TrimSpace(imagePath)
+	if rest, ok := strings.CutPrefix(p, `"`); ok {
+		p, _, _ = strings.Cut(rest, `"`)
+	} else {
+		lower := strings.ToLower(p)
+		for _, ext := range []string{".exe", ".sys", ".dll"} {
+			if i := strings.Index(lower, ext); i >= 0 {
+				p = p[:i+len(ext)]
+				break
+			}
+		}
+	}
+	p = strings.ToLower(p)
+	p = strings.TrimPrefix(p, `\??\`)
+	for _, prefix := range []string{`\systemroot\`, `%systemroot%\`, `%windir%\`} {
+		if rest, ok := strings.CutPrefix(p, prefix); ok {
+			return `c:\windows\` + rest
+		}
+	}
+	if strings.HasPrefix(p, `system32\`) {
+		return `c:\windows\` + p
+	}
+	return p
+}
+
+// serviceUserDirs are path fragments of directories users can write to.
+var serviceUserDirs = []string{
+	`\users\`, `\appdata\`, `\temp\`, `\tmp\`, `\downloads\`,
+	`\$recycle.bin\`, `\windows\tasks\`, `\windows\tracing\`,
+}
+
+// legitimateServices are services attackers commonly imitate, and the
+// built-in services close enough to them to be mistaken for imitations.
+var legitimateServices = []string{
+	"AudioSrv", "BITS", "CryptSvc", "DcomLaunch", "Dhcp", "Dnscache", "EventLog", "EventSystem",
+	"gpsvc", "iphlpsvc", "LanmanServer", "LanmanWorkstation", "lmhosts", "MpsSvc", "Netlogon",
+	"Netman", "nsi", "PlugPlay", "Power", "ProfSvc", "RpcEptMapper", "RpcSs", "SamSs", "Schedule",
+	"seclogon", "SENS", "ShellHWDetection", "Spooler", "SysMain", "TermService", "Themes",
+	"TrustedInstaller", "W32Time", "Wecsvc", "WinDefend", "Winmgmt", "WinRM", "wscsvc", "WSearch",
+	"wuauserv",
+	// Close to SENS and Wecsvc
+	"Sense", "WerSvc",
+}
+
+// legitimateBinaries are system executables attackers commonly imitate,
+// without their .exe extension; they live in System32.
+var legitimateBinaries = []string{
+	"svchost", "lsass", "services", "csrss", "winlogon", "smss",
+	"spoolsv", "wininit", "taskhostw", "dllhost", "conhost",
+}
+
+// serviceAnomalies returns why a service looks suspicious: an image or
+// DLL in a user-writable directory, an unquoted image path with spaces,
+// a svchost service without ServiceDll, a driver outside System32\drivers,
+// a name or binary imitating a system one, or a DACL letting every user
+// reconfigure it.
+func serviceAnomalies(s serviceInfo) []string {
+	var anomalies []string
+	exe := serviceExecutable(s.ImagePath)
+	base := path.Base(strings.ReplaceAll(exe, `\`, "/"))
+
+	for _, p := range []struct{ what, path string }{
+		{"image", exe},
+		{"service DLL", serviceExecutable(s.ServiceDll)},
+	} {
+		for _, dir := range serviceUserDirs {
+			if strings.Contains(p.path, dir) {
+				anomalies = append(anomalies, fmt.Sprintf("%s in user-writable directory %s", p.what, strings.Trim(dir, `\`)))
+				break
+			}
+		}
+	}
+
+	if trimmed := strings.TrimSpace(s.ImagePath); trimmed != "" && !strings.HasPrefix(trimmed, `"`) &&
+		strings.Contains(exe, " ") {
+		anomalies = append(anomalies, "unquoted image path with spaces")
+	}
+
+	if base == "svchost.exe" && s.ServiceDll == "" && !s.isDriver() {
+		anomalies = append(anomalies, "svchost service without ServiceDll")
+	}
+
+	if s.isDriver() && exe != "" && !strings.Contains(exe, `\system32\drivers\`) &&
+		!strings.Contains(exe, `\system32\driverstore\`) {
+		anomalies = append(anomalies, "driver outside System32\\drivers")
+	}
+
+	// A look-alike name is only suspicious when the service does not load
+	// its code from the system directories
+	systemCode := isSystemPath(exe) && (s.ServiceDll == "" || isSystemPath(serviceExecutable(s.ServiceDll)))
+	if name, ok := imitates(s.Name, legitimateServices); ok && !systemCode {
+		anomalies = append(anomalies, fmt.Sprintf("name imitates the %s service", name))
+	}
+	if program, ok := strings.CutSuffix(base, ".exe"); ok {
+		if name, ok := imitates(program, legitimateBinaries); ok {
+			anomalies = append(anomalies, fmt.Sprintf("binary name imitates %s.exe", name))
+		} else if isLegitimateBinary(program) && !isSystemPath(exe) {
+			anomalies = append(anomalies, fmt.Sprintf("%s outside System32", base))
+		}
+	}
+
+	for _, group := range s.WritableBy {
+		anomalies = append(anomalies, fmt.Sprintf("service configuration writable by %s", group))
+	}
+	return anomalies
+}
+
+// isSystemPath reports whether an executable returned by serviceExecutable
+// lies in System32 or SysWOW64, where only TrustedInstaller can write.
+func isSystemPath(exe string) bool {
+	return strings.HasPrefix(exe, `c:\windows\system32\`) || strings.HasPrefix(exe, `c:\windows\syswow64\`)
+}
+
+// isLegitimateBinary reports whether name is one of legitimateBinaries.
+func isLegitimateBinary(name string) bool {
+	for _, b := range legitimateBinaries {
+		if strings.EqualFold(name, b) {
+			return true
+		}
+	}
+	return false
+}
+
+// imitates returns the name of names that name is close to without being
+// equal to any: one edit away, or two for names of eight characters or
+// more. Swapping two adjacent characters counts as one edit.
+func imitates(name string, names []string) (string, bool) {
+	lower := strings.ToLower(name)
+	if len(lower) < 4 {
+		return "", false
+	}
+	for _, n := range names {
+		if strings.EqualFold(name, n) {
+			return "", false
+		}
+	}
+	maxDistance := 1
+	if len(lower) >= 8 {
+		maxDistance = 2
+	}
+	for _, n := range names {
+		if editDistance(lower, strings.ToLower(n)) <= maxDistance {
+			return n, true
+		}
+	}
+	return "", false
+}
+
+// editDistance returns the number of insertions, deletions, substitutions
+// and adjacent transpositions turning a into b (optimal string alignment).
+func editDistance(a, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
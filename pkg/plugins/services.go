@@ -1,9 +1,8 @@
 package plugins
 
 import (
-	"encoding/binary"
+	"context"
 	"fmt"
-	"strings"
 
 	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
 )
@@ -27,120 +26,91 @@ func (p *ServicesPlugin) CompatibleHiveTypes() []string {
 	return []string{"SYSTEM"}
 }
 
-func (p *ServicesPlugin) Run(hive *regf.Hive) error {
-	// Find current ControlSet
-	controlSet, err := p.findCurrentControlSet(hive)
-	if err != nil {
-		return fmt.Errorf("failed to find current controlset: %w", err)
+func (p *ServicesPlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategoryPersistence,
+		Techniques: []string{"T1543.003", "T1036.004", "T1574.009", "T1574.011"},
+		Artifact: "Services and drivers with their start type, image path, account and ServiceDll. Services whose " +
+			"binary sits in a user-writable directory, whose image path is unquoted with spaces, svchost services " +
+			"without a ServiceDll, drivers outside System32\\drivers and names imitating system services are flagged.",
+		References: []string{regRipperReference, "https://learn.microsoft.com/en-us/windows-hardware/drivers/install/hklm-system-currentcontrolset-services-registry-tree"},
+		Version:    "1.1.0",
+		Schema: []FieldSpec{
+			{Name: "Service", Type: FieldString, Description: "service key name"},
+			{Name: "Display Name", Type: FieldString, Description: "display name"},
+			{Name: "Image Path", Type: FieldString, Description: "binary started"},
+			{Name: "Start Type", Type: FieldString, Description: "start type"},
+			{Name: "Service Type", Type: FieldString, Description: "service type"},
+			{Name: "Error Control", Type: FieldString, Description: "severity of a failure to start"},
+			{Name: "Account", Type: FieldString, Description: "account a Win32 service runs as"},
+			{Name: "Service DLL", Type: FieldString, Description: "ServiceDll of a svchost service"},
+			{Name: "Anomalies", Type: FieldStrings, Description: "reasons the service looks suspicious"},
+		},
 	}
+}
 
-	fmt.Printf("Windows Services (from %s)\n", controlSet)
-	fmt.Println("==================================")
-	fmt.Println()
-
-	servicesPath := fmt.Sprintf("%s\\Services", controlSet)
-	servicesKey, err := hive.GetKey(servicesPath)
-	if err != nil {
-		return fmt.Errorf("failed to find services key: %w", err)
-	}
+func (p *ServicesPlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
 
-	for _, svcKey := range servicesKey.Subkeys() {
-		p.printService(svcKey)
-	}
+func (p *ServicesPlugin) Options() []Option {
+	return []Option{controlSetOption}
+}
 
-	return nil
+func (p *ServicesPlugin) Collect(hive *regf.Hive, emit Emitter) error {
+	return p.CollectContext(context.Background(), hive, DefaultOptions(p), emit)
 }
 
-func (p *ServicesPlugin) findCurrentControlSet(hive *regf.Hive) (string, error) {
-	selectKey, err := hive.GetKey("Select")
-	if err != nil {
-		return "", err
-	}
+func (p *ServicesPlugin) CollectContext(ctx context.Context, hive *regf.Hive, opts Options, emit Emitter) error {
+	sids := SIDResolverFrom(ctx, "SYSTEM", hive)
+	return forEachControlSet(ctx, hive, opts, emit, func(controlSet string, emit Emitter) error {
+		servicesPath := fmt.Sprintf("%s\\Services", controlSet)
+		servicesKey, err := hive.GetKey(servicesPath)
+		if err != nil {
+			return fmt.Errorf("failed to find services key: %w", err)
+		}
 
-	for _, v := range selectKey.Values() {
-		if strings.EqualFold(v.Name(), "Current") {
-			if v.Type() == 4 { // REG_DWORD
-				data := v.Bytes()
-				if len(data) >= 4 {
-					currentNum := binary.LittleEndian.Uint32(data)
-					return fmt.Sprintf("ControlSet%03d", currentNum), nil
-				}
+		for _, svcKey := range servicesKey.Subkeys() {
+			if err := ctx.Err(); err != nil {
+				return err
 			}
+
+			emit(p.serviceRecord(servicesPath, svcKey, sids))
 		}
-	}
 
-	return "", fmt.Errorf("current value not found")
+		return nil
+	})
 }
 
-func (p *ServicesPlugin) printService(svcKey *regf.Key) {
-	displayName := ""
-	imagePath := ""
-	startType := ""
-	serviceType := ""
-
-	for _, val := range svcKey.Values() {
-		name := val.Name()
-		switch {
-		case strings.EqualFold(name, "DisplayName"):
-			displayName = GetValueString(val)
-		case strings.EqualFold(name, "ImagePath"):
-			imagePath = GetValueString(val)
-		case strings.EqualFold(name, "Start"):
-			if val.Type() == 4 {
-				data := val.Bytes()
-				if len(data) >= 4 {
-					start := binary.LittleEndian.Uint32(data)
-					switch start {
-					case 0:
-						startType = "Boot"
-					case 1:
-						startType = "System"
-					case 2:
-						startType = "Automatic"
-					case 3:
-						startType = "Manual"
-					case 4:
-						startType = "Disabled"
-					default:
-						startType = fmt.Sprintf("Unknown (%d)", start)
-					}
-				}
-			}
-		case strings.EqualFold(name, "Type"):
-			if val.Type() == 4 {
-				data := val.Bytes()
-				if len(data) >= 4 {
-					svcType := binary.LittleEndian.Uint32(data)
-					switch svcType & 0xFF {
-					case 1:
-						serviceType = "Kernel Driver"
-					case 2:
-						serviceType = "File System Driver"
-					case 16:
-						serviceType = "Win32 Own Process"
-					case 32:
-						serviceType = "Win32 Share Process"
-					default:
-						serviceType = fmt.Sprintf("Type 0x%x", svcType)
-					}
-				}
-			}
+func (p *ServicesPlugin) serviceRecord(servicesPath string, svcKey *regf.Key, sids *SIDResolver) *Record {
+	s := readService(svcKey, sids)
+	r := NewRecord(joinKeyPath(servicesPath, svcKey.Name()), svcKey).
+		AddString("Service", s.Name)
+	for _, f := range []struct{ name, value string }{
+		{"Display Name", s.DisplayName},
+		{"Image Path", s.ImagePath},
+		{"Start Type", s.startType()},
+		{"Service Type", s.serviceType()},
+		{"Error Control", s.errorControl()},
+		{"Account", s.account()},
+		{"Service DLL", s.ServiceDll},
+	} {
+		if f.value != "" {
+			r.AddString(f.name, f.value)
 		}
 	}
+	addServiceAnomalies(r, s)
+	return r
+}
 
-	fmt.Printf("Service: %s\n", svcKey.Name())
-	if displayName != "" {
-		fmt.Printf("  Display Name: %s\n", displayName)
-	}
-	if imagePath != "" {
-		fmt.Printf("  Image Path: %s\n", imagePath)
-	}
-	if startType != "" {
-		fmt.Printf("  Start Type: %s\n", startType)
-	}
-	if serviceType != "" {
-		fmt.Printf("  Service Type: %s\n", serviceType)
+// addServiceAnomalies adds the anomalies of the service, raising the
+// severity of the record when there are any.
+func addServiceAnomalies(r *Record, s serviceInfo) {
+	anomalies := serviceAnomalies(s)
+	if len(anomalies) == 0 {
+		return
 	}
-	fmt.Printf("  Last Modified: %s\n", svcKey.Timestamp().Format("2006-01-02 15:04:05"))
-	fmt.Println()
+	r.AddStrings("Anomalies", anomalies).
+		WithSeverity(SeverityWarning).
+		WithTags("anomaly")
 }
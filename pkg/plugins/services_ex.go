@@ -1,8 +1,8 @@
 package plugins
 
 import (
+	"context"
 	"fmt"
-	"strings"
 
 	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
 )
@@ -11,6 +11,14 @@ func init() {
 	Register(&ServicesExPlugin{})
 }
 
+var servicesExLimitOption = Option{
+	Name:        "limit",
+	Type:        OptionInt,
+	Default:     "100",
+	Description: "Maximum number of services to list (0 for no limit)",
+	Validate:    validateLimit,
+}
+
 // ServicesExPlugin provides enhanced services details with more information
 type ServicesExPlugin struct{}
 
@@ -19,77 +27,148 @@ func (p *ServicesExPlugin) Name() string {
 }
 
 func (p *ServicesExPlugin) Description() string {
-	return "Enhanced Windows services with DLL/driver info and dependencies"
+	return "Decode Windows services in full and flag suspicious ones"
 }
 
 func (p *ServicesExPlugin) CompatibleHiveTypes() []string {
 	return []string{"SYSTEM"}
 }
 
-func (p *ServicesExPlugin) Run(hive *regf.Hive) error {
-	controlSetName, err := findCurrentControlSet(hive)
-	if err != nil {
-		return fmt.Errorf("failed to find current ControlSet: %w", err)
-	}
-
-	servicesPath := fmt.Sprintf("%s\\Services", controlSetName)
-	servicesKey, err := hive.GetKey(servicesPath)
-	if err != nil {
-		return fmt.Errorf("services key not found: %w", err)
+func (p *ServicesExPlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategoryPersistence,
+		Techniques: []string{"T1543.003", "T1036.004", "T1574.009", "T1574.011"},
+		Artifact: "Services and drivers decoded in full: start, type and error control, the account, the ServiceDll " +
+			"and ServiceMain from Parameters, failure actions and command, required privileges, the service SID " +
+			"type and the security descriptor from the Security subkey, with the anomalies of the services plugin " +
+			"and DACLs letting every user reconfigure the service.",
+		References: []string{
+			regRipperReference,
+			"https://learn.microsoft.com/en-us/windows-hardware/drivers/install/hklm-system-currentcontrolset-services-registry-tree",
+			"https://learn.microsoft.com/en-us/windows/win32/api/winsvc/ns-winsvc-service_failure_actionsw",
+		},
+		Version: "2.0.0",
+		Schema: []FieldSpec{
+			{Name: "Service", Type: FieldString, Description: "service key name"},
+			{Name: "Display Name", Type: FieldString, Description: "display name"},
+			{Name: "Description", Type: FieldString, Description: "description"},
+			{Name: "Image Path", Type: FieldString, Description: "binary started"},
+			{Name: "Start Type", Type: FieldString, Description: "start type, noting delayed automatic starts"},
+			{Name: "Service Type", Type: FieldString, Description: "service type bits"},
+			{Name: "Error Control", Type: FieldString, Description: "severity of a failure to start"},
+			{Name: "Account", Type: FieldString, Description: "account a Win32 service runs as"},
+			{Name: "Driver Object", Type: FieldString, Description: "ObjectName of a driver"},
+			{Name: "Service DLL", Type: FieldString, Description: "ServiceDll of a svchost service"},
+			{Name: "Service Main", Type: FieldString, Description: "entry point exported by the ServiceDll"},
+			{Name: "Group", Type: FieldString, Description: "load order group"},
+			{Name: "Dependencies", Type: FieldStrings, Description: "DependOnService"},
+			{Name: "Delayed Autostart", Type: FieldBool, Description: "automatic start delayed after boot"},
+			{Name: "SID Type", Type: FieldString, Description: "service SID type"},
+			{Name: "Required Privileges", Type: FieldStrings, Description: "privileges the service keeps"},
+			{Name: "Failure Actions", Type: FieldString, Description: "actions taken when the service fails"},
+			{Name: "Failure Command", Type: FieldString, Description: "command run by a Run Command failure action"},
+			{Name: "Security", Type: FieldString, Description: "security descriptor of the service, in SDDL form with SIDs resolved to accounts"},
+			{Name: "Anomalies", Type: FieldStrings, Description: "reasons the service looks suspicious"},
+		},
 	}
+}
 
-	fmt.Println("Windows Services (Enhanced):")
-	fmt.Println(strings.Repeat("=", 80))
-
-	count := 0
-	for _, svc := range servicesKey.Subkeys() {
-		var displayName, imageType, start string
-
-		for _, val := range svc.Values() {
-			switch val.Name() {
-			case "DisplayName":
-				displayName = GetValueString(val)
-			case "Type":
-				imageType = GetValueString(val)
-			case "Start":
-				start = GetValueString(val)
-			}
-		}
-
-		if displayName != "" || start != "" {
-			fmt.Printf("\n[%s] %s\n", svc.Timestamp().Format("2006-01-02 15:04:05"), svc.Name())
-			if displayName != "" {
-				fmt.Printf("  Display Name: %s\n", displayName)
-			}
+func (p *ServicesExPlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
 
-			for _, val := range svc.Values() {
-				name := val.Name()
-				switch name {
-				case "ImagePath":
-					fmt.Printf("  Image Path: %s\n", GetValueString(val))
+func (p *ServicesExPlugin) Options() []Option {
+	return []Option{controlSetOption, servicesExLimitOption}
+}
 
-				case "Type":
-					fmt.Printf("  Type: %s\n", imageType)
+func (p *ServicesExPlugin) Collect(hive *regf.Hive, emit Emitter) error {
+	return p.CollectContext(context.Background(), hive, DefaultOptions(p), emit)
+}
 
-				case "Start":
-					fmt.Printf("  Start: %s\n", start)
+func (p *ServicesExPlugin) CollectContext(ctx context.Context, hive *regf.Hive, opts Options, emit Emitter) error {
+	sids := SIDResolverFrom(ctx, "SYSTEM", hive)
+	return forEachControlSet(ctx, hive, opts, emit, func(controlSetName string, emit Emitter) error {
+		servicesPath := fmt.Sprintf("%s\\Services", controlSetName)
+		servicesKey, err := hive.GetKey(servicesPath)
+		if err != nil {
+			return fmt.Errorf("services key not found: %w", err)
+		}
 
-				case "DependOnService":
-					fmt.Printf("  Dependencies: %s\n", GetValueString(val))
+		var failed []error
+		count := 0
+		for _, svc := range servicesKey.Subkeys() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 
-				case "Group":
-					fmt.Printf("  Group: %s\n", GetValueString(val))
-				}
+			s := readService(svc, sids)
+			if s.DisplayName == "" && !s.HasStart {
+				continue
+			}
+			if s.SecurityErr != nil {
+				failed = append(failed, fmt.Errorf("%s security: %w", s.Name, s.SecurityErr))
 			}
+			emit(serviceExRecord(joinKeyPath(servicesPath, svc.Name()), svc, s))
 
 			count++
-			if count >= 100 {
-				fmt.Println("\n... (showing first 100 services)")
+			if limit := opts.Int("limit"); limit > 0 && count >= limit {
 				break
 			}
 		}
-	}
 
-	fmt.Printf("\nTotal services found: %d\n", count)
-	return nil
+		if len(failed) > 0 {
+			return partial(failed)
+		}
+		return nil
+	})
+}
+
+// serviceExRecord builds the detailed record of a service.
+func serviceExRecord(keyPath string, key *regf.Key, s serviceInfo) *Record {
+	r := NewRecord(keyPath, key).
+		AddString("Service", s.Name)
+	driverObject := ""
+	if s.isDriver() {
+		driverObject = s.ObjectName
+	}
+	for _, f := range []struct{ name, value string }{
+		{"Display Name", s.DisplayName},
+		{"Description", s.Description},
+		{"Image Path", s.ImagePath},
+		{"Start Type", s.startType()},
+		{"Service Type", s.serviceType()},
+		{"Error Control", s.errorControl()},
+		{"Account", s.account()},
+		{"Driver Object", driverObject},
+		{"Service DLL", s.ServiceDll},
+		{"Service Main", s.ServiceMain},
+		{"Group", s.Group},
+	} {
+		if f.value != "" {
+			r.AddString(f.name, f.value)
+		}
+	}
+	if len(s.Dependencies) > 0 {
+		r.AddStrings("Dependencies", s.Dependencies)
+	}
+	if s.DelayedAutostart {
+		r.AddBool("Delayed Autostart", true)
+	}
+	if sidType := s.sidType(); sidType != "" {
+		r.AddString("SID Type", sidType)
+	}
+	if len(s.RequiredPrivileges) > 0 {
+		r.AddStrings("Required Privileges", s.RequiredPrivileges)
+	}
+	for _, f := range []struct{ name, value string }{
+		{"Failure Actions", s.FailureActions},
+		{"Failure Command", s.FailureCommand},
+		{"Security", s.Security},
+	} {
+		if f.value != "" {
+			r.AddString(f.name, f.value)
+		}
+	}
+	addServiceAnomalies(r, s)
+	return r
 }
@@ -0,0 +1,138 @@
+package plugins
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// securityDescriptorBytes builds a self-relative security descriptor owned
+// by owner with one allow ACE per SID and mask pair.
+func securityDescriptorBytes(owner string, aces ...any) []byte {
+	var entries []byte
+	for i := 0; i < len(aces); i += 2 {
+		sid := sidBytes(aces[i].(string))
+		entries = concat(entries, []byte{aceAccessAllowed, 0}, le16(8+len(sid)), le32(aces[i+1].(int)), sid)
+	}
+	acl := concat([]byte{2, 0}, le16(8+len(entries)), le16(len(aces)/2), le16(0), entries)
+	ownerSID := sidBytes(owner)
+	return concat([]byte{1, 0}, le16(sdSelfRelative|sdDACLPresent),
+		le32(20), le32(0), le32(0), le32(20+len(ownerSID)), ownerSID, acl)
+}
+
+func TestServicesExDecodesServices(t *testing.T) {
+	multiSZ := func(name string, values ...string) testValue {
+		return testValue{name: name, dataType: regMultiSZ, data: utf16le(strings.Join(values, "\x00") + "\x00\x00")}
+	}
+	failureActions := concat(le32(86400), le32(0), le32(0), le32(2), le32(0),
+		le32(1), le32(60000), le32(3), le32(120000))
+
+	services := key("Services",
+		key("Schedule",
+			key("Parameters").with(szValue("ServiceDll", `%systemroot%\system32\schedsvc.dll`)),
+			key("Security").with(binValue("Security",
+				securityDescriptorBytes("S-1-5-18", "S-1-5-32-544", 0xF01FF, "S-1-5-11", 0x2008D,
+					"S-1-5-21-1-2-3-1001", 0x20094))),
+		).with(
+			szValue("DisplayName", "Task Scheduler"),
+			szValue("ImagePath", `%systemroot%\system32\svchost.exe -k netsvcs -p`),
+			dwordValue("Start", 2), dwordValue("DelayedAutostart", 1), dwordValue("Type", 0x20),
+			dwordValue("ErrorControl", 1), szValue("ObjectName", "LocalSystem"), dwordValue("ServiceSidType", 1),
+			multiSZ("RequiredPrivileges", "SeImpersonatePrivilege", "SeTcbPrivilege"),
+			multiSZ("DependOnService", "RPCSS"), binValue("FailureActions", failureActions),
+			szValue("FailureCommand", `C:\Tools\notify.exe`),
+		),
+		key("Schedu1e").with(
+			szValue("ImagePath", `C:\ProgramData\svchost.exe -k netsvcs`),
+			dwordValue("Start", 2), dwordValue("Type", 0x20),
+		),
+		key("Weak",
+			key("Security").with(binValue("Security", securityDescriptorBytes("S-1-5-18", "S-1-1-0", 0x2))),
+		).with(
+			szValue("ImagePath", `C:\Program Files\Acme App\agent.exe -service`),
+			dwordValue("Start", 3), dwordValue("Type", 0x10), szValue("ObjectName", `NT AUTHORITY\LocalService`),
+		),
+		key("rootkit").with(
+			szValue("ImagePath", `\??\C:\Users\Public\rootkit.sys`),
+			dwordValue("Start", 1), dwordValue("Type", 1), dwordValue("ErrorControl", 0),
+		),
+		key("Empty"),
+	)
+	hive := newTestHive(t, key("ROOT",
+		key("Select").with(dwordValue("Current", 1)),
+		key("ControlSet001", services),
+	))
+
+	records, err := Collect(&ServicesExPlugin{}, hive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]string{
+		{"Service": "Schedule", "Start Type": "Automatic (Delayed)", "Service Type": "Win32 Share Process",
+			"Error Control": "Normal", "Account": "LocalSystem", "Service DLL": `%systemroot%\system32\schedsvc.dll`,
+			"Service Main": "ServiceMain", "Delayed Autostart": "true", "SID Type": "Unrestricted",
+			"Required Privileges": "SeImpersonatePrivilege, SeTcbPrivilege", "Dependencies": "RPCSS",
+			"Failure Actions": "Restart after 1m0s, Run Command after 2m0s; reset after 24h0m0s",
+			"Failure Command": `C:\Tools\notify.exe`,
+			"Security": `O:NT AUTHORITY\SYSTEMD:(A;;0x000F01FF;;;BUILTIN\Administrators)` +
+				`(A;;0x0002008D;;;NT AUTHORITY\Authenticated Users)(A;;0x00020094;;;S-1-5-21-1-2-3-1001)`},
+		{"Service": "Schedu1e", "Account": "LocalSystem",
+			"Anomalies": "svchost service without ServiceDll, name imitates the Schedule service, " +
+				"svchost.exe outside System32"},
+		{"Service": "Weak", "Start Type": "Manual", "Account": `NT AUTHORITY\LocalService`,
+			"Anomalies": `unquoted image path with spaces, service configuration writable by Everyone`},
+		{"Service": "rootkit", "Start Type": "System", "Service Type": "Kernel Driver", "Error Control": "Ignore",
+			"Anomalies": `image in user-writable directory users, driver outside System32\drivers`},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("expected %d records, got %d", len(want), len(records))
+	}
+	for i, fields := range want {
+		for name, value := range fields {
+			if f, ok := records[i].Get(name); !ok || FormatValue(f) != value {
+				t.Errorf("record %d: %s = %v, want %s", i, name, f.Value, value)
+			}
+		}
+	}
+	if _, ok := records[0].Get("Anomalies"); ok || records[0].Severity != SeverityInfo {
+		t.Errorf("unexpected anomalies on Schedule: %v", records[0].Fields)
+	}
+	if records[1].Severity != SeverityWarning || !records[1].HasTag("anomaly") {
+		t.Errorf("expected an anomaly warning, got %v %v", records[1].Severity, records[1].Tags)
+	}
+	if _, ok := records[3].Get("Account"); ok {
+		t.Errorf("unexpected account on a driver")
+	}
+}
+
+func TestServiceAnomalies(t *testing.T) {
+	for _, tt := range []struct {
+		service serviceInfo
+		want    []string
+	}{
+		{serviceInfo{Name: "Wecsvc", ImagePath: `%SystemRoot%\system32\svchost.exe -k NetworkService`,
+			ServiceDll: `%SystemRoot%\system32\wecsvc.dll`, Type: 0x20, HasType: true}, nil},
+		{serviceInfo{Name: "WinDefend",
+			ImagePath: `"C:\ProgramData\Microsoft\Windows Defender\Platform\4.18.2\MsMpEng.exe"`}, nil},
+		{serviceInfo{Name: "wlms", ImagePath: `C:\Windows\system32\wlms\wlms.exe`}, nil},
+		{serviceInfo{Name: "WerSvc", ImagePath: `%SystemRoot%\System32\svchost.exe -k WerSvcGroup`,
+			ServiceDll: `%SystemRoot%\System32\wersvc.dll`, Type: 0x20, HasType: true}, nil},
+		{serviceInfo{Name: "Sense",
+			ImagePath: `"%ProgramFiles%\Windows Defender Advanced Threat Protection\MsSense.exe"`}, nil},
+		{serviceInfo{Name: "Spoolr", ImagePath: `%SystemRoot%\System32\spoolsv.exe`}, nil},
+		{serviceInfo{Name: "Spoolr", ImagePath: `%SystemRoot%\System32\svchost.exe -k netsvcs`, Type: 0x20,
+			HasType: true, ServiceDll: `C:\Windows\spool.dll`},
+			[]string{"name imitates the Spooler service"}},
+		{serviceInfo{Name: "Updater", ImagePath: `C:\Windows\scvhost.exe`},
+			[]string{"binary name imitates svchost.exe"}},
+		{serviceInfo{Name: "Updater", ImagePath: `C:\Windows\Temp\svchost.exe`, ServiceDll: `C:\x.dll`},
+			[]string{"image in user-writable directory temp", "svchost.exe outside System32"}},
+		{serviceInfo{Name: "Helper", ImagePath: `svchost.exe -k x`, Type: 0x20, HasType: true,
+			ServiceDll: `C:\Users\bob\AppData\Roaming\helper.dll`},
+			[]string{"service DLL in user-writable directory users", "svchost.exe outside System32"}},
+	} {
+		if got := serviceAnomalies(tt.service); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s %s: got %q, want %q", tt.service.Name, tt.service.ImagePath, got, tt.want)
+		}
+	}
+}
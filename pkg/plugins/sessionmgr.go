@@ -1,6 +1,7 @@
 package plugins
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
@@ -25,34 +26,48 @@ func (p *SessionManagerPlugin) CompatibleHiveTypes() []string {
 	return []string{"SYSTEM"}
 }
 
-func (p *SessionManagerPlugin) Run(hive *regf.Hive) error {
-	paths := []string{
-		"ControlSet001\\Control\\Session Manager",
-		"ControlSet002\\Control\\Session Manager",
+func (p *SessionManagerPlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategoryPersistence,
+		Techniques: []string{"T1547.001"},
+		Artifact:   "Session Manager settings such as PendingFileRenameOperations and SetupExecute.",
+		References: []string{regRipperReference},
+		Version:    "1.0.0",
+		Schema: []FieldSpec{
+			{Name: "Name", Type: FieldString, Description: "value name"},
+			{Name: "Value", Type: FieldStrings, Description: "value data"},
+		},
 	}
+}
+
+func (p *SessionManagerPlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
 
-	fmt.Println("Session Manager Configuration")
-	fmt.Println("=============================")
-	fmt.Println()
+func (p *SessionManagerPlugin) Options() []Option {
+	return []Option{controlSetOption}
+}
 
-	for _, path := range paths {
+func (p *SessionManagerPlugin) Collect(hive *regf.Hive, emit Emitter) error {
+	return p.CollectContext(context.Background(), hive, DefaultOptions(p), emit)
+}
+
+func (p *SessionManagerPlugin) CollectContext(ctx context.Context, hive *regf.Hive, opts Options, emit Emitter) error {
+	return forEachControlSet(ctx, hive, opts, emit, func(controlSet string, emit Emitter) error {
+		path := controlSet + "\\Control\\Session Manager"
 		key, err := hive.GetKey(path)
 		if err != nil {
-			continue
+			return fmt.Errorf("session manager key not found: %w", err)
 		}
 
-		fmt.Printf("[%s]\n", path)
-		fmt.Printf("Last Modified: %s\n", key.Timestamp().Format("2006-01-02 15:04:05"))
-
 		for _, val := range key.Values() {
 			if val.Name() == "BootExecute" || val.Name() == "PendingFileRenameOperations" {
-				fmt.Printf("  %s = %s\n", val.Name(), GetValueString(val))
+				emit(NewRecord(path, key).
+					AddString("Name", val.Name()).
+					AddStrings("Value", GetValueStrings(val)))
 			}
 		}
-		fmt.Println()
 
 		return nil
-	}
-
-	return fmt.Errorf("session manager key not found")
+	})
 }
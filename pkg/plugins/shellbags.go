@@ -1,7 +1,13 @@
 package plugins
 
 import (
+	"context"
+	"encoding/binary"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
 )
@@ -25,37 +31,197 @@ func (p *ShellBagsPlugin) CompatibleHiveTypes() []string {
 	return []string{"NTUSER.DAT", "USRCLASS.DAT"}
 }
 
-func (p *ShellBagsPlugin) Run(hive *regf.Hive) error {
-	paths := []string{
-		"Software\\Microsoft\\Windows\\Shell\\Bags",
-		"Software\\Microsoft\\Windows\\Shell\\BagMRU",
-		"Software\\Microsoft\\Windows\\ShellNoRoam\\Bags",
-		"Software\\Microsoft\\Windows\\ShellNoRoam\\BagMRU",
-		"Software\\Classes\\Local Settings\\Software\\Microsoft\\Windows\\Shell\\Bags",
-		"Software\\Classes\\Local Settings\\Software\\Microsoft\\Windows\\Shell\\BagMRU",
+func (p *ShellBagsPlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategoryUserActivity,
+		Techniques: []string{"T1083"},
+		Artifact:   "ShellBags record folders the user browsed in Explorer, including deleted and removable locations.",
+		References: []string{
+			regRipperReference,
+			"https://github.com/libyal/libfwsi/blob/main/documentation/Windows%20Shell%20Item%20format.asciidoc",
+		},
+		Version: "2.1.0",
+		Schema: []FieldSpec{
+			{Name: "Path", Type: FieldString, Description: "reconstructed folder path"},
+			{Name: "Item Type", Type: FieldString, Description: "shell item type of the last path component"},
+			{Name: "Slot", Type: FieldInt, Description: "NodeSlot, the Bags subkey holding the view settings"},
+			{Name: "Bag Last Write", Type: FieldTime, Description: "LastWrite of the Bags subkey, when the view settings last changed"},
+			{Name: "MRU Position", Type: FieldInt, Description: "position among its siblings, 0 being the most recent"},
+			{Name: "Created", Type: FieldTime, Description: "folder creation time from the shell item"},
+			{Name: "Modified", Type: FieldTime, Description: "folder modification time from the shell item"},
+			{Name: "Accessed", Type: FieldTime, Description: "folder access time from the shell item"},
+			{Name: "MFT Entry", Type: FieldInt, Description: "MFT entry number of the folder"},
+			{Name: "MFT Sequence", Type: FieldInt, Description: "MFT sequence number of the folder"},
+		},
 	}
+}
+
+func (p *ShellBagsPlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
+
+// shellBagRoots are the BagMRU trees of NTUSER.DAT (XP and later) and
+// UsrClass.dat (Vista and later).
+var shellBagRoots = []string{
+	"Software\\Microsoft\\Windows\\Shell\\BagMRU",
+	"Software\\Microsoft\\Windows\\ShellNoRoam\\BagMRU",
+	"Local Settings\\Software\\Microsoft\\Windows\\Shell\\BagMRU",
+	"Software\\Classes\\Local Settings\\Software\\Microsoft\\Windows\\Shell\\BagMRU",
+}
+
+// maxShellBagDepth bounds the walk of corrupt or looping BagMRU trees.
+const maxShellBagDepth = 64
+
+// Options is empty; ShellBags is a ContextPlugin so that walking a large
+// tree can be cancelled.
+func (p *ShellBagsPlugin) Options() []Option {
+	return nil
+}
 
-	fmt.Println("ShellBags (Folder Access History)")
-	fmt.Println("==================================")
-	fmt.Println()
+func (p *ShellBagsPlugin) Collect(hive *regf.Hive, emit Emitter) error {
+	return p.CollectContext(context.Background(), hive, DefaultOptions(p), emit)
+}
 
+func (p *ShellBagsPlugin) CollectContext(ctx context.Context, hive *regf.Hive, opts Options, emit Emitter) error {
 	found := false
-	for _, path := range paths {
+	w := &bagWalker{ctx: ctx, emit: emit}
+	for _, path := range shellBagRoots {
 		key, err := hive.GetKey(path)
 		if err != nil {
 			continue
 		}
-
 		found = true
-		fmt.Printf("[%s]\n", path)
-		fmt.Printf("Last Modified: %s\n", key.Timestamp().Format("2006-01-02 15:04:05"))
-		fmt.Printf("Subkeys: %d\n", len(key.Subkeys()))
-		fmt.Println()
+		// Bags is the sibling of BagMRU holding the view settings of each
+		// NodeSlot
+		w.bags, _ = hive.GetKey(strings.TrimSuffix(path, "BagMRU") + "Bags")
+		if err := w.walk(key, path, "", 0); err != nil {
+			return err
+		}
 	}
 
 	if !found {
-		return fmt.Errorf("no ShellBags keys found")
+		return notFound("no ShellBags keys")
 	}
 
+	return partial(w.skipped)
+}
+
+// bagWalker walks the BagMRU tree of one root.
+type bagWalker struct {
+	ctx  context.Context
+	emit Emitter
+	// bags is the Bags key next to the BagMRU root, nil when missing.
+	bags *regf.Key
+	// skipped reports the subtrees below maxShellBagDepth left unwalked.
+	skipped []error
+}
+
+// walk emits a record for every numbered value of a BagMRU key, in
+// MRUListEx order, and descends into the subkey of the same number, which
+// holds the folders below it.
+func (w *bagWalker) walk(key *regf.Key, path, parent string, depth int) error {
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+	if depth >= maxShellBagDepth {
+		if len(bagMRUEntries(key)) == 0 {
+			return nil
+		}
+		w.skipped = append(w.skipped, fmt.Errorf("%s: deeper than %d levels, not walked", path, maxShellBagDepth))
+		return nil
+	}
+
+	subkeys := make(map[string]*regf.Key)
+	for _, sk := range key.Subkeys() {
+		subkeys[sk.Name()] = sk
+	}
+	for _, e := range bagMRUEntries(key) {
+		item := parseShellItem(e.data)
+		folder := joinShellPath(parent, item.Name)
+
+		// The record belongs to the entry's own subkey, whose LastWrite
+		// tells when the folder was last browsed
+		recordKey, recordPath := key, path
+		child, hasChild := subkeys[e.name]
+		if hasChild {
+			recordKey, recordPath = child, path+"\\"+e.name
+		}
+		r := NewRecord(recordPath, recordKey).
+			AddString("Path", folder).
+			AddString("Item Type", item.Type)
+		if hasChild {
+			if v, err := getValue(child, "NodeSlot"); err == nil && len(v.Bytes()) >= 4 {
+				slot := binary.LittleEndian.Uint32(v.Bytes())
+				r.AddInt("Slot", int64(slot))
+				w.addBagTime(r, slot)
+			}
+		}
+		r.AddInt("MRU Position", int64(e.position))
+		for _, t := range []struct {
+			name  string
+			value time.Time
+		}{{"Created", item.Created}, {"Modified", item.Modified}, {"Accessed", item.Accessed}} {
+			if !t.value.IsZero() {
+				r.AddTime(t.name, t.value)
+			}
+		}
+		if item.HasMFT {
+			r.AddInt("MFT Entry", int64(item.MFTEntry)).
+				AddInt("MFT Sequence", int64(item.MFTSequence))
+		}
+		w.emit(r)
+
+		if hasChild {
+			if err := w.walk(child, recordPath, folder, depth+1); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
+
+// addBagTime adds the LastWrite of the Bags subkey of slot.
+func (w *bagWalker) addBagTime(r *Record, slot uint32) {
+	if w.bags == nil {
+		return
+	}
+	bag, err := getSubkey(w.bags, strconv.FormatUint(uint64(slot), 10))
+	if err != nil || bag.Timestamp().IsZero() {
+		return
+	}
+	r.AddTime("Bag Last Write", bag.Timestamp())
+}
+
+// bagMRUEntry is a numbered value of a BagMRU key.
+type bagMRUEntry struct {
+	name     string
+	position int
+	data     []byte
+}
+
+// bagMRUEntries returns the numbered values of key in MRUListEx order.
+// Values missing from the list follow in numeric order.
+func bagMRUEntries(key *regf.Key) []bagMRUEntry {
+	positions := mruPositions(key, OrderMRUListEx)
+	var entries []bagMRUEntry
+	order := make(map[string]int)
+	for _, v := range key.Values() {
+		n, err := strconv.Atoi(v.Name())
+		if err != nil {
+			continue
+		}
+		pos, ok := positions[v.Name()]
+		if !ok {
+			pos = 1<<30 + n
+		}
+		order[v.Name()] = pos
+		entries = append(entries, bagMRUEntry{name: v.Name(), data: v.Bytes()})
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return order[entries[i].name] < order[entries[j].name]
+	})
+	for i := range entries {
+		entries[i].position = i
+	}
+	return entries
+}
@@ -0,0 +1,144 @@
+package plugins
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// shellItemBytes prefixes an item body with its size.
+func shellItemBytes(body ...[]byte) []byte {
+	data := concat(body...)
+	return concat(le16(len(data)+2), data)
+}
+
+// fatBytes encodes a time as a FAT date and time pair.
+func fatBytes(t time.Time) []byte {
+	date := (t.Year()-1980)<<9 | int(t.Month())<<5 | t.Day()
+	clock := t.Hour()<<11 | t.Minute()<<5 | t.Second()/2
+	return concat(le16(date), le16(clock))
+}
+
+// directoryItem builds a file entry item for a directory with a version 9
+// beef0004 extension block.
+func directoryItem(short, long string, modified, created time.Time, mft uint64) []byte {
+	name := append([]byte(short), 0)
+	if len(name)%2 != 0 {
+		name = append(name, 0)
+	}
+	ext := concat(le16(0), le16(9), le32(0xBEEF0004), fatBytes(created), fatBytes(created),
+		le16(0x2E), le16(0), le64(mft|3<<48), le64(0), le16(0), le32(0), le32(0),
+		utf16le(long), le16(0), le16(0x14))
+	binary.LittleEndian.PutUint16(ext, uint16(len(ext)))
+	return shellItemBytes([]byte{0x31, 0}, le32(0), fatBytes(modified), le16(0x10), name, ext)
+}
+
+func mruListEx(order ...int) []byte {
+	var b []byte
+	for _, n := range order {
+		b = append(b, le32(n)...)
+	}
+	return append(b, le32(-1)...)
+}
+
+func TestShellBagsReconstructsPaths(t *testing.T) {
+	modified := time.Date(2022, 6, 7, 8, 9, 10, 0, time.UTC)
+	created := time.Date(2020, 1, 2, 3, 4, 6, 0, time.UTC)
+	myComputer := shellItemBytes([]byte{0x1F, 0x50}, []byte{
+		0xE0, 0x4F, 0xD0, 0x20, 0xEA, 0x3A, 0x69, 0x10, 0xA2, 0xD8, 0x08, 0x00, 0x2B, 0x30, 0x30, 0x9D})
+	drive := shellItemBytes([]byte{0x2F}, []byte("C:\\"), make([]byte, 19))
+
+	bagWritten := time.Date(2023, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	hive := newTestHive(t, key("ROOT", key("Local Settings", key("Software", key("Microsoft", key("Windows", key("Shell",
+		key("Bags", key("7").at(bagWritten)),
+		key("BagMRU",
+			key("0",
+				key("0",
+					key("0").with(dwordValue("NodeSlot", 7)),
+					key("1").with(dwordValue("NodeSlot", 8)),
+				).with(
+					binValue("0", directoryItem("USERS", "Users", modified, created, 1234)),
+					binValue("1", directoryItem("TOOLS~1", "Tools Dir", modified, created, 0)),
+					binValue("MRUListEx", mruListEx(1, 0)),
+				),
+			).with(binValue("0", drive), binValue("MRUListEx", mruListEx(0))),
+		).with(binValue("0", myComputer), binValue("MRUListEx", mruListEx(0))),
+	)))))))
+
+	records, err := Collect(&ShellBagsPlugin{}, hive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{`My Computer`, `My Computer\C:\`, `My Computer\C:\Tools Dir`, `My Computer\C:\Users`}
+	if len(records) != len(want) {
+		t.Fatalf("expected %d records, got %d", len(want), len(records))
+	}
+	for i, r := range records {
+		if f, _ := r.Get("Path"); FormatValue(f) != want[i] {
+			t.Errorf("record %d: path %v, want %s", i, f.Value, want[i])
+		}
+	}
+
+	users := records[3]
+	for name, value := range map[string]string{
+		"Item Type":      ShellItemDirectory,
+		"Slot":           "7",
+		"Bag Last Write": FormatTime(bagWritten),
+		"MRU Position":   "1",
+		"Modified":       FormatTime(modified),
+		"Created":        FormatTime(created),
+		"MFT Entry":      "1234",
+		"MFT Sequence":   "3",
+	} {
+		if f, ok := users.Get(name); !ok || FormatValue(f) != value {
+			t.Errorf("Users: %s = %v, want %s", name, f.Value, value)
+		}
+	}
+	if users.KeyPath != `Local Settings\Software\Microsoft\Windows\Shell\BagMRU\0\0\0` {
+		t.Errorf("unexpected key path %s", users.KeyPath)
+	}
+	if _, ok := records[2].Get("Bag Last Write"); ok {
+		t.Errorf("unexpected bag time for slot 8 without a Bags key")
+	}
+}
+
+func TestShellBagsReportsTruncatedTrees(t *testing.T) {
+	folder := directoryItem("DEEP", "Deep", time.Time{}, time.Time{}, 0)
+	level := key("0").with(binValue("0", folder))
+	for i := 0; i < maxShellBagDepth; i++ {
+		level = key("0", level).with(binValue("0", folder), binValue("MRUListEx", mruListEx(0)))
+	}
+	level.name = "BagMRU"
+	hive := newTestHive(t, key("ROOT", key("Software", key("Microsoft", key("Windows", key("Shell", level))))))
+
+	records, err := Collect(&ShellBagsPlugin{}, hive)
+	if StatusOf(err) != StatusPartial {
+		t.Fatalf("expected partial results, got %v", err)
+	}
+	if len(records) != maxShellBagDepth {
+		t.Errorf("expected %d records, got %d", maxShellBagDepth, len(records))
+	}
+}
+
+func TestParseShellItemTypes(t *testing.T) {
+	guid := []byte{0x20, 0x20, 0xEC, 0x21, 0xEA, 0x3A, 0x69, 0x10, 0xA2, 0xDD, 0x08, 0x00, 0x2B, 0x30, 0x30, 0x9D}
+	zipName := utf16le(`docs\2023`)
+	tests := []struct {
+		data     []byte
+		itemType string
+		name     string
+	}{
+		{shellItemBytes([]byte{0x41, 0, 0x01}, []byte(`\\server\share`), []byte{0}), ShellItemNetwork, `\\server\share`},
+		{shellItemBytes([]byte{0x61, 0x80}, le16(0), utf16le("ftp://example.org"), le16(0)), ShellItemURI, "ftp://example.org"},
+		{shellItemBytes([]byte{0x71, 0}, make([]byte, 10), guid), ShellItemControlPanel, "Control Panel Items"},
+		{shellItemBytes([]byte{0x52, 0}, make([]byte, 0x20), le32(len(zipName)/2), le32(0), zipName), ShellItemZIP, `docs\2023`},
+		{shellItemBytes([]byte{0x32, 0}, le32(10), le32(0), le16(0x20), []byte("A.TXT\x00")), ShellItemFile, "A.TXT"},
+	}
+	for _, tt := range tests {
+		item := parseShellItem(tt.data)
+		if item.Type != tt.itemType || item.Name != tt.name {
+			t.Errorf("got %s %q, want %s %q", item.Type, item.Name, tt.itemType, tt.name)
+		}
+	}
+}
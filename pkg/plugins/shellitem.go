@@ -0,0 +1,322 @@
+package plugins
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Shell item types reported in the Item Type field.
+const (
+	ShellItemRoot         = "Root Folder"
+	ShellItemVolume       = "Volume"
+	ShellItemDirectory    = "Directory"
+	ShellItemFile         = "File"
+	ShellItemNetwork      = "Network Location"
+	ShellItemURI          = "URI"
+	ShellItemControlPanel = "Control Panel"
+	ShellItemZIP          = "ZIP Contents"
+	ShellItemMTP          = "MTP Device"
+	ShellItemDelegate     = "Delegate"
+	ShellItemUnknown      = "Unknown"
+)
+
+// shellItem is one decoded shell item, a component of an ITEMIDLIST as
+// stored in ShellBags, ComDlg32 MRUs and shortcuts.
+type shellItem struct {
+	Type     string
+	Name     string
+	Created  time.Time
+	Modified time.Time
+	Accessed time.Time
+	// MFT entry and sequence number of the file, from beef0004 extension
+	// blocks of version 7 and later.
+	MFTEntry    uint64
+	MFTSequence uint16
+	HasMFT      bool
+}
+
+// shellFolders names the GUIDs of shell folders that appear as root and
+// GUID items. KnownFolder IDs are looked up as well.
+var shellFolders = map[string]string{
+	"{20D04FE0-3AEA-1069-A2D8-08002B30309D}": "My Computer",
+	"{450D8FBA-AD25-11D0-98A8-0800361B1103}": "My Documents",
+	"{59031A47-3F72-44A7-89C5-5595FE6B30EE}": "Users Files",
+	"{208D2C60-3AEA-1069-A2D7-08002B30309D}": "My Network Places",
+	"{F02C1A0D-BE21-4350-88B0-7367FC96EF3C}": "Network",
+	"{645FF040-5081-101B-9F08-00AA002F954E}": "Recycle Bin",
+	"{26EE0668-A00A-44D7-9371-BEB064C98683}": "Control Panel",
+	"{21EC2020-3AEA-1069-A2DD-08002B30309D}": "Control Panel Items",
+	"{031E4825-7B94-4DC3-B131-E946B44C8DD5}": "Libraries",
+	"{22877A6D-37A1-461A-91B0-DBDA5AAEBC99}": "Recent Places",
+	"{679F85CB-0220-4080-B29B-5540CC05AAB6}": "Quick Access",
+	"{018D5C66-4533-4307-9B53-224DE2ED1FE6}": "OneDrive",
+	"{9343812E-1C37-4A49-A12E-4B2D810D956B}": "Search Home",
+	"{088E3905-0323-4B02-9826-5D99428E115F}": "Downloads",
+	"{D3162B92-9365-467A-956B-92703ACA08AF}": "Documents",
+	"{24AD3AD4-A569-4530-98E1-AB02F9417AA8}": "Pictures",
+	"{3DFDF296-DBEC-4FB4-81D1-6A3438BCF4DE}": "Music",
+	"{F86FA3AB-70D2-4FC7-9C99-FCBF05467F3A}": "Videos",
+	"{0DB7E03F-FC29-4DC6-9020-FF41B59E513A}": "3D Objects",
+	"{B4BFCC3A-DB2C-424C-B029-7FE99A87C641}": "Desktop",
+	"{5E6C858F-0E22-4760-9AFE-EA3317B67173}": "User Profile",
+}
+
+// shellFolderName names a shell folder GUID, falling back to the GUID.
+func shellFolderName(guid string) string {
+	if name, ok := shellFolders[guid]; ok {
+		return name
+	}
+	if f, ok := lookupKnownFolder(guid); ok {
+		return f.Name
+	}
+	return guid
+}
+
+// mtpSignature marks the property store of MTP (phone and camera) items.
+const mtpSignature = 0x10312005
+
+// parseShellItem decodes a shell item, including its leading size. Items
+// it cannot decode keep their type and the best name found.
+func parseShellItem(data []byte) shellItem {
+	item := shellItem{Type: ShellItemUnknown}
+	if len(data) < 3 {
+		return item
+	}
+	class := data[2]
+	switch {
+	case class == 0x1F:
+		item.Type = ShellItemRoot
+		if len(data) >= 20 {
+			item.Name = shellFolderName(formatGUID(data[4:20]))
+		}
+	case class == 0x2E && len(data) >= 20:
+		// Shell folder inside My Computer, identified by GUID
+		item.Type = ShellItemRoot
+		item.Name = shellFolderName(formatGUID(data[4:20]))
+	case class&0x70 == 0x20:
+		item.Type = ShellItemVolume
+		item.Name = asciiString(data[3:])
+		if item.Name == "" && len(data) >= 20 {
+			// MTP and phone volumes carry a GUID and a UTF-16 name
+			item.Type = ShellItemMTP
+			item.Name = scanUTF16Name(data, 4)
+		}
+	case class&0x70 == 0x30:
+		parseFileEntry(data, class, &item)
+	case class&0x70 == 0x40:
+		item.Type = ShellItemNetwork
+		if len(data) > 5 {
+			item.Name = asciiString(data[5:])
+		}
+	case class == 0x52:
+		item.Type = ShellItemZIP
+		item.Name = zipItemName(data)
+	case class == 0x61:
+		item.Type = ShellItemURI
+		item.Name = uriItemName(data)
+	case class == 0x71:
+		item.Type = ShellItemControlPanel
+		if len(data) >= 30 {
+			item.Name = shellFolderName(formatGUID(data[14:30]))
+		}
+	case class == 0x00 && len(data) >= 10 && binary.LittleEndian.Uint32(data[6:]) == mtpSignature:
+		item.Type = ShellItemMTP
+		item.Name = scanUTF16Name(data, 0x26)
+	case class == 0x74 || class == 0x00:
+		// Delegate items wrap a file entry: its extension block names it
+		item.Type = ShellItemDelegate
+		if ext, ok := findBeef0004(data); ok {
+			item.Type = ShellItemDirectory
+			applyBeef0004(ext, &item)
+		}
+	}
+	if item.Type == ShellItemUnknown {
+		item.Type = fmt.Sprintf("%s (0x%02X)", ShellItemUnknown, class)
+	}
+	return item
+}
+
+// parseFileEntry decodes a file entry item: size, FAT modification time,
+// attributes and the short name, followed by a beef0004 extension block
+// holding the long name and the creation and access times.
+func parseFileEntry(data []byte, class byte, item *shellItem) {
+	item.Type = ShellItemFile
+	if class&0x01 != 0 {
+		item.Type = ShellItemDirectory
+	}
+	if len(data) < 14 {
+		return
+	}
+	item.Modified = fatTime(data[8:12])
+
+	// The short name is NUL-terminated and padded to an even offset
+	var end int
+	if class&0x04 != 0 {
+		item.Name = utf16String(data[14:])
+		end = 14
+		for end+1 < len(data) && (data[end] != 0 || data[end+1] != 0) {
+			end += 2
+		}
+		end += 2
+	} else {
+		item.Name = asciiString(data[14:])
+		end = 14 + len(item.Name) + 1
+	}
+	if end%2 != 0 {
+		end++
+	}
+	if end < len(data) {
+		if ext, ok := findBeef0004(data[end:]); ok {
+			applyBeef0004(ext, item)
+		}
+	}
+}
+
+// findBeef0004 returns the beef0004 extension block found in data.
+func findBeef0004(data []byte) ([]byte, bool) {
+	i := bytes.Index(data, []byte{0x04, 0x00, 0xEF, 0xBE})
+	if i < 4 {
+		return nil, false
+	}
+	block := data[i-4:]
+	size := int(binary.LittleEndian.Uint16(block))
+	if size < 18 || size > len(block) {
+		return nil, false
+	}
+	return block[:size], true
+}
+
+// applyBeef0004 copies the times, MFT reference and long name of a
+// beef0004 extension block into item. The long name moves as fields were
+// added: it starts at 0x14 in versions 3 to 6, 0x26 in 7, 0x2A in 8 and
+// 0x2E from 9.
+func applyBeef0004(ext []byte, item *shellItem) {
+	version := binary.LittleEndian.Uint16(ext[2:])
+	item.Created = fatTime(ext[8:12])
+	item.Accessed = fatTime(ext[12:16])
+
+	nameOffset := 0
+	switch {
+	case version >= 9:
+		nameOffset = 0x2E
+	case version == 8:
+		nameOffset = 0x2A
+	case version == 7:
+		nameOffset = 0x26
+	case version >= 3:
+		nameOffset = 0x14
+	}
+	if version >= 7 && len(ext) >= 28 {
+		ref := binary.LittleEndian.Uint64(ext[20:])
+		item.MFTEntry = ref & 0xFFFFFFFFFFFF
+		item.MFTSequence = uint16(ref >> 48)
+		item.HasMFT = item.MFTEntry != 0
+	}
+	if nameOffset > 0 && nameOffset < len(ext) {
+		if name := utf16String(ext[nameOffset:]); name != "" {
+			item.Name = name
+		}
+	}
+}
+
+// zipItemName reads the path of an item inside a ZIP file. Its length in
+// characters is stored at 0x24 and the name follows at 0x2C.
+func zipItemName(data []byte) string {
+	if len(data) >= 0x2C {
+		n := int(binary.LittleEndian.Uint32(data[0x24:]))
+		if n > 0 && 0x2C+2*n <= len(data) {
+			return utf16String(data[0x2C : 0x2C+2*n])
+		}
+	}
+	return scanUTF16Name(data, 4)
+}
+
+// uriItemName reads the URI of a URI item, UTF-16 when flag 0x80 is set.
+// Items with extra data store the string after a 38 byte header and its
+// size.
+func uriItemName(data []byte) string {
+	if len(data) < 6 {
+		return ""
+	}
+	unicodeName := data[3]&0x80 != 0
+	offset := 6
+	if binary.LittleEndian.Uint16(data[4:]) > 0 {
+		offset = 42
+	}
+	if offset >= len(data) {
+		return ""
+	}
+	if unicodeName {
+		return utf16String(data[offset:])
+	}
+	return asciiString(data[offset:])
+}
+
+// scanUTF16Name returns the first UTF-16 string of at least two printable
+// characters at or after from. It is used for items whose layout varies.
+func scanUTF16Name(data []byte, from int) string {
+	for i := from; i+4 <= len(data); i += 2 {
+		name := utf16String(data[i:])
+		if len([]rune(name)) >= 2 && strings.IndexFunc(name, func(r rune) bool { return !unicode.IsPrint(r) }) < 0 {
+			return name
+		}
+	}
+	return ""
+}
+
+// asciiString reads a NUL-terminated single-byte string.
+func asciiString(data []byte) string {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		data = data[:i]
+	}
+	return string(data)
+}
+
+// fatTime decodes a FAT date and time pair (date first) as stored in shell
+// items. Shell items store them in UTC.
+func fatTime(b []byte) time.Time {
+	date := binary.LittleEndian.Uint16(b)
+	clock := binary.LittleEndian.Uint16(b[2:])
+	if date == 0 {
+		return time.Time{}
+	}
+	day, month, year := int(date&0x1F), int(date>>5&0x0F), int(date>>9)+1980
+	if day == 0 || month == 0 || month > 12 {
+		return time.Time{}
+	}
+	return time.Date(year, time.Month(month), day,
+		int(clock>>11), int(clock>>5&0x3F), int(clock&0x1F)*2, 0, time.UTC)
+}
+
+// parseIDList decodes the shell items of an ITEMIDLIST, which ends with an
+// item of size 0, and joins their names into a path.
+func parseIDList(data []byte) (string, []shellItem) {
+	var path string
+	var items []shellItem
+	for len(data) >= 2 {
+		size := int(binary.LittleEndian.Uint16(data))
+		if size < 3 || size > len(data) {
+			break
+		}
+		item := parseShellItem(data[:size])
+		path = joinShellPath(path, item.Name)
+		items = append(items, item)
+		data = data[size:]
+	}
+	return path, items
+}
+
+// joinShellPath appends a shell item name to the path of its parent.
+func joinShellPath(parent, name string) string {
+	switch {
+	case parent == "":
+		return name
+	case strings.HasSuffix(parent, `\`):
+		return parent + name
+	}
+	return parent + `\` + name
+}
@@ -1,9 +1,11 @@
 package plugins
 
 import (
+	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
-	"strings"
+	"time"
 
 	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
 )
@@ -13,7 +15,7 @@ func init() {
 }
 
 // ShimCachePlugin displays Application Compatibility Cache (ShimCache) entries.
-// Based on RegRipper's shimcache.pl plugin.
+// Based on RegRipper's appcompatcache.pl plugin and Mandiant's ShimCacheParser.
 type ShimCachePlugin struct{}
 
 func (p *ShimCachePlugin) Name() string {
@@ -28,63 +30,370 @@ func (p *ShimCachePlugin) CompatibleHiveTypes() []string {
 	return []string{"SYSTEM"}
 }
 
-func (p *ShimCachePlugin) Run(hive *regf.Hive) error {
-	// Find current ControlSet
-	controlSetName, err := p.findCurrentControlSet(hive)
-	if err != nil {
-		return fmt.Errorf("failed to find current controlset: %w", err)
+func (p *ShimCachePlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategoryExecution,
+		Techniques: []string{"T1204.002"},
+		Artifact:   "The Application Compatibility Cache (ShimCache) lists executables seen by the system with their file modification times.",
+		References: []string{
+			regRipperReference,
+			"https://github.com/mandiant/ShimCacheParser",
+		},
+		Version: "2.0.0",
+		Schema: []FieldSpec{
+			{Name: "Position", Type: FieldInt, Description: "position in the cache, 0 being the most recent"},
+			{Name: "Path", Type: FieldString, Description: "path of the executable"},
+			{Name: "Modified", Type: FieldTime, Description: "last modification time of the file"},
+			{Name: "Executed", Type: FieldBool, Description: "CSRSS insert flag set (XP to 8.1 only)"},
+			{Name: "Data Size", Type: FieldInt, Description: "size of the shim data stored with the entry (7 and later)"},
+			{Name: "File Size", Type: FieldInt, Description: "size of the file (XP and 2003 only)"},
+			{Name: "Last Update", Type: FieldTime, Description: "time the entry was updated (XP only)"},
+			{Name: "Format", Type: FieldString, Description: "Windows version of the cache format"},
+		},
 	}
+}
 
-	// Path to AppCompatCache
-	path := fmt.Sprintf("%s/Control/Session Manager/AppCompatCache", controlSetName)
-	key, err := hive.GetKey(path)
-	if err != nil {
-		return fmt.Errorf("appcompatcache key not found: %w", err)
-	}
+func (p *ShimCachePlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
 
-	fmt.Printf("AppCompatCache entries from %s:\n", path)
-	fmt.Println(strings.Repeat("=", 80))
+// Options reads every control set by default: a non-current set often
+// holds a cache from before the last reboot.
+func (p *ShimCachePlugin) Options() []Option {
+	opt := controlSetOption
+	opt.Default = "all"
+	return []Option{opt}
+}
 
-	// Get AppCompatCache value
-	for _, val := range key.Values() {
-		if val.Name() == "AppCompatCache" {
-			data := val.Bytes()
-			fmt.Printf("\nFound AppCompatCache data (%d bytes)\n", len(data))
+func (p *ShimCachePlugin) Collect(hive *regf.Hive, emit Emitter) error {
+	return p.CollectContext(context.Background(), hive, DefaultOptions(p), emit)
+}
 
-			if len(data) < 16 {
-				fmt.Println("Data too small to parse")
-				return nil
+func (p *ShimCachePlugin) CollectContext(ctx context.Context, hive *regf.Hive, opts Options, emit Emitter) error {
+	return forEachControlSet(ctx, hive, opts, emit, func(controlSetName string, emit Emitter) error {
+		// XP keeps the cache under AppCompatibility, later versions under
+		// AppCompatCache
+		var key *regf.Key
+		var path string
+		for _, name := range []string{"AppCompatCache", "AppCompatibility"} {
+			path = controlSetName + `\Control\Session Manager\` + name
+			if k, err := hive.GetKey(path); err == nil {
+				key = k
+				break
 			}
+		}
+		if key == nil {
+			return notFound("no AppCompatCache key")
+		}
 
-			// Parse header (varies by Windows version)
-			// This is a simplified parser
-			if len(data) >= 4 {
-				signature := binary.LittleEndian.Uint32(data[0:4])
-				fmt.Printf("Signature: 0x%08x\n", signature)
+		val, err := getValue(key, "AppCompatCache")
+		if err != nil {
+			return notFound("no AppCompatCache value")
+		}
 
-				// Note: Full ShimCache parsing is complex and version-dependent
-				// This is a basic implementation showing the concept
-				fmt.Println("\nNote: Full ShimCache parsing requires version-specific logic.")
-				fmt.Println("Data is present but detailed parsing not fully implemented.")
+		cache, err := parseShimCache(val.Bytes())
+		for _, e := range cache.entries {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			r := NewRecord(path, key).
+				AddInt("Position", int64(e.position)).
+				AddString("Path", e.path).
+				AddTime("Modified", e.modified)
+			if e.hasExecuted {
+				r.AddBool("Executed", e.executed)
+			}
+			if e.hasDataSize {
+				r.AddInt("Data Size", e.dataSize)
+			}
+			if e.hasFileSize {
+				r.AddInt("File Size", e.fileSize)
+			}
+			if !e.lastUpdate.IsZero() {
+				r.AddTime("Last Update", e.lastUpdate)
 			}
+			emit(r.AddString("Format", cache.format).WithTags("execution"))
+		}
+		if err != nil && len(cache.entries) > 0 {
+			return partial([]error{err})
+		}
+		return err
+	})
+}
+
+// ShimCache signatures. Windows 8 and later store the header size in the
+// first DWORD and tag every entry.
+const (
+	shimCacheXPMagic     = 0xdeadbeef
+	shimCacheVistaMagic  = 0xbadc0ffe // also Server 2003
+	shimCacheWin7Magic   = 0xbadc0fee
+	shimCacheWin8Header  = 0x80
+	shimCacheWin10Header = 0x30
+	shimCacheWin11Header = 0x34 // Windows 10 Creators Update and later
+
+	shimCacheInsertExecuted = 0x2 // CSRSS executed the file
+)
+
+// errShimCacheTruncated is reported when the cache ends inside an entry.
+var errShimCacheTruncated = errors.New("truncated ShimCache entry")
+
+// shimEntry is one decoded ShimCache entry.
+type shimEntry struct {
+	position    int
+	path        string
+	modified    time.Time
+	executed    bool
+	hasExecuted bool
+	dataSize    int64
+	hasDataSize bool
+	fileSize    int64
+	hasFileSize bool
+	lastUpdate  time.Time
+}
+
+// shimCache is a decoded AppCompatCache value, entries in cache order.
+type shimCache struct {
+	format  string
+	entries []shimEntry
+}
+
+// parseShimCache decodes an AppCompatCache value. On a truncated or
+// inconsistent cache it returns the entries read so far with an error.
+func parseShimCache(data []byte) (shimCache, error) {
+	if len(data) < 8 {
+		return shimCache{}, fmt.Errorf("AppCompatCache value too short (%d bytes)", len(data))
+	}
+	magic := binary.LittleEndian.Uint32(data)
+	switch {
+	case magic == shimCacheXPMagic:
+		return parseShimCacheXP(data)
+	case magic == shimCacheVistaMagic:
+		return parseShimCacheVista(data)
+	case magic == shimCacheWin7Magic:
+		return parseShimCacheWin7(data)
+	case magic == shimCacheWin8Header && len(data) >= shimCacheWin8Header+4:
+		switch string(data[shimCacheWin8Header : shimCacheWin8Header+4]) {
+		case "00ts":
+			return parseShimCacheTagged(data, shimCacheWin8Header, "Windows 8")
+		case "10ts":
+			return parseShimCacheTagged(data, shimCacheWin8Header, "Windows 8.1")
+		}
+	case magic == shimCacheWin10Header || magic == shimCacheWin11Header:
+		return parseShimCacheTagged(data, int(magic), "Windows 10/11")
+	}
+	return shimCache{}, fmt.Errorf("unknown AppCompatCache format 0x%08x", magic)
+}
+
+// parseShimCacheXP decodes the Windows XP 32-bit cache: a 0x190 byte
+// header followed by fixed 552 byte entries holding the path inline.
+func parseShimCacheXP(data []byte) (shimCache, error) {
+	const headerSize, entrySize = 0x190, 552
+	cache := shimCache{format: "Windows XP"}
+	count := int(binary.LittleEndian.Uint32(data[4:]))
+	for i := 0; i < count; i++ {
+		off := headerSize + i*entrySize
+		if off+entrySize > len(data) {
+			return cache, errShimCacheTruncated
+		}
+		e := data[off : off+entrySize]
+		cache.entries = append(cache.entries, shimEntry{
+			position:    i,
+			path:        utf16String(e[:528]),
+			modified:    filetimeToTime(binary.LittleEndian.Uint64(e[528:])),
+			fileSize:    int64(binary.LittleEndian.Uint64(e[536:])),
+			hasFileSize: true,
+			lastUpdate:  filetimeToTime(binary.LittleEndian.Uint64(e[544:])),
+		})
+	}
+	return cache, nil
+}
+
+// shimPath reads a path stored as a UNICODE_STRING length and an offset
+// from the start of the value.
+func shimPath(data []byte, length int, offset uint64) (string, error) {
+	if offset > uint64(len(data)) || uint64(length) > uint64(len(data))-offset {
+		return "", errShimCacheTruncated
+	}
+	return utf16String(data[offset : offset+uint64(length)]), nil
+}
+
+// shimCacheIs64 tells 64-bit from 32-bit entries: in a 64-bit entry the
+// path pointer is 8 byte aligned, leaving zero padding after the lengths.
+func shimCacheIs64(entry []byte) bool {
+	return binary.LittleEndian.Uint32(entry[4:]) == 0
+}
+
+// parseShimCacheVista decodes the Server 2003 and Vista/2008 caches, which
+// share a signature. 2003 stores the file size where Vista stores the
+// insert and shim flags; a flags field never exceeds a few bits.
+func parseShimCacheVista(data []byte) (shimCache, error) {
+	const headerSize = 8
+	count := int(binary.LittleEndian.Uint32(data[4:]))
+	if count == 0 || len(data) < headerSize+24 {
+		return shimCache{format: "Windows Vista/2008"}, nil
+	}
+	entrySize, pathOff, restOff := 24, 4, 8
+	if shimCacheIs64(data[headerSize:]) {
+		entrySize, pathOff, restOff = 32, 8, 16
+	}
+
+	vista := true
+	for i := 0; i < count; i++ {
+		off := headerSize + i*entrySize
+		if off+entrySize > len(data) {
+			break
+		}
+		if binary.LittleEndian.Uint32(data[off+restOff+8:]) > 0x3 {
+			vista = false
+			break
 		}
 	}
 
-	return nil
+	cache := shimCache{format: "Windows Vista/2008"}
+	if !vista {
+		cache.format = "Windows Server 2003"
+	}
+	for i := 0; i < count; i++ {
+		off := headerSize + i*entrySize
+		if off+entrySize > len(data) {
+			return cache, errShimCacheTruncated
+		}
+		e := data[off : off+entrySize]
+		offset := uint64(binary.LittleEndian.Uint32(e[pathOff:]))
+		if entrySize == 32 {
+			offset = binary.LittleEndian.Uint64(e[pathOff:])
+		}
+		path, err := shimPath(data, int(binary.LittleEndian.Uint16(e)), offset)
+		if err != nil {
+			return cache, err
+		}
+		entry := shimEntry{
+			position: i,
+			path:     path,
+			modified: filetimeToTime(binary.LittleEndian.Uint64(e[restOff:])),
+		}
+		if vista {
+			entry.executed = binary.LittleEndian.Uint32(e[restOff+8:])&shimCacheInsertExecuted != 0
+			entry.hasExecuted = true
+		} else {
+			entry.fileSize = int64(binary.LittleEndian.Uint64(e[restOff+8:]))
+			entry.hasFileSize = true
+		}
+		cache.entries = append(cache.entries, entry)
+	}
+	return cache, nil
 }
 
-func (p *ShimCachePlugin) findCurrentControlSet(hive *regf.Hive) (string, error) {
-	selectKey, err := hive.GetKey("Select")
-	if err != nil {
-		return "", err
+// parseShimCacheWin7 decodes the Windows 7/2008 R2 cache: a 0x80 byte
+// header followed by entries pointing at their path and shim data.
+func parseShimCacheWin7(data []byte) (shimCache, error) {
+	const headerSize = 0x80
+	cache := shimCache{format: "Windows 7/2008 R2"}
+	count := int(binary.LittleEndian.Uint32(data[4:]))
+	if count == 0 || len(data) < headerSize+32 {
+		return cache, nil
+	}
+	entrySize, pathOff, restOff := 32, 4, 8
+	is64 := shimCacheIs64(data[headerSize:])
+	if is64 {
+		entrySize, pathOff, restOff = 48, 8, 16
+	}
+
+	for i := 0; i < count; i++ {
+		off := headerSize + i*entrySize
+		if off+entrySize > len(data) {
+			return cache, errShimCacheTruncated
+		}
+		e := data[off : off+entrySize]
+		offset := uint64(binary.LittleEndian.Uint32(e[pathOff:]))
+		dataSize := int64(binary.LittleEndian.Uint32(e[restOff+16:]))
+		if is64 {
+			offset = binary.LittleEndian.Uint64(e[pathOff:])
+			dataSize = int64(binary.LittleEndian.Uint64(e[restOff+16:]))
+		}
+		path, err := shimPath(data, int(binary.LittleEndian.Uint16(e)), offset)
+		if err != nil {
+			return cache, err
+		}
+		cache.entries = append(cache.entries, shimEntry{
+			position:    i,
+			path:        path,
+			modified:    filetimeToTime(binary.LittleEndian.Uint64(e[restOff:])),
+			executed:    binary.LittleEndian.Uint32(e[restOff+8:])&shimCacheInsertExecuted != 0,
+			hasExecuted: true,
+			dataSize:    dataSize,
+			hasDataSize: true,
+		})
 	}
+	return cache, nil
+}
+
+// parseShimCacheTagged decodes the Windows 8 and later caches, where each
+// entry starts with a "00ts" or "10ts" tag and its length. Windows 8.1
+// adds a package name after the path; Windows 10 drops the insert flags.
+func parseShimCacheTagged(data []byte, headerSize int, format string) (shimCache, error) {
+	cache := shimCache{format: format}
+	win8 := headerSize == shimCacheWin8Header
+	withPackage := format == "Windows 8.1"
+
+	for off := headerSize; off < len(data); {
+		if off+12 > len(data) {
+			return cache, errShimCacheTruncated
+		}
+		tag := string(data[off : off+4])
+		if tag != "00ts" && tag != "10ts" {
+			return cache, fmt.Errorf("unexpected ShimCache entry tag %q at 0x%x", tag, off)
+		}
+		size := int(binary.LittleEndian.Uint32(data[off+8:]))
+		if size > len(data)-off-12 {
+			return cache, errShimCacheTruncated
+		}
+		e := data[off+12 : off+12+size]
+		off += 12 + size
 
-	for _, val := range selectKey.Values() {
-		if val.Name() == "Current" && len(val.Bytes()) >= 4 {
-			current := binary.LittleEndian.Uint32(val.Bytes()[:4])
-			return fmt.Sprintf("ControlSet%03d", current), nil
+		entry, ok := parseShimTaggedEntry(e, win8, withPackage)
+		if !ok {
+			return cache, errShimCacheTruncated
 		}
+		entry.position = len(cache.entries)
+		cache.entries = append(cache.entries, entry)
 	}
+	return cache, nil
+}
 
-	return "", fmt.Errorf("current value not found in select key")
+// parseShimTaggedEntry decodes the body of a tagged entry.
+func parseShimTaggedEntry(e []byte, win8, withPackage bool) (shimEntry, bool) {
+	var entry shimEntry
+	if len(e) < 2 {
+		return entry, false
+	}
+	pathLen := int(binary.LittleEndian.Uint16(e))
+	pos := 2 + pathLen
+	if pos > len(e) {
+		return entry, false
+	}
+	entry.path = utf16String(e[2:pos])
+
+	if withPackage {
+		if pos+2 > len(e) {
+			return entry, false
+		}
+		pos += 2 + int(binary.LittleEndian.Uint16(e[pos:]))
+	}
+	if win8 {
+		// Insert flags and shim flags precede the time
+		if pos+8 > len(e) {
+			return entry, false
+		}
+		entry.executed = binary.LittleEndian.Uint32(e[pos:])&shimCacheInsertExecuted != 0
+		entry.hasExecuted = true
+		pos += 8
+	}
+	if pos+12 > len(e) {
+		return entry, false
+	}
+	entry.modified = filetimeToTime(binary.LittleEndian.Uint64(e[pos:]))
+	entry.dataSize = int64(binary.LittleEndian.Uint32(e[pos+8:]))
+	entry.hasDataSize = true
+	return entry, true
 }
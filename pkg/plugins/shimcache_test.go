@@ -0,0 +1,214 @@
+package plugins
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+var shimTime = time.Date(2021, 3, 4, 5, 6, 7, 123456700, time.UTC)
+
+func le16(n int) []byte { return binary.LittleEndian.AppendUint16(nil, uint16(n)) }
+func le32(n int) []byte { return binary.LittleEndian.AppendUint32(nil, uint32(n)) }
+func le64(n uint64) []byte {
+	return binary.LittleEndian.AppendUint64(nil, n)
+}
+
+func concat(parts ...[]byte) []byte {
+	var b []byte
+	for _, p := range parts {
+		b = append(b, p...)
+	}
+	return b
+}
+
+// taggedShimCache builds a Windows 8+ cache from entry bodies.
+func taggedShimCache(headerSize int, tag string, bodies ...[]byte) []byte {
+	data := make([]byte, headerSize)
+	binary.LittleEndian.PutUint32(data, uint32(headerSize))
+	for _, body := range bodies {
+		data = append(data, concat([]byte(tag), le32(0), le32(len(body)), body)...)
+	}
+	return data
+}
+
+// indexedShimCache builds a Vista or Windows 7 cache whose entries point at
+// paths stored after the entry table.
+func indexedShimCache(magic uint32, headerSize int, is64 bool, tail func(i int) []byte, paths ...string) []byte {
+	var table, pool []byte
+	entrySize := 8 + len(tail(0))
+	if is64 {
+		entrySize += 8
+	}
+	base := headerSize + entrySize*len(paths)
+	for i, p := range paths {
+		name := utf16le(p)
+		offset := base + len(pool)
+		if is64 {
+			table = append(table, concat(le16(len(name)), le16(len(name)), le32(0), le64(uint64(offset)), tail(i))...)
+		} else {
+			table = append(table, concat(le16(len(name)), le16(len(name)), le32(offset), tail(i))...)
+		}
+		pool = append(pool, name...)
+	}
+	header := make([]byte, headerSize)
+	binary.LittleEndian.PutUint32(header, magic)
+	binary.LittleEndian.PutUint32(header[4:], uint32(len(paths)))
+	return concat(header, table, pool)
+}
+
+func TestParseShimCache(t *testing.T) {
+	ft := le64(filetime(shimTime))
+	win10Body := func(path string, dataLen int) []byte {
+		name := utf16le(path)
+		return concat(le16(len(name)), name, ft, le32(dataLen), make([]byte, dataLen))
+	}
+	win81Body := func(path string, flags int) []byte {
+		name, pkg := utf16le(path), utf16le("pkg")
+		return concat(le16(len(name)), name, le16(len(pkg)), pkg, le32(flags), le32(0), ft, le32(0))
+	}
+	xpEntry := func(path string) []byte {
+		e := make([]byte, 552)
+		copy(e, utf16le(path))
+		copy(e[528:], ft)
+		copy(e[536:], le64(4096))
+		return e
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		format   string
+		paths    []string
+		executed []bool
+		dataSize bool
+	}{
+		{
+			name:     "Windows 10",
+			data:     taggedShimCache(shimCacheWin11Header, "10ts", win10Body(`C:\a.exe`, 4), win10Body(`C:\b.exe`, 0)),
+			format:   "Windows 10/11",
+			paths:    []string{`C:\a.exe`, `C:\b.exe`},
+			dataSize: true,
+		},
+		{
+			name:     "Windows 8.1",
+			data:     taggedShimCache(shimCacheWin8Header, "10ts", win81Body(`C:\a.exe`, 2), win81Body(`C:\b.exe`, 0)),
+			format:   "Windows 8.1",
+			paths:    []string{`C:\a.exe`, `C:\b.exe`},
+			executed: []bool{true, false},
+			dataSize: true,
+		},
+		{
+			name: "Windows 7 64-bit",
+			data: indexedShimCache(shimCacheWin7Magic, 0x80, true, func(i int) []byte {
+				return concat(ft, le32(2-2*i), le32(0), le64(0), le64(0))
+			}, `C:\a.exe`, `C:\b.exe`),
+			format:   "Windows 7/2008 R2",
+			paths:    []string{`C:\a.exe`, `C:\b.exe`},
+			executed: []bool{true, false},
+			dataSize: true,
+		},
+		{
+			name: "Windows 7 32-bit",
+			data: indexedShimCache(shimCacheWin7Magic, 0x80, false, func(i int) []byte {
+				return concat(ft, le32(0), le32(0), le32(0), le32(0))
+			}, `C:\a.exe`),
+			format:   "Windows 7/2008 R2",
+			paths:    []string{`C:\a.exe`},
+			executed: []bool{false},
+			dataSize: true,
+		},
+		{
+			name: "Vista",
+			data: indexedShimCache(shimCacheVistaMagic, 8, false, func(i int) []byte {
+				return concat(ft, le32(2), le32(0))
+			}, `C:\a.exe`),
+			format:   "Windows Vista/2008",
+			paths:    []string{`C:\a.exe`},
+			executed: []bool{true},
+		},
+		{
+			name: "Server 2003",
+			data: indexedShimCache(shimCacheVistaMagic, 8, true, func(i int) []byte {
+				return concat(ft, le64(123456))
+			}, `C:\a.exe`),
+			format: "Windows Server 2003",
+			paths:  []string{`C:\a.exe`},
+		},
+		{
+			name:   "Windows XP",
+			data:   concat(le32(shimCacheXPMagic), le32(2), make([]byte, 0x190-8), xpEntry(`C:\a.exe`), xpEntry(`C:\b.exe`)),
+			format: "Windows XP",
+			paths:  []string{`C:\a.exe`, `C:\b.exe`},
+		},
+	}
+	for _, tt := range tests {
+		cache, err := parseShimCache(tt.data)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if cache.format != tt.format || len(cache.entries) != len(tt.paths) {
+			t.Errorf("%s: got %s with %d entries", tt.name, cache.format, len(cache.entries))
+			continue
+		}
+		for i, e := range cache.entries {
+			if e.position != i || e.path != tt.paths[i] || !e.modified.Equal(shimTime) {
+				t.Errorf("%s: unexpected entry %d: %+v", tt.name, i, e)
+			}
+			if e.hasExecuted != (tt.executed != nil) || (tt.executed != nil && e.executed != tt.executed[i]) {
+				t.Errorf("%s: unexpected executed flag on entry %d: %+v", tt.name, i, e)
+			}
+			if e.hasDataSize != tt.dataSize {
+				t.Errorf("%s: unexpected data size on entry %d: %+v", tt.name, i, e)
+			}
+		}
+	}
+
+	truncated := taggedShimCache(shimCacheWin10Header, "10ts", win10Body(`C:\a.exe`, 0))
+	truncated = append(truncated, "10ts"...)
+	cache, err := parseShimCache(truncated)
+	if err == nil || len(cache.entries) != 1 {
+		t.Errorf("expected one entry and an error from a truncated cache, got %d (%v)", len(cache.entries), err)
+	}
+	if _, err := parseShimCache(le64(0x12345678)); err == nil {
+		t.Error("expected an error for an unknown signature")
+	}
+}
+
+func TestShimCachePluginReadsEveryControlSet(t *testing.T) {
+	body := func(path string) []byte {
+		name := utf16le(path)
+		return concat(le16(len(name)), name, le64(filetime(shimTime)), le32(0))
+	}
+	cache := func(paths ...string) *testKey {
+		var bodies [][]byte
+		for _, p := range paths {
+			bodies = append(bodies, body(p))
+		}
+		return key("Control", key("Session Manager", key("AppCompatCache").with(
+			binValue("AppCompatCache", taggedShimCache(shimCacheWin11Header, "10ts", bodies...)))))
+	}
+	hive := newTestHive(t, key("ROOT",
+		key("Select").with(dwordValue("Current", 1)),
+		key("ControlSet001", cache(`C:\new.exe`, `C:\old.exe`)),
+		key("ControlSet002", cache(`C:\gone.exe`)),
+	))
+
+	records, err := Collect(&ShimCachePlugin{}, hive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{`ControlSet001 0 C:\new.exe`, `ControlSet001 1 C:\old.exe`, `ControlSet002 0 C:\gone.exe`}
+	if len(records) != len(want) {
+		t.Fatalf("expected %d records, got %d", len(want), len(records))
+	}
+	for i, r := range records {
+		cs, _ := r.Get("Control Set")
+		pos, _ := r.Get("Position")
+		path, _ := r.Get("Path")
+		if got := FormatValue(cs) + " " + FormatValue(pos) + " " + FormatValue(path); got != want[i] {
+			t.Errorf("record %d: got %q, want %q", i, got, want[i])
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package plugins
 
 import (
+	"context"
 	"encoding/binary"
 	"fmt"
 	"strings"
@@ -27,40 +28,49 @@ func (p *ShutdownPlugin) CompatibleHiveTypes() []string {
 	return []string{"SYSTEM"}
 }
 
-func (p *ShutdownPlugin) Run(hive *regf.Hive) error {
-	paths := []string{
-		"ControlSet001\\Control\\Windows",
-		"ControlSet002\\Control\\Windows",
+func (p *ShutdownPlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategorySystem,
+		Artifact:   "The time Windows last shut down cleanly.",
+		References: []string{regRipperReference},
+		Version:    "1.0.0",
+		Schema: []FieldSpec{
+			{Name: "ShutdownTime", Type: FieldTime, Description: "last shutdown time"},
+		},
 	}
+}
+
+func (p *ShutdownPlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
 
-	fmt.Println("Shutdown Information")
-	fmt.Println("====================")
-	fmt.Println()
+func (p *ShutdownPlugin) Options() []Option {
+	return []Option{controlSetOption}
+}
 
-	for _, path := range paths {
+func (p *ShutdownPlugin) Collect(hive *regf.Hive, emit Emitter) error {
+	return p.CollectContext(context.Background(), hive, DefaultOptions(p), emit)
+}
+
+func (p *ShutdownPlugin) CollectContext(ctx context.Context, hive *regf.Hive, opts Options, emit Emitter) error {
+	return forEachControlSet(ctx, hive, opts, emit, func(controlSet string, emit Emitter) error {
+		path := controlSet + "\\Control\\Windows"
 		key, err := hive.GetKey(path)
 		if err != nil {
-			continue
+			return fmt.Errorf("shutdown key not found: %w", err)
 		}
 
-		fmt.Printf("[%s]\n", path)
-		fmt.Printf("Last Modified: %s\n", key.Timestamp().Format("2006-01-02 15:04:05"))
-
 		for _, val := range key.Values() {
 			name := val.Name()
 			if strings.EqualFold(name, "ShutdownTime") {
 				data := val.Bytes()
 				if len(data) >= 8 {
-					timestamp := binary.LittleEndian.Uint64(data)
-					// This is a FILETIME, but we'll just show raw for now
-					fmt.Printf("  ShutdownTime: 0x%x\n", timestamp)
+					emit(NewRecord(path, key).
+						AddTime("ShutdownTime", filetimeToTime(binary.LittleEndian.Uint64(data))))
 				}
 			}
 		}
-		fmt.Println()
 
 		return nil
-	}
-
-	return fmt.Errorf("shutdown key not found")
+	})
 }
@@ -0,0 +1,294 @@
+package plugins
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
+)
+
+// Sources of a SID resolution.
+const (
+	sidSourceWellKnown   = "well-known"
+	sidSourceSAM         = "SAM"
+	sidSourceProfileList = "ProfileList"
+	sidSourceSecurity    = "SECURITY"
+)
+
+// SECURITY keys naming the account (local machine) and primary domains.
+const (
+	policyAccountDomainSID  = `Policy\PolAcDmS`
+	policyAccountDomainName = `Policy\PolAcDmN`
+	policyPrimaryDomainSID  = `Policy\PolPrDmS`
+	policyPrimaryDomainName = `Policy\PolPrDmN`
+)
+
+// wellKnownSIDs names the SIDs that are the same on every host.
+var wellKnownSIDs = map[string]string{
+	"S-1-0-0":      "Nobody",
+	"S-1-1-0":      "Everyone",
+	"S-1-2-0":      "LOCAL",
+	"S-1-2-1":      "CONSOLE LOGON",
+	"S-1-3-0":      "CREATOR OWNER",
+	"S-1-3-1":      "CREATOR GROUP",
+	"S-1-3-4":      "OWNER RIGHTS",
+	"S-1-5-1":      `NT AUTHORITY\DIALUP`,
+	"S-1-5-2":      `NT AUTHORITY\NETWORK`,
+	"S-1-5-3":      `NT AUTHORITY\BATCH`,
+	"S-1-5-4":      `NT AUTHORITY\INTERACTIVE`,
+	"S-1-5-6":      `NT AUTHORITY\SERVICE`,
+	"S-1-5-7":      `NT AUTHORITY\ANONYMOUS LOGON`,
+	"S-1-5-9":      `NT AUTHORITY\ENTERPRISE DOMAIN CONTROLLERS`,
+	"S-1-5-10":     `NT AUTHORITY\SELF`,
+	"S-1-5-11":     `NT AUTHORITY\Authenticated Users`,
+	"S-1-5-13":     `NT AUTHORITY\TERMINAL SERVER USER`,
+	"S-1-5-14":     `NT AUTHORITY\REMOTE INTERACTIVE LOGON`,
+	"S-1-5-15":     `NT AUTHORITY\This Organization`,
+	"S-1-5-17":     `NT AUTHORITY\IUSR`,
+	"S-1-5-18":     `NT AUTHORITY\SYSTEM`,
+	"S-1-5-19":     `NT AUTHORITY\LOCAL SERVICE`,
+	"S-1-5-20":     `NT AUTHORITY\NETWORK SERVICE`,
+	"S-1-5-32-544": `BUILTIN\Administrators`,
+	"S-1-5-32-545": `BUILTIN\Users`,
+	"S-1-5-32-546": `BUILTIN\Guests`,
+	"S-1-5-32-547": `BUILTIN\Power Users`,
+	"S-1-5-32-551": `BUILTIN\Backup Operators`,
+	"S-1-5-32-555": `BUILTIN\Remote Desktop Users`,
+	"S-1-5-32-562": `BUILTIN\Distributed COM Users`,
+	"S-1-5-32-568": `BUILTIN\IIS_IUSRS`,
+	"S-1-5-32-573": `BUILTIN\Event Log Readers`,
+	"S-1-5-80-0":   `NT SERVICE\ALL SERVICES`,
+	"S-1-5-113":    `NT AUTHORITY\Local account`,
+	"S-1-5-114":    `NT AUTHORITY\Local account and member of Administrators group`,
+}
+
+// wellKnownSessionSIDs names the per-session accounts by SID prefix; the
+// session number follows.
+var wellKnownSessionSIDs = []struct {
+	prefix string
+	name   string
+}{
+	{"S-1-5-90-0-", `Window Manager\DWM-`},
+	{"S-1-5-96-0-", `Font Driver Host\UMFD-`},
+}
+
+// wellKnownRIDs names the accounts and groups every domain, including the
+// local machine's, creates with a fixed RID.
+var wellKnownRIDs = map[uint32]string{
+	500: "Administrator",
+	501: "Guest",
+	502: "krbtgt",
+	503: "DefaultAccount",
+	504: "WDAGUtilityAccount",
+	512: "Domain Admins",
+	513: "Domain Users",
+	514: "Domain Guests",
+	515: "Domain Computers",
+	516: "Domain Controllers",
+	518: "Schema Admins",
+	519: "Enterprise Admins",
+}
+
+// SIDName is what a SID resolves to. Source names where Name came from,
+// or the SECURITY hive when only the domain is known.
+type SIDName struct {
+	Name        string
+	Domain      string
+	ProfilePath string
+	Source      string
+}
+
+// Account returns the name as DOMAIN\name, or "" when only the domain is
+// known.
+func (n SIDName) Account() string {
+	if n.Name == "" || n.Domain == "" {
+		return n.Name
+	}
+	return n.Domain + `\` + n.Name
+}
+
+// SIDResolver resolves SIDs to account names with the hives of a host:
+// well-known SIDs, SAM accounts, the SOFTWARE profile list and the domain
+// SIDs of SECURITY. Every hive is optional. Plugins get the resolver of
+// the host they run on with SIDResolverFrom.
+type SIDResolver struct {
+	profiles map[string]string // SID to profile path
+	accounts map[string]string // SID to SAM user name
+	domains  map[string]string // domain SID to domain name
+}
+
+// NewSIDResolver reads the SID sources of the hives host holds.
+func NewSIDResolver(host *Host) *SIDResolver {
+	s := &SIDResolver{
+		profiles: make(map[string]string),
+		accounts: make(map[string]string),
+		domains:  make(map[string]string),
+	}
+	if software := host.Hive("SOFTWARE"); software != nil {
+		s.profiles = profilePaths(software)
+	}
+
+	var machineSID string
+	if security := host.Hive("SECURITY"); security != nil {
+		machineSID = policySID(security, policyAccountDomainSID)
+		if machineSID != "" {
+			s.domains[machineSID] = policyName(security, policyAccountDomainName)
+		}
+		if sid := policySID(security, policyPrimaryDomainSID); sid != "" {
+			s.domains[sid] = policyName(security, policyPrimaryDomainName)
+		}
+	}
+	if sam := host.Hive("SAM"); sam != nil {
+		if sid := samDomainSID(sam); sid != "" {
+			machineSID = sid
+		}
+		accounts, _ := readSAMAccounts(sam)
+		for _, a := range accounts {
+			if machineSID != "" && a.Username != "" {
+				s.accounts[fmt.Sprintf("%s-%d", machineSID, a.RID)] = a.Username
+			}
+		}
+	}
+	return s
+}
+
+// Resolve names a SID. Local account names come from SAM first, then
+// from the profile list, then from the RIDs every domain has. ok is false
+// when nothing is known about the SID.
+func (s *SIDResolver) Resolve(sid string) (n SIDName, ok bool) {
+	if name, found := wellKnownSIDs[sid]; found {
+		return splitAccount(name, sidSourceWellKnown), true
+	}
+	for _, w := range wellKnownSessionSIDs {
+		if session, found := strings.CutPrefix(sid, w.prefix); found {
+			if _, err := strconv.ParseUint(session, 10, 32); err == nil {
+				return splitAccount(w.name+session, sidSourceWellKnown), true
+			}
+		}
+	}
+
+	domainSID, rid := splitSID(sid)
+	n.Domain = s.domains[domainSID]
+	n.ProfilePath = s.profiles[sid]
+	switch {
+	case s.accounts[sid] != "":
+		n.Name, n.Source = s.accounts[sid], sidSourceSAM
+	case n.ProfilePath != "":
+		n.Name, n.Source = profileUser(n.ProfilePath), sidSourceProfileList
+	case strings.HasPrefix(sid, "S-1-5-21-") && wellKnownRIDs[rid] != "":
+		n.Name, n.Source = wellKnownRIDs[rid], sidSourceWellKnown
+	case n.Domain != "":
+		n.Source = sidSourceSecurity
+	default:
+		return SIDName{}, false
+	}
+	return n, true
+}
+
+// Account returns the DOMAIN\name account of a SID, or "" when its name is
+// unknown.
+func (s *SIDResolver) Account(sid string) string {
+	n, _ := s.Resolve(sid)
+	return n.Account()
+}
+
+// addTo adds the resolution of the SID field of r as the User, Domain,
+// Profile Path and User Source fields.
+func (s *SIDResolver) addTo(r *Record) {
+	f, ok := r.Get("SID")
+	if !ok {
+		return
+	}
+	n, ok := s.Resolve(FormatValue(f))
+	if !ok {
+		return
+	}
+	if n.Name != "" {
+		r.AddString("User", n.Name)
+	}
+	if n.Domain != "" {
+		r.AddString("Domain", n.Domain)
+	}
+	if n.ProfilePath != "" {
+		r.AddString("Profile Path", n.ProfilePath)
+	}
+	r.AddString("User Source", n.Source)
+}
+
+// splitAccount splits a DOMAIN\name account into a resolution.
+func splitAccount(account, source string) SIDName {
+	if domain, name, found := strings.Cut(account, `\`); found {
+		return SIDName{Name: name, Domain: domain, Source: source}
+	}
+	return SIDName{Name: account, Source: source}
+}
+
+// splitSID splits a SID into its domain SID and RID, its last
+// subauthority.
+func splitSID(sid string) (string, uint32) {
+	i := strings.LastIndex(sid, "-")
+	if i < 0 {
+		return "", 0
+	}
+	rid, err := strconv.ParseUint(sid[i+1:], 10, 32)
+	if err != nil {
+		return "", 0
+	}
+	return sid[:i], uint32(rid)
+}
+
+// policySID decodes the binary SID of PolAcDmS or PolPrDmS. A host
+// outside a domain has no primary domain SID.
+func policySID(security *regf.Hive, path string) string {
+	data, ok := defaultValue(security, path)
+	if !ok {
+		return ""
+	}
+	sid, _ := parseSID(data)
+	return sid
+}
+
+// policyName decodes the UNICODE_STRING of PolAcDmN or PolPrDmN: the
+// length in bytes and the maximum length, then the offset of the buffer,
+// as 32 or 64 bits depending on the architecture.
+func policyName(security *regf.Hive, path string) string {
+	data, ok := defaultValue(security, path)
+	if !ok || len(data) < 8 {
+		return ""
+	}
+	length := int(binary.LittleEndian.Uint16(data))
+	offset := int(binary.LittleEndian.Uint32(data[4:]))
+	if offset == 0 && len(data) >= 16 {
+		offset = int(binary.LittleEndian.Uint32(data[8:]))
+	}
+	if offset < 8 || offset+length > len(data) {
+		return ""
+	}
+	return utf16String(data[offset : offset+length])
+}
+
+// sidResolverKey is the context key of the SID resolver.
+type sidResolverKey struct{}
+
+// WithSIDResolver returns a context carrying the SID resolver plugins run
+// with should use.
+func WithSIDResolver(ctx context.Context, s *SIDResolver) context.Context {
+	return context.WithValue(ctx, sidResolverKey{}, s)
+}
+
+// SIDResolverFrom returns the SID resolver of ctx. Without one, it reads
+// the SID sources of hive, whose role is given, so that a plugin run on a
+// single hive still resolves what that hive knows.
+func SIDResolverFrom(ctx context.Context, role string, hive *regf.Hive) *SIDResolver {
+	if s, ok := ctx.Value(sidResolverKey{}).(*SIDResolver); ok && s != nil {
+		return s
+	}
+	host := &Host{}
+	if hive != nil {
+		host.Add(role, "", hive)
+	}
+	return host.SIDs()
+}
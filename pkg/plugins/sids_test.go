@@ -0,0 +1,102 @@
+package plugins
+
+import "testing"
+
+// unicodeString encodes a self-relative UNICODE_STRING as stored in
+// PolAcDmN and PolPrDmN.
+func unicodeString(s string) []byte {
+	buf := utf16le(s)
+	return concat(le16(len(buf)), le16(len(buf)), le32(8), buf)
+}
+
+const sidTestMachine, sidTestDomain = "S-1-5-21-11-22-33", "S-1-5-21-44-55-66"
+
+// sidTestHost returns a host whose SAM holds alice (RID 1001), whose
+// SOFTWARE profile list holds bob (RID 1002) and whose SECURITY names the
+// machine WS01 in domain CORP. currentVersion adds keys below the
+// CurrentVersion key of SOFTWARE.
+func sidTestHost(t *testing.T, currentVersion ...*testKey) *Host {
+	t.Helper()
+	sam := newTestHive(t, key("ROOT",
+		key("SAM", key("Domains", key("Account", key("Users",
+			key("000003E9").with(binValue("V", samRecord(samVHeader, map[int][]byte{0x0C: utf16le("alice")}, nil))),
+		)).with(binValue("V", append(make([]byte, 0x30), sidBytes(sidTestMachine)...))))),
+	))
+	currentVersion = append(currentVersion, key("ProfileList",
+		key(sidTestMachine+"-1002").with(szValue("ProfileImagePath", `C:\Users\bob`)),
+	))
+	security := newTestHive(t, key("ROOT", key("Policy",
+		key("PolAcDmS").with(binValue("", sidBytes(sidTestMachine))),
+		key("PolAcDmN").with(binValue("", unicodeString("WS01"))),
+		key("PolPrDmS").with(binValue("", sidBytes(sidTestDomain))),
+		key("PolPrDmN").with(binValue("", unicodeString("CORP"))),
+	)))
+
+	host := &Host{}
+	host.Add("SAM", "SAM", sam)
+	host.Add("SOFTWARE", "SOFTWARE", newTestHive(t, key("ROOT",
+		key("Microsoft", key("Windows NT", key("CurrentVersion", currentVersion...))))))
+	host.Add("SECURITY", "SECURITY", security)
+	return host
+}
+
+func TestSIDResolverCombinesSources(t *testing.T) {
+	const machine, domain = sidTestMachine, sidTestDomain
+	host := sidTestHost(t)
+	resolver := NewSIDResolver(host)
+
+	for sid, want := range map[string]SIDName{
+		machine + "-1001": {Name: "alice", Domain: "WS01", Source: sidSourceSAM},
+		machine + "-1002": {Name: "bob", Domain: "WS01", ProfilePath: `C:\Users\bob`, Source: sidSourceProfileList},
+		domain + "-500":   {Name: "Administrator", Domain: "CORP", Source: sidSourceWellKnown},
+		domain + "-1234":  {Domain: "CORP", Source: sidSourceSecurity},
+		"S-1-5-18":        {Name: "SYSTEM", Domain: "NT AUTHORITY", Source: sidSourceWellKnown},
+		"S-1-5-90-0-3":    {Name: "DWM-3", Domain: "Window Manager", Source: sidSourceWellKnown},
+	} {
+		if got, ok := resolver.Resolve(sid); !ok || got != want {
+			t.Errorf("resolve(%s) = %+v, %v, want %+v", sid, got, ok, want)
+		}
+	}
+	if got, ok := resolver.Resolve("S-1-5-21-7-8-9-1000"); ok {
+		t.Errorf("unexpected resolution %+v", got)
+	}
+}
+
+func TestPluginsResolveSIDsWithHost(t *testing.T) {
+	actions := concat(le16(3), taskString(sidTestMachine+"-1001"),
+		le16(0x6666), taskString(""), taskString(`C:\backup.exe`), taskString(""), taskString(""), le16(0))
+	const id = "{11111111-0000-0000-0000-000000000001}"
+	host := sidTestHost(t, key("Schedule", key("TaskCache",
+		key("Tasks", key(id).with(szValue("Path", `\Backup`), binValue("Actions", actions))),
+	)))
+	if host.SIDs() != host.SIDs() {
+		t.Error("host resolver is not cached")
+	}
+
+	records, err := CollectHost(t.Context(), &SAMParsePlugin{}, host, DefaultOptions(&SAMParsePlugin{}))
+	if err != nil || len(records) != 1 {
+		t.Fatalf("samparse: %d records (%v)", len(records), err)
+	}
+	if f, ok := records[0].Get("Domain"); !ok || f.Value != "WS01" {
+		t.Errorf("samparse: Domain = %v, want WS01", f.Value)
+	}
+
+	ctx := WithSIDResolver(t.Context(), host.SIDs())
+	software := host.Hive("SOFTWARE")
+	records, err = CollectContext(ctx, &TasksPlugin{}, software, DefaultOptions(&TasksPlugin{}))
+	if err != nil || len(records) != 1 {
+		t.Fatalf("tasks: %d records (%v)", len(records), err)
+	}
+	if f, ok := records[0].Get("Context Account"); !ok || f.Value != `WS01\alice` {
+		t.Errorf("tasks: Context Account = %v, want WS01\\alice", f.Value)
+	}
+
+	// Without a host, a plugin still resolves what its own hive knows
+	records, _ = Collect(&TasksPlugin{}, software)
+	if _, ok := records[0].Get("Context Account"); ok {
+		t.Errorf("tasks: unexpected account without SAM")
+	}
+	if got := SIDResolverFrom(t.Context(), "SOFTWARE", software).Account(sidTestMachine + "-1002"); got != "bob" {
+		t.Errorf("fallback resolver: got %q, want bob", got)
+	}
+}
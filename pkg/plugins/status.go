@@ -0,0 +1,95 @@
+package plugins
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
+)
+
+// Sentinel errors a plugin returns instead of a plain error, so that a
+// clean machine can be told apart from a broken plugin.
+var (
+	// ErrNotFound means the hive holds none of the keys the plugin reads:
+	// the artifact is absent, which is not a failure.
+	ErrNotFound = errors.New("artifact not found")
+	// ErrNotApplicable means the plugin does not apply to this hive or
+	// host, for example a SYSTEM plugin run on NTUSER.DAT.
+	ErrNotApplicable = errors.New("not applicable")
+	// ErrPartial means the plugin emitted records but some entries could
+	// not be read. The records are still valid.
+	ErrPartial = errors.New("partial results")
+)
+
+// Status summarises how a plugin run ended.
+type Status int
+
+const (
+	// StatusOK means the plugin ran; it may have found nothing to report.
+	StatusOK Status = iota
+	// StatusNotFound means the artifact is absent from the hive.
+	StatusNotFound
+	// StatusNotApplicable means the plugin does not apply to the hive.
+	StatusNotApplicable
+	// StatusPartial means some entries could not be read.
+	StatusPartial
+	// StatusError means the plugin failed.
+	StatusError
+	// StatusCancelled means the run was cancelled.
+	StatusCancelled
+)
+
+// String returns the name of the status as shown in reports.
+func (s Status) String() string {
+	switch s {
+	case StatusOK:
+		return "ok"
+	case StatusNotFound:
+		return "not-found"
+	case StatusNotApplicable:
+		return "not-applicable"
+	case StatusPartial:
+		return "partial"
+	case StatusError:
+		return "error"
+	case StatusCancelled:
+		return "cancelled"
+	default:
+		return "unknown"
+	}
+}
+
+// StatusOf classifies the error returned by a plugin run. Missing keys
+// reported by regf, missing control sets and missing hives count as not
+// found or not applicable rather than as failures.
+func StatusOf(err error) Status {
+	switch {
+	case err == nil:
+		return StatusOK
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return StatusCancelled
+	case errors.Is(err, ErrNotApplicable), errors.Is(err, ErrMissingHive):
+		return StatusNotApplicable
+	case errors.Is(err, ErrPartial):
+		return StatusPartial
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrControlSetNotFound), errors.Is(err, regf.ErrKeyNotFound):
+		return StatusNotFound
+	default:
+		return StatusError
+	}
+}
+
+// notFound returns an ErrNotFound naming the artifact that is missing.
+func notFound(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrNotFound, fmt.Sprintf(format, args...))
+}
+
+// partial wraps the errors met while reading some entries into an
+// ErrPartial. It returns nil when errs is empty.
+func partial(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %w", ErrPartial, errors.Join(errs...))
+}
@@ -0,0 +1,59 @@
+package plugins
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
+)
+
+func TestStatusOf(t *testing.T) {
+	tests := []struct {
+		err  error
+		want Status
+	}{
+		{nil, StatusOK},
+		{notFound("no Run keys"), StatusNotFound},
+		{fmt.Errorf("failed to open key: %w", regf.ErrKeyNotFound), StatusNotFound},
+		{fmt.Errorf("%w: Failed", ErrControlSetNotFound), StatusNotFound},
+		{fmt.Errorf("%w: SOFTWARE", ErrMissingHive), StatusNotApplicable},
+		{partial([]error{errors.New("bad value")}), StatusPartial},
+		{fmt.Errorf("run: %w", context.Canceled), StatusCancelled},
+		{errors.New("corrupt cell"), StatusError},
+	}
+	for _, tt := range tests {
+		if got := StatusOf(tt.err); got != tt.want {
+			t.Errorf("StatusOf(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+	if partial(nil) != nil {
+		t.Error("partial(nil) should be nil")
+	}
+}
+
+func TestPluginsReportNotFound(t *testing.T) {
+	hive := newTestHive(t, key("ROOT",
+		key("Select").with(dwordValue("Current", 1)),
+		key("ControlSet001"),
+	))
+	tests := []struct {
+		plugin Plugin
+		values map[string]string
+	}{
+		{&RunPlugin{}, nil},
+		{&PrintersPlugin{}, nil},
+		{&PrintersPlugin{}, map[string]string{"controlset": "all"}},
+	}
+	for _, tt := range tests {
+		opts, err := ParseOptions(tt.plugin, tt.values)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = CollectContext(context.Background(), tt.plugin, hive, opts)
+		if got := StatusOf(err); got != StatusNotFound {
+			t.Errorf("%s %v: expected not-found, got %s (%v)", tt.plugin.Name(), tt.values, got, err)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package plugins
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Action types of the Actions value.
+const (
+	TaskActionExec       = "Exec"
+	TaskActionComHandler = "ComHandler"
+	TaskActionEmail      = "Email"
+	TaskActionMessageBox = "MessageBox"
+)
+
+// taskActionTypes maps the signature of each action to its type.
+var taskActionTypes = map[uint16]string{
+	0x6666: TaskActionExec,
+	0x7777: TaskActionComHandler,
+	0x8888: TaskActionEmail,
+	0x9999: TaskActionMessageBox,
+}
+
+// taskTriggerTypes maps the signature of each trigger of the Triggers
+// value to its type.
+var taskTriggerTypes = map[uint32]string{
+	0xDDDD: "Time",
+	0x6666: "Logon",
+	0x7777: "Session State Change",
+	0x8888: "WNF State Change",
+	0xCCCC: "Event",
+	0xEEEE: "Idle",
+	0xFFFF: "Boot",
+}
+
+// errTaskBlobTruncated is reported when a TaskCache blob ends inside a
+// field.
+var errTaskBlobTruncated = errors.New("blob truncated")
+
+// taskBlob reads the little-endian fields of a TaskCache blob in order.
+// Reading past the end sets err and returns zero values.
+type taskBlob struct {
+	data []byte
+	err  error
+}
+
+func (b *taskBlob) bytes(n int) []byte {
+	if b.err != nil || n < 0 || n > len(b.data) {
+		b.err = errTaskBlobTruncated
+		return nil
+	}
+	v := b.data[:n]
+	b.data = b.data[n:]
+	return v
+}
+
+func (b *taskBlob) uint16() uint16 {
+	if v := b.bytes(2); v != nil {
+		return binary.LittleEndian.Uint16(v)
+	}
+	return 0
+}
+
+func (b *taskBlob) uint32() uint32 {
+	if v := b.bytes(4); v != nil {
+		return binary.LittleEndian.Uint32(v)
+	}
+	return 0
+}
+
+// string reads a UTF-16 string preceded by its size in bytes.
+func (b *taskBlob) string() string {
+	return utf16String(b.bytes(int(b.uint32())))
+}
+
+// taskAction is one decoded action of a task. Only the fields of its type
+// are set.
+type taskAction struct {
+	Type string
+	ID   string
+
+	Command    string
+	Arguments  string
+	WorkingDir string
+
+	CLSID string
+	Data  string
+
+	From, To, Cc, Bcc, ReplyTo string
+	Server, Subject, Body      string
+	Attachments                []string
+
+	Caption string
+	Content string
+}
+
+// String describes the action on one line.
+func (a taskAction) String() string {
+	switch a.Type {
+	case TaskActionExec:
+		s := strings.TrimSpace(a.Command + " " + a.Arguments)
+		if a.WorkingDir != "" {
+			s += " (in " + a.WorkingDir + ")"
+		}
+		return "Exec: " + s
+	case TaskActionComHandler:
+		s := "ComHandler: " + a.CLSID
+		if a.Data != "" {
+			s += " " + a.Data
+		}
+		return s
+	case TaskActionEmail:
+		return fmt.Sprintf("Email: to %s via %s: %s", a.To, a.Server, a.Subject)
+	case TaskActionMessageBox:
+		return fmt.Sprintf("MessageBox: %s: %s", a.Caption, a.Content)
+	}
+	return a.Type
+}
+
+// decodeTaskActions decodes an Actions value: a version, then from
+// version 2 the principal the actions run as, then the actions, each
+// starting with its signature and ID. Version 3 (Windows 10) adds flags
+// after each Exec action.
+func decodeTaskActions(data []byte) (principal string, actions []taskAction, err error) {
+	b := &taskBlob{data: data}
+	version := b.uint16()
+	if version >= 2 {
+		principal = b.string()
+	}
+	for b.err == nil && len(b.data) >= 2 {
+		signature := b.uint16()
+		actionType, ok := taskActionTypes[signature]
+		if !ok {
+			return principal, actions, fmt.Errorf("unknown action signature 0x%04X", signature)
+		}
+		a := taskAction{Type: actionType, ID: b.string()}
+		switch actionType {
+		case TaskActionExec:
+			a.Command, a.Arguments, a.WorkingDir = b.string(), b.string(), b.string()
+			if version >= 3 {
+				b.uint16()
+			}
+		case TaskActionComHandler:
+			if clsid := b.bytes(16); clsid != nil {
+				a.CLSID = formatGUID(clsid)
+			}
+			a.Data = b.string()
+		case TaskActionEmail:
+			a.From, a.To, a.Cc, a.Bcc, a.ReplyTo = b.string(), b.string(), b.string(), b.string(), b.string()
+			a.Server, a.Subject, a.Body = b.string(), b.string(), b.string()
+			for n := b.uint32(); n > 0 && b.err == nil; n-- {
+				a.Attachments = append(a.Attachments, b.string())
+			}
+			// Header fields, as name and value pairs
+			for n := b.uint32(); n > 0 && b.err == nil; n-- {
+				b.string()
+				b.string()
+			}
+		case TaskActionMessageBox:
+			a.Caption, a.Content = b.string(), b.string()
+		}
+		if b.err != nil {
+			return principal, actions, fmt.Errorf("%s action: %w", actionType, b.err)
+		}
+		actions = append(actions, a)
+	}
+	return principal, actions, nil
+}
+
+// taskTriggers is the decoded header of a Triggers value and the types of
+// the triggers it holds.
+type taskTriggers struct {
+	StartBoundary time.Time
+	EndBoundary   time.Time
+	Types         []string
+}
+
+// decodeTaskTriggers decodes a Triggers value: a version byte, then the
+// start and end boundary FILETIMEs at 8 and 16. The job settings and the
+// triggers follow, aligned to 8 bytes; triggers are recognised by the
+// signature that starts them.
+func decodeTaskTriggers(data []byte) (taskTriggers, error) {
+	var t taskTriggers
+	if len(data) < 24 {
+		return t, fmt.Errorf("triggers too short (%d bytes)", len(data))
+	}
+	t.StartBoundary = filetimeToTime(binary.LittleEndian.Uint64(data[8:]))
+	t.EndBoundary = filetimeToTime(binary.LittleEndian.Uint64(data[16:]))
+	seen := make(map[string]bool)
+	for off := 24; off+8 <= len(data); off += 8 {
+		name, ok := taskTriggerTypes[binary.LittleEndian.Uint32(data[off:])]
+		if ok && !seen[name] {
+			seen[name] = true
+			t.Types = append(t.Types, name)
+		}
+	}
+	return t, nil
+}
+
+// taskDynamicInfo is the decoded DynamicInfo value of a task.
+type taskDynamicInfo struct {
+	Created       time.Time
+	LastRun       time.Time
+	LastCompleted time.Time
+	LastResult    uint32
+}
+
+// decodeTaskDynamicInfo decodes a DynamicInfo value: a version, then the
+// registration and last run FILETIMEs, the task state and the result of
+// the last run. Windows 10 appends the time the last run completed.
+func decodeTaskDynamicInfo(data []byte) (taskDynamicInfo, error) {
+	var d taskDynamicInfo
+	if len(data) < 28 {
+		return d, fmt.Errorf("dynamic info too short (%d bytes)", len(data))
+	}
+	d.Created = filetimeToTime(binary.LittleEndian.Uint64(data[4:]))
+	d.LastRun = filetimeToTime(binary.LittleEndian.Uint64(data[12:]))
+	d.LastResult = binary.LittleEndian.Uint32(data[24:])
+	if len(data) >= 36 {
+		d.LastCompleted = filetimeToTime(binary.LittleEndian.Uint64(data[28:]))
+	}
+	return d, nil
+}
@@ -1,8 +1,11 @@
 package plugins
 
 import (
+	"context"
+	"encoding/binary"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
 )
@@ -11,6 +14,12 @@ func init() {
 	Register(&TasksPlugin{})
 }
 
+// taskCachePath is the SOFTWARE key of the scheduled task cache.
+const taskCachePath = "Microsoft\\Windows NT\\CurrentVersion\\Schedule\\TaskCache"
+
+// taskLists are the TaskCache keys listing task IDs by how they start.
+var taskLists = []string{"Plain", "Logon", "Boot", "Maintenance"}
+
 // TasksPlugin displays scheduled tasks from SOFTWARE hive.
 type TasksPlugin struct{}
 
@@ -26,53 +35,287 @@ func (p *TasksPlugin) CompatibleHiveTypes() []string {
 	return []string{"SOFTWARE"}
 }
 
+func (p *TasksPlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategoryPersistence,
+		Techniques: []string{"T1053.005", "T1564"},
+		Artifact: "The TaskCache keeps registered scheduled tasks: Tree names them with their ID, index and security " +
+			"descriptor, Tasks holds their actions, triggers and run history. A task without SD or with index 0 " +
+			"is hidden from the Task Scheduler.",
+		References: []string{
+			regRipperReference,
+			"https://www.microsoft.com/en-us/security/blog/2022/04/12/tarrask-malware-uses-scheduled-tasks-for-defense-evasion/",
+		},
+		Version: "2.1.0",
+		Schema: []FieldSpec{
+			{Name: "Task", Type: FieldString, Description: "task path"},
+			{Name: "Id", Type: FieldString, Description: "task GUID joining Tree and Tasks"},
+			{Name: "URI", Type: FieldString, Description: "task URI"},
+			{Name: "Author", Type: FieldString, Description: "task author"},
+			{Name: "Description", Type: FieldString, Description: "task description"},
+			{Name: "Source", Type: FieldString, Description: "task source"},
+			{Name: "Date", Type: FieldString, Description: "registration date, as stored"},
+			{Name: "Lists", Type: FieldStrings, Description: "Plain, Logon, Boot and Maintenance lists naming the task"},
+			{Name: "Index", Type: FieldInt, Description: "Tree index value"},
+			{Name: "SD Present", Type: FieldBool, Description: "whether the Tree key has its security descriptor"},
+			{Name: "Hidden", Type: FieldBool, Description: "SD missing or index 0"},
+			{Name: "Context", Type: FieldString, Description: "principal the actions run as"},
+			{Name: "Context Account", Type: FieldString, Description: "account of a principal given as a SID"},
+			{Name: "Actions", Type: FieldStrings, Description: "decoded actions"},
+			{Name: "Command", Type: FieldString, Description: "command of the first Exec action"},
+			{Name: "Arguments", Type: FieldString, Description: "arguments of the first Exec action"},
+			{Name: "COM Handler", Type: FieldString, Description: "CLSID of the first ComHandler action"},
+			{Name: "Triggers", Type: FieldStrings, Description: "trigger types"},
+			{Name: "Start Boundary", Type: FieldTime, Description: "time the triggers start"},
+			{Name: "End Boundary", Type: FieldTime, Description: "time the triggers end"},
+			{Name: "Created", Type: FieldTime, Description: "registration time from DynamicInfo"},
+			{Name: "Last Run", Type: FieldTime, Description: "last run time from DynamicInfo"},
+			{Name: "Last Completed", Type: FieldTime, Description: "time the last run completed (Windows 10+)"},
+			{Name: "Last Result", Type: FieldString, Description: "result code of the last run"},
+		},
+	}
+}
+
 func (p *TasksPlugin) Run(hive *regf.Hive) error {
-	paths := []string{
-		"Microsoft/Windows NT/CurrentVersion/Schedule/TaskCache/Tasks",
-		"Microsoft/Windows NT/CurrentVersion/Schedule/TaskCache/Tree",
+	return runText(p, hive)
+}
+
+// Options is empty; tasks is a ContextPlugin so that it resolves the SIDs
+// tasks run as with the hives of the host.
+func (p *TasksPlugin) Options() []Option {
+	return nil
+}
+
+func (p *TasksPlugin) Collect(hive *regf.Hive, emit Emitter) error {
+	return p.CollectContext(context.Background(), hive, DefaultOptions(p), emit)
+}
+
+func (p *TasksPlugin) CollectContext(ctx context.Context, hive *regf.Hive, opts Options, emit Emitter) error {
+	cache, err := hive.GetKey(taskCachePath)
+	if err != nil {
+		return notFound("no TaskCache keys")
 	}
 
-	fmt.Println("Scheduled Tasks:")
-	fmt.Println(strings.Repeat("=", 80))
+	tasks := make(map[string]*regf.Key)
+	var taskOrder []string
+	if key, err := getSubkey(cache, "Tasks"); err == nil {
+		for _, k := range key.Subkeys() {
+			id := strings.ToUpper(k.Name())
+			tasks[id] = k
+			taskOrder = append(taskOrder, id)
+		}
+	}
+	lists := make(map[string][]string)
+	for _, list := range taskLists {
+		if key, err := getSubkey(cache, list); err == nil {
+			for _, k := range key.Subkeys() {
+				id := strings.ToUpper(k.Name())
+				lists[id] = append(lists[id], list)
+			}
+		}
+	}
 
-	found := false
-	for _, path := range paths {
-		key, err := hive.GetKey(path)
-		if err != nil {
-			continue
-		}
-
-		found = true
-		fmt.Printf("\n%s:\n", path)
-		fmt.Printf("Last Write: %s\n\n", key.Timestamp().Format("2006-01-02 15:04:05"))
-
-		// Enumerate task GUIDs or names
-		for _, subkey := range key.Subkeys() {
-			fmt.Printf("  Task: %s\n", subkey.Name())
-			fmt.Printf("  Last Write: %s\n", subkey.Timestamp().Format("2006-01-02 15:04:05"))
-
-			for _, val := range subkey.Values() {
-				valStr := GetValueString(val)
-				switch val.Name() {
-				case "Path":
-					fmt.Printf("    Path: %s\n", valStr)
-				case "Author":
-					fmt.Printf("    Author: %s\n", valStr)
-				case "URI":
-					fmt.Printf("    URI: %s\n", valStr)
-				case "Actions":
-					if len(val.Bytes()) > 0 {
-						fmt.Printf("    Actions: (binary data, %d bytes)\n", len(val.Bytes()))
-					}
+	sids := SIDResolverFrom(ctx, "SOFTWARE", hive)
+	var failed []error
+	emitTask := func(t scheduledTask) {
+		if ctx.Err() != nil {
+			return
+		}
+		r, errs := t.record(lists, sids)
+		failed = append(failed, errs...)
+		emit(r)
+	}
+
+	// Tasks named in Tree, then those only present in Tasks
+	joined := make(map[string]bool)
+	if tree, err := getSubkey(cache, "Tree"); err == nil {
+		walkTaskTree(tree, joinKeyPath(taskCachePath, "Tree"), "", 0, func(t scheduledTask) {
+			t.task = tasks[t.id]
+			joined[t.id] = true
+			emitTask(t)
+		})
+	}
+	for _, id := range taskOrder {
+		if !joined[id] {
+			emitTask(scheduledTask{id: id, task: tasks[id]})
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(failed) > 0 {
+		return partial(failed)
+	}
+	return nil
+}
+
+// scheduledTask is a task joined from its Tree key, which may be missing,
+// and its Tasks key, which may be missing too.
+type scheduledTask struct {
+	id       string
+	path     string
+	treePath string
+	tree     *regf.Key
+	task     *regf.Key
+}
+
+// maxTaskTreeDepth bounds the walk of corrupt or looping Tree keys.
+const maxTaskTreeDepth = 32
+
+// walkTaskTree calls fn for every key of the Tree with an Id value; other
+// keys are folders.
+func walkTaskTree(key *regf.Key, keyPath, taskPath string, depth int, fn func(scheduledTask)) {
+	if depth >= maxTaskTreeDepth {
+		return
+	}
+	for _, sk := range key.Subkeys() {
+		path := taskPath + "\\" + sk.Name()
+		skPath := joinKeyPath(keyPath, sk.Name())
+		if v, err := getValue(sk, "Id"); err == nil {
+			fn(scheduledTask{
+				id:       strings.ToUpper(GetValueString(v)),
+				path:     path,
+				treePath: skPath,
+				tree:     sk,
+			})
+		}
+		walkTaskTree(sk, skPath, path, depth+1, fn)
+	}
+}
+
+// record builds the record of the task, naming its principal with sids.
+// Blobs that fail to decode are reported and the rest of the task is kept.
+func (t scheduledTask) record(lists map[string][]string, sids *SIDResolver) (*Record, []error) {
+	var errs []error
+	var r *Record
+	if t.tree != nil {
+		r = NewRecord(t.treePath, t.tree)
+	} else {
+		r = NewRecord(joinKeyPath(taskCachePath, "Tasks", t.task.Name()), t.task)
+	}
+
+	path := t.path
+	if path == "" && t.task != nil {
+		if v, err := getValue(t.task, "Path"); err == nil {
+			path = GetValueString(v)
+		}
+	}
+	r.AddString("Task", path).
+		AddString("Id", t.id)
+	if t.task != nil {
+		for _, name := range []string{"URI", "Author", "Description", "Source", "Date"} {
+			if v, err := getValue(t.task, name); err == nil {
+				if s := GetValueString(v); s != "" {
+					r.AddString(name, s)
 				}
 			}
-			fmt.Println()
 		}
 	}
+	if l := lists[t.id]; len(l) > 0 {
+		r.AddStrings("Lists", l)
+	}
 
-	if !found {
-		fmt.Println("No scheduled tasks found")
+	if t.tree != nil {
+		hidden := false
+		if v, err := getValue(t.tree, "Index"); err == nil && len(v.Bytes()) >= 4 {
+			index := binary.LittleEndian.Uint32(v.Bytes())
+			r.AddInt("Index", int64(index))
+			hidden = index == 0
+		}
+		_, err := getValue(t.tree, "SD")
+		r.AddBool("SD Present", err == nil)
+		hidden = hidden || err != nil
+		r.AddBool("Hidden", hidden)
+		if hidden {
+			r.WithSeverity(SeverityWarning).WithTags("hidden")
+		}
 	}
+	r.WithTags("persistence")
 
-	return nil
+	if t.task == nil {
+		return r, nil
+	}
+	if v, err := getValue(t.task, "Actions"); err == nil && len(v.Bytes()) > 0 {
+		principal, actions, err := decodeTaskActions(v.Bytes())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s actions: %w", t.id, err))
+		}
+		addTaskActions(r, principal, actions)
+		if strings.HasPrefix(principal, "S-1-") {
+			if account := sids.Account(principal); account != "" {
+				r.AddString("Context Account", account)
+			}
+		}
+	}
+	if v, err := getValue(t.task, "Triggers"); err == nil && len(v.Bytes()) > 0 {
+		triggers, err := decodeTaskTriggers(v.Bytes())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s triggers: %w", t.id, err))
+		} else {
+			if len(triggers.Types) > 0 {
+				r.AddStrings("Triggers", triggers.Types)
+			}
+			addTaskTimes(r, taskTime{"Start Boundary", triggers.StartBoundary}, taskTime{"End Boundary", triggers.EndBoundary})
+		}
+	}
+	if v, err := getValue(t.task, "DynamicInfo"); err == nil && len(v.Bytes()) > 0 {
+		info, err := decodeTaskDynamicInfo(v.Bytes())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s dynamic info: %w", t.id, err))
+		} else {
+			addTaskTimes(r, taskTime{"Created", info.Created}, taskTime{"Last Run", info.LastRun},
+				taskTime{"Last Completed", info.LastCompleted})
+			if !info.LastRun.IsZero() {
+				r.AddString("Last Result", fmt.Sprintf("0x%08X", info.LastResult))
+			}
+		}
+	}
+	return r, errs
+}
+
+// taskTime is a named time of a task.
+type taskTime struct {
+	name  string
+	value time.Time
+}
+
+// addTaskTimes adds the times that are set.
+func addTaskTimes(r *Record, times ...taskTime) {
+	for _, t := range times {
+		if !t.value.IsZero() {
+			r.AddTime(t.name, t.value)
+		}
+	}
+}
+
+// addTaskActions adds the principal, the action lines and the command or
+// handler of the first Exec and ComHandler actions.
+func addTaskActions(r *Record, principal string, actions []taskAction) {
+	if principal != "" {
+		r.AddString("Context", principal)
+	}
+	if len(actions) == 0 {
+		return
+	}
+	lines := make([]string, len(actions))
+	for i, a := range actions {
+		lines[i] = a.String()
+	}
+	r.AddStrings("Actions", lines)
+	for _, a := range actions {
+		if a.Type == TaskActionExec {
+			r.AddString("Command", a.Command)
+			if a.Arguments != "" {
+				r.AddString("Arguments", a.Arguments)
+			}
+			break
+		}
+	}
+	for _, a := range actions {
+		if a.Type == TaskActionComHandler {
+			r.AddString("COM Handler", a.CLSID)
+			break
+		}
+	}
 }
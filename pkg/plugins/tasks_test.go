@@ -0,0 +1,110 @@
+package plugins
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// taskString encodes a TaskCache string: its size in bytes, then UTF-16.
+func taskString(s string) []byte {
+	return concat(le32(len(utf16le(s))), utf16le(s))
+}
+
+func TestTasksJoinsTreeAndDecodesBlobs(t *testing.T) {
+	const defragID, updaterID, orphanID = "{11111111-0000-0000-0000-000000000001}",
+		"{22222222-0000-0000-0000-000000000002}", "{33333333-0000-0000-0000-000000000003}"
+	created := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	lastRun := time.Date(2024, 6, 7, 8, 9, 10, 0, time.UTC)
+	completed := lastRun.Add(time.Minute)
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	clsid := []byte{0xE0, 0x4F, 0xD0, 0x20, 0xEA, 0x3A, 0x69, 0x10, 0xA2, 0xD8, 0x08, 0x00, 0x2B, 0x30, 0x30, 0x9D}
+
+	execActions := concat(le16(3), taskString("Author"),
+		le16(0x6666), taskString(""), taskString(`C:\Windows\system32\defrag.exe`), taskString("-c -h"),
+		taskString(""), le16(0))
+	comActions := concat(le16(3), taskString("LocalSystem"),
+		le16(0x7777), taskString(""), clsid, taskString(""))
+	triggers := concat([]byte{0x17, 0, 0, 0, 0, 0, 0, 0}, le64(filetime(start)), le64(0),
+		le32(0x42), le32(0), le32(0xDDDD), le32(0))
+	dynamicInfo := concat(le32(3), le64(filetime(created)), le64(filetime(lastRun)), le32(0), le32(0x41301),
+		le64(filetime(completed)))
+
+	taskCache := key("TaskCache",
+		key("Tree",
+			key("Microsoft", key("Windows", key("Defrag", key("ScheduledDefrag").with(
+				szValue("Id", defragID), dwordValue("Index", 3), binValue("SD", []byte{1, 0, 4, 0x80}),
+			)))),
+			key("Updater").with(szValue("Id", updaterID), dwordValue("Index", 0)),
+		),
+		key("Tasks",
+			key(defragID).with(
+				szValue("Path", `\Microsoft\Windows\Defrag\ScheduledDefrag`),
+				szValue("Author", "Microsoft Corporation"),
+				binValue("Actions", execActions),
+				binValue("Triggers", triggers),
+				binValue("DynamicInfo", dynamicInfo),
+			),
+			key(updaterID).with(binValue("Actions", comActions)),
+			key(orphanID).with(szValue("Path", `\Orphan`)),
+		),
+		key("Plain", key(defragID)),
+		key("Boot", key(updaterID)),
+	)
+	hive := newTestHive(t, key("ROOT", key("Microsoft", key("Windows NT", key("CurrentVersion", key("Schedule", taskCache))))))
+
+	records, err := Collect(&TasksPlugin{}, hive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]string{
+		{"Task": `\Microsoft\Windows\Defrag\ScheduledDefrag`, "Id": defragID, "Author": "Microsoft Corporation",
+			"Lists": "Plain", "Index": "3", "Hidden": "false", "Context": "Author",
+			"Command": `C:\Windows\system32\defrag.exe`, "Arguments": "-c -h", "Triggers": "Time",
+			"Start Boundary": FormatTime(start), "Created": FormatTime(created), "Last Run": FormatTime(lastRun),
+			"Last Completed": FormatTime(completed), "Last Result": "0x00041301"},
+		{"Task": `\Updater`, "Id": updaterID, "Lists": "Boot", "Index": "0", "SD Present": "false",
+			"Hidden": "true", "Context": "LocalSystem", "COM Handler": "{20D04FE0-3AEA-1069-A2D8-08002B30309D}"},
+		{"Task": `\Orphan`, "Id": orphanID},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("expected %d records, got %d", len(want), len(records))
+	}
+	for i, fields := range want {
+		for name, value := range fields {
+			if f, ok := records[i].Get(name); !ok || FormatValue(f) != value {
+				t.Errorf("record %d: %s = %v, want %s", i, name, f.Value, value)
+			}
+		}
+	}
+	if f, _ := records[0].Get("Actions"); !strings.HasPrefix(FormatValue(f), `Exec: C:\Windows\system32\defrag.exe -c -h`) {
+		t.Errorf("unexpected actions %v", f.Value)
+	}
+	if records[0].Severity != SeverityInfo || records[1].Severity != SeverityWarning || !records[1].HasTag("hidden") {
+		t.Errorf("unexpected severities %v %v", records[0].Severity, records[1].Severity)
+	}
+	if _, ok := records[2].Get("Hidden"); ok {
+		t.Errorf("unexpected Hidden field without a Tree key")
+	}
+}
+
+func TestDecodeTaskActionsEmailAndMessage(t *testing.T) {
+	data := concat(le16(1),
+		le16(0x8888), taskString("mail"), taskString("a@example.org"), taskString("b@example.org"),
+		taskString(""), taskString(""), taskString(""), taskString("smtp.example.org"), taskString("hi"),
+		taskString("body"), le32(1), taskString(`C:\x.txt`), le32(1), taskString("X-A"), taskString("1"),
+		le16(0x9999), taskString(""), taskString("Title"), taskString("Text"))
+	principal, actions, err := decodeTaskActions(data)
+	if err != nil || principal != "" || len(actions) != 2 {
+		t.Fatalf("got %q %+v %v", principal, actions, err)
+	}
+	if got := actions[0].String(); got != "Email: to b@example.org via smtp.example.org: hi" {
+		t.Errorf("unexpected email action %q", got)
+	}
+	if actions[0].Attachments[0] != `C:\x.txt` || actions[1].String() != "MessageBox: Title: Text" {
+		t.Errorf("unexpected actions %+v", actions)
+	}
+	if _, _, err := decodeTaskActions(data[:len(data)-3]); err == nil {
+		t.Errorf("expected an error for a truncated blob")
+	}
+}
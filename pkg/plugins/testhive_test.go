@@ -0,0 +1,193 @@
+package plugins
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
+)
+
+// testKey describes a key of a synthetic hive built by newTestHive.
+type testKey struct {
+	name      string
+	class     string
+	timestamp time.Time
+	values    []testValue
+	subkeys   []*testKey
+}
+
+// testValue describes a value of a synthetic hive.
+type testValue struct {
+	name     string
+	dataType uint32
+	data     []byte
+}
+
+// key returns a test key with the given subkeys.
+func key(name string, subkeys ...*testKey) *testKey {
+	return &testKey{name: name, subkeys: subkeys}
+}
+
+// with adds values to the key and returns it.
+func (k *testKey) with(values ...testValue) *testKey {
+	k.values = append(k.values, values...)
+	return k
+}
+
+// at sets the LastWrite time of the key and returns it.
+func (k *testKey) at(t time.Time) *testKey {
+	k.timestamp = t
+	return k
+}
+
+func szValue(name, s string) testValue {
+	return testValue{name: name, dataType: regSZ, data: utf16le(s + "\x00")}
+}
+
+func dwordValue(name string, n uint32) testValue {
+	data := make([]byte, 4)
+	binary.LittleEndian.PutUint32(data, n)
+	return testValue{name: name, dataType: regDWORD, data: data}
+}
+
+func binValue(name string, data []byte) testValue {
+	return testValue{name: name, dataType: regBinary, data: data}
+}
+
+func utf16le(s string) []byte {
+	u := utf16.Encode([]rune(s))
+	b := make([]byte, len(u)*2)
+	for i, c := range u {
+		binary.LittleEndian.PutUint16(b[i*2:], c)
+	}
+	return b
+}
+
+func filetime(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(t.UnixNano()/100) + 116444736000000000
+}
+
+// hiveWriter lays out cells in a single hive bin.
+type hiveWriter struct {
+	bin []byte
+}
+
+// alloc appends an allocated cell holding payload and returns its offset
+// relative to the start of the hive bins.
+func (w *hiveWriter) alloc(payload []byte) uint32 {
+	offset := uint32(len(w.bin))
+	size := (len(payload) + 4 + 7) &^ 7
+	cell := make([]byte, size)
+	binary.LittleEndian.PutUint32(cell, uint32(-int32(size)))
+	copy(cell[4:], payload)
+	w.bin = append(w.bin, cell...)
+	return offset
+}
+
+func (w *hiveWriter) writeKey(k *testKey, parent uint32) uint32 {
+	name := []byte(k.name)
+	nk := make([]byte, 0x4C+len(name))
+	copy(nk, "nk")
+	binary.LittleEndian.PutUint16(nk[0x02:], 0x0020) // ASCII name
+	binary.LittleEndian.PutUint64(nk[0x04:], filetime(k.timestamp))
+	binary.LittleEndian.PutUint32(nk[0x10:], parent)
+	binary.LittleEndian.PutUint32(nk[0x14:], uint32(len(k.subkeys)))
+	binary.LittleEndian.PutUint32(nk[0x24:], uint32(len(k.values)))
+	binary.LittleEndian.PutUint32(nk[0x2C:], 0xFFFFFFFF)
+	binary.LittleEndian.PutUint32(nk[0x30:], 0xFFFFFFFF)
+	binary.LittleEndian.PutUint16(nk[0x48:], uint16(len(name)))
+	copy(nk[0x4C:], name)
+
+	if k.class != "" {
+		class := utf16le(k.class)
+		binary.LittleEndian.PutUint32(nk[0x30:], w.alloc(class))
+		binary.LittleEndian.PutUint16(nk[0x4A:], uint16(len(class)))
+	}
+
+	self := w.alloc(nk)
+	// Fields are patched through w.bin once the allocation is done, as
+	// allocations may move it.
+	field := func(off uint32) []byte {
+		return w.bin[self+4+off:]
+	}
+
+	if len(k.values) > 0 {
+		list := make([]byte, 4*len(k.values))
+		for i, v := range k.values {
+			binary.LittleEndian.PutUint32(list[i*4:], w.writeValue(v))
+		}
+		listOffset := w.alloc(list)
+		binary.LittleEndian.PutUint32(field(0x28), listOffset)
+	}
+
+	if len(k.subkeys) > 0 {
+		list := make([]byte, 4+8*len(k.subkeys))
+		copy(list, "lf")
+		binary.LittleEndian.PutUint16(list[2:], uint16(len(k.subkeys)))
+		for i, sk := range k.subkeys {
+			binary.LittleEndian.PutUint32(list[4+i*8:], w.writeKey(sk, self))
+		}
+		listOffset := w.alloc(list)
+		binary.LittleEndian.PutUint32(field(0x1C), listOffset)
+	}
+
+	return self
+}
+
+func (w *hiveWriter) writeValue(v testValue) uint32 {
+	name := []byte(v.name)
+	vk := make([]byte, 0x14+len(name))
+	copy(vk, "vk")
+	binary.LittleEndian.PutUint16(vk[0x02:], uint16(len(name)))
+	binary.LittleEndian.PutUint32(vk[0x0C:], v.dataType)
+	binary.LittleEndian.PutUint16(vk[0x10:], 0x0001) // ASCII name
+	copy(vk[0x14:], name)
+
+	if len(v.data) <= 4 {
+		binary.LittleEndian.PutUint32(vk[0x04:], uint32(len(v.data))|0x80000000)
+		inline := make([]byte, 4)
+		copy(inline, v.data)
+		copy(vk[0x08:], inline)
+	} else {
+		binary.LittleEndian.PutUint32(vk[0x04:], uint32(len(v.data)))
+		binary.LittleEndian.PutUint32(vk[0x08:], w.alloc(v.data))
+	}
+
+	return w.alloc(vk)
+}
+
+// newTestHive builds an in-memory REGF hive from the given root key.
+func newTestHive(t *testing.T, root *testKey) *regf.Hive {
+	t.Helper()
+
+	w := &hiveWriter{bin: make([]byte, 0x20)}
+	rootOffset := w.writeKey(root, 0)
+
+	// Pad the bin to a page boundary and fill in its header.
+	size := (len(w.bin) + 0xFFF) &^ 0xFFF
+	if pad := size - len(w.bin); pad > 0 {
+		free := make([]byte, pad)
+		if pad >= 4 {
+			binary.LittleEndian.PutUint32(free, uint32(pad))
+		}
+		w.bin = append(w.bin, free...)
+	}
+	copy(w.bin, "hbin")
+	binary.LittleEndian.PutUint32(w.bin[8:], uint32(len(w.bin)))
+
+	header := make([]byte, 0x1000)
+	copy(header, "regf")
+	binary.LittleEndian.PutUint32(header[0x24:], rootOffset)
+
+	hive, err := regf.OpenReader(bytes.NewReader(append(header, w.bin...)))
+	if err != nil {
+		t.Fatalf("failed to open synthetic hive: %v", err)
+	}
+	return hive
+}
@@ -1,8 +1,8 @@
 package plugins
 
 import (
+	"context"
 	"fmt"
-	"strings"
 
 	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
 )
@@ -26,48 +26,62 @@ func (p *TimeZonePlugin) CompatibleHiveTypes() []string {
 	return []string{"SYSTEM"}
 }
 
-func (p *TimeZonePlugin) Run(hive *regf.Hive) error {
-	// Find current ControlSet
-	selectKey, err := hive.GetKey("Select")
-	if err != nil {
-		return err
-	}
-
-	var currentNum uint32 = 1
-	for _, v := range selectKey.Values() {
-		if strings.EqualFold(v.Name(), "Current") && v.Type() == 4 {
-			data := v.Bytes()
-			if len(data) >= 4 {
-				currentNum = uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16 | uint32(data[3])<<24
-			}
-		}
+func (p *TimeZonePlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategorySystem,
+		Techniques: []string{"T1124"},
+		Artifact:   "Time zone settings, needed to interpret local timestamps.",
+		References: []string{regRipperReference},
+		Version:    "1.1.0",
+		Schema: []FieldSpec{
+			{Name: "Timezone", Type: FieldString, Description: "time zone key name"},
+			{Name: "Standard Name", Type: FieldString, Description: "standard time name"},
+			{Name: "Daylight Name", Type: FieldString, Description: "daylight saving time name"},
+			{Name: "UTC Offset", Type: FieldString, Description: "offset of standard time"},
+			{Name: "Daylight Offset", Type: FieldString, Description: "offset of daylight saving time, if observed"},
+			{Name: "Rule", Type: FieldString, Description: "POSIX TZ rule used by -tz hive"},
+		},
 	}
+}
 
-	controlSet := fmt.Sprintf("ControlSet%03d", currentNum)
-	tzPath := fmt.Sprintf("%s\\Control\\TimeZoneInformation", controlSet)
+func (p *TimeZonePlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
 
-	tzKey, err := hive.GetKey(tzPath)
-	if err != nil {
-		return fmt.Errorf("timezone key not found: %w", err)
-	}
+func (p *TimeZonePlugin) Options() []Option {
+	return []Option{controlSetOption}
+}
 
-	fmt.Println("Timezone Information")
-	fmt.Println("====================")
-	fmt.Println()
+func (p *TimeZonePlugin) Collect(hive *regf.Hive, emit Emitter) error {
+	return p.CollectContext(context.Background(), hive, DefaultOptions(p), emit)
+}
 
-	for _, val := range tzKey.Values() {
-		name := val.Name()
-		switch {
-		case strings.EqualFold(name, "TimeZoneKeyName"):
-			fmt.Printf("Timezone: %s\n", GetValueString(val))
-		case strings.EqualFold(name, "StandardName"):
-			fmt.Printf("Standard Name: %s\n", GetValueString(val))
-		case strings.EqualFold(name, "DaylightName"):
-			fmt.Printf("Daylight Name: %s\n", GetValueString(val))
+func (p *TimeZonePlugin) CollectContext(ctx context.Context, hive *regf.Hive, opts Options, emit Emitter) error {
+	return forEachControlSet(ctx, hive, opts, emit, func(controlSet string, emit Emitter) error {
+		tzPath := controlSet + "\\Control\\TimeZoneInformation"
+		tzKey, err := hive.GetKey(tzPath)
+		if err != nil {
+			return fmt.Errorf("timezone key not found: %w", err)
 		}
-	}
 
-	fmt.Printf("Last Modified: %s\n", tzKey.Timestamp().Format("2006-01-02 15:04:05"))
+		tz := readTimeZone(tzKey)
+		r := NewRecord(tzPath, tzKey)
+		if tz.KeyName != "" {
+			r.AddString("Timezone", tz.KeyName)
+		}
+		if tz.StandardName != "" {
+			r.AddString("Standard Name", tz.StandardName)
+		}
+		if tz.DaylightName != "" {
+			r.AddString("Daylight Name", tz.DaylightName)
+		}
+		r.AddString("UTC Offset", "UTC"+formatOffset(tz.offset(tz.StandardBias)))
+		if tz.hasDaylight() {
+			r.AddString("Daylight Offset", "UTC"+formatOffset(tz.offset(tz.DaylightBias)))
+		}
+		r.AddString("Rule", tz.posixRule())
+		emit(r)
 
-	return nil
+		return nil
+	})
 }
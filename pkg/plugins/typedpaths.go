@@ -25,7 +25,25 @@ func (p *TypedPathsPlugin) CompatibleHiveTypes() []string {
 	return []string{"NTUSER.DAT"}
 }
 
+func (p *TypedPathsPlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategoryUserActivity,
+		Techniques: []string{"T1083"},
+		Artifact:   "Paths typed into the Explorer address bar.",
+		References: []string{regRipperReference},
+		Version:    "1.0.0",
+		Schema: []FieldSpec{
+			{Name: "Value", Type: FieldString, Description: "value name"},
+			{Name: "Path", Type: FieldString, Description: "typed path"},
+		},
+	}
+}
+
 func (p *TypedPathsPlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
+
+func (p *TypedPathsPlugin) Collect(hive *regf.Hive, emit Emitter) error {
 	path := "Software\\Microsoft\\Windows\\CurrentVersion\\Explorer\\TypedPaths"
 
 	key, err := hive.GetKey(path)
@@ -33,14 +51,11 @@ func (p *TypedPathsPlugin) Run(hive *regf.Hive) error {
 		return fmt.Errorf("TypedPaths key not found: %w", err)
 	}
 
-	fmt.Println("Typed Paths (Windows Explorer)")
-	fmt.Println("==============================")
-	fmt.Printf("Last Modified: %s\n", key.Timestamp().Format("2006-01-02 15:04:05"))
-	fmt.Println()
-
 	for _, val := range key.Values() {
 		if val.Name() != "" {
-			fmt.Printf("%s: %s\n", val.Name(), GetValueString(val))
+			emit(NewRecord(path, key).
+				AddString("Value", val.Name()).
+				AddString("Path", GetValueString(val)))
 		}
 	}
 
@@ -25,7 +25,25 @@ func (p *TypedURLsPlugin) CompatibleHiveTypes() []string {
 	return []string{"NTUSER.DAT"}
 }
 
+func (p *TypedURLsPlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategoryUserActivity,
+		Techniques: []string{"T1217"},
+		Artifact:   "URLs typed into the Internet Explorer address bar.",
+		References: []string{regRipperReference},
+		Version:    "1.0.0",
+		Schema: []FieldSpec{
+			{Name: "Value", Type: FieldString, Description: "value name"},
+			{Name: "URL", Type: FieldString, Description: "typed URL"},
+		},
+	}
+}
+
 func (p *TypedURLsPlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
+
+func (p *TypedURLsPlugin) Collect(hive *regf.Hive, emit Emitter) error {
 	path := "Software\\Microsoft\\Internet Explorer\\TypedURLs"
 
 	key, err := hive.GetKey(path)
@@ -33,14 +51,11 @@ func (p *TypedURLsPlugin) Run(hive *regf.Hive) error {
 		return fmt.Errorf("TypedURLs key not found: %w", err)
 	}
 
-	fmt.Println("Typed URLs (Internet Explorer)")
-	fmt.Println("==============================")
-	fmt.Printf("Last Modified: %s\n", key.Timestamp().Format("2006-01-02 15:04:05"))
-	fmt.Println()
-
 	for _, val := range key.Values() {
 		if val.Name() != "" && val.Name() != "(Default)" {
-			fmt.Printf("%s: %s\n", val.Name(), GetValueString(val))
+			emit(NewRecord(path, key).
+				AddString("Value", val.Name()).
+				AddString("URL", GetValueString(val)))
 		}
 	}
 
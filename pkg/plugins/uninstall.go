@@ -1,9 +1,6 @@
 package plugins
 
 import (
-	"fmt"
-	"strings"
-
 	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
 )
 
@@ -26,23 +23,40 @@ func (p *UninstallPlugin) CompatibleHiveTypes() []string {
 	return []string{"SOFTWARE"}
 }
 
+func (p *UninstallPlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategorySoftware,
+		Techniques: []string{"T1518"},
+		Artifact:   "Uninstall entries for installed programs.",
+		References: []string{regRipperReference},
+		Version:    "1.0.0",
+		Schema: []FieldSpec{
+			{Name: "Program", Type: FieldString, Description: "display name"},
+			{Name: "Version", Type: FieldString, Description: "display version"},
+			{Name: "Publisher", Type: FieldString, Description: "publisher"},
+			{Name: "Install Date", Type: FieldString, Description: "install date as recorded"},
+			{Name: "Uninstall", Type: FieldString, Description: "uninstall command"},
+		},
+	}
+}
+
 func (p *UninstallPlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
+
+func (p *UninstallPlugin) Collect(hive *regf.Hive, emit Emitter) error {
 	paths := []string{
 		"Microsoft/Windows/CurrentVersion/Uninstall",
 		"Wow6432Node/Microsoft/Windows/CurrentVersion/Uninstall",
 	}
 
-	fmt.Println("Uninstall Registry Entries:")
-	fmt.Println(strings.Repeat("=", 80))
-
-	count := 0
+	found := false
 	for _, basePath := range paths {
 		key, err := hive.GetKey(basePath)
 		if err != nil {
 			continue
 		}
-
-		fmt.Printf("\n%s:\n", basePath)
+		found = true
 
 		for _, subkey := range key.Subkeys() {
 			var displayName, displayVersion, publisher, installDate, uninstallString string
@@ -64,25 +78,27 @@ func (p *UninstallPlugin) Run(hive *regf.Hive) error {
 			}
 
 			if displayName != "" {
-				count++
-				fmt.Printf("\n[%d] %s\n", count, displayName)
+				r := NewRecord(joinKeyPath(basePath, subkey.Name()), subkey).
+					AddString("Program", displayName)
 				if displayVersion != "" {
-					fmt.Printf("    Version: %s\n", displayVersion)
+					r.AddString("Version", displayVersion)
 				}
 				if publisher != "" {
-					fmt.Printf("    Publisher: %s\n", publisher)
+					r.AddString("Publisher", publisher)
 				}
 				if installDate != "" {
-					fmt.Printf("    Install Date: %s\n", installDate)
+					r.AddString("Install Date", installDate)
 				}
 				if uninstallString != "" {
-					fmt.Printf("    Uninstall: %s\n", uninstallString)
+					r.AddString("Uninstall", uninstallString)
 				}
-				fmt.Printf("    Last Write: %s\n", subkey.Timestamp().Format("2006-01-02 15:04:05"))
+				emit(r)
 			}
 		}
 	}
 
-	fmt.Printf("\nTotal programs found: %d\n", count)
+	if !found {
+		return notFound("no Uninstall keys")
+	}
 	return nil
 }
@@ -1,8 +1,8 @@
 package plugins
 
 import (
+	"context"
 	"fmt"
-	"strings"
 
 	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
 )
@@ -26,33 +26,60 @@ func (p *USBPlugin) CompatibleHiveTypes() []string {
 	return []string{"SYSTEM"}
 }
 
-func (p *USBPlugin) Run(hive *regf.Hive) error {
-	controlSetName, err := findCurrentControlSet(hive)
-	if err != nil {
-		return fmt.Errorf("failed to find current ControlSet: %w", err)
+func (p *USBPlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategoryUSB,
+		Techniques: []string{"T1091", "T1052.001"},
+		Artifact:   "Enum\\USB lists every USB device connected to the system, by vendor and product ID.",
+		References: []string{regRipperReference},
+		Version:    "1.0.0",
+		Schema: []FieldSpec{
+			{Name: "Device", Type: FieldString, Description: "VID/PID and instance"},
+			{Name: "*", Type: FieldString, Description: "device values such as FriendlyName and DeviceDesc"},
+		},
 	}
+}
 
-	usbPath := fmt.Sprintf("%s\\Enum\\USB", controlSetName)
-	usbKey, err := hive.GetKey(usbPath)
-	if err != nil {
-		return fmt.Errorf("USB key not found: %w", err)
-	}
+func (p *USBPlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
 
-	fmt.Println("USB Devices (Enumerated):")
-	fmt.Println(strings.Repeat("=", 80))
+func (p *USBPlugin) Options() []Option {
+	return []Option{controlSetOption}
+}
 
-	for _, deviceClass := range usbKey.Subkeys() {
-		for _, device := range deviceClass.Subkeys() {
-			fmt.Printf("\nDevice: %s\\%s\n", deviceClass.Name(), device.Name())
+func (p *USBPlugin) Collect(hive *regf.Hive, emit Emitter) error {
+	return p.CollectContext(context.Background(), hive, DefaultOptions(p), emit)
+}
 
-			for _, val := range device.Values() {
-				if val.Name() == "DeviceDesc" || val.Name() == "FriendlyName" ||
-					val.Name() == "Mfg" || val.Name() == "Service" {
-					fmt.Printf("  %s: %s\n", val.Name(), GetValueString(val))
+func (p *USBPlugin) CollectContext(ctx context.Context, hive *regf.Hive, opts Options, emit Emitter) error {
+	return forEachControlSet(ctx, hive, opts, emit, func(controlSetName string, emit Emitter) error {
+		usbPath := fmt.Sprintf("%s\\Enum\\USB", controlSetName)
+		usbKey, err := hive.GetKey(usbPath)
+		if err != nil {
+			return fmt.Errorf("USB key not found: %w", err)
+		}
+
+		for _, deviceClass := range usbKey.Subkeys() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			for _, device := range deviceClass.Subkeys() {
+				r := NewRecord(joinKeyPath(usbPath, deviceClass.Name(), device.Name()), device).
+					AddString("Device", deviceClass.Name()+"\\"+device.Name()).
+					WithTags("usb")
+
+				for _, val := range device.Values() {
+					if val.Name() == "DeviceDesc" || val.Name() == "FriendlyName" ||
+						val.Name() == "Mfg" || val.Name() == "Service" {
+						r.AddString(val.Name(), GetValueString(val))
+					}
 				}
+				emit(r)
 			}
 		}
-	}
 
-	return nil
+		return nil
+	})
 }
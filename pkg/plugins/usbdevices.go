@@ -1,7 +1,7 @@
 package plugins
 
 import (
-	"fmt"
+	"context"
 	"strings"
 
 	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
@@ -26,33 +26,62 @@ func (p *USBDevicesPlugin) CompatibleHiveTypes() []string {
 	return []string{"SYSTEM"}
 }
 
-func (p *USBDevicesPlugin) Run(hive *regf.Hive) error {
-	paths := []string{
-		"ControlSet001\\Enum\\USBSTOR",
-		"ControlSet001\\Enum\\USB",
+func (p *USBDevicesPlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategoryUSB,
+		Techniques: []string{"T1091", "T1052.001"},
+		Artifact:   "USB and USBSTOR device trees with their friendly names.",
+		References: []string{regRipperReference},
+		Version:    "1.0.0",
+		Schema: []FieldSpec{
+			{Name: "Device", Type: FieldString, Description: "device key name"},
+			{Name: "Depth", Type: FieldInt, Description: "depth below the enumerator"},
+			{Name: "Name", Type: FieldString, Description: "friendly name"},
+		},
 	}
+}
 
-	fmt.Println("USB Devices")
-	fmt.Println("===========")
-	fmt.Println()
+func (p *USBDevicesPlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
 
-	for _, basePath := range paths {
-		key, err := hive.GetKey(basePath)
-		if err != nil {
-			continue
+func (p *USBDevicesPlugin) Options() []Option {
+	return []Option{controlSetOption}
+}
+
+func (p *USBDevicesPlugin) Collect(hive *regf.Hive, emit Emitter) error {
+	return p.CollectContext(context.Background(), hive, DefaultOptions(p), emit)
+}
+
+func (p *USBDevicesPlugin) CollectContext(ctx context.Context, hive *regf.Hive, opts Options, emit Emitter) error {
+	return forEachControlSet(ctx, hive, opts, emit, func(controlSet string, emit Emitter) error {
+		paths := []string{
+			controlSet + "\\Enum\\USBSTOR",
+			controlSet + "\\Enum\\USB",
 		}
 
-		fmt.Printf("[%s]\n", basePath)
-		p.listUSBDevices(key, 0)
-		fmt.Println()
-	}
+		found := false
+		for _, basePath := range paths {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			key, err := hive.GetKey(basePath)
+			if err != nil {
+				continue
+			}
+			found = true
+
+			p.listUSBDevices(basePath, key, 0, emit)
+		}
 
-	return nil
+		if !found {
+			return notFound("no USB or USBSTOR enum keys")
+		}
+		return nil
+	})
 }
 
-func (p *USBDevicesPlugin) listUSBDevices(key *regf.Key, depth int) {
-	indent := strings.Repeat("  ", depth)
-
+func (p *USBDevicesPlugin) listUSBDevices(path string, key *regf.Key, depth int, emit Emitter) {
 	// Check for FriendlyName or DeviceDesc
 	friendlyName := ""
 	for _, val := range key.Values() {
@@ -63,14 +92,19 @@ func (p *USBDevicesPlugin) listUSBDevices(key *regf.Key, depth int) {
 		}
 	}
 
-	if friendlyName != "" {
-		fmt.Printf("%s%s: %s\n", indent, key.Name(), friendlyName)
-	} else if depth > 0 {
-		fmt.Printf("%s%s\n", indent, key.Name())
+	if friendlyName != "" || depth > 0 {
+		r := NewRecord(path, key).
+			AddString("Device", key.Name()).
+			AddInt("Depth", int64(depth)).
+			WithTags("usb")
+		if friendlyName != "" {
+			r.AddString("Name", friendlyName)
+		}
+		emit(r)
 	}
 
 	// Recurse into subkeys
 	for _, subkey := range key.Subkeys() {
-		p.listUSBDevices(subkey, depth+1)
+		p.listUSBDevices(joinKeyPath(path, subkey.Name()), subkey, depth+1, emit)
 	}
 }
@@ -1,8 +1,8 @@
 package plugins
 
 import (
+	"context"
 	"fmt"
-	"strings"
 
 	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
 )
@@ -26,34 +26,62 @@ func (p *USBSTORPlugin) CompatibleHiveTypes() []string {
 	return []string{"SYSTEM"}
 }
 
-func (p *USBSTORPlugin) Run(hive *regf.Hive) error {
-	controlSetName, err := findCurrentControlSet(hive)
-	if err != nil {
-		return fmt.Errorf("failed to find current ControlSet: %w", err)
+func (p *USBSTORPlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategoryUSB,
+		Techniques: []string{"T1091", "T1052.001"},
+		Artifact:   "USBSTOR lists USB mass storage devices by vendor, product and serial number.",
+		References: []string{regRipperReference},
+		Version:    "1.0.0",
+		Schema: []FieldSpec{
+			{Name: "Device", Type: FieldString, Description: "device type, vendor and product"},
+			{Name: "Serial", Type: FieldString, Description: "serial number (instance ID)"},
+			{Name: "*", Type: FieldString, Description: "device values such as FriendlyName"},
+		},
 	}
+}
 
-	usbstorPath := fmt.Sprintf("%s\\Enum\\USBSTOR", controlSetName)
-	usbstorKey, err := hive.GetKey(usbstorPath)
-	if err != nil {
-		return fmt.Errorf("USBSTOR key not found: %w", err)
-	}
+func (p *USBSTORPlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
 
-	fmt.Println("USB Storage Devices:")
-	fmt.Println(strings.Repeat("=", 80))
+func (p *USBSTORPlugin) Options() []Option {
+	return []Option{controlSetOption}
+}
 
-	for _, deviceType := range usbstorKey.Subkeys() {
-		for _, instance := range deviceType.Subkeys() {
-			fmt.Printf("\nDevice: %s\n", deviceType.Name())
-			fmt.Printf("  Serial: %s\n", instance.Name())
+func (p *USBSTORPlugin) Collect(hive *regf.Hive, emit Emitter) error {
+	return p.CollectContext(context.Background(), hive, DefaultOptions(p), emit)
+}
 
-			for _, val := range instance.Values() {
-				if val.Name() == "FriendlyName" || val.Name() == "DeviceDesc" ||
-					val.Name() == "ParentIdPrefix" {
-					fmt.Printf("  %s: %s\n", val.Name(), GetValueString(val))
+func (p *USBSTORPlugin) CollectContext(ctx context.Context, hive *regf.Hive, opts Options, emit Emitter) error {
+	return forEachControlSet(ctx, hive, opts, emit, func(controlSetName string, emit Emitter) error {
+		usbstorPath := fmt.Sprintf("%s\\Enum\\USBSTOR", controlSetName)
+		usbstorKey, err := hive.GetKey(usbstorPath)
+		if err != nil {
+			return fmt.Errorf("USBSTOR key not found: %w", err)
+		}
+
+		for _, deviceType := range usbstorKey.Subkeys() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			for _, instance := range deviceType.Subkeys() {
+				r := NewRecord(joinKeyPath(usbstorPath, deviceType.Name(), instance.Name()), instance).
+					AddString("Device", deviceType.Name()).
+					AddString("Serial", instance.Name()).
+					WithTags("usb")
+
+				for _, val := range instance.Values() {
+					if val.Name() == "FriendlyName" || val.Name() == "DeviceDesc" ||
+						val.Name() == "ParentIdPrefix" {
+						r.AddString(val.Name(), GetValueString(val))
+					}
 				}
+				emit(r)
 			}
 		}
-	}
 
-	return nil
+		return nil
+	})
 }
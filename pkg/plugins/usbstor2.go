@@ -1,8 +1,11 @@
 package plugins
 
 import (
+	"context"
+	"encoding/binary"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
 )
@@ -26,40 +29,105 @@ func (p *USBSTOR2Plugin) CompatibleHiveTypes() []string {
 	return []string{"SYSTEM"}
 }
 
-func (p *USBSTOR2Plugin) Run(hive *regf.Hive) error {
-	controlSetName, err := findCurrentControlSet(hive)
-	if err != nil {
-		return fmt.Errorf("failed to find current ControlSet: %w", err)
+func (p *USBSTOR2Plugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategoryUSB,
+		Techniques: []string{"T1091", "T1052.001"},
+		Artifact:   "USBSTOR devices with their first install, install, last arrival and last removal times.",
+		References: []string{regRipperReference},
+		Version:    "1.0.0",
+		Schema: []FieldSpec{
+			{Name: "Device", Type: FieldString, Description: "device type, vendor and product"},
+			{Name: "Instance", Type: FieldString, Description: "serial number (instance ID)"},
+			{Name: "First Install", Type: FieldTime, Description: "first time the device was installed"},
+			{Name: "Install", Type: FieldTime, Description: "last driver install"},
+			{Name: "Last Arrival", Type: FieldTime, Description: "last connection"},
+			{Name: "Last Removal", Type: FieldTime, Description: "last removal"},
+		},
 	}
+}
 
-	usbstorPath := fmt.Sprintf("%s\\Enum\\USBSTOR", controlSetName)
-	usbstorKey, err := hive.GetKey(usbstorPath)
-	if err != nil {
-		return fmt.Errorf("USBSTOR key not found: %w", err)
-	}
+func (p *USBSTOR2Plugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
+
+func (p *USBSTOR2Plugin) Options() []Option {
+	return []Option{controlSetOption}
+}
+
+func (p *USBSTOR2Plugin) Collect(hive *regf.Hive, emit Emitter) error {
+	return p.CollectContext(context.Background(), hive, DefaultOptions(p), emit)
+}
+
+func (p *USBSTOR2Plugin) CollectContext(ctx context.Context, hive *regf.Hive, opts Options, emit Emitter) error {
+	return forEachControlSet(ctx, hive, opts, emit, func(controlSetName string, emit Emitter) error {
+		usbstorPath := fmt.Sprintf("%s\\Enum\\USBSTOR", controlSetName)
+		usbstorKey, err := hive.GetKey(usbstorPath)
+		if err != nil {
+			return fmt.Errorf("USBSTOR key not found: %w", err)
+		}
+
+		for _, deviceType := range usbstorKey.Subkeys() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 
-	fmt.Println("USB Storage Devices (Enhanced):")
-	fmt.Println(strings.Repeat("=", 80))
-
-	for _, deviceType := range usbstorKey.Subkeys() {
-		for _, instance := range deviceType.Subkeys() {
-			fmt.Printf("\n[%s]\n", instance.Timestamp().Format("2006-01-02 15:04:05"))
-			fmt.Printf("Device: %s\n", deviceType.Name())
-			fmt.Printf("Instance: %s\n", instance.Name())
-
-			if props, err := getSubkey(instance, "Properties"); err == nil {
-				for _, guidKey := range props.Subkeys() {
-					for _, propKey := range guidKey.Subkeys() {
-						for _, val := range propKey.Values() {
-							if val.Name() == "Data" {
-								fmt.Printf("  Property: %s\n", GetValueString(val))
+			for _, instance := range deviceType.Subkeys() {
+				r := NewRecord(joinKeyPath(usbstorPath, deviceType.Name(), instance.Name()), instance).
+					AddString("Device", deviceType.Name()).
+					AddString("Instance", instance.Name()).
+					WithTags("usb")
+
+				if props, err := getSubkey(instance, "Properties"); err == nil {
+					for _, guidKey := range props.Subkeys() {
+						if !strings.EqualFold(guidKey.Name(), devicePropertyTimesGUID) {
+							continue
+						}
+						for _, propKey := range guidKey.Subkeys() {
+							name, ok := devicePropertyTimes[propKey.Name()]
+							if !ok {
+								continue
+							}
+							if t := devicePropertyTime(propKey); !t.IsZero() {
+								r.AddTime(name, t)
 							}
 						}
 					}
 				}
+				emit(r)
 			}
 		}
-	}
 
-	return nil
+		return nil
+	})
+}
+
+// devicePropertyTimesGUID is the device property set holding install and
+// connection times (DEVPKEY_Device_InstallDate and friends).
+const devicePropertyTimesGUID = "{83da6326-97a6-4088-9453-a1923f573b29}"
+
+// devicePropertyTimes maps property IDs of devicePropertyTimesGUID to names.
+var devicePropertyTimes = map[string]string{
+	"0064": "First Install",
+	"0065": "Install",
+	"0066": "Last Arrival",
+	"0067": "Last Removal",
+}
+
+// devicePropertyTime reads the FILETIME stored under a device property key.
+// Windows 7 keeps it in a "Data" value of a subkey, later versions in the
+// key's own default value.
+func devicePropertyTime(propKey *regf.Key) time.Time {
+	keys := append([]*regf.Key{propKey}, propKey.Subkeys()...)
+	for _, k := range keys {
+		for _, val := range k.Values() {
+			if val.Name() != "" && val.Name() != "Data" {
+				continue
+			}
+			if data := val.Bytes(); len(data) >= 8 {
+				return filetimeToTime(binary.LittleEndian.Uint64(data))
+			}
+		}
+	}
+	return time.Time{}
 }
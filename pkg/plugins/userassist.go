@@ -1,7 +1,10 @@
 package plugins
 
 import (
+	"encoding/binary"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
 )
@@ -25,7 +28,44 @@ func (p *UserAssistPlugin) CompatibleHiveTypes() []string {
 	return []string{"NTUSER.DAT", "USRCLASS.DAT"}
 }
 
+func (p *UserAssistPlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategoryExecution,
+		Techniques: []string{"T1204.002"},
+		Artifact:   "UserAssist counts programs and shortcuts the user started from Explorer, with the last run and focus time; names are ROT13 encoded.",
+		References: []string{
+			regRipperReference,
+			"https://learn.microsoft.com/en-us/windows/win32/shell/knownfolderid",
+		},
+		Version: "2.0.0",
+		Schema: []FieldSpec{
+			{Name: "GUID", Type: FieldString, Description: "UserAssist GUID"},
+			{Name: "Type", Type: FieldString, Description: "what the GUID counts, e.g. executables or shortcuts"},
+			{Name: "Name", Type: FieldString, Description: "decoded entry name"},
+			{Name: "Path", Type: FieldString, Description: "name with its KnownFolder ID expanded"},
+			{Name: "Session", Type: FieldInt, Description: "session ID"},
+			{Name: "Run Count", Type: FieldInt, Description: "number of runs"},
+			{Name: "Focus Count", Type: FieldInt, Description: "number of times the program got focus (Windows 7+)"},
+			{Name: "Focus Time", Type: FieldString, Description: "total time the program had focus (Windows 7+)"},
+			{Name: "Last Run", Type: FieldTime, Description: "last execution time"},
+		},
+	}
+}
+
 func (p *UserAssistPlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
+
+// userAssistTypes names the UserAssist GUIDs of Windows XP to 11.
+var userAssistTypes = map[string]string{
+	"{CEBFF5CD-ACE2-4F4F-9178-9926F41749EA}": "Executable File Execution",
+	"{F4E57C4B-2036-45F0-A9AB-443BCFE33D2F}": "Shortcut File Execution",
+	"{75048700-EF1F-11D0-9888-006097DEACF9}": "Active Desktop",
+	"{5E6AB780-7743-11CF-A12B-00AA004AE837}": "Internet Toolbar",
+	"{0D6D4F41-2994-4BA0-8FEF-620E43CD2812}": "Internet Explorer 7 Toolbar",
+}
+
+func (p *UserAssistPlugin) Collect(hive *regf.Hive, emit Emitter) error {
 	basePath := "Software\\Microsoft\\Windows\\CurrentVersion\\Explorer\\UserAssist"
 
 	key, err := hive.GetKey(basePath)
@@ -33,31 +73,78 @@ func (p *UserAssistPlugin) Run(hive *regf.Hive) error {
 		return fmt.Errorf("UserAssist key not found: %w", err)
 	}
 
-	fmt.Println("UserAssist Data (Program Execution)")
-	fmt.Println("====================================")
-	fmt.Println()
-
 	for _, guidKey := range key.Subkeys() {
-		fmt.Printf("GUID: %s\n", guidKey.Name())
-
-		countKey, err := hive.GetKey(basePath + "\\" + guidKey.Name() + "\\Count")
+		countPath := basePath + "\\" + guidKey.Name() + "\\Count"
+		countKey, err := hive.GetKey(countPath)
 		if err != nil {
 			continue
 		}
 
 		for _, val := range countKey.Values() {
-			if val.Name() != "" {
-				// ROT13 decode the name
-				decodedName := rot13(val.Name())
-				fmt.Printf("  %s\n", decodedName)
+			if val.Name() == "" {
+				continue
 			}
+			name := rot13(val.Name())
+			r := NewRecord(countPath, countKey).AddString("GUID", guidKey.Name())
+			if kind, ok := userAssistTypes[strings.ToUpper(guidKey.Name())]; ok {
+				r.AddString("Type", kind)
+			}
+			r.AddString("Name", name)
+			if path := expandKnownFolder(name); path != name {
+				r.AddString("Path", path)
+			}
+			if entry, ok := parseUserAssistEntry(val.Bytes()); ok {
+				r.AddInt("Session", int64(entry.session)).
+					AddInt("Run Count", int64(entry.runCount))
+				if entry.hasFocus {
+					r.AddInt("Focus Count", int64(entry.focusCount)).
+						AddString("Focus Time", entry.focusTime.String())
+				}
+				r.AddTime("Last Run", entry.lastRun)
+			}
+			emit(r.WithTags("execution"))
 		}
-		fmt.Println()
 	}
 
 	return nil
 }
 
+// userAssistEntry is the decoded data of a UserAssist value.
+type userAssistEntry struct {
+	session    uint32
+	runCount   uint32
+	focusCount uint32
+	focusTime  time.Duration
+	hasFocus   bool
+	lastRun    time.Time
+}
+
+// parseUserAssistEntry decodes the 16 byte Windows XP and 72 byte
+// Windows 7+ layouts. XP run counts start at 5. Other values, such as
+// UEME_CTLSESSION, are not counters.
+func parseUserAssistEntry(data []byte) (userAssistEntry, bool) {
+	var e userAssistEntry
+	switch len(data) {
+	case 16:
+		e.session = binary.LittleEndian.Uint32(data[0:])
+		e.runCount = binary.LittleEndian.Uint32(data[4:])
+		if e.runCount >= 5 {
+			e.runCount -= 5
+		}
+		e.lastRun = filetimeToTime(binary.LittleEndian.Uint64(data[8:]))
+	case 72:
+		e.session = binary.LittleEndian.Uint32(data[0:])
+		e.runCount = binary.LittleEndian.Uint32(data[4:])
+		e.focusCount = binary.LittleEndian.Uint32(data[8:])
+		e.focusTime = time.Duration(binary.LittleEndian.Uint32(data[12:])) * time.Millisecond
+		e.hasFocus = true
+		e.lastRun = filetimeToTime(binary.LittleEndian.Uint64(data[60:]))
+	default:
+		return e, false
+	}
+	return e, true
+}
+
 // rot13 decodes ROT13 encoded strings used in UserAssist
 func rot13(s string) string {
 	result := make([]byte, len(s))
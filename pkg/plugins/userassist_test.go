@@ -0,0 +1,57 @@
+package plugins
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestUserAssistDecodesData(t *testing.T) {
+	lastRun := time.Date(2023, 8, 9, 10, 11, 12, 300, time.UTC)
+	win7 := make([]byte, 72)
+	binary.LittleEndian.PutUint32(win7[0:], 1)
+	binary.LittleEndian.PutUint32(win7[4:], 7)
+	binary.LittleEndian.PutUint32(win7[8:], 3)
+	binary.LittleEndian.PutUint32(win7[12:], 90500)
+	binary.LittleEndian.PutUint64(win7[60:], filetime(lastRun))
+	xp := make([]byte, 16)
+	binary.LittleEndian.PutUint32(xp[4:], 9)
+	binary.LittleEndian.PutUint64(xp[8:], filetime(lastRun))
+
+	hive := newTestHive(t, key("ROOT", key("Software", key("Microsoft", key("Windows", key("CurrentVersion",
+		key("Explorer", key("UserAssist",
+			key("{CEBFF5CD-ACE2-4F4F-9178-9926F41749EA}", key("Count").with(
+				binValue(rot13(`{6D809377-6AF0-444B-8957-A3773F02200E}\Tool\tool.exe`), win7),
+			)),
+			key("{75048700-EF1F-11D0-9888-006097DEACF9}", key("Count").with(
+				binValue(rot13(`UEME_RUNPATH:C:\old.exe`), xp),
+			)),
+		))))))))
+
+	records, err := Collect(&UserAssistPlugin{}, hive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+	want := map[string]string{
+		"Type":        "Executable File Execution",
+		"Path":        `C:\Program Files\Tool\tool.exe`,
+		"Run Count":   "7",
+		"Focus Count": "3",
+		"Focus Time":  "1m30.5s",
+		"Last Run":    FormatTime(lastRun),
+	}
+	for name, value := range want {
+		if f, ok := records[0].Get(name); !ok || FormatValue(f) != value {
+			t.Errorf("Windows 7 entry: %s = %v, want %s", name, f.Value, value)
+		}
+	}
+	if f, _ := records[1].Get("Run Count"); FormatValue(f) != "4" {
+		t.Errorf("XP run count should drop the initial 5, got %v", f.Value)
+	}
+	if _, ok := records[1].Get("Focus Count"); ok {
+		t.Error("XP entries have no focus count")
+	}
+}
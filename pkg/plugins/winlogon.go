@@ -25,7 +25,24 @@ func (p *WinlogonPlugin) CompatibleHiveTypes() []string {
 	return []string{"SOFTWARE"}
 }
 
+func (p *WinlogonPlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategoryPersistence,
+		Techniques: []string{"T1547.004"},
+		Artifact:   "Winlogon Shell, Userinit and notification settings started at logon.",
+		References: []string{regRipperReference},
+		Version:    "1.0.0",
+		Schema: []FieldSpec{
+			{Name: "*", Type: FieldString, Description: "Winlogon values such as Shell and Userinit"},
+		},
+	}
+}
+
 func (p *WinlogonPlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
+
+func (p *WinlogonPlugin) Collect(hive *regf.Hive, emit Emitter) error {
 	path := "Microsoft\\Windows NT\\CurrentVersion\\Winlogon"
 
 	key, err := hive.GetKey(path)
@@ -33,11 +50,6 @@ func (p *WinlogonPlugin) Run(hive *regf.Hive) error {
 		return fmt.Errorf("winlogon key not found: %w", err)
 	}
 
-	fmt.Println("Winlogon Information")
-	fmt.Println("====================")
-	fmt.Printf("Last Modified: %s\n", key.Timestamp().Format("2006-01-02 15:04:05"))
-	fmt.Println()
-
 	interestingValues := []string{
 		"DefaultUserName",
 		"DefaultDomainName",
@@ -49,14 +61,16 @@ func (p *WinlogonPlugin) Run(hive *regf.Hive) error {
 		"LegalNoticeText",
 	}
 
+	r := NewRecord(path, key)
 	for _, valName := range interestingValues {
 		for _, val := range key.Values() {
 			if val.Name() == valName {
-				fmt.Printf("%s: %s\n", valName, GetValueString(val))
+				r.AddString(valName, GetValueString(val))
 				break
 			}
 		}
 	}
+	emit(r)
 
 	return nil
 }
@@ -1,7 +1,9 @@
 package plugins
 
 import (
+	"encoding/binary"
 	"fmt"
+	"time"
 
 	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
 )
@@ -25,7 +27,24 @@ func (p *WindowsVersionPlugin) CompatibleHiveTypes() []string {
 	return []string{"SOFTWARE"}
 }
 
+func (p *WindowsVersionPlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategorySystem,
+		Techniques: []string{"T1082"},
+		Artifact:   "Windows product name, build and install date.",
+		References: []string{regRipperReference},
+		Version:    "1.0.0",
+		Schema: []FieldSpec{
+			{Name: "*", Type: FieldString, Description: "CurrentVersion values; InstallDate is decoded as a time"},
+		},
+	}
+}
+
 func (p *WindowsVersionPlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
+
+func (p *WindowsVersionPlugin) Collect(hive *regf.Hive, emit Emitter) error {
 	path := "Microsoft\\Windows NT\\CurrentVersion"
 
 	key, err := hive.GetKey(path)
@@ -33,10 +52,6 @@ func (p *WindowsVersionPlugin) Run(hive *regf.Hive) error {
 		return fmt.Errorf("windows version key not found: %w", err)
 	}
 
-	fmt.Println("Windows Version Information")
-	fmt.Println("===========================")
-	fmt.Println()
-
 	values := []string{
 		"ProductName",
 		"CurrentVersion",
@@ -50,16 +65,22 @@ func (p *WindowsVersionPlugin) Run(hive *regf.Hive) error {
 		"CompositionEditionID",
 	}
 
+	r := NewRecord(path, key)
 	for _, valName := range values {
 		for _, val := range key.Values() {
-			if val.Name() == valName {
-				fmt.Printf("%s: %s\n", valName, GetValueString(val))
-				break
+			if val.Name() != valName {
+				continue
 			}
+			if valName == "InstallDate" && val.Type() == regDWORD && len(val.Bytes()) >= 4 {
+				// InstallDate is a Unix timestamp
+				r.AddTime(valName, time.Unix(int64(binary.LittleEndian.Uint32(val.Bytes())), 0).UTC())
+			} else {
+				r.AddString(valName, GetValueString(val))
+			}
+			break
 		}
 	}
-
-	fmt.Printf("\nLast Modified: %s\n", key.Timestamp().Format("2006-01-02 15:04:05"))
+	emit(r)
 
 	return nil
 }
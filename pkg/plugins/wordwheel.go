@@ -25,7 +25,25 @@ func (p *WordWheelQueryPlugin) CompatibleHiveTypes() []string {
 	return []string{"NTUSER.DAT"}
 }
 
+func (p *WordWheelQueryPlugin) Metadata() Metadata {
+	return Metadata{
+		Category:   CategoryUserActivity,
+		Techniques: []string{"T1083"},
+		Artifact:   "WordWheelQuery keeps the terms searched in Explorer.",
+		References: []string{regRipperReference},
+		Version:    "1.0.0",
+		Schema: []FieldSpec{
+			{Name: "Value", Type: FieldString, Description: "value name"},
+			{Name: "Search Term", Type: FieldString, Description: "search term"},
+		},
+	}
+}
+
 func (p *WordWheelQueryPlugin) Run(hive *regf.Hive) error {
+	return runText(p, hive)
+}
+
+func (p *WordWheelQueryPlugin) Collect(hive *regf.Hive, emit Emitter) error {
 	path := "Software\\Microsoft\\Windows\\CurrentVersion\\Explorer\\WordWheelQuery"
 
 	key, err := hive.GetKey(path)
@@ -33,18 +51,15 @@ func (p *WordWheelQueryPlugin) Run(hive *regf.Hive) error {
 		return fmt.Errorf("WordWheelQuery key not found: %w", err)
 	}
 
-	fmt.Println("Windows Search Terms")
-	fmt.Println("====================")
-	fmt.Printf("Last Modified: %s\n", key.Timestamp().Format("2006-01-02 15:04:05"))
-	fmt.Println()
-
 	for _, val := range key.Values() {
 		if val.Name() == "MRUListEx" {
 			// Binary data representing order
 			continue
 		}
 		if val.Name() != "" {
-			fmt.Printf("%s: %s\n", val.Name(), GetValueString(val))
+			emit(NewRecord(path, key).
+				AddString("Value", val.Name()).
+				AddString("Search Term", GetValueString(val)))
 		}
 	}
 
@@ -0,0 +1,263 @@
+package plugins
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Robin-Van-de-Merghel/HiveDigger/pkg/regf"
+)
+
+// TimeFormat is the layout of every timestamp HiveDigger prints: ISO 8601
+// with the full 100 ns precision of a FILETIME and the zone offset ("Z"
+// for UTC).
+const TimeFormat = "2006-01-02T15:04:05.0000000Z07:00"
+
+// ErrUnknownZone is returned by ParseZone for a zone it cannot resolve.
+var ErrUnknownZone = errors.New("unknown time zone")
+
+// ZoneHive is the ParseZone name selecting the zone the hive's own system
+// was set to.
+const ZoneHive = "hive"
+
+// ParseZone resolves the zone timestamps are shown in. It accepts "utc"
+// (the default), "local", "hive", an IANA name such as Europe/Brussels or
+// a fixed offset such as +02:00. "hive" decodes TimeZoneInformation from
+// system, which must then be a SYSTEM hive.
+func ParseZone(name string, system *regf.Hive) (*time.Location, error) {
+	switch strings.ToLower(name) {
+	case "", "utc", "z":
+		return time.UTC, nil
+	case "local":
+		return time.Local, nil
+	case ZoneHive:
+		if system == nil {
+			return nil, fmt.Errorf("%w: time zone %q needs a SYSTEM hive", ErrMissingHive, ZoneHive)
+		}
+		return HiveLocation(system)
+	}
+	if offset, ok := parseOffset(name); ok {
+		return time.FixedZone("UTC"+formatOffset(offset), offset), nil
+	}
+	zone, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownZone, name)
+	}
+	return zone, nil
+}
+
+// parseOffset parses a fixed offset such as +02:00, -0530 or UTC+1 into
+// seconds east of UTC.
+func parseOffset(s string) (int, bool) {
+	s = strings.TrimPrefix(strings.ToUpper(s), "UTC")
+	if len(s) < 2 || (s[0] != '+' && s[0] != '-') {
+		return 0, false
+	}
+	sign := 1
+	if s[0] == '-' {
+		sign = -1
+	}
+	hh, mm, ok := strings.Cut(s[1:], ":")
+	if !ok && len(hh) == 4 {
+		hh, mm = hh[:2], hh[2:]
+	}
+	hours, err := strconv.Atoi(hh)
+	if err != nil || hours > 14 {
+		return 0, false
+	}
+	minutes := 0
+	if mm != "" {
+		if minutes, err = strconv.Atoi(mm); err != nil || minutes > 59 {
+			return 0, false
+		}
+	}
+	return sign * (hours*3600 + minutes*60), true
+}
+
+// formatOffset renders seconds east of UTC as +hh:mm.
+func formatOffset(offset int) string {
+	sign := '+'
+	if offset < 0 {
+		sign, offset = '-', -offset
+	}
+	return fmt.Sprintf("%c%02d:%02d", sign, offset/3600, offset/60%60)
+}
+
+// ZoneLabel describes a zone for report headers: its name and its UTC
+// offsets, standard time first when it observes daylight saving time.
+func ZoneLabel(zone *time.Location) string {
+	if zone == nil || zone == time.UTC {
+		return "UTC"
+	}
+	year := time.Now().Year()
+	_, jan := time.Date(year, time.January, 1, 0, 0, 0, 0, zone).Zone()
+	_, jul := time.Date(year, time.July, 1, 0, 0, 0, 0, zone).Zone()
+	offsets := "UTC" + formatOffset(min(jan, jul))
+	if jan != jul {
+		offsets += ", daylight UTC" + formatOffset(max(jan, jul))
+	}
+	if zone.String() == offsets {
+		return offsets
+	}
+	return zone.String() + " (" + offsets + ")"
+}
+
+// FormatTimeIn formats a timestamp in zone with TimeFormat. A nil zone
+// means UTC.
+func FormatTimeIn(t time.Time, zone *time.Location) string {
+	if zone == nil {
+		zone = time.UTC
+	}
+	return t.In(zone).Format(TimeFormat)
+}
+
+// systemTime is a Windows SYSTEMTIME. In TimeZoneInformation transition
+// dates Year is zero, Day is the week of the month (5 meaning the last)
+// and DayOfWeek the weekday, 0 being Sunday.
+type systemTime struct {
+	Year, Month, DayOfWeek, Day, Hour, Minute, Second, Milliseconds uint16
+}
+
+// timeZoneInfo is the decoded TimeZoneInformation key. Biases are in
+// minutes and follow the Windows convention: UTC = local time + bias.
+type timeZoneInfo struct {
+	KeyName       string
+	StandardName  string
+	DaylightName  string
+	Bias          int32
+	StandardBias  int32
+	DaylightBias  int32
+	StandardStart systemTime
+	DaylightStart systemTime
+}
+
+// readTimeZone decodes the values of a TimeZoneInformation key.
+func readTimeZone(key *regf.Key) timeZoneInfo {
+	var tz timeZoneInfo
+	for _, val := range key.Values() {
+		data := val.Bytes()
+		switch strings.ToLower(val.Name()) {
+		case "timezonekeyname":
+			tz.KeyName = GetValueString(val)
+		case "standardname":
+			tz.StandardName = GetValueString(val)
+		case "daylightname":
+			tz.DaylightName = GetValueString(val)
+		case "bias":
+			tz.Bias = int32Value(data)
+		case "standardbias":
+			tz.StandardBias = int32Value(data)
+		case "daylightbias":
+			tz.DaylightBias = int32Value(data)
+		case "standardstart":
+			_ = binary.Read(bytes.NewReader(data), binary.LittleEndian, &tz.StandardStart)
+		case "daylightstart":
+			_ = binary.Read(bytes.NewReader(data), binary.LittleEndian, &tz.DaylightStart)
+		}
+	}
+	return tz
+}
+
+func int32Value(data []byte) int32 {
+	if len(data) < 4 {
+		return 0
+	}
+	return int32(binary.LittleEndian.Uint32(data))
+}
+
+// name returns the best name of the zone: the key name on Vista and later,
+// the standard name before.
+func (tz timeZoneInfo) name() string {
+	if tz.KeyName != "" {
+		return tz.KeyName
+	}
+	if tz.StandardName != "" && !strings.HasPrefix(tz.StandardName, "@") {
+		return tz.StandardName
+	}
+	return "UTC" + formatOffset(tz.offset(tz.StandardBias))
+}
+
+// offset returns the UTC offset in seconds east for the given extra bias.
+func (tz timeZoneInfo) offset(bias int32) int {
+	return -int(tz.Bias+bias) * 60
+}
+
+// hasDaylight reports whether the zone switches to daylight saving time
+// on recurring dates. Absolute, single-year dates are ignored.
+func (tz timeZoneInfo) hasDaylight() bool {
+	return tz.DaylightStart.Month != 0 && tz.StandardStart.Month != 0 &&
+		tz.DaylightStart.Year == 0 && tz.DaylightBias != tz.StandardBias
+}
+
+// posixRule renders the zone as a POSIX TZ string, the form Go uses to
+// extend zone data past its last transition.
+func (tz timeZoneInfo) posixRule() string {
+	zone := func(offset int) string {
+		return "<" + strings.ReplaceAll(formatOffset(offset), ":", "") + ">" + posixOffset(-offset)
+	}
+	rule := zone(tz.offset(tz.StandardBias))
+	if !tz.hasDaylight() {
+		return rule
+	}
+	date := func(st systemTime) string {
+		return fmt.Sprintf("M%d.%d.%d/%d:%02d:%02d", st.Month, min(max(st.Day, 1), 5), st.DayOfWeek, st.Hour, st.Minute, st.Second)
+	}
+	return rule + zone(tz.offset(tz.DaylightBias)) + "," + date(tz.DaylightStart) + "," + date(tz.StandardStart)
+}
+
+// posixOffset renders seconds as the [-]h[:mm] offset of a POSIX TZ string.
+func posixOffset(seconds int) string {
+	sign := ""
+	if seconds < 0 {
+		sign, seconds = "-", -seconds
+	}
+	if seconds%3600 == 0 {
+		return fmt.Sprintf("%s%d", sign, seconds/3600)
+	}
+	return fmt.Sprintf("%s%d:%02d", sign, seconds/3600, seconds/60%60)
+}
+
+// location builds a time.Location following the recurring rules of the
+// zone. Go only reads such rules from TZif data, so a minimal version 2
+// file without transitions is built around the POSIX rule.
+func (tz timeZoneInfo) location() (*time.Location, error) {
+	abbr := strings.ReplaceAll(formatOffset(tz.offset(tz.StandardBias)), ":", "")
+	header := func(typecnt, charcnt uint32) []byte {
+		h := make([]byte, 44)
+		copy(h, "TZif2")
+		binary.BigEndian.PutUint32(h[36:], typecnt)
+		binary.BigEndian.PutUint32(h[40:], charcnt)
+		return h
+	}
+
+	var b bytes.Buffer
+	b.Write(header(0, 0))
+	b.Write(header(1, uint32(len(abbr)+1)))
+	_ = binary.Write(&b, binary.BigEndian, int32(tz.offset(tz.StandardBias)))
+	b.Write([]byte{0, 0})
+	b.WriteString(abbr + "\x00")
+	b.WriteString("\n" + tz.posixRule() + "\n")
+	return time.LoadLocationFromTZData(tz.name(), b.Bytes())
+}
+
+// HiveLocation returns the time zone the system of a SYSTEM hive was set
+// to, decoded from TimeZoneInformation in its current control set.
+func HiveLocation(hive *regf.Hive) (*time.Location, error) {
+	cs, err := ResolveControlSets(hive)
+	if err != nil {
+		return nil, err
+	}
+	current, err := cs.Current()
+	if err != nil {
+		return nil, err
+	}
+	key, err := hive.GetKey(current.Name + `\Control\TimeZoneInformation`)
+	if err != nil {
+		return nil, fmt.Errorf("time zone not found: %w", err)
+	}
+	return readTimeZone(key).location()
+}
@@ -0,0 +1,87 @@
+package plugins
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+)
+
+func systemTimeBytes(st systemTime) []byte {
+	var b bytes.Buffer
+	_ = binary.Write(&b, binary.LittleEndian, st)
+	return b.Bytes()
+}
+
+// zoneTestHive is a SYSTEM hive set to W. Europe Standard Time.
+func zoneTestHive(t *testing.T) *testKey {
+	t.Helper()
+	bias := int32(-60)
+	return key("ROOT",
+		key("Select").with(dwordValue("Current", 1)),
+		key("ControlSet001", key("Control", key("TimeZoneInformation").with(
+			szValue("TimeZoneKeyName", "W. Europe Standard Time"),
+			szValue("StandardName", "@tzres.dll,-322"),
+			dwordValue("Bias", uint32(bias)),
+			dwordValue("StandardBias", 0),
+			dwordValue("DaylightBias", uint32(bias)),
+			binValue("StandardStart", systemTimeBytes(systemTime{Month: 10, Day: 5, Hour: 3})),
+			binValue("DaylightStart", systemTimeBytes(systemTime{Month: 3, Day: 5, Hour: 2})),
+		))),
+	)
+}
+
+func TestHiveLocation(t *testing.T) {
+	zone, err := HiveLocation(newTestHive(t, zoneTestHive(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if zone.String() != "W. Europe Standard Time" {
+		t.Errorf("unexpected zone name %q", zone)
+	}
+	tests := []struct {
+		utc  time.Time
+		want string
+	}{
+		{time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC), "2024-01-15T13:00:00.0000000+01:00"},
+		{time.Date(2024, 3, 31, 0, 59, 59, 0, time.UTC), "2024-03-31T01:59:59.0000000+01:00"},
+		{time.Date(2024, 3, 31, 1, 0, 0, 0, time.UTC), "2024-03-31T03:00:00.0000000+02:00"},
+		{time.Date(2024, 10, 27, 1, 0, 0, 100, time.UTC), "2024-10-27T02:00:00.0000001+01:00"},
+	}
+	for _, tt := range tests {
+		if got := FormatTimeIn(tt.utc, zone); got != tt.want {
+			t.Errorf("FormatTimeIn(%v) = %s, want %s", tt.utc, got, tt.want)
+		}
+	}
+	if label := ZoneLabel(zone); label != "W. Europe Standard Time (UTC+01:00, daylight UTC+02:00)" {
+		t.Errorf("unexpected label %q", label)
+	}
+}
+
+func TestParseZone(t *testing.T) {
+	for name, want := range map[string]string{
+		"":       "UTC",
+		"UTC":    "UTC",
+		"+02:00": "UTC+02:00",
+		"-0530":  "UTC-05:30",
+		"utc+1":  "UTC+01:00",
+	} {
+		zone, err := ParseZone(name, nil)
+		if err != nil || ZoneLabel(zone) != want {
+			t.Errorf("ParseZone(%q) = %v (%v), want %s", name, zone, err, want)
+		}
+	}
+	if _, err := ParseZone("Mars/Olympus", nil); !errors.Is(err, ErrUnknownZone) {
+		t.Errorf("expected ErrUnknownZone, got %v", err)
+	}
+	if _, err := ParseZone("hive", nil); !errors.Is(err, ErrMissingHive) {
+		t.Errorf("expected ErrMissingHive without a SYSTEM hive, got %v", err)
+	}
+	if got := FormatTime(time.Date(2024, 5, 6, 7, 8, 9, 123456700, time.UTC)); got != "2024-05-06T07:08:09.1234567Z" {
+		t.Errorf("unexpected UTC format %s", got)
+	}
+	if got := filetimeToTime(133594493891234567); got.Nanosecond()%1000 != 700 || got.Location() != time.UTC {
+		t.Errorf("filetimeToTime lost precision or zone: %v", got)
+	}
+}
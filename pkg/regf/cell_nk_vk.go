@@ -43,6 +43,8 @@ type Key struct {
 	valueCount   uint32
 	subkeyList   int64
 	valueList    int64
+	classOffset  int64
+	classLen     uint16
 	hive         *Hive
 }
 
@@ -56,6 +58,31 @@ func (k *Key) Timestamp() time.Time {
 	return k.timestamp
 }
 
+// Class returns the class name of the key, or "" if it has none. Class
+// names are rarely set; the LSA keys holding the boot key use them.
+func (k *Key) Class() string {
+	if k.classLen == 0 || k.classOffset == 0xFFFFFFFF {
+		return ""
+	}
+
+	absOffset := int64(dataOffset) + k.classOffset
+	if absOffset < 0 || absOffset+4 > k.hive.fileSize {
+		return ""
+	}
+	cellSize := int32(binary.LittleEndian.Uint32(k.hive.data[absOffset : absOffset+4]))
+	if cellSize >= 0 {
+		// Not an allocated cell
+		return ""
+	}
+
+	start := absOffset + 4
+	end := start + int64(k.classLen)
+	if end > absOffset+int64(-cellSize) || end > k.hive.fileSize {
+		return ""
+	}
+	return parseNameBytes(k.hive.data[start:end], false)
+}
+
 // Subkeys returns the list of subkeys.
 func (k *Key) Subkeys() []*Key {
 	var subkeys []*Key
@@ -307,6 +334,10 @@ func parseNK(h *Hive, offset int64, payload []byte) *Key {
 	// Value list offset at 0x28
 	key.valueList = int64(readUint32(payload, 0x28))
 
+	// Class name offset at 0x30, its length at 0x4A
+	key.classOffset = int64(readUint32(payload, 0x30))
+	key.classLen = readUint16(payload, 0x4A)
+
 	// Name length at 0x48
 	nameLen := readUint16(payload, 0x48)
 
@@ -413,7 +444,7 @@ func parseNameBytes(data []byte, asciiFlag bool) string {
 	return string(data)
 }
 
-// filetimeToTime converts a Windows FILETIME to time.Time.
+// filetimeToTime converts a Windows FILETIME to a UTC time.Time.
 // FILETIME is 100-nanosecond intervals since January 1, 1601 UTC.
 func filetimeToTime(filetime uint64) time.Time {
 	// Windows epoch: January 1, 1601
@@ -426,5 +457,5 @@ func filetimeToTime(filetime uint64) time.Time {
 	}
 
 	unixNano := int64((filetime - windowsToUnixEpoch) * 100)
-	return time.Unix(0, unixNano)
+	return time.Unix(0, unixNano).UTC()
 }
@@ -4,11 +4,14 @@
 package regf
 
 import (
+	"crypto/sha256"
 	"encoding/binary"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"unicode/utf16"
 )
 
 const (
@@ -23,6 +26,8 @@ const (
 var (
 	ErrInvalidSignature = errors.New("invalid REGF signature")
 	ErrInvalidHive      = errors.New("invalid hive file")
+	// ErrKeyNotFound is returned by GetKey when a path does not exist.
+	ErrKeyNotFound = errors.New("key not found")
 )
 
 // Hive represents an open Windows Registry hive file.
@@ -248,7 +253,7 @@ func (h *Hive) GetKey(path string) (*Key, error) {
 		}
 
 		if !found {
-			return nil, fmt.Errorf("key not found: %s", path)
+			return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, path)
 		}
 	}
 
@@ -278,6 +283,31 @@ func (h *Hive) FileSize() int64 {
 	return h.fileSize
 }
 
+// FileName returns the file name embedded in the base block, which holds
+// the last 31 UTF-16 characters of the path the hive was loaded from
+// (for example "emRoot\System32\Config\SYSTEM").
+func (h *Hive) FileName() string {
+	if len(h.data) < 0x70 {
+		return ""
+	}
+	raw := h.data[0x30:0x70]
+	u16 := make([]uint16, 0, len(raw)/2)
+	for i := 0; i+1 < len(raw); i += 2 {
+		ch := binary.LittleEndian.Uint16(raw[i : i+2])
+		if ch == 0 {
+			break
+		}
+		u16 = append(u16, ch)
+	}
+	return string(utf16.Decode(u16))
+}
+
+// SHA256 returns the hex-encoded SHA-256 digest of the hive contents.
+func (h *Hive) SHA256() string {
+	sum := sha256.Sum256(h.data)
+	return hex.EncodeToString(sum[:])
+}
+
 // Close closes the hive and releases any associated resources.
 func (h *Hive) Close() error {
 	if h.closer != nil {